@@ -50,6 +50,48 @@ otherwise it will create a client token.
 
     corectl create-token [-net] [name]
 
+Step Down
+
+Subcommand 'step-down' asks the core leader to stop generating or
+fetching blocks and give up its leadership, so that another process
+can take over without waiting for the leader's lease to expire.
+It is useful before restarting the leader, e.g. for an upgrade.
+
+    corectl step-down [-t token] [-a addr] [successor]
+
+Flag -t provides a client access token for the core.
+
+Flag -a gives the address of a process of the core to send the
+request to. By default, it is sent to the leader recorded in the
+database. Cores using Raft leader election must use -a.
+
+If a successor address is given, that process is favored to become
+the next leader.
+
+Update Config
+
+Subcommand 'update-config' changes settings of a configured core that
+don't affect consensus. Running cored processes pick up the change
+within a few seconds, without a restart.
+
+    corectl update-config [-u url] [-t token] [-w duration] [-p period] [-e] [-i duration] [-n count] [pubkey url]...
+
+Flags -u and -t set a new generator URL and access token, on a core
+that is not the generator. The generator must be reachable with them.
+
+Flag -w sets a new maximum issuance window, on a generator.
+
+Flags -p, -e, -i, and -n set when a generator or backup generator
+makes blocks: the block period; whether to make empty blocks, with
+-e=true or -e=false; the longest time to go without a block when
+skipping empty ones, or 0 for no limit; and the number of pending
+transactions at which to make a block before the period ends, or 0
+to always wait.
+
+Each pubkey url pair sets a new URL for the block signer with that
+public key, on a generator. Signers can only be added or removed by
+rotating the consensus program.
+
 Reset
 
 Subcommand 'reset' resets the database so the Chain Core can be configured again.
@@ -4,19 +4,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"chain/core/accesstoken"
 	"chain/core/config"
+	"chain/core/leader"
 	"chain/core/migrate"
 	"chain/core/mockhsm"
+	"chain/core/rpc"
 	"chain/crypto/ed25519"
 	"chain/database/sql"
+	chainjson "chain/encoding/json"
 	"chain/env"
 	"chain/log"
 )
@@ -24,6 +29,12 @@ import (
 // config vars
 var (
 	dbURL = env.String("DATABASE_URL", "postgres:///core?sslmode=disable")
+
+	// These match cored's, so that corectl finds the leader the
+	// same way the Core's processes do.
+	listenAddr    = env.String("LISTEN", ":1999")
+	leaderBackend = env.String("LEADER_BACKEND", "postgres") // or "raft"
+	raftPeers     = env.StringSlice("RAFT_PEERS")
 )
 
 // We collect log output in this buffer,
@@ -40,6 +51,8 @@ var commands = map[string]*command{
 	"create-token":         {createToken},
 	"config":               {configNongenerator},
 	"reset":                {reset},
+	"step-down":            {stepDown},
+	"update-config":        {updateConfig},
 }
 
 func main() {
@@ -206,6 +219,133 @@ func configNongenerator(db *sql.DB, args []string) {
 	}
 }
 
+func stepDown(db *sql.DB, args []string) {
+	const usage = "usage: corectl step-down [-t token] [-a addr] [successor]"
+	var flags flag.FlagSet
+	flagT := flags.String("t", "", "client access `token`")
+	flagA := flags.String("a", "", "`address` of a process of the core (default: the leader)")
+	flags.Usage = func() {
+		fmt.Println(usage)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args) > 1 {
+		fatalln(usage)
+	}
+	var successor string
+	if len(args) == 1 {
+		successor = args[0]
+	}
+
+	ctx := context.Background()
+	addrs := []string{*flagA}
+	if *flagA == "" {
+		var err error
+		addrs, err = leaderAddrs(ctx, db)
+		if err != nil {
+			fatalln("error:", err)
+		}
+	}
+	req := map[string]string{"successor": successor}
+	var err error
+	for _, addr := range addrs {
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+		client := &rpc.Client{BaseURL: addr, AccessToken: *flagT}
+		err = client.Call(ctx, "/step-down", req, nil)
+		if err == nil {
+			return
+		}
+	}
+	fatalln("error:", err)
+}
+
+// leaderAddrs returns the addresses of processes to send a request
+// for the leader to, in order of preference, according to the
+// leader election backend selected by LEADER_BACKEND.
+//
+// With the postgres backend, that is the leader itself. A Raft
+// leader is known only to the Core's processes, so with the raft
+// backend it is every process; each forwards the request to the
+// leader it knows of.
+func leaderAddrs(ctx context.Context, db *sql.DB) ([]string, error) {
+	switch *leaderBackend {
+	case "postgres":
+		s, err := leader.NewPostgres(db, "").Status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if s.LeaderAddress == "" || !time.Now().Before(s.LeaseExpiry) {
+			return nil, errors.New("no leader; pending election")
+		}
+		return []string{s.LeaderAddress}, nil
+	case "raft":
+		return append([]string{*listenAddr}, *raftPeers...), nil
+	}
+	return nil, fmt.Errorf("unknown LEADER_BACKEND %q", *leaderBackend)
+}
+
+func updateConfig(db *sql.DB, args []string) {
+	const usage = "usage: corectl update-config [-u url] [-t token] [-w duration] [-p period] [-e] [-i duration] [-n count] [pubkey url]..."
+	var flags flag.FlagSet
+	flagU := flags.String("u", "", "new generator `url`")
+	flagT := flags.String("t", "", "new generator access `token`")
+	flagW := flags.Duration("w", 0, "new maximum issuance window `duration`")
+	flagP := flags.Duration("p", 0, "new block `period`")
+	flagE := flags.Bool("e", false, "make empty blocks")
+	flagI := flags.Duration("i", 0, "new maximum idle interval `duration`")
+	flagN := flags.Int("n", 0, "new pending transaction `count` that cuts a block early")
+	flags.Usage = func() {
+		fmt.Println(usage)
+		flags.PrintDefaults()
+		os.Exit(1)
+	}
+	flags.Parse(args)
+	args = flags.Args()
+	if len(args)%2 != 0 {
+		fatalln(usage)
+	}
+
+	var u config.Update
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "u":
+			u.GeneratorURL = flagU
+		case "t":
+			u.GeneratorAccessToken = flagT
+		case "w":
+			u.MaxIssuanceWindow = &chainjson.Duration{Duration: *flagW}
+		case "p":
+			u.BlockPeriod = &chainjson.Duration{Duration: *flagP}
+		case "e":
+			u.MakeEmptyBlocks = flagE
+		case "i":
+			u.MaxIdleInterval = &chainjson.Duration{Duration: *flagI}
+		case "n":
+			u.MaxPendingTxs = flagN
+		}
+	})
+	for i := 0; i < len(args); i += 2 {
+		pubkey, err := hex.DecodeString(args[i])
+		if err != nil || len(pubkey) < ed25519.PublicKeySize {
+			fatalln(usage)
+		}
+		u.Signers = append(u.Signers, config.BlockSigner{
+			Pubkey: pubkey[:ed25519.PublicKeySize],
+			URL:    args[i+1],
+		})
+	}
+
+	ctx := context.Background()
+	_, err := config.ApplyUpdate(ctx, db, &u)
+	if err != nil {
+		fatalln("error:", err)
+	}
+}
+
 func fatalln(v ...interface{}) {
 	io.Copy(os.Stderr, &logbuf)
 	fmt.Fprintln(os.Stderr, v...)
@@ -13,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/kr/secureheader"
@@ -23,14 +24,20 @@ import (
 	"chain/core/asset"
 	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/consolidate"
+	"chain/core/coordinate"
+	"chain/core/failover"
 	"chain/core/fetch"
 	"chain/core/generator"
 	"chain/core/leader"
 	"chain/core/migrate"
 	"chain/core/mockhsm"
+	"chain/core/payment"
 	"chain/core/pin"
 	"chain/core/query"
 	"chain/core/rpc"
+	"chain/core/schedule"
+	"chain/core/signerfault"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
@@ -66,6 +73,11 @@ var (
 	rpsToken      = env.Int("RATELIMIT_TOKEN", 0)       // reqs/sec
 	rpsRemoteAddr = env.Int("RATELIMIT_REMOTE_ADDR", 0) // reqs/sec
 	indexTxs      = env.Bool("INDEX_TRANSACTIONS", true)
+	leaderBackend = env.String("LEADER_BACKEND", "postgres") // or "raft"
+	raftPeers     = env.StringSlice("RAFT_PEERS")
+	raftToken     = env.String("RAFT_ACCESS_TOKEN", "")
+	raftTimeout   = env.Duration("RAFT_ELECTION_TIMEOUT", 2*time.Second)
+	quorumMargin  = env.Int("SIGNER_QUORUM_MARGIN", 1) // responding signers beyond quorum
 
 	// build vars; initialized by the linker
 	buildTag    = "dev"
@@ -75,8 +87,11 @@ var (
 	race          []interface{} // initialized in race.go
 	httpsRedirect = true        // initialized in insecure.go
 
-	blockPeriod              = 1 * time.Second
 	expireReservationsPeriod = time.Minute
+	consolidationPeriod      = time.Minute
+	paymentBatchPeriod       = 10 * time.Second
+	schedulerPeriod          = 10 * time.Second
+	configWatchPeriod        = 5 * time.Second
 )
 
 func init() {
@@ -184,18 +199,16 @@ func main() {
 }
 
 func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config, processID string) http.Handler {
-	var remoteGenerator *rpc.Client
+	var (
+		genMu           sync.Mutex // protects remoteGenerator and liveConf
+		remoteGenerator *rpc.Client
+		liveConf        = new(config.Config)
+	)
+	*liveConf = *conf // conf itself changes under h.SetConfig
 	if !conf.IsGenerator {
-		remoteGenerator = &rpc.Client{
-			BaseURL:      conf.GeneratorURL,
-			AccessToken:  conf.GeneratorAccessToken,
-			Username:     processID,
-			CoreID:       conf.ID,
-			BuildTag:     buildTag,
-			BlockchainID: conf.BlockchainID.String(),
-		}
+		remoteGenerator = newGeneratorClient(processID, conf)
 	}
-	txbuilder.Generator = remoteGenerator
+	txbuilder.SetGenerator(remoteGenerator)
 
 	heights, err := txdb.ListenBlocks(ctx, *dbURL)
 	if err != nil {
@@ -228,18 +241,26 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		indexer.RegisterAnnotator(accounts.AnnotateTxs)
 		assets.IndexAssets(indexer, pinStore)
 		accounts.IndexAccounts(indexer, pinStore)
+	} else {
+		// Asset supply is tracked even without
+		// transaction indexing, to enforce issuance caps.
+		assets.IndexAssets(nil, pinStore)
 	}
 
 	hsm := mockhsm.New(db)
-	var generatorSigners []generator.BlockSigner
+	var blockSigner *blocksigner.Signer
 	var signBlockHandler func(context.Context, *bc.Block) ([]byte, error)
+	var checkBlockHandler func(context.Context, *bc.Block) error
+	var approveConsensusProgram func(context.Context, uint64, []byte) ([]byte, error)
 	if conf.IsSigner {
 		blockPub, err := hex.DecodeString(conf.BlockPub)
 		if err != nil {
 			chainlog.Fatal(ctx, chainlog.KeyError, err)
 		}
 		s := blocksigner.New(blockPub, hsm, db, c)
-		generatorSigners = append(generatorSigners, s) // "local" signer
+		s.SetFailover(conf.GeneratorCoreID, backupIDs(conf), conf.FailoverTimeout)
+		s.SetPolicies(blocksigner.NewPolicies(conf.BlockPolicies))
+		blockSigner = s // "local" signer
 		signBlockHandler = func(ctx context.Context, b *bc.Block) ([]byte, error) {
 			sig, err := s.ValidateAndSignBlock(ctx, b)
 			if errors.Root(err) == blocksigner.ErrInvalidKey {
@@ -247,18 +268,27 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 			}
 			return sig, err
 		}
+		checkBlockHandler = s.CheckBlock
+		approveConsensusProgram = s.ApproveConsensusProgram
 	}
 
+	dialSigner := func(signer config.BlockSigner) generator.BlockSigner {
+		return newRemoteSigner(ctx, processID, buildTag, conf, signer)
+	}
 	if conf.IsGenerator {
-		for _, signer := range remoteSignerInfo(ctx, processID, buildTag, conf.BlockchainID.String(), conf) {
-			generatorSigners = append(generatorSigners, signer)
-		}
 		c.MaxIssuanceWindow = conf.MaxIssuanceWindow
 	}
 
 	// GC old submitted txs periodically.
 	go core.CleanupSubmittedTxs(ctx, db)
 
+	elector, electionPeriod := leaderElector(ctx, db)
+
+	signerMonitor := &generator.SignerMonitor{QuorumMargin: *quorumMargin}
+	expvar.Publish("generator.block_signers", expvar.Func(func() interface{} {
+		return signerMonitor.Statuses()
+	}))
+
 	h := &core.Handler{
 		Chain:        c,
 		Store:        store,
@@ -267,14 +297,24 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		Accounts:     accounts,
 		HSM:          hsm,
 		TxFeeds:      &txfeed.Tracker{DB: db},
+		Consolidator: &consolidate.Manager{DB: db, Chain: c, Accounts: accounts},
+		Payments:     &payment.Queue{DB: db, Chain: c, Accounts: accounts},
+		Scheduler:    &schedule.Scheduler{DB: db, Chain: c},
+		Coordinator:  &coordinate.Manager{DB: db},
+		Leader:       elector,
 		Indexer:      indexer,
 		AccessTokens: &accesstoken.CredentialStore{DB: db},
 		Config:       conf,
 		DB:           db,
 		Addr:         *listenAddr,
 		Signer:       signBlockHandler,
+		CheckBlock:   checkBlockHandler,
 		AltAuth:      authLoopbackInDev,
+
+		ApproveConsensusProgram: approveConsensusProgram,
+		SignerMonitor:           signerMonitor,
 	}
+	signerMonitor.Health = h.HealthSetter("block_signers")
 	if *rpsToken > 0 {
 		h.RequestLimits = append(h.RequestLimits, core.RequestLimit{
 			Key:       limit.AuthUserID,
@@ -295,22 +335,112 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 		fetchhealth = h.HealthSetter("fetch")
 	)
 
+	// Signer faults found before this process started stay
+	// a health error.
+	h.HealthSetter("signer_faults")(signerfault.Health(ctx, db))
+
 	// Note, it's important for any services that will install blockchain
-	// callbacks to be initialized before leader.Run() and the http server,
+	// callbacks to be initialized before leader.RunElector() and the http server,
 	// otherwise there's a data race within protocol.Chain.
-	go leader.Run(db, *listenAddr, func(ctx context.Context) {
-		go h.Accounts.ExpireReservations(ctx, expireReservationsPeriod)
-		if conf.IsGenerator {
-			go generator.Generate(ctx, c, generatorSigners, db, blockPeriod, genhealth)
-		} else {
-			go fetch.Fetch(ctx, c, remoteGenerator, fetchhealth)
+	go leader.RunElector(elector, electionPeriod, func(ctx context.Context) {
+		// Wait for everything to stop before returning,
+		// so that stepping down hands off cleanly.
+		var wg sync.WaitGroup
+		run := func(f func()) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f()
+			}()
 		}
+		defer wg.Wait()
+
+		run(func() { h.Accounts.ExpireReservations(ctx, expireReservationsPeriod) })
+		run(func() { h.RunConsolidation(ctx, consolidationPeriod) })
+		run(func() { h.RunPaymentBatching(ctx, paymentBatchPeriod) })
+		run(func() { h.RunScheduler(ctx, schedulerPeriod) })
+		genMu.Lock()
+		cur, peer := liveConf, remoteGenerator
+		genMu.Unlock()
+		generate := func(ctx context.Context, heartbeat time.Duration) {
+			var signers []generator.BlockSigner
+			if blockSigner != nil {
+				signers = append(signers, &localSigner{blockSigner, cur.GeneratorRank()})
+			}
+			sched := generator.Schedule{
+				Period:     cur.BlockPeriod,
+				MakeEmpty:  cur.MakeEmptyBlocks,
+				MaxIdle:    cur.MaxIdleInterval,
+				MaxPending: cur.MaxPendingTxs,
+			}
+			if heartbeat > 0 && (sched.MaxIdle == 0 || heartbeat < sched.MaxIdle) {
+				sched.MaxIdle = heartbeat
+			}
+			generator.Generate(ctx, c, signers, dialSigner, signerMonitor, db, sched, genhealth)
+		}
+		fetchBlocks := func(ctx context.Context, peer *rpc.Client) {
+			fetch.Fetch(ctx, c, peer, db, fetchhealth)
+		}
+		switch {
+		case len(cur.BackupGenerators) > 0:
+			run(func() { runFailover(ctx, db, processID, cur, c, generate, fetchBlocks) })
+		case cur.IsGenerator:
+			run(func() { generate(ctx, 0) })
+		default:
+			run(func() { fetchBlocks(ctx, peer) })
+		}
+		// Asset supply is tracked even without transaction
+		// indexing, to enforce issuance caps.
+		run(func() { h.Assets.ProcessBlocks(ctx) })
 		if !*indexTxs {
 			return
 		}
-		go h.Accounts.ProcessBlocks(ctx)
-		go h.Assets.ProcessBlocks(ctx)
-		go h.Indexer.ProcessBlocks(ctx)
+		run(func() { h.Accounts.ProcessBlocks(ctx) })
+		run(func() { h.Indexer.ProcessBlocks(ctx) })
+	})
+
+	// Submit transactions to the generator that the leader
+	// process is following.
+	go followActiveGenerator(ctx, db, processID, func() *config.Config {
+		genMu.Lock()
+		defer genMu.Unlock()
+		return liveConf
+	})
+
+	// Apply configuration updates made by any process of this Core.
+	go config.Watch(ctx, db, configWatchPeriod, func(newConf *config.Config) {
+		h.SetConfig(newConf)
+		if blockSigner != nil {
+			blockSigner.SetFailover(newConf.GeneratorCoreID, backupIDs(newConf), newConf.FailoverTimeout)
+			blockSigner.SetPolicies(blocksigner.NewPolicies(newConf.BlockPolicies))
+		}
+		genMu.Lock()
+		liveConf = newConf
+		genMu.Unlock()
+		if newConf.IsGenerator {
+			c.SetMaxIssuanceWindow(newConf.MaxIssuanceWindow)
+		} else {
+			client := newGeneratorClient(processID, newConf)
+			genMu.Lock()
+			remoteGenerator = client
+			genMu.Unlock()
+		}
+		// With backup generators, followActiveGenerator
+		// picks the generator to submit transactions to.
+		if len(newConf.BackupGenerators) == 0 {
+			genMu.Lock()
+			txbuilder.SetGenerator(remoteGenerator)
+			genMu.Unlock()
+		}
+
+		// Restart the leader's work, to pick up the new
+		// generator or block signers.
+		ctx, cancel := context.WithTimeout(ctx, time.Minute)
+		defer cancel()
+		err := leader.Restart(ctx)
+		if err != nil && errors.Root(err) != leader.ErrNotLeader {
+			chainlog.Error(ctx, err)
+		}
 	})
 
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
@@ -319,6 +449,149 @@ func launchConfiguredCore(ctx context.Context, db *sql.DB, conf *config.Config,
 	})
 }
 
+func newGeneratorClient(processID string, conf *config.Config) *rpc.Client {
+	return &rpc.Client{
+		BaseURL:      conf.GeneratorURL,
+		AccessToken:  conf.GeneratorAccessToken,
+		Username:     processID,
+		CoreID:       conf.ID,
+		BuildTag:     buildTag,
+		BlockchainID: conf.BlockchainID.String(),
+	}
+}
+
+// backupIDs returns the core IDs of conf's backup generators.
+func backupIDs(conf *config.Config) []string {
+	var ids []string
+	for _, g := range conf.BackupGenerators {
+		ids = append(ids, g.CoreID)
+	}
+	return ids
+}
+
+// generatorPeers returns clients for conf's generator and backup
+// generators, indexed by rank.
+func generatorPeers(processID string, conf *config.Config) []*rpc.Client {
+	peers := []*rpc.Client{newGeneratorClient(processID, conf)}
+	for _, g := range conf.BackupGenerators {
+		peers = append(peers, &rpc.Client{
+			BaseURL:      g.URL,
+			AccessToken:  g.AccessToken,
+			Username:     processID,
+			CoreID:       conf.ID,
+			BuildTag:     buildTag,
+			BlockchainID: conf.BlockchainID.String(),
+		})
+	}
+	return peers
+}
+
+// runFailover makes or fetches blocks, following the active one of
+// conf's generator and backup generators, until ctx is canceled.
+// It records the active generator in db for the Core's other
+// processes (see followActiveGenerator).
+func runFailover(
+	ctx context.Context,
+	db *sql.DB,
+	processID string,
+	conf *config.Config,
+	c *protocol.Chain,
+	generate func(ctx context.Context, heartbeat time.Duration),
+	fetchBlocks func(ctx context.Context, peer *rpc.Client),
+) {
+	peers := generatorPeers(processID, conf)
+	setActive := func(ctx context.Context, rank int) {
+		err := failover.SaveActive(ctx, db, rank)
+		if err != nil {
+			chainlog.Error(ctx, err)
+		}
+	}
+	s := &failover.Set{
+		Self:    conf.GeneratorRank(),
+		N:       len(peers),
+		Timeout: conf.FailoverTimeout,
+		Status: func(ctx context.Context, rank int) (failover.Status, error) {
+			ctx, cancel := context.WithTimeout(ctx, conf.FailoverTimeout/4)
+			defer cancel()
+			var st failover.Status
+			err := peers[rank].Call(ctx, "/rpc/generator-status", nil, &st)
+			return st, err
+		},
+		Local: c.Height,
+		Generate: func(ctx context.Context) {
+			setActive(ctx, conf.GeneratorRank())
+			txbuilder.SetGenerator(nil)
+			c.SetMaxIssuanceWindow(conf.MaxIssuanceWindow)
+			generate(ctx, conf.FailoverTimeout/2)
+		},
+		Fetch: func(ctx context.Context, rank int) {
+			setActive(ctx, rank)
+			txbuilder.SetGenerator(peers[rank])
+			fetchBlocks(ctx, peers[rank])
+		},
+	}
+	s.Run(ctx)
+}
+
+// followActiveGenerator submits this process's transactions to the
+// generator that the Core's leader process is following, as recorded
+// by runFailover, until ctx is canceled. Each process of the Core
+// does this, whether or not it is the leader. It does nothing while
+// the Core has no backup generators.
+func followActiveGenerator(ctx context.Context, db *sql.DB, processID string, conf func() *config.Config) {
+	var (
+		prevConf *config.Config
+		prevRank = -1
+	)
+	for {
+		cur := conf()
+		wait := configWatchPeriod
+		if len(cur.BackupGenerators) > 0 {
+			wait = cur.FailoverTimeout / 4
+			rank, ok, err := failover.LoadActive(ctx, db)
+			if err != nil {
+				chainlog.Error(ctx, err)
+			} else if ok && rank <= len(cur.BackupGenerators) && (cur != prevConf || rank != prevRank) {
+				if rank == cur.GeneratorRank() {
+					txbuilder.SetGenerator(nil)
+				} else {
+					txbuilder.SetGenerator(generatorPeers(processID, cur)[rank])
+				}
+				prevConf, prevRank = cur, rank
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// leaderElector returns the leader election backend selected by
+// LEADER_BACKEND, and how often to campaign with it.
+func leaderElector(ctx context.Context, db *sql.DB) (leader.LeaderElector, time.Duration) {
+	switch *leaderBackend {
+	case "postgres":
+		// We use our process's address as the key, because it's unique
+		// among all processes within a Core and it allows a restarted
+		// leader to immediately return to its leadership.
+		chainlog.Messagef(ctx, "Using leaderKey: %q", *listenAddr)
+		return leader.NewPostgres(db, *listenAddr), 5 * time.Second
+	case "raft":
+		r := &leader.Raft{
+			Address:         *listenAddr,
+			Peers:           *raftPeers,
+			Transport:       &leader.HTTPTransport{AccessToken: *raftToken},
+			ElectionTimeout: *raftTimeout,
+		}
+		return r, r.HeartbeatInterval()
+	}
+	chainlog.Fatal(ctx, chainlog.KeyError, errors.New("unknown LEADER_BACKEND"), "backend", *leaderBackend)
+	return nil, 0 // not reached
+}
+
 // remoteSigner defines the address and public key of another Core
 // that may sign blocks produced by this generator.
 type remoteSigner struct {
@@ -326,26 +599,23 @@ type remoteSigner struct {
 	Key    ed25519.PublicKey
 }
 
-func remoteSignerInfo(ctx context.Context, processID, buildTag, blockchainID string, conf *config.Config) (a []*remoteSigner) {
-	for _, signer := range conf.Signers {
-		u, err := url.Parse(signer.URL)
-		if err != nil {
-			chainlog.Fatal(ctx, chainlog.KeyError, err)
-		}
-		if len(signer.Pubkey) != ed25519.PublicKeySize {
-			chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err), "at", "decoding signer public key")
-		}
-		client := &rpc.Client{
-			BaseURL:      u.String(),
-			AccessToken:  signer.AccessToken,
-			Username:     processID,
-			CoreID:       conf.ID,
-			BuildTag:     buildTag,
-			BlockchainID: blockchainID,
-		}
-		a = append(a, &remoteSigner{Client: client, Key: ed25519.PublicKey(signer.Pubkey)})
+func newRemoteSigner(ctx context.Context, processID, buildTag string, conf *config.Config, signer config.BlockSigner) *remoteSigner {
+	u, err := url.Parse(signer.URL)
+	if err != nil {
+		chainlog.Fatal(ctx, chainlog.KeyError, err)
+	}
+	if len(signer.Pubkey) != ed25519.PublicKeySize {
+		chainlog.Fatal(ctx, chainlog.KeyError, errors.Wrap(err), "at", "decoding signer public key")
+	}
+	client := &rpc.Client{
+		BaseURL:      u.String(),
+		AccessToken:  signer.AccessToken,
+		Username:     processID,
+		CoreID:       conf.ID,
+		BuildTag:     buildTag,
+		BlockchainID: conf.BlockchainID.String(),
 	}
-	return a
+	return &remoteSigner{Client: client, Key: ed25519.PublicKey(signer.Pubkey)}
 }
 
 func (s *remoteSigner) SignBlock(ctx context.Context, b *bc.Block) (signature []byte, err error) {
@@ -356,10 +626,34 @@ func (s *remoteSigner) SignBlock(ctx context.Context, b *bc.Block) (signature []
 	return
 }
 
+func (s *remoteSigner) CheckBlock(ctx context.Context, b *bc.Block) error {
+	return s.Client.Call(ctx, "/rpc/signer/check-block", b, nil)
+}
+
 func (s *remoteSigner) String() string {
 	return s.Client.BaseURL
 }
 
+// localSigner signs the blocks made by this Core's generator with
+// its own block signer, which follows the failover rule for the
+// generator's rank just as it does for other generators.
+type localSigner struct {
+	Signer *blocksigner.Signer
+	Rank   int
+}
+
+func (s *localSigner) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	return s.Signer.SignOwnBlock(ctx, s.Rank, b)
+}
+
+func (s *localSigner) CheckBlock(ctx context.Context, b *bc.Block) error {
+	return s.Signer.CheckBlock(ctx, b)
+}
+
+func (s *localSigner) String() string {
+	return s.Signer.String()
+}
+
 func logWriter() io.Writer {
 	dropmsg := []byte("\nlog data dropped\n")
 	rotation := &errlog{w: rotation.Create(logFile, *logSize, *logCount)}
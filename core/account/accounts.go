@@ -13,13 +13,11 @@ import (
 	"chain/core/account/utxodb"
 	"chain/core/pin"
 	"chain/core/signers"
-	"chain/crypto/ed25519/chainkd"
 	"chain/database/pg"
 	"chain/database/sql"
 	"chain/errors"
 	"chain/log"
 	"chain/protocol"
-	"chain/protocol/vmutil"
 )
 
 const maxAccountCache = 100
@@ -76,12 +74,31 @@ func (m *Manager) ExpireReservations(ctx context.Context, period time.Duration)
 
 type Account struct {
 	*signers.Signer
-	Alias string
-	Tags  map[string]interface{}
+	Alias           string
+	Tags            map[string]interface{}
+	ProgramTemplate *ProgramTemplate
+
+	// CoinSelection names the utxodb coin selection strategy used
+	// by spends from the account that don't choose their own.
+	// Accounts are cached, and another process may have changed
+	// it since, so spends read it with coinSelection instead.
+	CoinSelection string
+
+	// SpendingPolicy, if set, restricts spends from the account.
+	// As with CoinSelection, spends read it from the database.
+	SpendingPolicy *SpendingPolicy
 }
 
-// Create creates a new Account.
-func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias string, tags map[string]interface{}, clientToken *string) (*Account, error) {
+// Create creates a new Account. If tmpl is non-nil, every control
+// program created for the account follows it.
+func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias string, tags map[string]interface{}, tmpl *ProgramTemplate, clientToken *string) (*Account, error) {
+	if tmpl != nil {
+		err := tmpl.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	signer, err := signers.Create(ctx, m.db, "account", xpubs, quorum, clientToken)
 	if err != nil {
 		return nil, errors.Wrap(err)
@@ -92,16 +109,24 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 		return nil, err
 	}
 
+	var tmplParam []byte
+	if tmpl != nil {
+		tmplParam, err = json.Marshal(tmpl)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+
 	aliasSQL := stdsql.NullString{
 		String: alias,
 		Valid:  alias != "",
 	}
 
 	const q = `
-		INSERT INTO accounts (account_id, alias, tags) VALUES ($1, $2, $3)
-		ON CONFLICT (account_id) DO UPDATE SET alias = $2, tags = $3
+		INSERT INTO accounts (account_id, alias, tags, program_template) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (account_id) DO UPDATE SET alias = $2, tags = $3, program_template = $4
 	`
-	_, err = m.db.Exec(ctx, q, signer.ID, aliasSQL, tagsParam)
+	_, err = m.db.Exec(ctx, q, signer.ID, aliasSQL, tagsParam, tmplParam)
 	if pg.IsUniqueViolation(err) {
 		return nil, errors.WithDetail(ErrDuplicateAlias, "an account with the provided alias already exists")
 	} else if err != nil {
@@ -109,9 +134,10 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 	}
 
 	account := &Account{
-		Signer: signer,
-		Alias:  alias,
-		Tags:   tags,
+		Signer:          signer,
+		Alias:           alias,
+		Tags:            tags,
+		ProgramTemplate: tmpl,
 	}
 
 	err = m.indexAnnotatedAccount(ctx, account)
@@ -122,6 +148,50 @@ func (m *Manager) Create(ctx context.Context, xpubs []string, quorum int, alias
 	return account, nil
 }
 
+// SetCoinSelection sets the default coin selection strategy for
+// spends from an account. The empty string restores the default.
+func (m *Manager) SetCoinSelection(ctx context.Context, accountID, strategy string) error {
+	_, err := utxodb.SelectorByName(strategy)
+	if err != nil {
+		return err
+	}
+	const q = `UPDATE accounts SET coin_selection = $2 WHERE account_id = $1`
+	res, err := m.db.Exec(ctx, q, accountID, stdsql.NullString{String: strategy, Valid: strategy != ""})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	}
+
+	m.cacheMu.Lock()
+	m.cache.Remove(accountID)
+	m.cacheMu.Unlock()
+
+	account, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(m.indexAnnotatedAccount(ctx, account), "indexing annotated account")
+}
+
+// coinSelection returns the current default coin selection
+// strategy of an account, read from the database rather than
+// the account cache.
+func (m *Manager) coinSelection(ctx context.Context, accountID string) (string, error) {
+	const q = `SELECT coin_selection FROM accounts WHERE account_id=$1`
+	var strategy stdsql.NullString
+	err := m.db.QueryRow(ctx, q, accountID).Scan(&strategy)
+	if err == stdsql.ErrNoRows {
+		return "", errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	}
+	return strategy.String, errors.Wrap(err, "reading coin selection")
+}
+
 // FindByAlias retrieves an account's Signer record by its alias
 func (m *Manager) FindByAlias(ctx context.Context, alias string) (*signers.Signer, error) {
 	const q = `SELECT account_id FROM accounts WHERE alias=$1`
@@ -133,21 +203,57 @@ func (m *Manager) FindByAlias(ctx context.Context, alias string) (*signers.Signe
 	if err != nil {
 		return nil, errors.Wrap(err)
 	}
-	return m.findByID(ctx, accountID)
+	account, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return account.Signer, nil
 }
 
-// findByID returns an account's Signer record by its ID.
-func (m *Manager) findByID(ctx context.Context, id string) (*signers.Signer, error) {
+// findByID returns an account, including its Signer record and
+// program template, by its ID.
+func (m *Manager) findByID(ctx context.Context, id string) (*Account, error) {
 	m.cacheMu.Lock()
 	cached, ok := m.cache.Get(id)
 	m.cacheMu.Unlock()
 	if ok {
-		return cached.(*signers.Signer), nil
+		return cached.(*Account), nil
 	}
-	account, err := signers.Find(ctx, m.db, "account", id)
+	signer, err := signers.Find(ctx, m.db, "account", id)
 	if err != nil {
 		return nil, err
 	}
+
+	var (
+		alias, coinSelection           stdsql.NullString
+		tagsJSON, tmplJSON, policyJSON []byte
+	)
+	const q = `SELECT alias, tags, program_template, coin_selection, spending_policy FROM accounts WHERE account_id=$1`
+	err = m.db.QueryRow(ctx, q, id).Scan(&alias, &tagsJSON, &tmplJSON, &coinSelection, &policyJSON)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	account := &Account{Signer: signer, Alias: alias.String, CoinSelection: coinSelection.String}
+	if len(tagsJSON) > 0 {
+		err = json.Unmarshal(tagsJSON, &account.Tags)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+	if len(tmplJSON) > 0 {
+		account.ProgramTemplate = new(ProgramTemplate)
+		err = json.Unmarshal(tmplJSON, account.ProgramTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+	if len(policyJSON) > 0 {
+		account.SpendingPolicy = new(SpendingPolicy)
+		err = json.Unmarshal(policyJSON, account.SpendingPolicy)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
 	m.cacheMu.Lock()
 	m.cache.Add(id, account)
 	m.cacheMu.Unlock()
@@ -156,6 +262,8 @@ func (m *Manager) findByID(ctx context.Context, id string) (*signers.Signer, err
 
 // CreateControlProgram creates a control program
 // that is tied to the Account and stores it in the database.
+// Storing it is what lets the indexer recognize outputs
+// paying to it as belonging to the account.
 func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, change bool) ([]byte, error) {
 	account, err := m.findByID(ctx, accountID)
 	if err != nil {
@@ -167,10 +275,8 @@ func (m *Manager) CreateControlProgram(ctx context.Context, accountID string, ch
 		return nil, err
 	}
 
-	path := signers.Path(account, signers.AccountKeySpace, idx)
-	derivedXPubs := chainkd.DeriveXPubs(account.XPubs, path)
-	derivedPKs := chainkd.XPubKeys(derivedXPubs)
-	control, err := vmutil.P2SPMultiSigProgram(derivedPKs, account.Quorum)
+	path := signers.Path(account.Signer, signers.AccountKeySpace, idx)
+	control, err := program(account, account.ProgramTemplate, path, time.Now())
 	if err != nil {
 		return nil, err
 	}
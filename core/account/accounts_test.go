@@ -6,10 +6,14 @@ import (
 	"reflect"
 	"testing"
 
+	"chain/crypto/ed25519/chainkd"
 	"chain/database/pg/pgtest"
 	"chain/errors"
+	"chain/protocol/bc"
 	"chain/protocol/prottest"
+	"chain/protocol/state"
 	"chain/protocol/vm"
+	"chain/protocol/vmutil"
 	"chain/testutil"
 )
 
@@ -20,7 +24,7 @@ func TestCreateAccount(t *testing.T) {
 	m := NewManager(db, prottest.NewChain(t))
 	ctx := context.Background()
 
-	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, nil)
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, nil, nil)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -43,11 +47,11 @@ func TestCreateAccountIdempotency(t *testing.T) {
 	ctx := context.Background()
 	var clientToken = "a-unique-client-token"
 
-	account1, err := m.Create(ctx, []string{dummyXPub}, 1, "satoshi", nil, &clientToken)
+	account1, err := m.Create(ctx, []string{dummyXPub}, 1, "satoshi", nil, nil, &clientToken)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
-	account2, err := m.Create(ctx, []string{dummyXPub}, 1, "satoshi", nil, &clientToken)
+	account2, err := m.Create(ctx, []string{dummyXPub}, 1, "satoshi", nil, nil, &clientToken)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -62,7 +66,7 @@ func TestCreateAccountReusedAlias(t *testing.T) {
 	ctx := context.Background()
 	m.createTestAccount(ctx, t, "some-account", nil)
 
-	_, err := m.Create(ctx, []string{dummyXPub}, 1, "some-account", nil, nil)
+	_, err := m.Create(ctx, []string{dummyXPub}, 1, "some-account", nil, nil, nil)
 	if errors.Root(err) != ErrDuplicateAlias {
 		t.Errorf("Expected %s when reusing an alias, got %v", ErrDuplicateAlias, err)
 	}
@@ -74,7 +78,7 @@ func TestCreateControlProgram(t *testing.T) {
 	m := NewManager(db, prottest.NewChain(t))
 	ctx := context.Background()
 
-	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, nil)
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, nil, nil)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -94,8 +98,71 @@ func TestCreateControlProgram(t *testing.T) {
 	}
 }
 
+func TestCreateControlProgramTemplate(t *testing.T) {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	m := NewManager(db, prottest.NewChain(t))
+	ctx := context.Background()
+
+	tmpl := &ProgramTemplate{
+		Type:            "multisig_recovery",
+		RecoveryXPubs:   []chainkd.XPub{testutil.TestXPub},
+		RecoveryQuorum:  1,
+		RecoveryDelayMS: 1000,
+	}
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, "", nil, tmpl, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	found, err := m.findByID(ctx, account.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !reflect.DeepEqual(found.ProgramTemplate, tmpl) {
+		t.Errorf("got template %+v want %+v", found.ProgramTemplate, tmpl)
+	}
+
+	prog, err := m.CreateControlProgram(ctx, account.ID, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	main, recovery, err := vmutil.ParseTwoBranchProgram(prog)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	mainBranch, err := vmutil.ParseBranchProgram(main)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	recoveryBranch, err := vmutil.ParseBranchProgram(recovery)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if mainBranch.NotAfter != 0 || mainBranch.Quorum != 1 {
+		t.Errorf("got main branch %+v, want unbounded 1-of-1", mainBranch)
+	}
+	if recoveryBranch.NotBefore == 0 || recoveryBranch.Quorum != 1 {
+		t.Errorf("got recovery branch %+v, want time-locked 1-of-1", recoveryBranch)
+	}
+
+	// Outputs paying to the program belong to the account.
+	out := &state.Output{TxOutput: *bc.NewTxOutput(bc.AssetID{}, 1, prog, nil)}
+	outs, err := m.loadAccountInfo(ctx, []*state.Output{out})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(outs) != 1 || outs[0].AccountID != account.ID {
+		t.Errorf("got account outputs %+v, want one output for %s", outs, account.ID)
+	}
+
+	_, err = m.Create(ctx, []string{dummyXPub}, 1, "", nil, &ProgramTemplate{Type: "bogus"}, nil)
+	if errors.Root(err) != ErrBadProgramTemplate {
+		t.Errorf("got error %v want ErrBadProgramTemplate", err)
+	}
+}
+
 func (m *Manager) createTestAccount(ctx context.Context, t testing.TB, alias string, tags map[string]interface{}) *Account {
-	account, err := m.Create(ctx, []string{dummyXPub}, 1, alias, tags, nil)
+	account, err := m.Create(ctx, []string{dummyXPub}, 1, alias, tags, nil, nil)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -127,7 +194,7 @@ func TestFindByID(t *testing.T) {
 		testutil.FatalErr(t, err)
 	}
 
-	if !reflect.DeepEqual(account.Signer, found) {
+	if !reflect.DeepEqual(account.Signer, found.Signer) {
 		t.Errorf("expected found account to be %v, instead found %v", account, found)
 	}
 }
@@ -3,6 +3,7 @@ package account
 import (
 	"context"
 	"encoding/json"
+	"expvar"
 	"time"
 
 	"chain/core/account/utxodb"
@@ -36,8 +37,21 @@ type spendAction struct {
 	AccountID     string        `json:"account_id"`
 	ReferenceData chainjson.Map `json:"reference_data"`
 	ClientToken   *string       `json:"client_token"`
+
+	// CoinSelection names the utxodb coin selection strategy to
+	// use, overriding the account's own.
+	CoinSelection string `json:"coin_selection"`
 }
 
+// Spend metrics, keyed by coin selection strategy. Comparing
+// spendChangeOutputs to spends shows how often each strategy
+// leaves change behind.
+var (
+	spends             = expvar.NewMap("account.spends")
+	spendInputs        = expvar.NewMap("account.spend_inputs")
+	spendChangeOutputs = expvar.NewMap("account.spend_change_outputs")
+)
+
 func (a *spendAction) Build(ctx context.Context, maxTime time.Time) (*txbuilder.BuildResult, error) {
 	var missing []string
 	if a.AccountID == "" {
@@ -55,11 +69,24 @@ func (a *spendAction) Build(ctx context.Context, maxTime time.Time) (*txbuilder.
 		return nil, errors.Wrap(err, "get account info")
 	}
 
+	strategy := a.CoinSelection
+	if strategy == "" {
+		strategy, err = a.accounts.coinSelection(ctx, a.AccountID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	selector, err := utxodb.SelectorByName(strategy)
+	if err != nil {
+		return nil, err
+	}
+
 	src := utxodb.Source{
 		AssetID:     a.AssetID,
 		Amount:      a.Amount,
 		AccountID:   a.AccountID,
 		ClientToken: a.ClientToken,
+		Selector:    selector,
 	}
 	rid, reserved, change, err := a.accounts.utxoDB.Reserve(ctx, src, maxTime)
 	if err != nil {
@@ -89,12 +116,20 @@ func (a *spendAction) Build(ctx context.Context, maxTime time.Time) (*txbuilder.
 		changeOuts = append(changeOuts, bc.NewTxOutput(a.AssetID, change[0].Amount, acp, nil))
 	}
 
+	if strategy == "" {
+		strategy = "default"
+	}
+	spends.Add(strategy, 1)
+	spendInputs.Add(strategy, int64(len(txins)))
+	spendChangeOutputs.Add(strategy, int64(len(changeOuts)))
+
 	br := &txbuilder.BuildResult{
 		Inputs:              txins,
 		Outputs:             changeOuts,
 		SigningInstructions: tplInsts,
 		Rollback:            canceler(ctx, a.accounts, rid),
 	}
+	a.accounts.addPolicyCheck(ctx, acct.ID, br)
 	return br, nil
 }
 
@@ -137,11 +172,13 @@ func (a *spendUTXOAction) Build(ctx context.Context, maxTime time.Time) (*txbuil
 		return nil, err
 	}
 
-	return &txbuilder.BuildResult{
+	br := &txbuilder.BuildResult{
 		Inputs:              []*bc.TxInput{txInput},
 		SigningInstructions: []*txbuilder.SigningInstruction{sigInst},
 		Rollback:            canceler(ctx, a.accounts, rid),
-	}, nil
+	}
+	a.accounts.addPolicyCheck(ctx, acct.ID, br)
+	return br, nil
 }
 
 // Best-effort cancellation attempt to put in txbuilder.BuildResult.Rollback.
@@ -154,7 +191,7 @@ func canceler(ctx context.Context, m *Manager, rid int32) func() {
 	}
 }
 
-func utxoToInputs(ctx context.Context, account *signers.Signer, u *utxodb.UTXO, refData []byte) (
+func utxoToInputs(ctx context.Context, account *Account, u *utxodb.UTXO, refData []byte) (
 	*bc.TxInput,
 	*txbuilder.SigningInstruction,
 	error,
@@ -165,10 +202,11 @@ func utxoToInputs(ctx context.Context, account *signers.Signer, u *utxodb.UTXO,
 		AssetAmount: u.AssetAmount,
 	}
 
-	path := signers.Path(account, signers.AccountKeySpace, u.ControlProgramIndex)
+	path := signers.Path(account.Signer, signers.AccountKeySpace, u.ControlProgramIndex)
 	keyIDs := txbuilder.KeyIDs(account.XPubs, path)
 
 	sigInst.AddWitnessKeys(keyIDs, account.Quorum)
+	addWitnessSelector(sigInst, account.ProgramTemplate)
 
 	return txInput, sigInst, nil
 }
@@ -50,13 +50,23 @@ func (m *Manager) indexAnnotatedAccount(ctx context.Context, a *Account) error {
 			"account_derivation_path": jsonPath,
 		})
 	}
-	return m.indexer.SaveAnnotatedAccount(ctx, a.ID, map[string]interface{}{
+	annotated := map[string]interface{}{
 		"id":     a.ID,
 		"alias":  a.Alias,
 		"keys":   keys,
 		"tags":   a.Tags,
 		"quorum": a.Quorum,
-	})
+	}
+	if a.ProgramTemplate != nil {
+		annotated["program_template"] = a.ProgramTemplate
+	}
+	if a.CoinSelection != "" {
+		annotated["coin_selection"] = a.CoinSelection
+	}
+	if a.SpendingPolicy != nil {
+		annotated["spending_policy"] = a.SpendingPolicy
+	}
+	return m.indexer.SaveAnnotatedAccount(ctx, a.ID, annotated)
 }
 
 type output struct {
@@ -0,0 +1,492 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	stdsql "database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+var (
+	ErrBadSpendingPolicy = errors.New("invalid spending policy")
+	ErrPolicyViolation   = errors.New("spend violates account spending policy")
+)
+
+// velocityWindow is the trailing period over which a spending
+// limit's MaxPerDay applies.
+const velocityWindow = 24 * time.Hour
+
+// Spending decisions recorded in the audit log.
+const (
+	DecisionAllowed    = "allowed"
+	DecisionDenied     = "denied"
+	DecisionRolledBack = "rolled_back"
+)
+
+// A SpendingPolicy restricts spends from an account.
+//
+// Spends are checked when their transactions are built, against
+// the total amount of each asset the whole transaction takes from
+// the account. A limit on daily spending counts every spend the
+// policy allowed in the trailing 24 hours, including spends whose
+// transactions were never submitted, so it errs toward denying.
+type SpendingPolicy struct {
+	Limits []SpendingLimit `json:"limits,omitempty"`
+
+	// If either AllowedAccountIDs or AllowedControlPrograms is
+	// nonempty, every output of a transaction spending from the
+	// account must pay the account itself, one of the allowed
+	// accounts, or one of the allowed control programs.
+	AllowedAccountIDs      []string             `json:"allowed_account_ids,omitempty"`
+	AllowedControlPrograms []chainjson.HexBytes `json:"allowed_control_programs,omitempty"`
+}
+
+// A SpendingLimit limits spends of one asset. Zero values mean no
+// limit.
+type SpendingLimit struct {
+	AssetID           bc.AssetID `json:"asset_id"`
+	MaxPerTransaction uint64     `json:"max_per_transaction"`
+	MaxPerDay         uint64     `json:"max_per_day"`
+}
+
+// A SpendingDecision is an audit record of one policy check.
+type SpendingDecision struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+	Amount    uint64     `json:"amount"`
+	Decision  string     `json:"decision"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Validate checks that p is well formed.
+func (p *SpendingPolicy) Validate() error {
+	seen := make(map[bc.AssetID]bool)
+	for i, l := range p.Limits {
+		if l.AssetID == (bc.AssetID{}) {
+			return errors.WithDetailf(ErrBadSpendingPolicy, "limit %d has no asset_id", i)
+		}
+		if seen[l.AssetID] {
+			return errors.WithDetailf(ErrBadSpendingPolicy, "more than one limit for asset %s", l.AssetID)
+		}
+		seen[l.AssetID] = true
+		if l.MaxPerTransaction == 0 && l.MaxPerDay == 0 {
+			return errors.WithDetailf(ErrBadSpendingPolicy, "limit %d sets no maximum", i)
+		}
+	}
+	for i, prog := range p.AllowedControlPrograms {
+		if len(prog) == 0 {
+			return errors.WithDetailf(ErrBadSpendingPolicy, "allowed control program %d is empty", i)
+		}
+	}
+	return nil
+}
+
+func (p *SpendingPolicy) limit(assetID bc.AssetID) (SpendingLimit, bool) {
+	for _, l := range p.Limits {
+		if l.AssetID == assetID {
+			return l, true
+		}
+	}
+	return SpendingLimit{}, false
+}
+
+func (p *SpendingPolicy) restrictsDestinations() bool {
+	return len(p.AllowedAccountIDs) > 0 || len(p.AllowedControlPrograms) > 0
+}
+
+// SetSpendingPolicy sets the spending policy of an account. A nil
+// policy removes any restrictions.
+func (m *Manager) SetSpendingPolicy(ctx context.Context, accountID string, p *SpendingPolicy) error {
+	var policyJSON []byte
+	if p != nil {
+		err := p.Validate()
+		if err != nil {
+			return err
+		}
+		policyJSON, err = json.Marshal(p)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	// Take the lock policy checks hold, so a check in progress
+	// finishes under the old policy and later ones see the new.
+	dbtx, err := m.db.Begin(ctx)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction for spending policy")
+	}
+	defer dbtx.Rollback(ctx)
+	err = lockSpending(ctx, dbtx, accountID)
+	if err != nil {
+		return err
+	}
+	const q = `UPDATE accounts SET spending_policy = $2 WHERE account_id = $1`
+	res, err := dbtx.Exec(ctx, q, accountID, policyJSON)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	}
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "commit spending policy")
+	}
+
+	m.cacheMu.Lock()
+	m.cache.Remove(accountID)
+	m.cacheMu.Unlock()
+
+	account, err := m.findByID(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(m.indexAnnotatedAccount(ctx, account), "indexing annotated account")
+}
+
+// SpendingDecisions returns up to limit audit records of policy
+// checks on spends from an account, most recent first, starting
+// after the record with ID after if it is nonempty.
+func (m *Manager) SpendingDecisions(ctx context.Context, accountID, after string, limit int) ([]*SpendingDecision, error) {
+	const q = `
+		SELECT id, account_id, asset_id, amount, decision, reason, created_at
+		FROM account_spending_decisions
+		WHERE account_id=$1 AND ($2='' OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	var ds []*SpendingDecision
+	err := pg.ForQueryRows(ctx, m.db, q, accountID, after, limit, func(id, accountID string, assetID bc.AssetID, amount uint64, decision, reason string, createdAt time.Time) {
+		ds = append(ds, &SpendingDecision{
+			ID:        id,
+			AccountID: accountID,
+			AssetID:   assetID,
+			Amount:    amount,
+			Decision:  decision,
+			Reason:    reason,
+			CreatedAt: createdAt,
+		})
+	})
+	return ds, errors.Wrap(err, "querying spending decisions")
+}
+
+// addPolicyCheck arranges for the transaction built from br to be
+// checked against the account's policy once the whole transaction
+// is known. Limits apply to the total amount of each asset the
+// transaction takes from the account, however many actions spend
+// from it. If the build fails after the check, its decisions are
+// rolled back along with br.
+func (m *Manager) addPolicyCheck(ctx context.Context, accountID string, br *txbuilder.BuildResult) {
+	own := make(map[bc.Outpoint]bool, len(br.Inputs))
+	for _, in := range br.Inputs {
+		own[in.Outpoint()] = true
+	}
+	var decisionIDs []string
+	br.Check = func(ctx context.Context, tx *bc.TxData) error {
+		var err error
+		decisionIDs, err = m.checkSpendTx(ctx, accountID, own, tx)
+		return err
+	}
+	rollback := br.Rollback
+	br.Rollback = func() {
+		rollback()
+		for _, id := range decisionIDs {
+			err := m.rollBackDecision(ctx, id)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+// checkSpendTx is called with the complete transaction tx
+// containing the spend from the account whose inputs are own. It
+// checks tx against the account's policy and records the
+// decisions, returning the IDs of those allowed.
+//
+// Every spend action from the account in tx makes this check, but
+// only the one holding the account's first input in tx decides;
+// the others return nil.
+//
+// The policy is read, the daily totals summed, and the allowed
+// decisions recorded in one transaction holding the account's
+// spending lock, so neither concurrent builds nor a policy change
+// in another process can slip a spend past the policy.
+func (m *Manager) checkSpendTx(ctx context.Context, accountID string, own map[bc.Outpoint]bool, tx *bc.TxData) ([]string, error) {
+	dbtx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction for spending policy")
+	}
+	defer dbtx.Rollback(ctx)
+	err = lockSpending(ctx, dbtx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := spendingPolicy(ctx, dbtx, accountID)
+	if err != nil || policy == nil {
+		return nil, err
+	}
+
+	spent, first, err := m.spentFrom(ctx, accountID, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(spent) == 0 || !own[first] {
+		return nil, nil
+	}
+
+	var assetIDs []bc.AssetID
+	for assetID := range spent {
+		assetIDs = append(assetIDs, assetID)
+	}
+	sort.Sort(byAssetID(assetIDs))
+
+	if policy.restrictsDestinations() {
+		n, err := m.disallowedOutputs(ctx, accountID, policy, tx)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			amt := bc.AssetAmount{AssetID: assetIDs[0], Amount: spent[assetIDs[0]]}
+			return nil, m.deny(ctx, accountID, amt, fmt.Sprintf("%d output(s) pay destinations not allowed by the policy", n))
+		}
+	}
+
+	var ids []string
+	for _, assetID := range assetIDs {
+		id, err := m.checkSpendLimits(ctx, dbtx, accountID, policy, bc.AssetAmount{AssetID: assetID, Amount: spent[assetID]})
+		if err != nil {
+			// Rolling back dbtx discards the decisions already allowed.
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "commit spending decisions")
+	}
+	return ids, nil
+}
+
+// lockSpending takes the lock that serializes policy checks and
+// policy changes for an account, held until dbtx ends.
+func lockSpending(ctx context.Context, dbtx *sql.Tx, accountID string) error {
+	const q = `SELECT pg_advisory_xact_lock(hashtext('account_spending'), hashtext($1))`
+	_, err := dbtx.Exec(ctx, q, accountID)
+	return errors.Wrap(err, "locking account spending")
+}
+
+// spendingPolicy reads the current spending policy of an account
+// from db. It returns nil if the account has none.
+func spendingPolicy(ctx context.Context, db pg.DB, accountID string) (*SpendingPolicy, error) {
+	const q = `SELECT spending_policy FROM accounts WHERE account_id=$1`
+	var policyJSON []byte
+	err := db.QueryRow(ctx, q, accountID).Scan(&policyJSON)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "account id: %s", accountID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading spending policy")
+	}
+	if len(policyJSON) == 0 {
+		return nil, nil
+	}
+	p := new(SpendingPolicy)
+	err = json.Unmarshal(policyJSON, p)
+	return p, errors.Wrap(err, "decoding spending policy")
+}
+
+// spentFrom returns the amount of each asset tx takes from an
+// account: the amounts of its inputs spending the account's
+// outputs, less the amounts of its outputs paying the account,
+// such as change. It also returns the outpoint of tx's first input
+// spending from the account.
+func (m *Manager) spentFrom(ctx context.Context, accountID string, tx *bc.TxData) (map[bc.AssetID]uint64, bc.Outpoint, error) {
+	var (
+		hashes  pq.StringArray
+		indexes pq.Int64Array
+		progs   pq.ByteaArray
+	)
+	for _, in := range tx.Inputs {
+		if in.IsIssuance() {
+			continue
+		}
+		o := in.Outpoint()
+		hashes = append(hashes, o.Hash.String())
+		indexes = append(indexes, int64(o.Index))
+	}
+	for _, out := range tx.Outputs {
+		progs = append(progs, out.ControlProgram)
+	}
+
+	const inputsQ = `
+		SELECT tx_hash, index, asset_id, amount FROM account_utxos
+		WHERE account_id=$1 AND (tx_hash, index) IN (SELECT unnest($2::text[]), unnest($3::integer[]))
+	`
+	var (
+		ins     = make(map[bc.Outpoint]bc.AssetAmount)
+		inTotal = make(map[bc.AssetID]uint64)
+	)
+	err := pg.ForQueryRows(ctx, m.db, inputsQ, accountID, hashes, indexes, func(hash bc.Hash, index uint32, assetID bc.AssetID, amount uint64) {
+		ins[bc.Outpoint{Hash: hash, Index: index}] = bc.AssetAmount{AssetID: assetID, Amount: amount}
+		inTotal[assetID] += amount
+	})
+	if err != nil {
+		return nil, bc.Outpoint{}, errors.Wrap(err, "finding spent account outputs")
+	}
+	if len(ins) == 0 {
+		return nil, bc.Outpoint{}, nil
+	}
+	var first bc.Outpoint
+	for _, in := range tx.Inputs {
+		if _, ok := ins[in.Outpoint()]; ok && !in.IsIssuance() {
+			first = in.Outpoint()
+			break
+		}
+	}
+
+	const ownProgsQ = `
+		SELECT control_program FROM account_control_programs
+		WHERE signer_id=$1 AND control_program=ANY($2::bytea[])
+	`
+	own := make(map[string]bool)
+	err = pg.ForQueryRows(ctx, m.db, ownProgsQ, accountID, progs, func(prog []byte) {
+		own[string(prog)] = true
+	})
+	if err != nil {
+		return nil, bc.Outpoint{}, errors.Wrap(err, "finding account outputs")
+	}
+	outTotal := make(map[bc.AssetID]uint64)
+	for _, out := range tx.Outputs {
+		if own[string(out.ControlProgram)] {
+			outTotal[out.AssetID] += out.Amount
+		}
+	}
+
+	spent := make(map[bc.AssetID]uint64, len(inTotal))
+	for assetID, in := range inTotal {
+		if in > outTotal[assetID] {
+			spent[assetID] = in - outTotal[assetID]
+		}
+	}
+	return spent, first, nil
+}
+
+// checkSpendLimits checks the total amt a transaction takes from
+// an account against policy's spending limits, and records the
+// decision. It returns the ID of an allowed decision, recorded in
+// dbtx, or the policy error for a denied one.
+//
+// The caller holds the account's spending lock in dbtx, so
+// concurrent builds can't each spend up to the daily limit.
+func (m *Manager) checkSpendLimits(ctx context.Context, dbtx *sql.Tx, accountID string, policy *SpendingPolicy, amt bc.AssetAmount) (string, error) {
+	l, ok := policy.limit(amt.AssetID)
+	if !ok || amt.Amount == 0 {
+		return m.record(ctx, dbtx, accountID, amt, DecisionAllowed, "")
+	}
+	if l.MaxPerTransaction > 0 && amt.Amount > l.MaxPerTransaction {
+		return "", m.deny(ctx, accountID, amt, fmt.Sprintf("amount exceeds the per-transaction limit of %d", l.MaxPerTransaction))
+	}
+	if l.MaxPerDay == 0 {
+		return m.record(ctx, dbtx, accountID, amt, DecisionAllowed, "")
+	}
+
+	const sumQ = `
+		SELECT COALESCE(SUM(amount), 0) FROM account_spending_decisions
+		WHERE account_id=$1 AND asset_id=$2 AND decision='allowed' AND created_at > $3
+	`
+	var spent uint64
+	err := dbtx.QueryRow(ctx, sumQ, accountID, amt.AssetID, time.Now().Add(-velocityWindow)).Scan(&spent)
+	if err != nil {
+		return "", errors.Wrap(err, "summing recent spends")
+	}
+	if spent+amt.Amount > l.MaxPerDay || spent+amt.Amount < spent {
+		return "", m.deny(ctx, accountID, amt, fmt.Sprintf("amount exceeds the daily limit of %d; %d already spent", l.MaxPerDay, spent))
+	}
+	return m.record(ctx, dbtx, accountID, amt, DecisionAllowed, "")
+}
+
+// disallowedOutputs returns the number of outputs of tx that pay
+// neither the account, nor an account or control program policy
+// allows.
+func (m *Manager) disallowedOutputs(ctx context.Context, accountID string, policy *SpendingPolicy, tx *bc.TxData) (int, error) {
+	var unknown [][]byte
+outputs:
+	for _, out := range tx.Outputs {
+		for _, prog := range policy.AllowedControlPrograms {
+			if bytes.Equal(out.ControlProgram, prog) {
+				continue outputs
+			}
+		}
+		unknown = append(unknown, out.ControlProgram)
+	}
+	if len(unknown) == 0 {
+		return 0, nil
+	}
+
+	allowed := append([]string{accountID}, policy.AllowedAccountIDs...)
+	const q = `
+		SELECT COUNT(*) FROM unnest($1::bytea[]) AS p(control_program)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM account_control_programs acp
+			WHERE acp.control_program=p.control_program AND acp.signer_id=ANY($2)
+		)
+	`
+	var n int
+	err := m.db.QueryRow(ctx, q, pq.ByteaArray(unknown), pq.StringArray(allowed)).Scan(&n)
+	return n, errors.Wrap(err, "checking destinations")
+}
+
+// record adds a decision to the audit log and returns its ID.
+func (m *Manager) record(ctx context.Context, db pg.DB, accountID string, amt bc.AssetAmount, decision, reason string) (string, error) {
+	const q = `
+		INSERT INTO account_spending_decisions (account_id, asset_id, amount, decision, reason)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`
+	var id string
+	err := db.QueryRow(ctx, q, accountID, amt.AssetID, amt.Amount, decision, reason).Scan(&id)
+	return id, errors.Wrap(err, "recording spending decision")
+}
+
+// deny records a denied spend and returns the policy error.
+func (m *Manager) deny(ctx context.Context, accountID string, amt bc.AssetAmount, reason string) error {
+	_, err := m.record(ctx, m.db, accountID, amt, DecisionDenied, reason)
+	if err != nil {
+		return err
+	}
+	return errors.WithDetail(ErrPolicyViolation, reason)
+}
+
+// rollBackDecision marks an allowed decision as rolled back, so
+// that it no longer counts toward daily limits.
+func (m *Manager) rollBackDecision(ctx context.Context, id string) error {
+	const q = `UPDATE account_spending_decisions SET decision='rolled_back' WHERE id=$1`
+	_, err := m.db.Exec(ctx, q, id)
+	return errors.Wrap(err, "rolling back spending decision")
+}
+
+type byAssetID []bc.AssetID
+
+func (a byAssetID) Len() int           { return len(a) }
+func (a byAssetID) Less(i, j int) bool { return a[i].String() < a[j].String() }
+func (a byAssetID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
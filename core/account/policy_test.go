@@ -0,0 +1,248 @@
+package account_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestSpendingPolicyValidate(t *testing.T) {
+	cases := []struct {
+		policy account.SpendingPolicy
+		ok     bool
+	}{
+		{account.SpendingPolicy{}, true},
+		{account.SpendingPolicy{Limits: []account.SpendingLimit{{AssetID: bc.AssetID{1}, MaxPerDay: 10}}}, true},
+		{account.SpendingPolicy{Limits: []account.SpendingLimit{{MaxPerDay: 10}}}, false},
+		{account.SpendingPolicy{Limits: []account.SpendingLimit{{AssetID: bc.AssetID{1}}}}, false},
+		{account.SpendingPolicy{Limits: []account.SpendingLimit{
+			{AssetID: bc.AssetID{1}, MaxPerDay: 10},
+			{AssetID: bc.AssetID{1}, MaxPerTransaction: 5},
+		}}, false},
+		{account.SpendingPolicy{AllowedControlPrograms: []json.HexBytes{{}}}, false},
+	}
+	for i, c := range cases {
+		err := c.policy.Validate()
+		if c.ok && err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+		}
+		if !c.ok && errors.Root(err) != account.ErrBadSpendingPolicy {
+			t.Errorf("case %d: got error %v want %v", i, err, account.ErrBadSpendingPolicy)
+		}
+	}
+}
+
+func TestSpendingPolicy(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		dst     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		other   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	// Each allowed spend holds its reservation, so issue enough
+	// separate outputs for all of them.
+	for i := 0; i < 3; i++ {
+		coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 20, src)
+	}
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	err := accounts.SetSpendingPolicy(ctx, src, &account.SpendingPolicy{
+		Limits:            []account.SpendingLimit{{AssetID: assetID, MaxPerTransaction: 10, MaxPerDay: 15}},
+		AllowedAccountIDs: []string{dst},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	build := func(amount uint64, to string) error {
+		amt := bc.AssetAmount{AssetID: assetID, Amount: amount}
+		_, err := txbuilder.Build(ctx, nil, []txbuilder.Action{
+			accounts.NewSpendAction(amt, src, nil, nil),
+			accounts.NewControlAction(amt, to, nil),
+		}, time.Now().Add(time.Minute))
+		return err
+	}
+
+	cases := []struct {
+		amount uint64
+		to     string
+		ok     bool
+	}{
+		{11, dst, false},  // over the per-transaction limit
+		{5, other, false}, // destination not allowed
+		{10, dst, true},
+		{6, dst, false}, // over the daily limit
+		{5, dst, true},
+	}
+	for i, c := range cases {
+		err := build(c.amount, c.to)
+		if c.ok && err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+		}
+		if !c.ok && !isPolicyViolation(err) {
+			t.Errorf("case %d: got error %v want %v", i, err, account.ErrPolicyViolation)
+		}
+	}
+
+	decisions, err := accounts.SpendingDecisions(ctx, src, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	var got []string
+	for i := len(decisions) - 1; i >= 0; i-- {
+		got = append(got, decisions[i].Decision)
+	}
+	want := []string{"denied", "denied", "allowed", "denied", "allowed"}
+	if len(got) != len(want) {
+		t.Fatalf("got decisions %v want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got decisions %v want %v", got, want)
+			break
+		}
+	}
+}
+
+func TestSpendingPolicyWholeTx(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		dst     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	for i := 0; i < 2; i++ {
+		coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 20, src)
+	}
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	err := accounts.SetSpendingPolicy(ctx, src, &account.SpendingPolicy{
+		Limits: []account.SpendingLimit{{AssetID: assetID, MaxPerTransaction: 10}},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// Each spend is within the limit, but together they are not.
+	amt := bc.AssetAmount{AssetID: assetID, Amount: 6}
+	_, err = txbuilder.Build(ctx, nil, []txbuilder.Action{
+		accounts.NewSpendAction(amt, src, nil, nil),
+		accounts.NewSpendAction(amt, src, nil, nil),
+		accounts.NewControlAction(bc.AssetAmount{AssetID: assetID, Amount: 12}, dst, nil),
+	}, time.Now().Add(time.Minute))
+	if !isPolicyViolation(err) {
+		t.Errorf("got error %v want %v", err, account.ErrPolicyViolation)
+	}
+
+	decisions, err := accounts.SpendingDecisions(ctx, src, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(decisions) != 1 || decisions[0].Decision != account.DecisionDenied || decisions[0].Amount != 12 {
+		t.Errorf("got decisions %+v want one denial of 12", decisions)
+	}
+}
+
+func TestSpendingPolicyOtherProcess(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		other    = account.NewManager(db, c) // another process
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		dst     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 20, src)
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	other.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	// Spending caches src in accounts before the other process
+	// sets its policy.
+	amt := bc.AssetAmount{AssetID: assetID, Amount: 5}
+	_, err := txbuilder.Build(ctx, nil, []txbuilder.Action{
+		accounts.NewSpendAction(amt, src, nil, nil),
+		accounts.NewControlAction(amt, dst, nil),
+	}, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	err = other.SetSpendingPolicy(ctx, src, &account.SpendingPolicy{
+		Limits: []account.SpendingLimit{{AssetID: assetID, MaxPerTransaction: 1}},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	_, err = txbuilder.Build(ctx, nil, []txbuilder.Action{
+		accounts.NewSpendAction(amt, src, nil, nil),
+		accounts.NewControlAction(amt, dst, nil),
+	}, time.Now().Add(time.Minute))
+	if !isPolicyViolation(err) {
+		t.Errorf("got error %v want %v", err, account.ErrPolicyViolation)
+	}
+}
+
+func isPolicyViolation(err error) bool {
+	if errors.Root(err) == account.ErrPolicyViolation {
+		return true
+	}
+	if errors.Root(err) != txbuilder.ErrAction {
+		return false
+	}
+	for _, e := range errors.Data(err)["actions"].([]error) {
+		if errors.Root(e) == account.ErrPolicyViolation {
+			return true
+		}
+	}
+	return false
+}
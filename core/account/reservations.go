@@ -0,0 +1,34 @@
+package account
+
+import (
+	"context"
+
+	"chain/core/account/utxodb"
+	"chain/database/pg"
+	"chain/errors"
+)
+
+// Reservations returns up to limit reservations of account UTXOs
+// matching f, in order of ID, starting after the reservation with ID
+// after.
+func (m *Manager) Reservations(ctx context.Context, f utxodb.ReservationFilter, after int32, limit int) ([]*utxodb.Reservation, error) {
+	return m.utxoDB.Reservations(ctx, f, after, limit)
+}
+
+// CancelReservation cancels a reservation before it expires,
+// releasing its UTXOs for other spends. It returns the canceled
+// reservation.
+//
+// A transaction already built from the reservation remains valid,
+// but its inputs may be reserved again by another transaction
+// before it is submitted.
+func (m *Manager) CancelReservation(ctx context.Context, id int32) (*utxodb.Reservation, error) {
+	rs, err := m.utxoDB.Reservations(ctx, utxodb.ReservationFilter{ID: id}, 0, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "reservation id: %d", id)
+	}
+	return rs[0], m.utxoDB.Cancel(ctx, id)
+}
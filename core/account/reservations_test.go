@@ -0,0 +1,78 @@
+package account_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/account/utxodb"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/database/pg/pgtest"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestCancelReservation(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+		out     = coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 2, accID)
+	)
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	amt := bc.AssetAmount{AssetID: assetID, Amount: 1}
+	_, err := accounts.NewSpendAction(amt, accID, nil, nil).Build(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	f := utxodb.ReservationFilter{AccountID: accID}
+	rs, err := accounts.Reservations(ctx, f, 0, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(rs) != 1 {
+		t.Fatalf("got %d reservations want 1", len(rs))
+	}
+	wantOutputs := []bc.Outpoint{out.Outpoint}
+	if !reflect.DeepEqual(rs[0].Outputs, wantOutputs) || rs[0].Change != 1 {
+		t.Errorf("got reservation %+v want outputs %v and change 1", rs[0], wantOutputs)
+	}
+
+	_, err = accounts.CancelReservation(ctx, rs[0].ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	rs, err = accounts.Reservations(ctx, f, 0, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(rs) != 0 {
+		t.Errorf("got %d reservations after cancel want 0", len(rs))
+	}
+
+	// The UTXO can be reserved again right away.
+	_, err = accounts.NewSpendAction(bc.AssetAmount{AssetID: assetID, Amount: 2}, accID, nil, nil).Build(ctx, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+}
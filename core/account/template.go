@@ -0,0 +1,79 @@
+package account
+
+import (
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+var ErrBadProgramTemplate = errors.New("invalid control program template")
+
+// A ProgramTemplate describes the shape of every control program
+// derived for an account. Accounts without a template get a plain
+// P2SP multisig over the account keys.
+//
+// The only template type is "multisig_recovery": the account keys
+// can spend at any time, and RecoveryQuorum of RecoveryXPubs can
+// spend once RecoveryDelayMS has elapsed since the control program
+// was created. Recovery keys are derived along the same path as the
+// account keys.
+type ProgramTemplate struct {
+	Type            string         `json:"type"`
+	RecoveryXPubs   []chainkd.XPub `json:"recovery_xpubs"`
+	RecoveryQuorum  int            `json:"recovery_quorum"`
+	RecoveryDelayMS uint64         `json:"recovery_delay_ms"`
+}
+
+func (t *ProgramTemplate) validate() error {
+	if t.Type != "multisig_recovery" {
+		return errors.WithDetailf(ErrBadProgramTemplate, "unknown template type %q", t.Type)
+	}
+	if len(t.RecoveryXPubs) == 0 {
+		return errors.WithDetail(ErrBadProgramTemplate, "at least one recovery xpub is required")
+	}
+	if t.RecoveryQuorum <= 0 || t.RecoveryQuorum > len(t.RecoveryXPubs) {
+		return errors.WithDetail(ErrBadProgramTemplate, "bad recovery quorum")
+	}
+	if t.RecoveryDelayMS == 0 {
+		return errors.WithDetail(ErrBadProgramTemplate, "recovery delay must be positive")
+	}
+	return nil
+}
+
+// program returns the control program for the account keys
+// derived along path, following tmpl if it is non-nil.
+func program(account *Account, tmpl *ProgramTemplate, path [][]byte, now time.Time) ([]byte, error) {
+	derivedPKs := chainkd.XPubKeys(chainkd.DeriveXPubs(account.XPubs, path))
+	if tmpl == nil {
+		return vmutil.P2SPMultiSigProgram(derivedPKs, account.Quorum)
+	}
+
+	main, err := vmutil.BranchProgram(vmutil.Branch{Pubkeys: derivedPKs, Quorum: account.Quorum})
+	if err != nil {
+		return nil, err
+	}
+	recovery, err := vmutil.BranchProgram(vmutil.Branch{
+		NotBefore: bc.Millis(now) + tmpl.RecoveryDelayMS,
+		Pubkeys:   chainkd.XPubKeys(chainkd.DeriveXPubs(tmpl.RecoveryXPubs, path)),
+		Quorum:    tmpl.RecoveryQuorum,
+	})
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadProgramTemplate, errors.Detail(err))
+	}
+	return vmutil.TwoBranchProgram(main, recovery), nil
+}
+
+// addWitnessSelector adds whatever witness components the
+// account's template needs, beyond the account signatures, to spend
+// through the account keys.
+func addWitnessSelector(sigInst *txbuilder.SigningInstruction, tmpl *ProgramTemplate) {
+	if tmpl == nil {
+		return
+	}
+	sigInst.WitnessComponents = append(sigInst.WitnessComponents, txbuilder.DataWitness(vm.BoolBytes(false)))
+}
@@ -6,9 +6,12 @@ import (
 	stdsql "database/sql"
 	"time"
 
+	"github.com/lib/pq"
+
 	"chain/database/pg"
 	"chain/database/sql"
 	"chain/errors"
+	"chain/net/http/reqid"
 	"chain/protocol/bc"
 )
 
@@ -56,6 +59,10 @@ type (
 		OutputIndex *uint32
 		Amount      uint64
 		ClientToken *string `json:"client_token"`
+
+		// Selector chooses the UTXOs to reserve. If it is nil,
+		// they are taken in the order reserve_utxos finds them.
+		Selector CoinSelector `json:"-"`
 	}
 )
 
@@ -106,6 +113,12 @@ func (res *DBReserver) ReserveUTXO(ctx context.Context, txHash bc.Hash, pos uint
 		}
 		return 0, nil, ErrReserved
 	}
+	if !alreadyExisted {
+		err = recordRequestID(ctx, dbtx, reservationID)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
 
 	var (
 		accountID    string
@@ -206,13 +219,17 @@ func (res *DBReserver) Reserve(ctx context.Context, source Source, exp time.Time
 	//  * already_existed will be TRUE
 	//  * existing_change will be the change value for the existing
 	//    reservation row.
-	err = dbtx.QueryRow(ctx, reserveQ, source.AssetID, source.AccountID, txHash, outIndex, source.Amount, exp, source.ClientToken).Scan(
-		&reservationID,
-		&alreadyExisted,
-		&existingChange,
-		&reservedAmount,
-		&insufficient,
-	)
+	if source.Selector != nil {
+		reservationID, alreadyExisted, existingChange, reservedAmount, insufficient, err = selectUTXOs(ctx, dbtx, source, txHash, outIndex, exp)
+	} else {
+		err = dbtx.QueryRow(ctx, reserveQ, source.AssetID, source.AccountID, txHash, outIndex, source.Amount, exp, source.ClientToken).Scan(
+			&reservationID,
+			&alreadyExisted,
+			&existingChange,
+			&reservedAmount,
+			&insufficient,
+		)
+	}
 	if err != nil {
 		return 0, nil, nil, errors.Wrap(err, "reserve utxos")
 	}
@@ -223,6 +240,13 @@ func (res *DBReserver) Reserve(ctx context.Context, source Source, exp time.Time
 		return 0, nil, nil, ErrReserved
 	}
 
+	if !alreadyExisted {
+		err = recordRequestID(ctx, dbtx, reservationID)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+	}
+
 	if alreadyExisted && existingChange > 0 {
 		// This reservation already exists from a previous request
 		change = append(change, Change{source, existingChange})
@@ -256,6 +280,170 @@ func (res *DBReserver) Reserve(ctx context.Context, source Source, exp time.Time
 	return reservationID, reserved, change, err
 }
 
+// selectUTXOs does the work of the reserve_utxos database function,
+// using source.Selector to choose among the available UTXOs, and
+// returns the same results. It must run inside the database
+// transaction of a reservation.
+func selectUTXOs(ctx context.Context, dbtx *sql.Tx, source Source, txHash stdsql.NullString, outIndex stdsql.NullInt64, exp time.Time) (
+	reservationID int32,
+	alreadyExisted bool,
+	existingChange uint64,
+	reservedAmount uint64,
+	insufficient bool,
+	err error,
+) {
+	const (
+		createQ = `
+			SELECT reservation_id, already_existed, existing_change
+			FROM create_reservation($1, $2, $3, $4)
+		`
+		// Every available UTXO is a candidate, so that the
+		// selector chooses among all of them. Candidates are
+		// read without locking, so that reserving a few UTXOs
+		// doesn't lock all of the account's others. Only the
+		// UTXOs the selector chooses are locked, by lockQ.
+		candidatesQ = `
+			SELECT tx_hash, index, amount
+			FROM account_utxos
+			WHERE asset_id = $1 AND account_id = $2
+				AND ($3::text IS NULL OR tx_hash = $3)
+				AND ($4::bigint IS NULL OR index = $4)
+				AND reservation_id IS NULL
+		`
+		lockQ = `
+			SELECT tx_hash, index FROM account_utxos
+			WHERE (tx_hash, index) IN (SELECT unnest($1::text[]), unnest($2::integer[]))
+				AND reservation_id IS NULL
+			FOR UPDATE SKIP LOCKED
+		`
+		unavailableQ = `
+			SELECT COALESCE(SUM(change), 0) FROM reservations
+			WHERE asset_id = $1 AND account_id = $2
+		`
+		reserveQ = `
+			UPDATE account_utxos SET reservation_id = $1
+			WHERE (tx_hash, index) IN (SELECT unnest($2::text[]), unnest($3::integer[]))
+		`
+		changeQ = `UPDATE reservations SET change = $2 WHERE reservation_id = $1`
+	)
+
+	err = dbtx.QueryRow(ctx, createQ, source.AssetID, source.AccountID, exp, source.ClientToken).Scan(
+		&reservationID,
+		&alreadyExisted,
+		&existingChange,
+	)
+	if err != nil || alreadyExisted {
+		return reservationID, alreadyExisted, existingChange, 0, false, err
+	}
+
+	var (
+		candidates []*UTXO
+		available  uint64
+		selected   []*UTXO
+	)
+	err = pg.ForQueryRows(ctx, dbtx, candidatesQ, source.AssetID, source.AccountID, txHash, outIndex, func(hash bc.Hash, index uint32, amount uint64) {
+		candidates = append(candidates, &UTXO{
+			Outpoint:    bc.Outpoint{Hash: hash, Index: index},
+			AssetAmount: bc.AssetAmount{AssetID: source.AssetID, Amount: amount},
+		})
+		available += amount
+	})
+	if err != nil {
+		return 0, false, 0, 0, false, errors.Wrap(err, "query available utxos")
+	}
+	for {
+		selected, err = source.Selector.Select(candidates, source.Amount)
+		if err == ErrInsufficient {
+			// Like reserve_utxos, report insufficient funds only if
+			// the change from pending reservations won't cover the
+			// shortfall either. The caller's rollback discards the
+			// reservation.
+			var unavailable uint64
+			err = dbtx.QueryRow(ctx, unavailableQ, source.AssetID, source.AccountID).Scan(&unavailable)
+			if err != nil {
+				return 0, false, 0, 0, false, errors.Wrap(err, "query pending change")
+			}
+			return 0, false, 0, available, available+unavailable < source.Amount, nil
+		} else if err != nil {
+			return 0, false, 0, 0, false, errors.Wrap(err, "selecting utxos")
+		}
+
+		// Another reservation may have taken some of the selected
+		// UTXOs since they were read. Drop those and select again.
+		var locked map[bc.Outpoint]bool
+		locked, err = lockUTXOs(ctx, dbtx, lockQ, selected)
+		if err != nil {
+			return 0, false, 0, 0, false, err
+		}
+		if len(locked) == len(selected) {
+			break
+		}
+		lost := make(map[bc.Outpoint]bool)
+		for _, u := range selected {
+			if !locked[u.Outpoint] {
+				lost[u.Outpoint] = true
+			}
+		}
+		remaining := candidates[:0]
+		available = 0
+		for _, u := range candidates {
+			if !lost[u.Outpoint] {
+				remaining = append(remaining, u)
+				available += u.Amount
+			}
+		}
+		candidates = remaining
+	}
+
+	var (
+		hashes  = make([]string, 0, len(selected))
+		indexes = make([]int64, 0, len(selected))
+	)
+	for _, u := range selected {
+		hashes = append(hashes, u.Hash.String())
+		indexes = append(indexes, int64(u.Index))
+		reservedAmount += u.Amount
+	}
+	_, err = dbtx.Exec(ctx, reserveQ, reservationID, pq.StringArray(hashes), pq.Int64Array(indexes))
+	if err != nil {
+		return 0, false, 0, 0, false, errors.Wrap(err, "reserving selected utxos")
+	}
+	_, err = dbtx.Exec(ctx, changeQ, reservationID, reservedAmount-source.Amount)
+	if err != nil {
+		return 0, false, 0, 0, false, errors.Wrap(err, "recording reservation change")
+	}
+	return reservationID, false, 0, reservedAmount, false, nil
+}
+
+// lockUTXOs locks those of utxos that are still unreserved and not
+// locked by another reservation, and returns their outpoints.
+func lockUTXOs(ctx context.Context, dbtx *sql.Tx, q string, utxos []*UTXO) (map[bc.Outpoint]bool, error) {
+	var (
+		hashes  = make([]string, 0, len(utxos))
+		indexes = make([]int64, 0, len(utxos))
+	)
+	for _, u := range utxos {
+		hashes = append(hashes, u.Hash.String())
+		indexes = append(indexes, int64(u.Index))
+	}
+	locked := make(map[bc.Outpoint]bool, len(utxos))
+	err := pg.ForQueryRows(ctx, dbtx, q, pq.StringArray(hashes), pq.Int64Array(indexes), func(hash bc.Hash, index uint32) {
+		locked[bc.Outpoint{Hash: hash, Index: index}] = true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "locking selected utxos")
+	}
+	return locked, nil
+}
+
+// recordRequestID notes the ID of the request that made a new
+// reservation, so operators can trace where it came from.
+func recordRequestID(ctx context.Context, dbtx *sql.Tx, rid int32) error {
+	const q = `UPDATE reservations SET request_id = $2 WHERE reservation_id = $1`
+	_, err := dbtx.Exec(ctx, q, rid, reqid.FromContext(ctx))
+	return errors.Wrap(err, "recording reservation request id")
+}
+
 // Cancel cancels the given reservation if possible.
 // If it doesn't exist (if it's already been consumed
 // or canceled), it is silently ignored.
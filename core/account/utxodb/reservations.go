@@ -0,0 +1,111 @@
+package utxodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// A Reservation is a set of account UTXOs held for a transaction
+// being built, until the transaction is submitted or the
+// reservation expires or is canceled.
+type Reservation struct {
+	ID          int32         `json:"id"`
+	AccountID   string        `json:"account_id"`
+	AssetID     string        `json:"asset_id"`
+	Outputs     []bc.Outpoint `json:"reserved_outputs"`
+	Change      uint64        `json:"change"`
+	ClientToken string        `json:"client_token,omitempty"`
+	RequestID   string        `json:"request_id"`
+	Expiry      time.Time     `json:"expiry"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// ReservationFilter selects reservations. Empty fields match
+// any reservation.
+type ReservationFilter struct {
+	ID          int32
+	AccountID   string
+	AssetID     string
+	ClientToken string
+}
+
+// Reservations returns up to limit reservations matching f, in
+// order of ID, starting after the reservation with ID after.
+//
+// Reservations of a single UTXO don't record their account and
+// asset, so those are taken from the reserved UTXO.
+func (res *DBReserver) Reservations(ctx context.Context, f ReservationFilter, after int32, limit int) ([]*Reservation, error) {
+	const (
+		reservationsQ = `
+			SELECT r.reservation_id,
+				COALESCE(r.account_id, u.account_id, ''), COALESCE(r.asset_id, u.asset_id, ''),
+				r.change, COALESCE(r.idempotency_key, ''), r.request_id, r.expiry, r.created_at
+			FROM reservations r
+			LEFT JOIN LATERAL (
+				SELECT account_id, asset_id FROM account_utxos
+				WHERE reservation_id = r.reservation_id LIMIT 1
+			) u ON TRUE
+			WHERE ($1=0 OR r.reservation_id=$1)
+				AND ($2='' OR COALESCE(r.account_id, u.account_id)=$2)
+				AND ($3='' OR COALESCE(r.asset_id, u.asset_id)=$3)
+				AND ($4='' OR r.idempotency_key=$4)
+				AND r.reservation_id > $5
+			ORDER BY r.reservation_id
+			LIMIT $6
+		`
+		outputsQ = `
+			SELECT reservation_id, tx_hash, index FROM account_utxos
+			WHERE reservation_id = ANY($1)
+			ORDER BY tx_hash, index
+		`
+	)
+
+	var (
+		rs   []*Reservation
+		byID = make(map[int32]*Reservation)
+		ids  pq.Int64Array
+	)
+	err := pg.ForQueryRows(ctx, res.DB, reservationsQ, f.ID, f.AccountID, f.AssetID, f.ClientToken, after, limit, func(
+		id int32,
+		accountID, assetID string,
+		change uint64,
+		clientToken, requestID string,
+		expiry, createdAt time.Time,
+	) {
+		r := &Reservation{
+			ID:          id,
+			AccountID:   accountID,
+			AssetID:     assetID,
+			Outputs:     []bc.Outpoint{},
+			Change:      change,
+			ClientToken: clientToken,
+			RequestID:   requestID,
+			Expiry:      expiry,
+			CreatedAt:   createdAt,
+		}
+		rs = append(rs, r)
+		byID[id] = r
+		ids = append(ids, int64(id))
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "query reservations")
+	}
+	if len(rs) == 0 {
+		return rs, nil
+	}
+
+	err = pg.ForQueryRows(ctx, res.DB, outputsQ, ids, func(id int32, hash bc.Hash, index uint32) {
+		r := byID[id]
+		r.Outputs = append(r.Outputs, bc.Outpoint{Hash: hash, Index: index})
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "query reserved outputs")
+	}
+	return rs, nil
+}
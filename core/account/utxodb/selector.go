@@ -0,0 +1,164 @@
+package utxodb
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"chain/errors"
+)
+
+// ErrBadSelector is returned by SelectorByName for an unknown
+// strategy name.
+var ErrBadSelector = errors.New("unknown coin selection strategy")
+
+// A CoinSelector chooses which of an account's available UTXOs to
+// reserve to cover an amount.
+type CoinSelector interface {
+	// Select returns a subset of utxos whose amounts sum to at
+	// least amount, or ErrInsufficient if there is none. It must
+	// not modify utxos.
+	Select(utxos []*UTXO, amount uint64) ([]*UTXO, error)
+}
+
+// Selectors holds the available coin selection strategies by name.
+var Selectors = map[string]CoinSelector{
+	"largest_first":  LargestFirst,
+	"smallest_first": SmallestFirst,
+	"exact_match":    ExactMatch,
+	"random":         Random,
+}
+
+// SelectorByName returns the strategy with the given name. The
+// empty name selects the default strategy, reserve_utxos's own scan
+// order, for which SelectorByName returns nil.
+func SelectorByName(name string) (CoinSelector, error) {
+	if name == "" {
+		return nil, nil
+	}
+	s, ok := Selectors[name]
+	if !ok {
+		return nil, errors.WithDetailf(ErrBadSelector, "strategy %q", name)
+	}
+	return s, nil
+}
+
+var (
+	// LargestFirst spends the largest UTXOs first, minimizing the
+	// number of inputs.
+	LargestFirst CoinSelector = &orderedSelector{less: func(a, b *UTXO) bool { return a.Amount > b.Amount }}
+
+	// SmallestFirst spends the smallest UTXOs first, consolidating
+	// dust at the cost of larger transactions.
+	SmallestFirst CoinSelector = &orderedSelector{less: func(a, b *UTXO) bool { return a.Amount < b.Amount }}
+
+	// ExactMatch searches for a set of UTXOs summing exactly to the
+	// requested amount, so that no change output is needed. If it
+	// finds none within its search limit, it falls back to
+	// LargestFirst.
+	ExactMatch CoinSelector = exactMatch{maxTries: 100000}
+
+	// Random spends UTXOs in random order, so that the choice of
+	// inputs reveals as little as possible about the account's
+	// other holdings.
+	Random CoinSelector = &randomSelector{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+)
+
+type orderedSelector struct {
+	less func(a, b *UTXO) bool
+}
+
+func (s *orderedSelector) Select(utxos []*UTXO, amount uint64) ([]*UTXO, error) {
+	sorted := make([]*UTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.Sort(utxoSorter{sorted, s.less})
+	return accumulate(sorted, amount)
+}
+
+type utxoSorter struct {
+	utxos []*UTXO
+	less  func(a, b *UTXO) bool
+}
+
+func (s utxoSorter) Len() int           { return len(s.utxos) }
+func (s utxoSorter) Less(i, j int) bool { return s.less(s.utxos[i], s.utxos[j]) }
+func (s utxoSorter) Swap(i, j int)      { s.utxos[i], s.utxos[j] = s.utxos[j], s.utxos[i] }
+
+// accumulate takes UTXOs in order until they cover amount.
+func accumulate(utxos []*UTXO, amount uint64) ([]*UTXO, error) {
+	var sum uint64
+	for i, u := range utxos {
+		sum += u.Amount
+		if sum >= amount {
+			return utxos[:i+1], nil
+		}
+	}
+	return nil, ErrInsufficient
+}
+
+type exactMatch struct {
+	maxTries int
+}
+
+// Select performs a depth-first branch-and-bound search over the
+// UTXOs in descending order of amount, pruning branches that
+// overshoot the target or can no longer reach it.
+func (s exactMatch) Select(utxos []*UTXO, amount uint64) ([]*UTXO, error) {
+	sorted := make([]*UTXO, len(utxos))
+	copy(sorted, utxos)
+	sort.Sort(utxoSorter{sorted, func(a, b *UTXO) bool { return a.Amount > b.Amount }})
+
+	// remaining[i] is the sum of sorted[i:].
+	remaining := make([]uint64, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Amount
+	}
+	if remaining[0] < amount {
+		return nil, ErrInsufficient
+	}
+
+	var (
+		chosen []*UTXO
+		tries  int
+		search func(i int, target uint64) bool
+	)
+	search = func(i int, target uint64) bool {
+		if target == 0 {
+			return true
+		}
+		tries++
+		if i == len(sorted) || remaining[i] < target || tries > s.maxTries {
+			return false
+		}
+		if sorted[i].Amount <= target {
+			chosen = append(chosen, sorted[i])
+			if search(i+1, target-sorted[i].Amount) {
+				return true
+			}
+			chosen = chosen[:len(chosen)-1]
+		}
+		return search(i+1, target)
+	}
+	if search(0, amount) {
+		return chosen, nil
+	}
+	return accumulate(sorted, amount)
+}
+
+type randomSelector struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (s *randomSelector) Select(utxos []*UTXO, amount uint64) ([]*UTXO, error) {
+	s.mu.Lock()
+	perm := s.rand.Perm(len(utxos))
+	s.mu.Unlock()
+
+	shuffled := make([]*UTXO, len(utxos))
+	for i, j := range perm {
+		shuffled[i] = utxos[j]
+	}
+	return accumulate(shuffled, amount)
+}
@@ -0,0 +1,104 @@
+package utxodb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func amounts(utxos []*UTXO) []uint64 {
+	var res []uint64
+	for _, u := range utxos {
+		res = append(res, u.Amount)
+	}
+	return res
+}
+
+func utxosWithAmounts(amts ...uint64) []*UTXO {
+	var res []*UTXO
+	for _, a := range amts {
+		u := new(UTXO)
+		u.Amount = a
+		res = append(res, u)
+	}
+	return res
+}
+
+func TestSelectors(t *testing.T) {
+	utxos := utxosWithAmounts(5, 1, 10, 3, 7)
+	cases := []struct {
+		selector CoinSelector
+		amount   uint64
+		want     []uint64
+	}{
+		{LargestFirst, 12, []uint64{10, 7}},
+		{SmallestFirst, 8, []uint64{1, 3, 5}},
+		{ExactMatch, 12, []uint64{7, 5}},
+		{ExactMatch, 9, []uint64{5, 3, 1}},
+		{ExactMatch, 26, []uint64{10, 7, 5, 3, 1}},
+		{LargestFirst, 26, []uint64{10, 7, 5, 3, 1}},
+	}
+	for i, c := range cases {
+		got, err := c.selector.Select(utxos, c.amount)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if !reflect.DeepEqual(amounts(got), c.want) {
+			t.Errorf("case %d: got %v want %v", i, amounts(got), c.want)
+		}
+	}
+
+	// Selection must not reorder the caller's UTXOs.
+	if !reflect.DeepEqual(amounts(utxos), []uint64{5, 1, 10, 3, 7}) {
+		t.Errorf("input modified: %v", amounts(utxos))
+	}
+
+	for name, s := range Selectors {
+		_, err := s.Select(utxos, 27)
+		if err != ErrInsufficient {
+			t.Errorf("%s: got error %v want %v", name, err, ErrInsufficient)
+		}
+	}
+}
+
+func TestExactMatchFallback(t *testing.T) {
+	// No subset of these sums to 4.
+	got, err := ExactMatch.Select(utxosWithAmounts(3, 3, 3), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(amounts(got), []uint64{3, 3}) {
+		t.Errorf("got %v want [3 3]", amounts(got))
+	}
+}
+
+func TestRandomCovers(t *testing.T) {
+	utxos := utxosWithAmounts(5, 1, 10, 3, 7)
+	for i := 0; i < 20; i++ {
+		got, err := Random.Select(utxos, 15)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum uint64
+		for _, u := range got {
+			sum += u.Amount
+		}
+		if sum < 15 || sum-got[len(got)-1].Amount >= 15 {
+			t.Errorf("selection %v does not minimally cover 15", amounts(got))
+		}
+	}
+}
+
+func TestSelectorByName(t *testing.T) {
+	s, err := SelectorByName("")
+	if s != nil || err != nil {
+		t.Errorf("SelectorByName(\"\") = %v, %v want nil, nil", s, err)
+	}
+	s, err = SelectorByName("largest_first")
+	if s != LargestFirst || err != nil {
+		t.Errorf("SelectorByName(largest_first) = %v, %v", s, err)
+	}
+	_, err = SelectorByName("bogus")
+	if err == nil {
+		t.Error("expected error for unknown strategy")
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"context"
 	"sync"
 
+	"chain/core/account"
+	"chain/core/account/utxodb"
 	"chain/core/signers"
+	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
 )
 
@@ -15,6 +18,10 @@ type accountResponse struct {
 	Keys   interface{} `json:"keys"`
 	Quorum interface{} `json:"quorum"`
 	Tags   interface{} `json:"tags"`
+
+	ProgramTemplate interface{} `json:"program_template,omitempty"`
+	CoinSelection   interface{} `json:"coin_selection,omitempty"`
+	SpendingPolicy  interface{} `json:"spending_policy,omitempty"`
 }
 
 type accountKey struct {
@@ -30,6 +37,17 @@ func (h *Handler) createAccount(ctx context.Context, ins []struct {
 	Alias     string
 	Tags      map[string]interface{}
 
+	// ProgramTemplate, if set, describes the shape of the control
+	// programs created for the account.
+	ProgramTemplate *account.ProgramTemplate `json:"program_template"`
+
+	// CoinSelection, if set, names the coin selection strategy
+	// for spends from the account.
+	CoinSelection string `json:"coin_selection"`
+
+	// SpendingPolicy, if set, restricts spends from the account.
+	SpendingPolicy *account.SpendingPolicy `json:"spending_policy"`
+
 	// ClientToken is the application's unique token for the account. Every account
 	// should have a unique client token. The client token is used to ensure
 	// idempotency of create account requests. Duplicate create account requests
@@ -46,11 +64,39 @@ func (h *Handler) createAccount(ctx context.Context, ins []struct {
 			defer wg.Done()
 			defer batchRecover(subctx, &responses[i])
 
-			acc, err := h.Accounts.Create(subctx, ins[i].RootXPubs, ins[i].Quorum, ins[i].Alias, ins[i].Tags, ins[i].ClientToken)
+			_, err := utxodb.SelectorByName(ins[i].CoinSelection)
 			if err != nil {
 				responses[i] = err
 				return
 			}
+			if ins[i].SpendingPolicy != nil {
+				err = ins[i].SpendingPolicy.Validate()
+				if err != nil {
+					responses[i] = err
+					return
+				}
+			}
+			acc, err := h.Accounts.Create(subctx, ins[i].RootXPubs, ins[i].Quorum, ins[i].Alias, ins[i].Tags, ins[i].ProgramTemplate, ins[i].ClientToken)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			if ins[i].CoinSelection != "" {
+				err = h.Accounts.SetCoinSelection(subctx, acc.ID, ins[i].CoinSelection)
+				if err != nil {
+					responses[i] = err
+					return
+				}
+				acc.CoinSelection = ins[i].CoinSelection
+			}
+			if ins[i].SpendingPolicy != nil {
+				err = h.Accounts.SetSpendingPolicy(subctx, acc.ID, ins[i].SpendingPolicy)
+				if err != nil {
+					responses[i] = err
+					return
+				}
+				acc.SpendingPolicy = ins[i].SpendingPolicy
+			}
 			path := signers.Path(acc.Signer, signers.AccountKeySpace)
 			var keys []accountKey
 			for _, xpub := range acc.XPubs {
@@ -60,16 +106,66 @@ func (h *Handler) createAccount(ctx context.Context, ins []struct {
 					AccountDerivationPath: path,
 				})
 			}
-			responses[i] = &accountResponse{
+			resp := &accountResponse{
 				ID:     acc.ID,
 				Alias:  acc.Alias,
 				Keys:   keys,
 				Quorum: acc.Quorum,
 				Tags:   acc.Tags,
 			}
+			if acc.ProgramTemplate != nil {
+				resp.ProgramTemplate = acc.ProgramTemplate
+			}
+			if acc.CoinSelection != "" {
+				resp.CoinSelection = acc.CoinSelection
+			}
+			if acc.SpendingPolicy != nil {
+				resp.SpendingPolicy = acc.SpendingPolicy
+			}
+			responses[i] = resp
 		}(i)
 	}
 
 	wg.Wait()
 	return responses
 }
+
+// POST /update-account-spending-policy
+//
+// A null spending_policy removes any restrictions on the account.
+func (h *Handler) updateAccountSpendingPolicy(ctx context.Context, in struct {
+	AccountID      string                  `json:"account_id"`
+	AccountAlias   string                  `json:"account_alias"`
+	SpendingPolicy *account.SpendingPolicy `json:"spending_policy"`
+}) error {
+	if in.AccountID == "" && in.AccountAlias != "" {
+		acc, err := h.Accounts.FindByAlias(ctx, in.AccountAlias)
+		if err != nil {
+			return err
+		}
+		in.AccountID = acc.ID
+	}
+	return h.Accounts.SetSpendingPolicy(ctx, in.AccountID, in.SpendingPolicy)
+}
+
+// POST /list-account-spending-decisions
+func (h *Handler) listAccountSpendingDecisions(ctx context.Context, in struct {
+	AccountID string `json:"account_id"`
+	After     string `json:"after"`
+}) (interface{}, error) {
+	limit := defGenericPageSize
+	decisions, err := h.Accounts.SpendingDecisions(ctx, in.AccountID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(decisions) > 0 {
+		next.After = decisions[len(decisions)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(decisions), next, len(decisions) < limit}, nil
+}
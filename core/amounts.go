@@ -0,0 +1,137 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"chain/core/asset"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/bc"
+)
+
+// amountFormatter renders asset amounts in API output according to
+// the amount_format option of a query. With "decimal", amounts are
+// strings scaled by the precision of their asset; otherwise they are
+// integers in the asset's smallest unit.
+type amountFormatter struct {
+	assets     *asset.Registry
+	decimal    bool
+	precisions map[bc.AssetID]int
+}
+
+func (h *Handler) newAmountFormatter(format string) (*amountFormatter, error) {
+	f := &amountFormatter{assets: h.Assets, precisions: make(map[bc.AssetID]int)}
+	switch format {
+	case "", "integer":
+	case "decimal":
+		f.decimal = true
+	default:
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "unknown amount format %q", format)
+	}
+	return f, nil
+}
+
+// format returns amount formatted for the asset identified by
+// assetID. Both are taken as they appear in annotated JSON objects.
+func (f *amountFormatter) format(ctx context.Context, assetID, amount interface{}) (interface{}, error) {
+	if !f.decimal {
+		return amount, nil
+	}
+
+	var id bc.AssetID
+	idStr, ok := assetID.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type %T for asset id", assetID)
+	}
+	err := id.UnmarshalText([]byte(idStr))
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding asset id")
+	}
+
+	var n uint64
+	switch amount := amount.(type) {
+	case uint64:
+		n = amount
+	case json.Number:
+		n, err = parseUint(amount)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unexpected type %T for amount", amount)
+	}
+
+	precision, ok := f.precisions[id]
+	if !ok {
+		precision, err = f.assets.Precision(ctx, id)
+		if err != nil {
+			return nil, errors.Wrap(err, "looking up asset precision")
+		}
+		f.precisions[id] = precision
+	}
+	return asset.FormatAmount(n, precision), nil
+}
+
+// parseUint parses n as an integer amount. It returns an error
+// if n is negative, fractional, or too large.
+func parseUint(n json.Number) (uint64, error) {
+	x, err := strconv.ParseUint(string(n), 10, 64)
+	return x, errors.Wrap(err, "decoding amount")
+}
+
+// decodeAnnotated decodes the annotated JSON object data into v,
+// keeping numbers as json.Number so amounts can be formatted
+// without losing precision.
+func decodeAnnotated(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// parseDecimalAmounts replaces any decimal string amount in the
+// build actions with the equivalent integer amount. It must run
+// after filterAliases, so that every action identifies its asset
+// by ID.
+func (h *Handler) parseDecimalAmounts(ctx context.Context, br *buildRequest) error {
+	for i, m := range br.Actions {
+		s, ok := m["amount"].(string)
+		if !ok {
+			continue
+		}
+		var id bc.AssetID
+		switch v := m["asset_id"].(type) {
+		case bc.AssetID:
+			id = v
+		case string:
+			err := id.UnmarshalText([]byte(v))
+			if err != nil {
+				return errors.WithDetailf(errBadAction, "invalid asset id on action %d", i)
+			}
+		default:
+			return errors.WithDetailf(errBadAction, "decimal amount on action %d requires an asset", i)
+		}
+		precision, err := h.Assets.Precision(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "looking up asset precision")
+		}
+		amount, err := asset.ParseAmount(s, precision)
+		if err != nil {
+			return errors.WithDetailf(err, "invalid amount on action %d", i)
+		}
+		m["amount"] = amount
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseUint(t *testing.T) {
+	cases := []struct {
+		in   json.Number
+		want uint64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"9007199254740993", 9007199254740993, true},
+		{"18446744073709551615", 18446744073709551615, true},
+		{"18446744073709551616", 0, false},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"1e3", 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseUint(c.in)
+		if (err == nil) != c.ok {
+			t.Errorf("parseUint(%s) err = %v want ok = %t", c.in, err, c.ok)
+		} else if c.ok && got != c.want {
+			t.Errorf("parseUint(%s) = %d want %d", c.in, got, c.want)
+		}
+	}
+}
@@ -14,15 +14,20 @@ import (
 	"chain/core/account"
 	"chain/core/asset"
 	"chain/core/config"
+	"chain/core/consolidate"
+	"chain/core/coordinate"
+	"chain/core/generator"
 	"chain/core/leader"
 	"chain/core/mockhsm"
+	"chain/core/payment"
 	"chain/core/pin"
 	"chain/core/query"
 	"chain/core/rpc"
+	"chain/core/schedule"
 	"chain/core/txbuilder"
 	"chain/core/txdb"
 	"chain/core/txfeed"
-	"chain/database/pg"
+	"chain/database/sql"
 	"chain/encoding/json"
 	"chain/errors"
 	"chain/generated/dashboard"
@@ -59,16 +64,26 @@ type Handler struct {
 	HSM           *mockhsm.HSM
 	Indexer       *query.Indexer
 	TxFeeds       *txfeed.Tracker
+	Consolidator  *consolidate.Manager
+	Payments      *payment.Queue
+	Scheduler     *schedule.Scheduler
+	Coordinator   *coordinate.Manager
+	Leader        leader.LeaderElector
 	AccessTokens  *accesstoken.CredentialStore
 	Config        *config.Config
-	DB            pg.DB
+	DB            *sql.DB
 	Addr          string
 	AltAuth       func(*http.Request) bool
 	Signer        func(context.Context, *bc.Block) ([]byte, error)
+	CheckBlock    func(context.Context, *bc.Block) error
 	RequestLimits []RequestLimit
 
+	ApproveConsensusProgram func(ctx context.Context, height uint64, program []byte) ([]byte, error)
+	SignerMonitor           *generator.SignerMonitor
+
 	once           sync.Once
 	handler        http.Handler
+	configMu       sync.Mutex // protects runtime-changeable fields of Config
 	actionDecoders map[string]func(data []byte) (txbuilder.Action, error)
 
 	healthMu     sync.Mutex
@@ -86,7 +101,9 @@ func maxBytes(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		// A block can easily be bigger than maxReqSize, but everything
 		// else should be pretty small.
-		if req.URL.Path != networkRPCPrefix+"signer/sign-block" {
+		switch req.URL.Path {
+		case networkRPCPrefix + "signer/sign-block", networkRPCPrefix + "signer/check-block":
+		default:
 			req.Body = http.MaxBytesReader(w, req.Body, maxReqSize)
 		}
 		h.ServeHTTP(w, req)
@@ -97,10 +114,13 @@ func (h *Handler) init() {
 	// Setup the available transact actions.
 	h.actionDecoders = map[string]func(data []byte) (txbuilder.Action, error){
 		"control_account":                h.Accounts.DecodeControlAction,
+		"control_contract":               txbuilder.DecodeControlContractAction,
 		"control_program":                txbuilder.DecodeControlProgramAction,
 		"issue":                          h.Assets.DecodeIssueAction,
+		"retire":                         txbuilder.DecodeRetireAction,
 		"spend_account":                  h.Accounts.DecodeSpendAction,
 		"spend_account_unspent_output":   h.Accounts.DecodeSpendUTXOAction,
+		"spend_contract_unspent_output":  txbuilder.DecodeSpendContractAction,
 		"set_transaction_reference_data": txbuilder.DecodeSetTxRefDataAction,
 	}
 
@@ -116,9 +136,15 @@ func (h *Handler) init() {
 	m.Handle("/", alwaysError(errNotFound))
 
 	m.Handle("/create-account", needConfig(h.createAccount))
+	m.Handle("/update-account-spending-policy", needConfig(h.updateAccountSpendingPolicy))
+	m.Handle("/list-account-spending-decisions", needConfig(h.listAccountSpendingDecisions))
 	m.Handle("/create-asset", needConfig(h.createAsset))
+	m.Handle("/publish-asset-definition", needConfig(h.publishAssetDefinition))
+	m.Handle("/get-asset-definition", needConfig(h.getAssetDefinition))
+	m.Handle("/get-asset-supply", needConfig(h.getAssetSupply))
 	m.Handle("/build-transaction", needConfig(h.build))
 	m.Handle("/submit-transaction", needConfig(h.submit))
+	m.Handle("/decode-transaction-template", needConfig(h.decodeTxTemplate))
 	m.Handle("/create-control-program", needConfig(h.createControlProgram))
 	m.Handle("/create-transaction-feed", needConfig(h.createTxFeed))
 	m.Handle("/get-transaction-feed", needConfig(h.getTxFeed))
@@ -128,6 +154,27 @@ func (h *Handler) init() {
 	m.Handle("/mockhsm/list-keys", needConfig(h.mockhsmListKeys))
 	m.Handle("/mockhsm/delkey", needConfig(h.mockhsmDelKey))
 	m.Handle("/mockhsm/sign-transaction", needConfig(h.mockhsmSignTemplates))
+	m.Handle("/mockhsm/sign-asset-definition", needConfig(h.mockhsmSignAssetDefinitions))
+	m.Handle("/create-consolidation-policy", needConfig(h.createConsolidationPolicy))
+	m.Handle("/list-consolidation-policies", needConfig(h.listConsolidationPolicies))
+	m.Handle("/update-consolidation-policy", needConfig(h.updateConsolidationPolicy))
+	m.Handle("/trigger-consolidation", needConfig(h.triggerConsolidation))
+	m.Handle("/list-consolidation-runs", needConfig(h.listConsolidationRuns))
+	m.Handle("/enqueue-payment", needConfig(h.enqueuePayments))
+	m.Handle("/list-payments", needConfig(h.listPayments))
+	m.Handle("/create-scheduled-transaction", needConfig(h.createScheduledTxs))
+	m.Handle("/list-scheduled-transactions", needConfig(h.listScheduledTxs))
+	m.Handle("/cancel-scheduled-transaction", needConfig(h.cancelScheduledTx))
+	m.Handle("/list-scheduled-transaction-runs", needConfig(h.listScheduledTxRuns))
+	m.Handle("/create-coordination-session", needConfig(h.createCoordinationSession))
+	m.Handle("/get-coordination-session", needConfig(h.getCoordinationSession))
+	m.Handle("/list-coordination-sessions", needConfig(h.listCoordinationSessions))
+	m.Handle("/contribute-to-coordination-session", needConfig(h.contributeToCoordinationSession))
+	m.Handle("/add-coordination-session-signatures", needConfig(h.addCoordinationSessionSignatures))
+	m.Handle("/join-coordination-session", needConfig(h.joinCoordinationSession))
+	m.Handle("/sign-coordination-session", needConfig(h.signCoordinationSession))
+	m.Handle("/list-reservations", needConfig(h.listReservations))
+	m.Handle("/cancel-reservation", needConfig(h.cancelReservation))
 	m.Handle("/list-accounts", needConfig(h.listAccounts))
 	m.Handle("/list-assets", needConfig(h.listAssets))
 	m.Handle("/list-transaction-feeds", needConfig(h.listTxFeeds))
@@ -135,13 +182,27 @@ func (h *Handler) init() {
 	m.Handle("/list-balances", needConfig(h.listBalances))
 	m.Handle("/list-unspent-outputs", needConfig(h.listUnspentOutputs))
 	m.Handle("/reset", needConfig(h.reset))
-
-	m.Handle(networkRPCPrefix+"submit", needConfig(h.Chain.AddTx))
+	m.Handle("/step-down", needConfig(h.stepDown))
+	m.Handle("/update-configuration", needConfig(h.updateConfiguration))
+	m.Handle("/list-configuration-updates", needConfig(h.listConfigurationUpdates))
+	m.Handle("/propose-consensus-program", needConfig(h.proposeConsensusProgram))
+	m.Handle("/approve-consensus-program", needConfig(h.approveConsensusProgram))
+	m.Handle("/add-consensus-program-approvals", needConfig(h.addConsensusProgramApprovals))
+	m.Handle("/get-consensus-program-rotation", needConfig(h.getConsensusProgramRotation))
+	m.Handle("/list-signer-faults", needConfig(h.listSignerFaults))
+	m.Handle("/list-block-signers", needConfig(h.listBlockSigners))
+
+	m.Handle(networkRPCPrefix+"submit", needConfig(h.submitRPC))
 	m.Handle(networkRPCPrefix+"get-blocks", needConfig(h.getBlocksRPC)) // DEPRECATED: use get-block instead
 	m.Handle(networkRPCPrefix+"get-block", needConfig(h.getBlockRPC))
 	m.Handle(networkRPCPrefix+"get-snapshot-info", needConfig(h.getSnapshotInfoRPC))
 	m.Handle(networkRPCPrefix+"get-snapshot", http.HandlerFunc(h.getSnapshotRPC))
 	m.Handle(networkRPCPrefix+"signer/sign-block", needConfig(h.leaderSignHandler(h.Signer)))
+	m.Handle(networkRPCPrefix+"signer/check-block", needConfig(h.checkBlockRPC))
+	m.Handle(networkRPCPrefix+"report-signer-fault", needConfig(h.reportSignerFaultRPC))
+	m.Handle(networkRPCPrefix+"leader/request-vote", needConfig(h.requestVoteRPC))
+	m.Handle(networkRPCPrefix+"leader/heartbeat", needConfig(h.heartbeatRPC))
+	m.Handle(networkRPCPrefix+"generator-status", needConfig(h.generatorStatusRPC))
 	m.Handle(networkRPCPrefix+"block-height", needConfig(func(ctx context.Context) map[string]uint64 {
 		h := h.Chain.Height()
 		return map[string]uint64{
@@ -217,6 +278,11 @@ type requestQuery struct {
 	// TODO(bobg): Different request structs for endpoints with different needs
 	TimestampMS uint64 `json:"timestamp,omitempty"`
 
+	// AmountFormat is used by /list-balances, /list-unspent-outputs
+	// and /list-transactions. Value must be "integer" (the default)
+	// or "decimal".
+	AmountFormat string `json:"amount_format,omitempty"`
+
 	// This is used for filtering results from /list-access-tokens
 	// Value must be "client" or "network"
 	Type string `json:"type"`
@@ -285,12 +351,38 @@ func (h *Handler) leaderSignHandler(f func(context.Context, *bc.Block) ([]byte,
 	}
 }
 
+// checkBlockRPC applies this Core's block policies to a block
+// without signing it. Every process has the policies, so unlike
+// signing, it doesn't need the leader.
+func (h *Handler) checkBlockRPC(ctx context.Context, b *bc.Block) error {
+	if h.CheckBlock == nil {
+		return errNotFound
+	}
+	return h.CheckBlock(ctx, b)
+}
+
+// leaderAddress returns the address of the core's leader process,
+// as reported by the leader election backend.
+func (h *Handler) leaderAddress(ctx context.Context) (string, error) {
+	if h.Leader == nil {
+		return leader.Address(ctx, h.DB)
+	}
+	s, err := h.Leader.Status(ctx)
+	if err != nil {
+		return "", err
+	}
+	if s.LeaderAddress == "" {
+		return "", errLeaderElection
+	}
+	return s.LeaderAddress, nil
+}
+
 // forwardToLeader forwards the current request to the core's leader
 // process. It propagates the same credentials used in the current
 // request. For that reason, it cannot be used outside of a request-
 // handling context.
 func (h *Handler) forwardToLeader(ctx context.Context, path string, body interface{}, resp interface{}) error {
-	addr, err := leader.Address(ctx, h.DB)
+	addr, err := h.leaderAddress(ctx)
 	if err != nil {
 		return errors.Wrap(err)
 	}
@@ -305,6 +397,7 @@ func (h *Handler) forwardToLeader(ctx context.Context, path string, body interfa
 	// TODO(jackson): If using TLS, use https:// here.
 	l := &rpc.Client{
 		BaseURL: "http://" + addr,
+		CoreID:  reqid.CoreIDFromContext(ctx),
 	}
 
 	// Forward the request credentials if we have them.
@@ -318,7 +411,12 @@ func (h *Handler) forwardToLeader(ctx context.Context, path string, body interfa
 		l.AccessToken = fmt.Sprintf("%s:%s", user, pass)
 	}
 
-	return l.Call(ctx, path, body, &resp)
+	err = l.Call(ctx, path, body, &resp)
+	if r := rpc.Response(err); r != nil {
+		// Pass the leader's error through to our client.
+		return errors.Wrap(r)
+	}
+	return err
 }
 
 // expvarHandler is copied from the expvar package.
@@ -33,7 +33,7 @@ func TestBuildFinal(t *testing.T) {
 	accounts.IndexAccounts(query.NewIndexer(db, c, pinStore), pinStore)
 	go accounts.ProcessBlocks(ctx)
 
-	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil)
+	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -143,7 +143,7 @@ func TestAccountTransfer(t *testing.T) {
 	accounts.IndexAccounts(query.NewIndexer(db, c, pinStore), pinStore)
 	go accounts.ProcessBlocks(ctx)
 
-	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil)
+	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -49,6 +49,9 @@ type Registry struct {
 	cache   *lru.Cache
 }
 
+// IndexAssets sets up reg to process blocks with pinStore,
+// tracking asset supply and saving new non-local assets to
+// indexer. A nil indexer tracks supply only.
 func (reg *Registry) IndexAssets(indexer Saver, pinStore *pin.Store) {
 	reg.indexer = indexer
 	reg.pinStore = pinStore
@@ -67,6 +70,11 @@ type Asset struct {
 
 // Define defines a new Asset.
 func (reg *Registry) Define(ctx context.Context, xpubs []string, quorum int, definition map[string]interface{}, alias string, tags map[string]interface{}, clientToken *string) (*Asset, error) {
+	_, err := decimalsFromDefinition(definition)
+	if err != nil {
+		return nil, err
+	}
+
 	assetSigner, err := signers.Create(ctx, reg.db, "asset", xpubs, quorum, clientToken)
 	if err != nil {
 		return nil, err
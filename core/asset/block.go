@@ -72,14 +72,20 @@ func (reg *Registry) indexAnnotatedAsset(ctx context.Context, a *Asset) error {
 }
 
 func (reg *Registry) ProcessBlocks(ctx context.Context) {
-	if reg.indexer == nil || reg.pinStore == nil {
+	if reg.pinStore == nil {
 		return
 	}
 	reg.pinStore.ProcessBlocks(ctx, reg.chain, PinName, reg.indexAssets)
 }
 
-// indexAssets is run on every block and indexes all non-local assets.
+// indexAssets is run on every block. It indexes all non-local
+// assets and updates asset supply.
 func (reg *Registry) indexAssets(ctx context.Context, b *bc.Block) error {
+	err := reg.indexSupply(ctx, b)
+	if err != nil {
+		return err
+	}
+
 	var (
 		assetIDs, definitions pq.StringArray
 		issuancePrograms      pq.ByteaArray
@@ -127,7 +133,7 @@ func (reg *Registry) indexAssets(ctx context.Context, b *bc.Block) error {
 		SELECT id FROM assets WHERE first_block_height = $6
 	`
 	var newAssetIDs []bc.AssetID
-	err := pg.ForQueryRows(ctx, reg.db, q, assetIDs, issuancePrograms, definitions, b.Time(), reg.initialBlockHash, b.Height,
+	err = pg.ForQueryRows(ctx, reg.db, q, assetIDs, issuancePrograms, definitions, b.Time(), reg.initialBlockHash, b.Height,
 		func(assetID bc.AssetID) { newAssetIDs = append(newAssetIDs, assetID) })
 	if err != nil {
 		return errors.Wrap(err, "error indexing non-local assets")
@@ -11,6 +11,7 @@ import (
 	"chain/database/pg"
 	chainjson "chain/encoding/json"
 	"chain/errors"
+	"chain/log"
 	"chain/protocol/bc"
 )
 
@@ -52,6 +53,14 @@ func (a *issueAction) Build(ctx context.Context, maxTime time.Time) (*txbuilder.
 	if err != nil {
 		return nil, err
 	}
+
+	// The issuance counts toward the asset's issuance cap until
+	// it lands in a block or can no longer land.
+	reserved, err := a.assets.reserveIssuance(ctx, a.AssetID, nonce[:], a.Amount, maxTime)
+	if err != nil {
+		return nil, err
+	}
+
 	txin := bc.NewIssuanceInput(nonce[:], a.Amount, a.ReferenceData, asset.InitialBlockHash, asset.IssuanceProgram, nil)
 
 	tplIn := &txbuilder.SigningInstruction{AssetAmount: a.AssetAmount}
@@ -59,9 +68,18 @@ func (a *issueAction) Build(ctx context.Context, maxTime time.Time) (*txbuilder.
 	keyIDs := txbuilder.KeyIDs(asset.Signer.XPubs, path)
 	tplIn.AddWitnessKeys(keyIDs, asset.Signer.Quorum)
 
-	return &txbuilder.BuildResult{
+	br := &txbuilder.BuildResult{
 		Inputs:              []*bc.TxInput{txin},
 		SigningInstructions: []*txbuilder.SigningInstruction{tplIn},
 		MinTimeMS:           bc.Millis(time.Now()),
-	}, nil
+	}
+	if reserved {
+		br.Rollback = func() {
+			err := a.assets.releaseIssuance(ctx, a.AssetID, nonce[:])
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+	return br, nil
 }
@@ -0,0 +1,105 @@
+package asset
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+var (
+	ErrBadDecimals      = errors.New("invalid asset precision")
+	ErrBadDecimalAmount = errors.New("invalid decimal amount")
+)
+
+// decimalsFromDefinition returns the precision declared by the
+// "decimals" field of an asset definition, or 0 if there is none.
+func decimalsFromDefinition(def map[string]interface{}) (int, error) {
+	d, ok := def["decimals"]
+	if !ok {
+		return 0, nil
+	}
+	var f float64
+	switch v := d.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	default:
+		return 0, errors.WithDetailf(ErrBadDecimals, "decimals must be a number, not %T", v)
+	}
+	if f != math.Trunc(f) || f < 0 || f > maxDecimals {
+		return 0, errors.WithDetailf(ErrBadDecimals, "decimals must be an integer between 0 and %d", maxDecimals)
+	}
+	return int(f), nil
+}
+
+// Precision returns the number of decimal places declared in the
+// definition of the given asset. Assets that are unknown to this
+// core, or that declare no precision, have precision 0.
+func (reg *Registry) Precision(ctx context.Context, assetID bc.AssetID) (int, error) {
+	asset, err := reg.findByID(ctx, assetID)
+	if errors.Root(err) == pg.ErrUserInputNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	d, err := decimalsFromDefinition(asset.Definition)
+	if err != nil {
+		// The definition predates precision validation.
+		return 0, nil
+	}
+	return d, nil
+}
+
+// FormatAmount formats amount, in the smallest units of an asset
+// with the given precision, as a decimal string with exactly
+// decimals digits after the decimal point.
+func FormatAmount(amount uint64, decimals int) string {
+	s := strconv.FormatUint(amount, 10)
+	if decimals == 0 {
+		return s
+	}
+	if len(s) <= decimals {
+		s = strings.Repeat("0", decimals-len(s)+1) + s
+	}
+	return s[:len(s)-decimals] + "." + s[len(s)-decimals:]
+}
+
+// ParseAmount parses a decimal string into an amount in the
+// smallest units of an asset with the given precision. The string
+// may have at most decimals digits after the decimal point.
+func ParseAmount(s string, decimals int) (uint64, error) {
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+		if fracPart == "" {
+			return 0, errors.WithDetailf(ErrBadDecimalAmount, "%q has no digits after the decimal point", s)
+		}
+	}
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "%q is not a decimal number", s)
+	}
+	if len(fracPart) > decimals {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "%q has more than %d decimal places", s, decimals)
+	}
+	digits := intPart + fracPart + strings.Repeat("0", decimals-len(fracPart))
+	amount, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, errors.WithDetailf(ErrBadDecimalAmount, "%q is out of range", s)
+	}
+	return amount, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package asset
+
+import (
+	"testing"
+
+	"chain/errors"
+)
+
+func TestFormatAmount(t *testing.T) {
+	cases := []struct {
+		amount   uint64
+		decimals int
+		want     string
+	}{
+		{0, 0, "0"},
+		{1250, 0, "1250"},
+		{1250, 2, "12.50"},
+		{5, 2, "0.05"},
+		{0, 3, "0.000"},
+		{1<<64 - 1, 18, "18.446744073709551615"},
+	}
+	for _, c := range cases {
+		got := FormatAmount(c.amount, c.decimals)
+		if got != c.want {
+			t.Errorf("FormatAmount(%d, %d) = %q want %q", c.amount, c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	cases := []struct {
+		s        string
+		decimals int
+		want     uint64
+		wantErr  error
+	}{
+		{"12.50", 2, 1250, nil},
+		{"12.5", 2, 1250, nil},
+		{"12", 2, 1200, nil},
+		{"0.05", 2, 5, nil},
+		{"007", 0, 7, nil},
+		{"18.446744073709551615", 18, 1<<64 - 1, nil},
+		{"12.505", 2, 0, ErrBadDecimalAmount},
+		{"1.5", 0, 0, ErrBadDecimalAmount},
+		{"12.", 2, 0, ErrBadDecimalAmount},
+		{".5", 2, 0, ErrBadDecimalAmount},
+		{"-1", 2, 0, ErrBadDecimalAmount},
+		{"1e3", 2, 0, ErrBadDecimalAmount},
+		{"", 2, 0, ErrBadDecimalAmount},
+		{"18.446744073709551616", 18, 0, ErrBadDecimalAmount},
+	}
+	for _, c := range cases {
+		got, err := ParseAmount(c.s, c.decimals)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("ParseAmount(%q, %d) error = %v want %v", c.s, c.decimals, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("ParseAmount(%q, %d) = %d want %d", c.s, c.decimals, got, c.want)
+		}
+	}
+}
+
+func TestDecimalsFromDefinition(t *testing.T) {
+	cases := []struct {
+		def     map[string]interface{}
+		want    int
+		wantErr error
+	}{
+		{nil, 0, nil},
+		{map[string]interface{}{"decimals": 2.0}, 2, nil},
+		{map[string]interface{}{"decimals": 18}, 18, nil},
+		{map[string]interface{}{"decimals": 2.5}, 0, ErrBadDecimals},
+		{map[string]interface{}{"decimals": 19.0}, 0, ErrBadDecimals},
+		{map[string]interface{}{"decimals": "2"}, 0, ErrBadDecimals},
+	}
+	for i, c := range cases {
+		got, err := decimalsFromDefinition(c.def)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("case %d: error = %v want %v", i, err, c.wantErr)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("case %d: got %d want %d", i, got, c.want)
+		}
+	}
+}
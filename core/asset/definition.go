@@ -0,0 +1,230 @@
+package asset
+
+import (
+	"context"
+	"database/sql"
+	stdjson "encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/sha3"
+
+	"chain/core/signers"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+var (
+	ErrBadDefinition          = errors.New("invalid asset definition")
+	ErrDefinitionVersion      = errors.New("asset definition version out of sequence")
+	ErrBadDefinitionSignature = errors.New("asset definition is not signed by the issuance keys")
+)
+
+// maxDecimals is the largest number of decimal places whose
+// smallest unit still leaves room for a useful range of uint64
+// amounts.
+const maxDecimals = 18
+
+// A Definition is a versioned metadata document published by the
+// issuer of an asset. Unlike the definition embedded in the
+// issuance program, it can be updated: each new version must be
+// signed by a quorum of the keys in the asset's issuance program,
+// so anyone holding the issuance program can verify it.
+type Definition struct {
+	AssetID       bc.AssetID    `json:"asset_id"`
+	Version       uint64        `json:"version"`
+	Name          string        `json:"name"`
+	Decimals      int           `json:"decimals"`
+	Issuer        string        `json:"issuer"`
+	DocumentsHash json.HexBytes `json:"documents_hash"`
+
+	// Signatures holds one entry for each pubkey in the issuance
+	// program, in the same order. Entries for keys that have not
+	// signed are empty.
+	Signatures []json.HexBytes `json:"signatures"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Hash returns the hash signed by the issuance keys. It covers
+// every field of the document except the signatures and the
+// creation time.
+func (d *Definition) Hash() bc.Hash {
+	doc := struct {
+		AssetID       bc.AssetID    `json:"asset_id"`
+		Version       uint64        `json:"version"`
+		Name          string        `json:"name"`
+		Decimals      int           `json:"decimals"`
+		Issuer        string        `json:"issuer"`
+		DocumentsHash json.HexBytes `json:"documents_hash"`
+	}{d.AssetID, d.Version, d.Name, d.Decimals, d.Issuer, d.DocumentsHash}
+
+	// Marshaling a struct of these types cannot fail.
+	b, _ := stdjson.Marshal(doc)
+	return sha3.Sum256(append([]byte("assetdefinition:"), b...))
+}
+
+func (d *Definition) validate() error {
+	if d.Version == 0 {
+		return errors.WithDetail(ErrBadDefinition, "version must be positive")
+	}
+	if d.Decimals < 0 || d.Decimals > maxDecimals {
+		return errors.WithDetailf(ErrBadDefinition, "decimals must be between 0 and %d", maxDecimals)
+	}
+	return nil
+}
+
+// Verify checks that d is signed by a quorum of the keys in
+// issuanceProgram, which must be the issuance program of the asset
+// d describes.
+func (d *Definition) Verify(issuanceProgram []byte) error {
+	pubkeys, quorum, err := vmutil.ParseP2SPMultiSigProgram(issuanceProgram)
+	if err != nil {
+		return errors.WithDetail(ErrBadDefinitionSignature, "cannot parse issuance program")
+	}
+	if len(d.Signatures) != len(pubkeys) {
+		return errors.WithDetailf(ErrBadDefinitionSignature, "expected %d signatures, got %d", len(pubkeys), len(d.Signatures))
+	}
+	h := d.Hash()
+	var valid int
+	for i, sig := range d.Signatures {
+		if len(sig) == 0 {
+			continue
+		}
+		if !ed25519.Verify(pubkeys[i], h[:], sig) {
+			return errors.WithDetailf(ErrBadDefinitionSignature, "signature %d is invalid", i)
+		}
+		valid++
+	}
+	if valid < quorum {
+		return errors.WithDetailf(ErrBadDefinitionSignature, "%d of %d required signatures", valid, quorum)
+	}
+	return nil
+}
+
+// SignDefinition adds signatures to d from the issuance keys of a
+// locally-defined asset, using signFn for each key in xpubs. Keys
+// signFn cannot sign with are left unsigned.
+func (reg *Registry) SignDefinition(ctx context.Context, d *Definition, xpubs []string, signFn txbuilder.SignFunc) error {
+	asset, err := reg.findByID(ctx, d.AssetID)
+	if err != nil {
+		return errors.Wrap(err, "finding asset")
+	}
+	if asset.Signer == nil {
+		return errors.WithDetail(ErrBadDefinition, "asset was not defined on this core")
+	}
+	err = d.validate()
+	if err != nil {
+		return err
+	}
+
+	if len(d.Signatures) != len(asset.Signer.XPubs) {
+		d.Signatures = make([]json.HexBytes, len(asset.Signer.XPubs))
+	}
+	path := signers.Path(asset.Signer, signers.AssetKeySpace)
+	h := d.Hash()
+	for i, xpub := range asset.Signer.XPubs {
+		if !contains(xpubs, xpub.String()) {
+			continue
+		}
+		sig, err := signFn(ctx, xpub.String(), path, h)
+		if err != nil {
+			return errors.Wrap(err, "computing signature")
+		}
+		if sig != nil {
+			d.Signatures[i] = sig
+		}
+	}
+	return nil
+}
+
+// PublishDefinition verifies d against the issuance program of its
+// asset and stores it as the asset's next version. The first
+// version of a definition is 1.
+func (reg *Registry) PublishDefinition(ctx context.Context, d *Definition) (*Definition, error) {
+	err := d.validate()
+	if err != nil {
+		return nil, err
+	}
+	asset, err := reg.findByID(ctx, d.AssetID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding asset")
+	}
+	decimals, err := decimalsFromDefinition(asset.Definition)
+	if err == nil && d.Decimals != decimals {
+		return nil, errors.WithDetailf(ErrBadDefinition, "decimals must match the asset's declared precision of %d", decimals)
+	}
+	err = d.Verify(asset.IssuanceProgram)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+		INSERT INTO asset_definitions
+			(asset_id, version, name, decimals, issuer, documents_hash, signatures)
+		SELECT $1, $2, $3, $4, $5, $6, $7
+		WHERE $2 = 1 + (SELECT COALESCE(MAX(version), 0) FROM asset_definitions WHERE asset_id=$1)
+		RETURNING created_at
+	`
+	sigs := make(pq.ByteaArray, 0, len(d.Signatures))
+	for _, sig := range d.Signatures {
+		sigs = append(sigs, sig)
+	}
+	err = reg.db.QueryRow(ctx, q,
+		d.AssetID, d.Version, d.Name, d.Decimals, d.Issuer, []byte(d.DocumentsHash), sigs,
+	).Scan(&d.CreatedAt)
+	if err == sql.ErrNoRows || pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetailf(ErrDefinitionVersion, "version %d does not follow the latest published version", d.Version)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "inserting asset definition")
+	}
+	return d, nil
+}
+
+// GetDefinition returns the given version of the definition of an
+// asset, or the latest version if version is 0.
+func (reg *Registry) GetDefinition(ctx context.Context, assetID bc.AssetID, version uint64) (*Definition, error) {
+	const q = `
+		SELECT version, name, decimals, issuer, documents_hash, signatures, created_at
+		FROM asset_definitions
+		WHERE asset_id=$1 AND ($2=0 OR version=$2)
+		ORDER BY version DESC
+		LIMIT 1
+	`
+	var (
+		d    = Definition{AssetID: assetID}
+		sigs pq.ByteaArray
+	)
+	err := reg.db.QueryRow(ctx, q, assetID, version).Scan(
+		&d.Version,
+		&d.Name,
+		&d.Decimals,
+		&d.Issuer,
+		(*[]byte)(&d.DocumentsHash),
+		&sigs,
+		&d.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "asset definition %s version %d", assetID, version)
+	} else if err != nil {
+		return nil, errors.Wrap(err, "loading asset definition")
+	}
+	for _, sig := range sigs {
+		d.Signatures = append(d.Signatures, sig)
+	}
+	return &d, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
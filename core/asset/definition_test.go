@@ -0,0 +1,116 @@
+package asset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg/pgtest"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestDefinitionVerify(t *testing.T) {
+	prv0, pub0, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prv1, pub1, err := chainkd.NewXKeys(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog, err := programWithDefinition(chainkd.XPubKeys([]chainkd.XPub{pub0, pub1}), 2, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &Definition{Version: 1, Name: "USD", Decimals: 2, Issuer: "Acme"}
+	h := d.Hash()
+	sig0, sig1 := prv0.Sign(h[:]), prv1.Sign(h[:])
+
+	cases := []struct {
+		sigs    []json.HexBytes
+		wantErr error
+	}{
+		{[]json.HexBytes{sig0, sig1}, nil},
+		{[]json.HexBytes{sig0, nil}, ErrBadDefinitionSignature},
+		{[]json.HexBytes{sig1, sig0}, ErrBadDefinitionSignature},
+		{[]json.HexBytes{sig0}, ErrBadDefinitionSignature},
+	}
+	for i, c := range cases {
+		d.Signatures = c.sigs
+		err := d.Verify(prog)
+		if errors.Root(err) != c.wantErr {
+			t.Errorf("case %d: got error %v, want %v", i, err, c.wantErr)
+		}
+	}
+
+	// Changing any signed field invalidates the signatures.
+	d.Signatures = []json.HexBytes{sig0, sig1}
+	d.Decimals = 3
+	if errors.Root(d.Verify(prog)) != ErrBadDefinitionSignature {
+		t.Error("expected modified definition to fail verification")
+	}
+}
+
+func TestPublishDefinition(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t))
+	ctx := context.Background()
+
+	keys := []string{testutil.TestXPub.String()}
+	asset, err := r.Define(ctx, keys, 1, map[string]interface{}{"decimals": 2}, "", nil, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+
+	for _, version := range []uint64{1, 2} {
+		d := &Definition{AssetID: asset.AssetID, Version: version, Name: "USD", Decimals: 2}
+		err = r.SignDefinition(ctx, d, keys, signFn)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		_, err = r.PublishDefinition(ctx, d)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	// Versions must be published in sequence.
+	d := &Definition{AssetID: asset.AssetID, Version: 4, Name: "USD", Decimals: 2}
+	err = r.SignDefinition(ctx, d, keys, signFn)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = r.PublishDefinition(ctx, d)
+	if errors.Root(err) != ErrDefinitionVersion {
+		t.Errorf("got error %v, want %v", err, ErrDefinitionVersion)
+	}
+
+	latest, err := r.GetDefinition(ctx, asset.AssetID, 0)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if latest.Version != 2 {
+		t.Errorf("latest version = %d want 2", latest.Version)
+	}
+	first, err := r.GetDefinition(ctx, asset.AssetID, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if first.Version != 1 {
+		t.Errorf("version = %d want 1", first.Version)
+	}
+	if reflect.DeepEqual(first.Signatures, latest.Signatures) {
+		t.Error("expected each version to carry its own signatures")
+	}
+	err = first.Verify(asset.IssuanceProgram)
+	if err != nil {
+		t.Errorf("stored definition does not verify: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package asset
+
+import (
+	"context"
+	"time"
+
+	"chain/database/pg"
+	"chain/database/sql"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// reserveIssuance counts amount units of an asset toward its
+// issuance cap while an issuance with the given nonce is pending,
+// until exp, when the transaction can no longer land. It returns
+// ErrIssuanceCap if the units already issued, plus those reserved,
+// plus amount would exceed the cap, and reports whether it made a
+// reservation; an asset without a cap needs none.
+//
+// The check and the reservation happen under a lock on the asset's
+// row, so concurrent issuances can't both fit under the cap. The
+// reservation is released by releaseIssuance, or by indexSupply
+// when the issuance lands in a block.
+func (reg *Registry) reserveIssuance(ctx context.Context, id bc.AssetID, nonce []byte, amount uint64, exp time.Time) (bool, error) {
+	db, commit := reg.db, func(context.Context) error { return nil }
+	// If reg.db is already a database transaction, as in tests,
+	// the reservation is made in it.
+	if b, ok := reg.db.(interface {
+		Begin(context.Context) (*sql.Tx, error)
+	}); ok {
+		dbtx, err := b.Begin(ctx)
+		if err != nil {
+			return false, errors.Wrap(err, "begin transaction")
+		}
+		defer dbtx.Rollback(ctx)
+		db, commit = dbtx, dbtx.Commit
+	}
+
+	const (
+		lockQ = `
+			SELECT issuance_cap IS NOT NULL, COALESCE(issuance_cap, 0)
+			FROM assets WHERE id=$1 FOR UPDATE
+		`
+		expireQ = `DELETE FROM pending_issuances WHERE asset_id=$1 AND expires_at <= NOW()`
+		sumQ    = `
+			SELECT COALESCE((SELECT issued FROM asset_supply WHERE asset_id=$1), 0),
+				COALESCE((SELECT SUM(amount) FROM pending_issuances WHERE asset_id=$1), 0)::bigint
+		`
+		insertQ = `
+			INSERT INTO pending_issuances (asset_id, nonce, amount, expires_at)
+			VALUES ($1, $2, $3, $4)
+		`
+	)
+	var (
+		capped      bool
+		issuanceCap uint64
+	)
+	err := db.QueryRow(ctx, lockQ, id).Scan(&capped, &issuanceCap)
+	if err == sql.ErrNoRows {
+		return false, errors.WithDetailf(pg.ErrUserInputNotFound, "missing asset with ID %q", id)
+	} else if err != nil {
+		return false, errors.Wrap(err, "locking asset")
+	}
+	if !capped {
+		return false, nil
+	}
+
+	_, err = db.Exec(ctx, expireQ, id)
+	if err != nil {
+		return false, errors.Wrap(err, "expiring pending issuances")
+	}
+	var issued, pending uint64
+	err = db.QueryRow(ctx, sumQ, id).Scan(&issued, &pending)
+	if err != nil {
+		return false, errors.Wrap(err, "querying asset supply")
+	}
+	total := issued + pending + amount
+	if total > issuanceCap || total < amount {
+		return false, errors.WithDetailf(ErrIssuanceCap,
+			"issuing %d units would exceed the cap of %d (%d already issued, %d pending)",
+			amount, issuanceCap, issued, pending)
+	}
+
+	_, err = db.Exec(ctx, insertQ, id, nonce, amount, exp)
+	if err != nil {
+		return false, errors.Wrap(err, "reserving issuance")
+	}
+	err = commit(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "commit transaction")
+	}
+	return true, nil
+}
+
+// releaseIssuance releases the reservation made by reserveIssuance
+// for the issuance with the given nonce.
+func (reg *Registry) releaseIssuance(ctx context.Context, id bc.AssetID, nonce []byte) error {
+	const q = `DELETE FROM pending_issuances WHERE asset_id=$1 AND nonce=$2`
+	_, err := reg.db.Exec(ctx, q, id, nonce)
+	return errors.Wrap(err, "releasing pending issuance")
+}
@@ -0,0 +1,185 @@
+package asset
+
+import (
+	"context"
+	"database/sql"
+	"math"
+
+	"github.com/lib/pq"
+
+	"chain/database/pg"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+var (
+	// ErrBadIssuanceCap is returned when an issuance cap
+	// cannot be represented as a transaction amount.
+	ErrBadIssuanceCap = errors.New("invalid issuance cap")
+
+	// ErrIssuanceCap is returned when building an issue action
+	// would take an asset's supply past its issuance cap.
+	ErrIssuanceCap = errors.New("issuance cap exceeded")
+)
+
+// Supply is the amount of an asset in existence, as of the
+// most recent block processed by the asset indexer.
+// Retired units are those sent to unspendable control programs.
+type Supply struct {
+	AssetID     bc.AssetID `json:"asset_id"`
+	Issued      uint64     `json:"issued"`
+	Retired     uint64     `json:"retired"`
+	Outstanding uint64     `json:"outstanding"`
+	IssuanceCap *uint64    `json:"issuance_cap"`
+	BlockHeight uint64     `json:"block_height"`
+}
+
+// Supply returns the supply of the asset with the given ID.
+func (reg *Registry) Supply(ctx context.Context, id bc.AssetID) (*Supply, error) {
+	supplies, err := reg.Supplies(ctx, []bc.AssetID{id})
+	if err != nil {
+		return nil, err
+	}
+	s, ok := supplies[id]
+	if !ok {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "missing asset with ID %q", id)
+	}
+	return s, nil
+}
+
+// Supplies returns the supplies of the assets with the given IDs,
+// keyed by asset ID. Unknown assets are omitted.
+func (reg *Registry) Supplies(ctx context.Context, ids []bc.AssetID) (map[bc.AssetID]*Supply, error) {
+	var height uint64
+	if reg.pinStore != nil {
+		height = reg.pinStore.Pin(PinName).Height()
+	}
+
+	idStrs := make(pq.StringArray, 0, len(ids))
+	for _, id := range ids {
+		idStrs = append(idStrs, id.String())
+	}
+	const q = `
+		SELECT assets.id, COALESCE(asset_supply.issued, 0), COALESCE(asset_supply.retired, 0),
+			assets.issuance_cap
+		FROM assets
+		LEFT JOIN asset_supply ON asset_supply.asset_id=assets.id
+		WHERE assets.id=ANY($1::text[])
+	`
+	supplies := make(map[bc.AssetID]*Supply, len(ids))
+	err := pg.ForQueryRows(ctx, reg.db, q, idStrs, func(id bc.AssetID, issued, retired uint64, issuanceCap sql.NullInt64) {
+		s := &Supply{
+			AssetID:     id,
+			Issued:      issued,
+			Retired:     retired,
+			BlockHeight: height,
+		}
+		if issued > retired {
+			s.Outstanding = issued - retired
+		}
+		if issuanceCap.Valid {
+			c := uint64(issuanceCap.Int64)
+			s.IssuanceCap = &c
+		}
+		supplies[id] = s
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "querying asset supply")
+	}
+	return supplies, nil
+}
+
+// SetIssuanceCap sets the maximum number of units of an asset
+// that may ever be issued by transactions built on this Core.
+// A nil cap removes any existing cap.
+//
+// The cap is checked against the supply issued in blocks the
+// asset indexer has processed, plus the issuances this Core has
+// built that are still pending. It is a Core-side safeguard,
+// not a consensus rule; see the issuance_cap block policy for
+// a limit enforced by block signers.
+func (reg *Registry) SetIssuanceCap(ctx context.Context, id bc.AssetID, issuanceCap *uint64) error {
+	var param sql.NullInt64
+	if issuanceCap != nil {
+		if *issuanceCap > math.MaxInt64 {
+			return errors.WithDetailf(ErrBadIssuanceCap, "issuance cap must be at most %d", int64(math.MaxInt64))
+		}
+		param = sql.NullInt64{Int64: int64(*issuanceCap), Valid: true}
+	}
+	const q = `UPDATE assets SET issuance_cap=$2 WHERE id=$1`
+	res, err := reg.db.Exec(ctx, q, id, param)
+	if err != nil {
+		return errors.Wrap(err, "setting issuance cap")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(pg.ErrUserInputNotFound, "missing asset with ID %q", id)
+	}
+	return nil
+}
+
+// indexSupply adds the amounts issued and retired in b
+// to the asset_supply table, and releases the reservations of
+// pending issuances that landed in b.
+func (reg *Registry) indexSupply(ctx context.Context, b *bc.Block) error {
+	var (
+		assetIDs        pq.StringArray
+		issued, retired pq.Int64Array
+		nonceAssetIDs   pq.StringArray
+		nonces          pq.ByteaArray
+	)
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			if !in.IsIssuance() {
+				continue
+			}
+			assetIDs = append(assetIDs, in.AssetID().String())
+			issued = append(issued, int64(in.Amount()))
+			retired = append(retired, 0)
+			if ii, ok := in.TypedInput.(*bc.IssuanceInput); ok {
+				nonceAssetIDs = append(nonceAssetIDs, in.AssetID().String())
+				nonces = append(nonces, ii.Nonce)
+			}
+		}
+		for _, out := range tx.Outputs {
+			if !vmutil.IsUnspendable(out.ControlProgram) {
+				continue
+			}
+			assetIDs = append(assetIDs, out.AssetID.String())
+			issued = append(issued, 0)
+			retired = append(retired, int64(out.Amount))
+		}
+	}
+	if len(assetIDs) == 0 {
+		return nil
+	}
+
+	// The block_height condition makes this idempotent: if the
+	// pin is not raised after a block is indexed (because of a
+	// crash, say), indexing the same block again has no effect.
+	// Releasing reservations in the same statement keeps the
+	// issued and pending amounts consistent for reserveIssuance.
+	const q = `
+		WITH released AS (
+			DELETE FROM pending_issuances
+			WHERE (asset_id, nonce) IN (
+				SELECT * FROM unnest($5::text[], $6::bytea[])
+			)
+		)
+		INSERT INTO asset_supply (asset_id, issued, retired, block_height)
+		SELECT asset_id, SUM(issued), SUM(retired), $4
+		FROM unnest($1::text[], $2::bigint[], $3::bigint[]) AS t(asset_id, issued, retired)
+		GROUP BY asset_id
+		ON CONFLICT (asset_id) DO UPDATE
+			SET issued = asset_supply.issued + excluded.issued,
+				retired = asset_supply.retired + excluded.retired,
+				block_height = excluded.block_height
+			WHERE asset_supply.block_height < excluded.block_height
+	`
+	_, err := reg.db.Exec(ctx, q, assetIDs, issued, retired, b.Height, nonceAssetIDs, nonces)
+	return errors.Wrap(err, "updating asset supply")
+}
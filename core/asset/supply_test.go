@@ -0,0 +1,132 @@
+package asset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/protocol/vm"
+	"chain/testutil"
+)
+
+func TestIndexSupply(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t))
+	ctx := context.Background()
+
+	a, err := r.Define(ctx, []string{testutil.TestXPub.String()}, 1, nil, "", nil, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	issue := bc.NewIssuanceInput(nil, 100, nil, r.initialBlockHash, a.IssuanceProgram, nil)
+	b := &bc.Block{
+		BlockHeader: bc.BlockHeader{Height: 2},
+		Transactions: []*bc.Tx{
+			bc.NewTx(bc.TxData{
+				Inputs: []*bc.TxInput{issue},
+				Outputs: []*bc.TxOutput{
+					bc.NewTxOutput(a.AssetID, 70, []byte{byte(vm.OP_TRUE)}, nil),
+					bc.NewTxOutput(a.AssetID, 30, []byte{byte(vm.OP_FAIL)}, nil),
+				},
+			}),
+			bc.NewTx(bc.TxData{Inputs: []*bc.TxInput{issue}}),
+		},
+	}
+
+	// Indexing the same block twice must count it once.
+	for i := 0; i < 2; i++ {
+		err = r.indexSupply(ctx, b)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	got, err := r.Supply(ctx, a.AssetID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	want := &Supply{
+		AssetID:     a.AssetID,
+		Issued:      200,
+		Retired:     30,
+		Outstanding: 170,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Supply() = %+v want %+v", got, want)
+	}
+}
+
+func TestIssuanceCap(t *testing.T) {
+	r := NewRegistry(pgtest.NewTx(t), prottest.NewChain(t))
+	ctx := context.Background()
+
+	a, err := r.Define(ctx, []string{testutil.TestXPub.String()}, 1, nil, "", nil, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	issuanceCap := uint64(100)
+	err = r.SetIssuanceCap(ctx, a.AssetID, &issuanceCap)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	issue := bc.NewIssuanceInput(nil, 60, nil, r.initialBlockHash, a.IssuanceProgram, nil)
+	err = r.indexSupply(ctx, &bc.Block{
+		BlockHeader:  bc.BlockHeader{Height: 2},
+		Transactions: []*bc.Tx{bc.NewTx(bc.TxData{Inputs: []*bc.TxInput{issue}})},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	maxTime := time.Now().Add(time.Minute)
+	res, err := r.NewIssueAction(bc.AssetAmount{AssetID: a.AssetID, Amount: 20}, nil).Build(ctx, maxTime)
+	if err != nil {
+		t.Errorf("issuing under the cap: %v", err)
+	}
+	// The first issuance is pending, so it counts toward the cap.
+	_, err = r.NewIssueAction(bc.AssetAmount{AssetID: a.AssetID, Amount: 21}, nil).Build(ctx, maxTime)
+	if errors.Root(err) != ErrIssuanceCap {
+		t.Errorf("issuing past the cap with a pending issuance: got error %v want %v", err, ErrIssuanceCap)
+	}
+	res.Rollback()
+	res, err = r.NewIssueAction(bc.AssetAmount{AssetID: a.AssetID, Amount: 40}, nil).Build(ctx, maxTime)
+	if err != nil {
+		t.Errorf("issuing up to the cap after a rollback: %v", err)
+	}
+
+	// Once the issuance lands in a block, it counts as issued
+	// instead of pending.
+	err = r.indexSupply(ctx, &bc.Block{
+		BlockHeader:  bc.BlockHeader{Height: 3},
+		Transactions: []*bc.Tx{bc.NewTx(bc.TxData{Inputs: res.Inputs})},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = r.NewIssueAction(bc.AssetAmount{AssetID: a.AssetID, Amount: 1}, nil).Build(ctx, maxTime)
+	if errors.Root(err) != ErrIssuanceCap {
+		t.Errorf("issuing past the cap: got error %v want %v", err, ErrIssuanceCap)
+	}
+	var pending int
+	err = r.db.QueryRow(ctx, `SELECT COUNT(*) FROM pending_issuances`).Scan(&pending)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if pending != 0 {
+		t.Errorf("got %d pending issuances after indexing want 0", pending)
+	}
+
+	err = r.SetIssuanceCap(ctx, a.AssetID, nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	_, err = r.NewIssueAction(bc.AssetAmount{AssetID: a.AssetID, Amount: 41}, nil).Build(ctx, maxTime)
+	if err != nil {
+		t.Errorf("issuing without a cap: %v", err)
+	}
+}
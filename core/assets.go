@@ -4,21 +4,26 @@ import (
 	"context"
 	"sync"
 
+	"chain/core/asset"
 	"chain/core/signers"
 	"chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
 	"chain/net/http/reqid"
+	"chain/protocol/bc"
 )
 
 // This type enforces JSON field ordering in API output.
 type assetResponse struct {
-	ID              interface{} `json:"id"`
-	Alias           *string     `json:"alias"`
-	IssuanceProgram interface{} `json:"issuance_program"`
-	Keys            interface{} `json:"keys"`
-	Quorum          interface{} `json:"quorum"`
-	Definition      interface{} `json:"definition"`
-	Tags            interface{} `json:"tags"`
-	IsLocal         interface{} `json:"is_local"`
+	ID              interface{}   `json:"id"`
+	Alias           *string       `json:"alias"`
+	IssuanceProgram interface{}   `json:"issuance_program"`
+	Keys            interface{}   `json:"keys"`
+	Quorum          interface{}   `json:"quorum"`
+	Definition      interface{}   `json:"definition"`
+	Tags            interface{}   `json:"tags"`
+	IsLocal         interface{}   `json:"is_local"`
+	Supply          *asset.Supply `json:"supply,omitempty"`
 }
 
 type assetKey struct {
@@ -35,6 +40,10 @@ func (h *Handler) createAsset(ctx context.Context, ins []struct {
 	Definition map[string]interface{}
 	Tags       map[string]interface{}
 
+	// IssuanceCap, if set, limits the total amount of the
+	// asset that this Core will build issuances for.
+	IssuanceCap *uint64 `json:"issuance_cap"`
+
 	// ClientToken is the application's unique token for the asset. Every asset
 	// should have a unique client token. The client token is used to ensure
 	// idempotency of create asset requests. Duplicate create asset requests
@@ -64,6 +73,18 @@ func (h *Handler) createAsset(ctx context.Context, ins []struct {
 				responses[i] = err
 				return
 			}
+			if ins[i].IssuanceCap != nil {
+				err = h.Assets.SetIssuanceCap(subctx, asset.AssetID, ins[i].IssuanceCap)
+				if err != nil {
+					responses[i] = err
+					return
+				}
+			}
+			supply, err := h.Assets.Supply(subctx, asset.AssetID)
+			if err != nil {
+				responses[i] = err
+				return
+			}
 			var keys []assetKey
 			for _, xpub := range asset.Signer.XPubs {
 				path := signers.Path(asset.Signer, signers.AssetKeySpace)
@@ -83,10 +104,82 @@ func (h *Handler) createAsset(ctx context.Context, ins []struct {
 				Definition:      asset.Definition,
 				Tags:            asset.Tags,
 				IsLocal:         "yes",
+				Supply:          supply,
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return responses, nil
+}
+
+// POST /publish-asset-definition
+func (h *Handler) publishAssetDefinition(ctx context.Context, defs []*asset.Definition) ([]interface{}, error) {
+	responses := make([]interface{}, len(defs))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			def, err := h.Assets.PublishDefinition(subctx, defs[i])
+			if err != nil {
+				responses[i] = err
+				return
 			}
+			responses[i] = def
 		}(i)
 	}
 
 	wg.Wait()
 	return responses, nil
 }
+
+// POST /get-asset-definition
+//
+// Version selects a published version of the definition;
+// if it is omitted, the latest version is returned.
+func (h *Handler) getAssetDefinition(ctx context.Context, in struct {
+	AssetID    *bc.AssetID `json:"asset_id"`
+	AssetAlias string      `json:"asset_alias"`
+	Version    uint64      `json:"version"`
+}) (*asset.Definition, error) {
+	var assetID bc.AssetID
+	switch {
+	case in.AssetID != nil:
+		assetID = *in.AssetID
+	case in.AssetAlias != "":
+		a, err := h.Assets.FindByAlias(ctx, in.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding asset")
+		}
+		assetID = a.AssetID
+	default:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id or asset_alias is required")
+	}
+	return h.Assets.GetDefinition(ctx, assetID, in.Version)
+}
+
+// POST /get-asset-supply
+func (h *Handler) getAssetSupply(ctx context.Context, in struct {
+	AssetID    *bc.AssetID `json:"asset_id"`
+	AssetAlias string      `json:"asset_alias"`
+}) (*asset.Supply, error) {
+	var assetID bc.AssetID
+	switch {
+	case in.AssetID != nil:
+		assetID = *in.AssetID
+	case in.AssetAlias != "":
+		a, err := h.Assets.FindByAlias(ctx, in.AssetAlias)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding asset")
+		}
+		assetID = a.AssetID
+	default:
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "asset_id or asset_alias is required")
+	}
+	return h.Assets.Supply(ctx, assetID)
+}
@@ -4,32 +4,58 @@ package blocksigner
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
+	"sync"
+	"time"
 
+	"chain/core/failover"
 	"chain/core/mockhsm"
 	"chain/crypto/ed25519"
+	"chain/crypto/sha3pool"
 	"chain/database/pg"
+	"chain/database/sql"
 	"chain/errors"
+	"chain/net/http/reqid"
 	"chain/protocol"
 	"chain/protocol/bc"
+	"chain/protocol/vmutil"
 )
 
 // ErrConsensusChange is returned from ValidateAndSignBlock
-// when a new consensus program is detected.
+// when a new consensus program is detected that this
+// signer has not approved for the block's height.
 var ErrConsensusChange = errors.New("consensus program has changed")
 
+// ErrBadConsensusProgram is returned from ApproveConsensusProgram
+// when the proposed program is not a valid block multisig program
+// or its height has passed.
+var ErrBadConsensusProgram = errors.New("invalid consensus program proposal")
+
 // ErrInvalidKey is returned from SignBlock when the
 // key specified on the Signer is invalid. It may be
 // not found by the mock HSM or not paired to a valid
 // private key.
 var ErrInvalidKey = errors.New("misconfigured signer public key")
 
+// ErrNotActiveGenerator is returned from ValidateAndSignBlock when
+// the block comes from a backup generator that may not yet take over
+// from the generator whose blocks this signer last signed, or from
+// a Core that isn't one of the generators at all.
+var ErrNotActiveGenerator = errors.New("block is not from the active generator")
+
 // Signer validates and signs blocks.
 type Signer struct {
 	Pub ed25519.PublicKey
 	hsm *mockhsm.HSM
 	db  pg.DB
 	c   *protocol.Chain
+
+	mu        sync.Mutex // protects generator, backups, timeout, and policies
+	generator string
+	backups   []string
+	timeout   time.Duration
+	policies  []BlockPolicy
 }
 
 // New returns a new Signer that validates blocks with c and signs
@@ -43,6 +69,27 @@ func New(pub ed25519.PublicKey, hsm *mockhsm.HSM, db pg.DB, c *protocol.Chain) *
 	}
 }
 
+// SetFailover sets the core IDs of the generator and of the backup
+// generators, in order, and the failover timeout. With no backups,
+// the signer signs blocks from any generator. It is safe to call
+// while s is signing blocks.
+func (s *Signer) SetFailover(generator string, backups []string, timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generator = generator
+	s.backups = backups
+	s.timeout = timeout
+}
+
+// SetPolicies sets the block policies that s applies to each
+// block before signing it. It is safe to call while s is signing
+// blocks.
+func (s *Signer) SetPolicies(policies []BlockPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.policies = policies
+}
+
 // SignBlock computes the signature for the block using
 // the private key in s.  It does not validate the block.
 func (s *Signer) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
@@ -63,7 +110,7 @@ func (s *Signer) String() string {
 // is used as the httpjson handler for /rpc/signer/sign-block.
 //
 // This function fails if this node has ever signed a different block at the
-// same height as b.
+// same height as b, or if one of the signer's block policies refuses b.
 func (s *Signer) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
 	err := <-s.c.WaitForBlockSoon(ctx, b.Height-1)
 	if err != nil {
@@ -71,21 +118,48 @@ func (s *Signer) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte,
 	}
 	prev, err := s.c.GetBlock(ctx, b.Height-1)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting block at height %d", b.Height-1)
-	}
-	// TODO: Add the ability to change the consensus program
-	// by having a current consensus program, and a potential
-	// next consensus program. Once the next consensus program
-	// has been used, it will become the current consensus program
-	// and the only signable consensus program until a new
-	// next is set.
+		return nil, errors.Wrapf(err, "getting block at height %d", b.Height-1)
+	}
+	// The consensus program can change only at a height
+	// for which we approved the new program.
 	if !bytes.Equal(b.ConsensusProgram, prev.ConsensusProgram) {
-		return nil, errors.Wrap(ErrConsensusChange)
+		approved, err := approvedProgram(ctx, s.db, b.Height)
+		if err != nil {
+			return nil, errors.Wrap(err, "checking consensus program approval")
+		}
+		if !bytes.Equal(b.ConsensusProgram, approved) {
+			return nil, errors.Wrap(ErrConsensusChange)
+		}
 	}
 	err = s.c.ValidateBlockForSig(ctx, b)
 	if err != nil {
 		return nil, errors.Wrap(err, "validating block for signature")
 	}
+	rank, err := s.generatorRank(reqid.CoreIDFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return s.lockAndSign(ctx, rank, b)
+}
+
+// SignOwnBlock signs a block made by the generator in this Core,
+// of the given rank among the generators. The generator has already
+// validated the block, but the signer still applies its block
+// policies and the failover rule, and still signs only one block
+// at each height.
+func (s *Signer) SignOwnBlock(ctx context.Context, rank int, b *bc.Block) ([]byte, error) {
+	return s.lockAndSign(ctx, rank, b)
+}
+
+func (s *Signer) lockAndSign(ctx context.Context, rank int, b *bc.Block) ([]byte, error) {
+	err := s.checkPolicies(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	err = s.checkGenerator(ctx, rank)
+	if err != nil {
+		return nil, err
+	}
 	err = lockBlockHeight(ctx, s.db, b)
 	if err != nil {
 		return nil, errors.Wrap(err, "lock block height")
@@ -93,6 +167,78 @@ func (s *Signer) ValidateAndSignBlock(ctx context.Context, b *bc.Block) ([]byte,
 	return s.SignBlock(ctx, b)
 }
 
+// generatorRank returns the rank of the generator with the given
+// core ID: 0 for the generator, and i+1 for the i'th backup
+// generator. With failover configured, any other core ID, including
+// none, is an error. Without it, every request has rank 0.
+// The core ID comes from the Chain-Core-ID header of the request.
+// Only Cores with a signer's access token can make the request,
+// so the header is trusted here.
+func (s *Signer) generatorRank(coreID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.backups) == 0 {
+		return 0, nil
+	}
+	if coreID != "" {
+		if coreID == s.generator {
+			return 0, nil
+		}
+		for i, id := range s.backups {
+			if id == coreID {
+				return i + 1, nil
+			}
+		}
+	}
+	return 0, errors.WithDetailf(ErrNotActiveGenerator, "core ID %q is not one of the generators", coreID)
+}
+
+// checkGenerator applies the failover rule to a request to sign a
+// block from the generator of the given rank, and records the
+// request. The signer keeps signing for the generator it last signed
+// for. It switches to a generator at distance d after it, in the
+// ring of generators, only when it has signed nothing for d failover
+// timeouts.
+func (s *Signer) checkGenerator(ctx context.Context, rank int) error {
+	s.mu.Lock()
+	n, timeout := len(s.backups)+1, s.timeout
+	s.mu.Unlock()
+	if n == 1 {
+		return nil
+	}
+
+	const selectQ = `
+		SELECT rank, (EXTRACT(EPOCH FROM NOW() - last_signed_at) * 1000)::bigint
+		FROM signer_generator
+	`
+	var (
+		prev      = rank
+		silenceMS int64
+	)
+	err := s.db.QueryRow(ctx, selectQ).Scan(&prev, &silenceMS)
+	if err != nil && err != sql.ErrNoRows {
+		return errors.Wrap(err, "loading active generator")
+	}
+	silence := time.Duration(silenceMS) * time.Millisecond
+	if d := failover.Distance(prev, rank, n); silence < time.Duration(d)*timeout {
+		return errors.WithDetailf(ErrNotActiveGenerator, "generator of rank %d may not take over from rank %d yet", rank, prev)
+	}
+
+	// Record the request, unless another one changed
+	// the active generator in the meantime.
+	const updateQ = `
+		INSERT INTO signer_generator (rank, last_signed_at) VALUES ($1, NOW())
+		ON CONFLICT (singleton) DO UPDATE SET rank = $1, last_signed_at = NOW()
+		WHERE signer_generator.rank = $2
+		RETURNING rank
+	`
+	err = s.db.QueryRow(ctx, updateQ, rank, prev).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return errors.WithDetailf(ErrNotActiveGenerator, "generator of rank %d lost a race to take over", rank)
+	}
+	return errors.Wrap(err, "recording active generator")
+}
+
 // lockBlockHeight records a signer's intention to sign a given block
 // at a given height.  It's an error if a different block at the same
 // height has previously been signed.
@@ -106,3 +252,69 @@ func lockBlockHeight(ctx context.Context, db pg.DB, b *bc.Block) error {
 	_, err := db.Exec(ctx, q, b.Height, b.HashForSig())
 	return err
 }
+
+// RotationHash returns the hash signed to approve a change of
+// consensus program on the blockchain with the given ID, taking
+// effect in the block at the given height. That block is the first
+// to carry the new program, so the blocks after it must satisfy it.
+func RotationHash(blockchainID bc.Hash, height uint64, program []byte) (h bc.Hash) {
+	var heightBuf [8]byte
+	binary.BigEndian.PutUint64(heightBuf[:], height)
+
+	var msg []byte
+	msg = append(msg, "consensus program rotation"...)
+	msg = append(msg, blockchainID[:]...)
+	msg = append(msg, heightBuf[:]...)
+	msg = append(msg, program...)
+	sha3pool.Sum256(h[:], msg)
+	return h
+}
+
+// ApproveConsensusProgram records this signer's approval of program
+// as the consensus program of the block at the given height, and
+// returns a signature over its RotationHash. Approving a program
+// for a height replaces any earlier approval for it; the signer
+// signs a block at that height carrying a new program only if it
+// is the one approved last.
+//
+// Approval is up to the signer's operator, so it is not exposed to
+// other Cores; see /approve-consensus-program.
+func (s *Signer) ApproveConsensusProgram(ctx context.Context, height uint64, program []byte) ([]byte, error) {
+	_, _, err := vmutil.ParseBlockMultiSigProgram(program)
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadConsensusProgram, err.Error())
+	}
+	if height <= s.c.Height() {
+		return nil, errors.WithDetailf(ErrBadConsensusProgram, "height %d has already passed", height)
+	}
+
+	const q = `
+		INSERT INTO signer_consensus_approvals (block_height, consensus_program)
+		VALUES ($1, $2)
+		ON CONFLICT (block_height) DO UPDATE
+			SET consensus_program = $2, approved_at = now()
+	`
+	_, err = s.db.Exec(ctx, q, height, program)
+	if err != nil {
+		return nil, errors.Wrap(err, "recording approval")
+	}
+
+	hash := RotationHash(s.c.InitialBlockHash, height, program)
+	sig, err := s.hsm.Sign(ctx, s.Pub, hash[:])
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidKey, "err=%s", err.Error())
+	}
+	return sig, nil
+}
+
+// approvedProgram returns the consensus program approved for the
+// block at height, or nil if there is none.
+func approvedProgram(ctx context.Context, db pg.DB, height uint64) ([]byte, error) {
+	const q = `SELECT consensus_program FROM signer_consensus_approvals WHERE block_height = $1`
+	var program []byte
+	err := db.QueryRow(ctx, q, height).Scan(&program)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return program, err
+}
@@ -0,0 +1,37 @@
+package blocksigner
+
+import (
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestGeneratorRank(t *testing.T) {
+	s := new(Signer)
+	rank, err := s.generatorRank("")
+	if err != nil || rank != 0 {
+		t.Errorf("generatorRank without failover = %d, %v want 0, nil", rank, err)
+	}
+
+	s.SetFailover("gen", []string{"backup1", "backup2"}, time.Minute)
+	cases := []struct {
+		coreID string
+		rank   int
+		err    error
+	}{
+		{"gen", 0, nil},
+		{"backup1", 1, nil},
+		{"backup2", 2, nil},
+		{"other", 0, ErrNotActiveGenerator},
+		{"", 0, ErrNotActiveGenerator},
+	}
+	for _, c := range cases {
+		rank, err := s.generatorRank(c.coreID)
+		if errors.Root(err) != c.err {
+			t.Errorf("generatorRank(%q) err = %v want %v", c.coreID, err, c.err)
+		} else if err == nil && rank != c.rank {
+			t.Errorf("generatorRank(%q) = %d want %d", c.coreID, rank, c.rank)
+		}
+	}
+}
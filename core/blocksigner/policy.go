@@ -0,0 +1,162 @@
+package blocksigner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"chain/core/config"
+	"chain/core/rpc"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// ErrPolicyRefusal is returned from ValidateAndSignBlock when
+// one of the signer's block policies refuses a valid block.
+// The error's data holds the Refusal, under the key "refusal".
+var ErrPolicyRefusal = errors.New("block refused by signing policy")
+
+// A BlockPolicy applies a block signer's own rules, beyond
+// validity, to the blocks it is asked to sign.
+type BlockPolicy interface {
+	// Name identifies the policy in refusals.
+	Name() string
+
+	// CheckBlock returns a refusal if the signer must not sign b,
+	// or nil if it may. An error means the check itself failed.
+	CheckBlock(ctx context.Context, b *bc.Block) (*Refusal, error)
+}
+
+// A Refusal is a block policy's reason for refusing to sign a block.
+type Refusal struct {
+	Policy string   `json:"policy"`
+	Reason string   `json:"reason"`
+	TxID   *bc.Hash `json:"transaction_id,omitempty"`
+}
+
+func (r *Refusal) String() string {
+	if r.TxID != nil {
+		return fmt.Sprintf("%s: transaction %s: %s", r.Policy, r.TxID, r.Reason)
+	}
+	return fmt.Sprintf("%s: %s", r.Policy, r.Reason)
+}
+
+// RefusalOf returns the Refusal carried by err, from a local
+// signer's ErrPolicyRefusal or from a remote signer's error
+// response, or nil if err isn't a refusal.
+func RefusalOf(err error) *Refusal {
+	if r, ok := errors.Data(err)["refusal"].(*Refusal); ok {
+		return r
+	}
+	resp := rpc.Response(err)
+	if resp == nil || resp.Data["refusal"] == nil {
+		return nil
+	}
+	data, err := json.Marshal(resp.Data["refusal"])
+	if err != nil {
+		return nil
+	}
+	r := new(Refusal)
+	if json.Unmarshal(data, r) != nil {
+		return nil
+	}
+	return r
+}
+
+// NewPolicies returns the built-in block policies set up by
+// a Core's configuration.
+func NewPolicies(configs []config.BlockPolicy) []BlockPolicy {
+	var policies []BlockPolicy
+	for _, c := range configs {
+		switch c.Type {
+		case config.PolicySanctionedPrograms:
+			p := sanctionedPrograms(make(map[string]bool))
+			for _, prog := range c.ControlPrograms {
+				p[string(prog)] = true
+			}
+			policies = append(policies, p)
+		case config.PolicyIssuanceCap:
+			policies = append(policies, &issuanceCap{assetID: *c.AssetID, max: c.MaxAmount})
+		}
+	}
+	return policies
+}
+
+// CheckBlock applies s's block policies to b without signing it,
+// so that a generator can leave refused transactions out of a block
+// before any signer is committed to it. It returns ErrPolicyRefusal
+// if a policy refuses b.
+func (s *Signer) CheckBlock(ctx context.Context, b *bc.Block) error {
+	return s.checkPolicies(ctx, b)
+}
+
+// checkPolicies applies s's block policies to b.
+func (s *Signer) checkPolicies(ctx context.Context, b *bc.Block) error {
+	s.mu.Lock()
+	policies := s.policies
+	s.mu.Unlock()
+	for _, p := range policies {
+		r, err := p.CheckBlock(ctx, b)
+		if err != nil {
+			return errors.Wrapf(err, "checking block policy %s", p.Name())
+		}
+		if r != nil {
+			r.Policy = p.Name()
+			err = errors.WithDetail(ErrPolicyRefusal, r.String())
+			return errors.WithData(err, "refusal", r)
+		}
+	}
+	return nil
+}
+
+// sanctionedPrograms refuses blocks with transactions that spend
+// from or pay to any of a set of control programs.
+type sanctionedPrograms map[string]bool
+
+func (p sanctionedPrograms) Name() string { return config.PolicySanctionedPrograms }
+
+func (p sanctionedPrograms) CheckBlock(ctx context.Context, b *bc.Block) (*Refusal, error) {
+	for _, tx := range b.Transactions {
+		for i, in := range tx.Inputs {
+			if p[string(in.ControlProgram())] {
+				return txRefusal(tx, "input %d spends from a sanctioned control program", i), nil
+			}
+		}
+		for i, out := range tx.Outputs {
+			if p[string(out.ControlProgram)] {
+				return txRefusal(tx, "output %d pays to a sanctioned control program", i), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// issuanceCap refuses blocks that issue more than max units
+// of an asset.
+type issuanceCap struct {
+	assetID bc.AssetID
+	max     uint64
+}
+
+func (p *issuanceCap) Name() string { return config.PolicyIssuanceCap }
+
+func (p *issuanceCap) CheckBlock(ctx context.Context, b *bc.Block) (*Refusal, error) {
+	var total uint64
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			if !in.IsIssuance() || in.AssetID() != p.assetID {
+				continue
+			}
+			total += in.Amount()
+			if total > p.max || total < in.Amount() {
+				return txRefusal(tx, "block issues more than %d units of asset %s", p.max, p.assetID), nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func txRefusal(tx *bc.Tx, format string, args ...interface{}) *Refusal {
+	id := tx.Hash
+	return &Refusal{Reason: fmt.Sprintf(format, args...), TxID: &id}
+}
@@ -0,0 +1,73 @@
+package blocksigner
+
+import (
+	"context"
+	"testing"
+
+	"chain/core/config"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestPolicies(t *testing.T) {
+	ctx := context.Background()
+	sanctioned := []byte{0x51}
+	issue := bc.NewIssuanceInput(nil, 60, nil, bc.Hash{}, []byte{1}, nil)
+	assetID := issue.AssetID()
+
+	policies := NewPolicies([]config.BlockPolicy{
+		{Type: config.PolicySanctionedPrograms, ControlPrograms: []chainjson.HexBytes{sanctioned}},
+		{Type: config.PolicyIssuanceCap, AssetID: &assetID, MaxAmount: 100},
+	})
+	if len(policies) != 2 {
+		t.Fatalf("got %d policies want 2", len(policies))
+	}
+
+	block := func(txs ...*bc.TxData) *bc.Block {
+		b := new(bc.Block)
+		for _, tx := range txs {
+			b.Transactions = append(b.Transactions, bc.NewTx(*tx))
+		}
+		return b
+	}
+	spend := bc.NewSpendInput(bc.Hash{1}, 0, nil, assetID, 10, sanctioned, nil)
+	pay := bc.NewTxOutput(assetID, 10, sanctioned, nil)
+	other := bc.NewTxOutput(assetID, 60, []byte{0x52}, nil)
+
+	cases := []struct {
+		policy int
+		b      *bc.Block
+		refuse bool
+	}{
+		{0, block(&bc.TxData{Inputs: []*bc.TxInput{issue}, Outputs: []*bc.TxOutput{other}}), false},
+		{0, block(&bc.TxData{Inputs: []*bc.TxInput{spend}, Outputs: []*bc.TxOutput{other}}), true},
+		{0, block(&bc.TxData{Inputs: []*bc.TxInput{issue}, Outputs: []*bc.TxOutput{pay}}), true},
+		{1, block(&bc.TxData{Inputs: []*bc.TxInput{issue}}), false},
+		{1, block(&bc.TxData{Inputs: []*bc.TxInput{issue}}, &bc.TxData{Inputs: []*bc.TxInput{issue}}), true},
+	}
+	for i, c := range cases {
+		r, err := policies[c.policy].CheckBlock(ctx, c.b)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if got := r != nil; got != c.refuse {
+			t.Errorf("case %d: refused = %v want %v", i, got, c.refuse)
+		}
+		if r != nil && r.TxID == nil {
+			t.Errorf("case %d: refusal has no transaction ID", i)
+		}
+	}
+}
+
+func TestRefusalOf(t *testing.T) {
+	id := bc.Hash{1}
+	r := &Refusal{Policy: "p", Reason: "no", TxID: &id}
+	err := errors.Wrap(errors.WithData(ErrPolicyRefusal, "refusal", r))
+	if got := RefusalOf(err); got != r {
+		t.Errorf("RefusalOf(local) = %v want %v", got, r)
+	}
+	if got := RefusalOf(errors.New("other")); got != nil {
+		t.Errorf("RefusalOf(other) = %v want nil", got)
+	}
+}
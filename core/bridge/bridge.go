@@ -0,0 +1,725 @@
+// Package bridge moves assets between two blockchains whose
+// Cores are run by the same federation.
+//
+// Units of an asset on the source blockchain are locked by paying
+// them to the federation's vault account there. The federation then
+// issues the same amount of a wrapped asset on the destination
+// blockchain, after checking a proof that the lock transaction is
+// in a source block. Redemption is the reverse: a holder retires
+// wrapped units on the destination blockchain, and the federation
+// releases the locked units from the vault once it has checked a
+// proof of the retirement.
+//
+// Each member of the federation verifies the proof and checks the
+// transaction against it before signing with its own keys, so no
+// single member can move assets on its own. Each proven transaction
+// is claimed at most once, so a proof cannot be replayed to issue or
+// release assets twice.
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/txbuilder"
+	"chain/crypto/sha3pool"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/validation"
+	"chain/protocol/vmutil"
+)
+
+// txTTL is how long the reservations made for a bridge
+// transaction are held.
+const txTTL = 5 * time.Minute
+
+var (
+	// ErrBadProof is returned when a proof does not show a
+	// transaction in a block of the expected blockchain, or the
+	// transaction moves nothing across the bridge.
+	ErrBadProof = errors.New("invalid bridge proof")
+
+	// ErrClaimed is returned when a proven transaction has
+	// already been claimed.
+	ErrClaimed = errors.New("bridge transaction already claimed")
+
+	// ErrBadTemplate is returned when a federation member is asked
+	// to sign a transaction that does not do exactly what the proof
+	// calls for.
+	ErrBadTemplate = errors.New("bridge transaction does not match its proof")
+
+	// ErrNoQuorum is returned when too few federation members
+	// sign a bridge transaction. The members that did sign are
+	// bound to it until it can no longer land, so the proof can
+	// be tried again once a block past its max time is made.
+	ErrNoQuorum = errors.New("too few federation members signed")
+)
+
+// SubmitFunc finalizes and submits a signed transaction template.
+type SubmitFunc func(context.Context, *txbuilder.Template) error
+
+// A Side is one of the two blockchains a Bridge connects,
+// and the Core services the federation runs on it.
+type Side struct {
+	DB       pg.DB
+	Chain    *protocol.Chain
+	Accounts *account.Manager
+	Assets   *asset.Registry
+	Submit   SubmitFunc
+}
+
+// A Bridge moves assets from its Source blockchain to its Dest
+// blockchain and back.
+type Bridge struct {
+	Source Side
+	Dest   Side
+
+	// XPubs and Quorum are the federation's keys. They control
+	// the vault account on the source blockchain and issue the
+	// wrapped assets on the destination blockchain.
+	XPubs  []string
+	Quorum int
+}
+
+// A Member is one of the federation's members. Each member holds
+// some of the federation's keys, and signs a bridge transaction
+// only after checking it against the proof on its own.
+type Member interface {
+	// SignMint signs tpl, a transaction issuing wrapped assets
+	// for the lock transaction proven by p.
+	SignMint(ctx context.Context, p *Proof, tpl *txbuilder.Template) error
+
+	// SignRelease signs tpl, a transaction releasing locked assets
+	// for the redemption transaction proven by p.
+	SignRelease(ctx context.Context, p *Proof, tpl *txbuilder.Template) error
+}
+
+// A LocalMember is a federation member whose keys are held in this
+// process. Bridge is the member's own view of the two blockchains:
+// proofs are verified against its copies of them, and the member's
+// claims are recorded in its databases.
+type LocalMember struct {
+	Bridge *Bridge
+	XPubs  []string
+	SignFn txbuilder.SignFunc
+}
+
+// A Proof shows that a transaction is in a block
+// of the blockchain with the given ID.
+type Proof struct {
+	BlockchainID bc.Hash    `json:"blockchain_id"`
+	BlockHeight  uint64     `json:"block_height"`
+	Tx           *bc.TxData `json:"transaction"`
+	Position     int        `json:"position"`
+	TxCount      int        `json:"transaction_count"`
+	MerklePath   []bc.Hash  `json:"merkle_path"`
+}
+
+// Prove returns a proof that the transaction with ID txID is
+// in the block at height on c.
+func Prove(ctx context.Context, c *protocol.Chain, height uint64, txID bc.Hash) (*Proof, error) {
+	b, err := c.GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrapf(err, "getting block %d", height)
+	}
+	for i, tx := range b.Transactions {
+		if tx.Hash != txID {
+			continue
+		}
+		return &Proof{
+			BlockchainID: c.InitialBlockHash,
+			BlockHeight:  height,
+			Tx:           &tx.TxData,
+			Position:     i,
+			TxCount:      len(b.Transactions),
+			MerklePath:   validation.CalcMerklePath(b.Transactions, i),
+		}, nil
+	}
+	return nil, errors.WithDetailf(ErrBadProof, "transaction %s is not in block %d", txID, height)
+}
+
+// Verify checks p against the block headers of c.
+func (p *Proof) Verify(ctx context.Context, c *protocol.Chain) error {
+	if p.BlockchainID != c.InitialBlockHash {
+		return errors.WithDetailf(ErrBadProof, "proof is for blockchain %s, not %s", p.BlockchainID, c.InitialBlockHash)
+	}
+	if p.Tx == nil {
+		return errors.WithDetail(ErrBadProof, "proof has no transaction")
+	}
+	if p.BlockHeight == 0 || p.BlockHeight > c.Height() {
+		return errors.WithDetailf(ErrBadProof, "block %d is not in the blockchain", p.BlockHeight)
+	}
+	b, err := c.GetBlock(ctx, p.BlockHeight)
+	if err != nil {
+		return errors.Wrapf(err, "getting block %d", p.BlockHeight)
+	}
+	root, err := validation.MerkleRootFromPath(p.Tx.WitnessHash(), p.Position, p.TxCount, p.MerklePath)
+	if err != nil {
+		return errors.WithDetail(ErrBadProof, err.Error())
+	}
+	if root != b.TransactionsMerkleRoot {
+		return errors.WithDetailf(ErrBadProof, "transaction is not in block %d", p.BlockHeight)
+	}
+	return nil
+}
+
+// bridgeData is the reference data of lock and redemption outputs.
+type bridgeData struct {
+	Recipient        chainjson.HexBytes `json:"bridge_recipient"`
+	DestBlockchainID bc.Hash            `json:"bridge_destination"`
+}
+
+// NewLockAction returns an action that locks amt in the vault on the
+// source blockchain, to be issued on the destination blockchain as
+// the wrapped asset and paid to the control program recipient.
+func (b *Bridge) NewLockAction(ctx context.Context, amt bc.AssetAmount, recipient []byte) (txbuilder.Action, error) {
+	vaultID, err := b.vault(ctx)
+	if err != nil {
+		return nil, err
+	}
+	refData, err := json.Marshal(bridgeData{
+		Recipient:        recipient,
+		DestBlockchainID: b.Dest.Chain.InitialBlockHash,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return b.Source.Accounts.NewControlAction(amt, vaultID, refData), nil
+}
+
+// NewRedeemAction returns an action that retires amt of a wrapped
+// asset on the destination blockchain, to be released from the vault
+// on the source blockchain to the control program recipient.
+func (b *Bridge) NewRedeemAction(amt bc.AssetAmount, recipient []byte) (txbuilder.Action, error) {
+	refData, err := json.Marshal(bridgeData{
+		Recipient:        recipient,
+		DestBlockchainID: b.Source.Chain.InitialBlockHash,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	return txbuilder.NewRetireAction(amt, refData), nil
+}
+
+// Mint issues wrapped assets on the destination blockchain for the
+// lock outputs of the source transaction proven by p. Lock outputs
+// bound for other blockchains are ignored. Each of members checks
+// and signs the issuance on its own; once a quorum of the
+// federation's keys has signed, Mint submits it.
+func (b *Bridge) Mint(ctx context.Context, p *Proof, members []Member) (*txbuilder.Template, error) {
+	transfers, err := b.mints(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	var actions []txbuilder.Action
+	for _, t := range transfers {
+		actions = append(actions,
+			b.Dest.Assets.NewIssueAction(t.AssetAmount, t.SourceData),
+			txbuilder.NewControlProgramAction(t.AssetAmount, t.Recipient, nil),
+		)
+	}
+	return b.claimAndSubmit(ctx, b.Dest, p, actions, members, Member.SignMint)
+}
+
+// Release pays out locked assets from the vault on the source
+// blockchain for the redemption outputs of the destination
+// transaction proven by p. Each of members checks and signs the
+// transaction on its own; once a quorum of the federation's keys
+// has signed, Release submits it.
+func (b *Bridge) Release(ctx context.Context, p *Proof, members []Member) (*txbuilder.Template, error) {
+	transfers, err := b.releases(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	vaultID, err := b.vault(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var actions []txbuilder.Action
+	for _, t := range transfers {
+		actions = append(actions,
+			b.Source.Accounts.NewSpendAction(t.AssetAmount, vaultID, nil, nil),
+			txbuilder.NewControlProgramAction(t.AssetAmount, t.Recipient, t.SourceData),
+		)
+	}
+	return b.claimAndSubmit(ctx, b.Source, p, actions, members, Member.SignRelease)
+}
+
+// SignMint implements Member. It verifies p, checks that tpl issues
+// exactly the wrapped assets p calls for, and signs tpl with m's keys.
+func (m *LocalMember) SignMint(ctx context.Context, p *Proof, tpl *txbuilder.Template) error {
+	transfers, err := m.Bridge.mints(ctx, p)
+	if err != nil {
+		return err
+	}
+	for i, in := range tpl.Transaction.Inputs {
+		if !in.IsIssuance() {
+			return errors.WithDetailf(ErrBadTemplate, "input %d is not an issuance", i)
+		}
+	}
+	err = checkOutputs(tpl.Transaction.Outputs, transfers, nil)
+	if err != nil {
+		return err
+	}
+	return m.sign(ctx, m.Bridge.Dest, p, tpl)
+}
+
+// SignRelease implements Member. It verifies p, checks that tpl
+// pays exactly the released assets p calls for, returning any change
+// to the vault, and signs tpl with m's keys.
+func (m *LocalMember) SignRelease(ctx context.Context, p *Proof, tpl *txbuilder.Template) error {
+	transfers, err := m.Bridge.releases(ctx, p)
+	if err != nil {
+		return err
+	}
+	vaultID, err := m.Bridge.vault(ctx)
+	if err != nil {
+		return err
+	}
+	change, err := m.Bridge.vaultPrograms(ctx, vaultID, tpl.Transaction.Outputs)
+	if err != nil {
+		return err
+	}
+	err = checkOutputs(tpl.Transaction.Outputs, transfers, change)
+	if err != nil {
+		return err
+	}
+	return m.sign(ctx, m.Bridge.Source, p, tpl)
+}
+
+// sign claims the transaction proven by p in side's database on
+// behalf of m, then adds m's signatures to tpl. The claim is bound
+// to tpl's transaction, so m will sign that transaction again but
+// no other for the same proof, unless that transaction can no
+// longer land.
+func (m *LocalMember) sign(ctx context.Context, side Side, p *Proof, tpl *txbuilder.Template) error {
+	// Signatures must commit to the whole transaction,
+	// so that it can't be changed once it's checked.
+	if tpl.AllowAdditional {
+		return errors.WithDetail(ErrBadTemplate, "template allows additional actions")
+	}
+	for _, sigInst := range tpl.SigningInstructions {
+		if sigInst.Position < 0 || sigInst.Position >= len(tpl.Transaction.Inputs) {
+			return errors.WithDetailf(ErrBadTemplate, "signing instruction for missing input %d", sigInst.Position)
+		}
+		prog := txbuilder.SigProgram(tpl, sigInst.Position)
+		for _, c := range sigInst.WitnessComponents {
+			sw, ok := c.(*txbuilder.SignatureWitness)
+			if ok && len(sw.Program) > 0 && !bytes.Equal(sw.Program, prog) {
+				return errors.WithDetailf(ErrBadTemplate, "signature program of input %d does not commit to the transaction", sigInst.Position)
+			}
+		}
+	}
+
+	const q = `
+		INSERT INTO bridge_claims (blockchain_id, tx_hash, claim_tx_hash, claim_tx, claim_height)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (blockchain_id, tx_hash) DO UPDATE
+		SET claim_tx_hash=$3, claim_tx=$4, claim_height=COALESCE(bridge_claims.claim_height, $5)
+		WHERE bridge_claims.claim_tx_hash IS NULL OR bridge_claims.claim_tx_hash=$3
+	`
+	tx := tpl.Transaction
+	res, err := side.DB.Exec(ctx, q, p.BlockchainID, p.Tx.Hash(), tx.Hash(), tx, side.Chain.Height())
+	if err != nil {
+		return errors.Wrap(err, "claiming bridge transaction")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		err = rebindClaim(ctx, side, p, tx)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = txbuilder.Sign(ctx, tpl, m.XPubs, m.SignFn)
+	return errors.Wrap(err, "signing bridge transaction")
+}
+
+// rebindClaim binds the claim on the transaction proven by p, which
+// is bound to some other transaction, to tx instead. It does so
+// only if the other transaction can no longer land: it is not in
+// side's blockchain, and a block past its max time is. A member
+// that signed a transaction too few others signed can then sign
+// the next one built for the same proof.
+func rebindClaim(ctx context.Context, side Side, p *Proof, tx *bc.TxData) error {
+	const selectQ = `
+		SELECT claim_tx_hash, claim_tx, claim_height FROM bridge_claims
+		WHERE blockchain_id=$1 AND tx_hash=$2
+	`
+	var (
+		txID      = p.Tx.Hash()
+		claimHash string
+		claimTx   []byte
+		height    sql.NullInt64
+	)
+	err := side.DB.QueryRow(ctx, selectQ, p.BlockchainID, txID).Scan(&claimHash, &claimTx, &height)
+	if err != nil {
+		return errors.Wrap(err, "loading bridge claim")
+	}
+	if len(claimTx) == 0 || !height.Valid {
+		// Claimed by a transaction this member didn't sign.
+		return errors.WithDetailf(ErrClaimed, "transaction %s", txID)
+	}
+	var claimed bc.TxData
+	err = claimed.Scan(claimTx)
+	if err != nil {
+		return errors.Wrap(err, "decoding claiming transaction")
+	}
+	landed, expired, err := txbuilder.FindTx(ctx, side.Chain, &claimed, uint64(height.Int64))
+	if err != nil {
+		return err
+	}
+	if landed || !expired {
+		return errors.WithDetailf(ErrClaimed, "transaction %s is claimed by transaction %s", txID, claimHash)
+	}
+
+	const updateQ = `
+		UPDATE bridge_claims SET claim_tx_hash=$4, claim_tx=$5, claim_height=$6
+		WHERE blockchain_id=$1 AND tx_hash=$2 AND claim_tx_hash=$3
+	`
+	res, err := side.DB.Exec(ctx, updateQ, p.BlockchainID, txID, claimHash, tx, side.Chain.Height())
+	if err != nil {
+		return errors.Wrap(err, "rebinding bridge claim")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	if n == 0 {
+		return errors.WithDetailf(ErrClaimed, "transaction %s", txID)
+	}
+	return nil
+}
+
+// A transfer is an amount that a bridge transaction pays
+// to Recipient for one output of a proven transaction.
+type transfer struct {
+	bc.AssetAmount
+	Recipient []byte
+
+	// SourceData is reference data naming the proven output.
+	SourceData []byte
+}
+
+// mints verifies p against the source blockchain and returns the
+// transfers of wrapped assets called for by its lock outputs.
+func (b *Bridge) mints(ctx context.Context, p *Proof) ([]transfer, error) {
+	err := p.Verify(ctx, b.Source.Chain)
+	if err != nil {
+		return nil, err
+	}
+	vaultID, err := b.vault(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vaultPrograms, err := b.vaultPrograms(ctx, vaultID, p.Tx.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	txID := p.Tx.Hash()
+	var transfers []transfer
+	for i, out := range p.Tx.Outputs {
+		if !vaultPrograms[string(out.ControlProgram)] {
+			continue
+		}
+		data, ok := bridgeDataOf(out)
+		if !ok || data.DestBlockchainID != b.Dest.Chain.InitialBlockHash {
+			continue
+		}
+		wrapped, err := b.wrappedAsset(ctx, out.AssetID)
+		if err != nil {
+			return nil, err
+		}
+		t, err := newTransfer(bc.AssetAmount{AssetID: wrapped, Amount: out.Amount}, data.Recipient, txID, i)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	if len(transfers) == 0 {
+		return nil, errors.WithDetailf(ErrBadProof, "transaction %s locks nothing in the bridge vault for blockchain %s", txID, b.Dest.Chain.InitialBlockHash)
+	}
+	return transfers, nil
+}
+
+// releases verifies p against the destination blockchain and returns
+// the transfers of locked assets called for by its redemption outputs.
+func (b *Bridge) releases(ctx context.Context, p *Proof) ([]transfer, error) {
+	err := p.Verify(ctx, b.Dest.Chain)
+	if err != nil {
+		return nil, err
+	}
+	sources, err := b.sourceAssets(ctx, p.Tx.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	txID := p.Tx.Hash()
+	var transfers []transfer
+	for i, out := range p.Tx.Outputs {
+		if !vmutil.IsUnspendable(out.ControlProgram) {
+			continue
+		}
+		source, ok := sources[out.AssetID]
+		if !ok {
+			continue
+		}
+		data, ok := bridgeDataOf(out)
+		if !ok || data.DestBlockchainID != b.Source.Chain.InitialBlockHash {
+			continue
+		}
+		t, err := newTransfer(bc.AssetAmount{AssetID: source, Amount: out.Amount}, data.Recipient, txID, i)
+		if err != nil {
+			return nil, err
+		}
+		transfers = append(transfers, t)
+	}
+	if len(transfers) == 0 {
+		return nil, errors.WithDetailf(ErrBadProof, "transaction %s redeems no wrapped assets", txID)
+	}
+	return transfers, nil
+}
+
+func newTransfer(amt bc.AssetAmount, recipient []byte, txID bc.Hash, index int) (transfer, error) {
+	sourceData, err := json.Marshal(map[string]interface{}{
+		"bridge_source": bc.Outpoint{Hash: txID, Index: uint32(index)},
+	})
+	if err != nil {
+		return transfer{}, errors.Wrap(err)
+	}
+	return transfer{AssetAmount: amt, Recipient: recipient, SourceData: sourceData}, nil
+}
+
+// checkOutputs checks that outs pay each of transfers once, and
+// pay nothing else except to the control programs in change.
+func checkOutputs(outs []*bc.TxOutput, transfers []transfer, change map[string]bool) error {
+	paid := make([]bool, len(transfers))
+outputs:
+	for i, out := range outs {
+		for j, t := range transfers {
+			if !paid[j] && out.AssetAmount == t.AssetAmount && bytes.Equal(out.ControlProgram, t.Recipient) {
+				paid[j] = true
+				continue outputs
+			}
+		}
+		if !change[string(out.ControlProgram)] {
+			return errors.WithDetailf(ErrBadTemplate, "output %d is not called for by the proof", i)
+		}
+	}
+	for j, t := range transfers {
+		if !paid[j] {
+			return errors.WithDetailf(ErrBadTemplate, "transaction does not pay %d of asset %s to its recipient", t.Amount, t.AssetID)
+		}
+	}
+	return nil
+}
+
+// claimAndSubmit claims the transaction proven by p in side's
+// database, then builds a transaction from actions on side's
+// blockchain, has each of members sign it with sign, and submits
+// it. If building fails, or members holding a quorum of the
+// federation's keys don't sign, it drops the claim and releases
+// the transaction's reservations so the proof can be tried again. Once the transaction is signed, the claim
+// records its hash and is kept even if submission fails, since the
+// transaction may still land; an operator can resubmit it or drop
+// the claim.
+func (b *Bridge) claimAndSubmit(ctx context.Context, side Side, p *Proof, actions []txbuilder.Action, members []Member, sign func(Member, context.Context, *Proof, *txbuilder.Template) error) (*txbuilder.Template, error) {
+	const claimQ = `
+		INSERT INTO bridge_claims (blockchain_id, tx_hash) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	txID := p.Tx.Hash()
+	res, err := side.DB.Exec(ctx, claimQ, p.BlockchainID, txID)
+	if err != nil {
+		return nil, errors.Wrap(err, "claiming bridge transaction")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrClaimed, "transaction %s", txID)
+	}
+
+	tpl, err := b.buildAndSign(ctx, p, actions, members, sign)
+	if err != nil {
+		const unclaimQ = `DELETE FROM bridge_claims WHERE blockchain_id=$1 AND tx_hash=$2`
+		_, err2 := side.DB.Exec(ctx, unclaimQ, p.BlockchainID, txID)
+		if err2 != nil {
+			log.Error(ctx, err2, "dropping claim on bridge transaction ", txID)
+		}
+		return nil, err
+	}
+
+	const updateQ = `UPDATE bridge_claims SET claim_tx_hash=$3 WHERE blockchain_id=$1 AND tx_hash=$2`
+	_, err = side.DB.Exec(ctx, updateQ, p.BlockchainID, txID, tpl.Transaction.Hash())
+	if err != nil {
+		return nil, errors.Wrap(err, "recording bridge claim")
+	}
+
+	err = side.Submit(ctx, tpl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "submitting bridge transaction %s", tpl.Transaction.Hash())
+	}
+	return tpl, nil
+}
+
+// buildAndSign builds a transaction from actions and passes it to
+// each of members in turn to sign. A member that refuses is skipped;
+// the transaction is returned only if it ends up with enough
+// signatures on every input. Otherwise the build is rolled back.
+func (b *Bridge) buildAndSign(ctx context.Context, p *Proof, actions []txbuilder.Action, members []Member, sign func(Member, context.Context, *Proof, *txbuilder.Template) error) (*txbuilder.Template, error) {
+	tpl, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(txTTL))
+	if err != nil {
+		return nil, errors.Wrap(err, "building bridge transaction")
+	}
+	for i, m := range members {
+		err = sign(m, ctx, p, tpl)
+		if err != nil {
+			log.Error(ctx, err, "federation member ", i, " did not sign bridge transaction ", tpl.Transaction.Hash())
+		}
+	}
+	for _, sigInst := range tpl.SigningInstructions {
+		for _, c := range sigInst.WitnessComponents {
+			sw, ok := c.(*txbuilder.SignatureWitness)
+			if !ok {
+				continue
+			}
+			var n int
+			for _, sig := range sw.Sigs {
+				if len(sig) > 0 {
+					n++
+				}
+			}
+			if n < sw.Quorum {
+				tpl.Rollback()
+				return nil, errors.WithDetailf(ErrNoQuorum, "input %d has %d of %d signatures", sigInst.Position, n, sw.Quorum)
+			}
+		}
+	}
+	return tpl, nil
+}
+
+// vault returns the ID of the federation's account on the source
+// blockchain holding assets locked for the destination blockchain,
+// creating it if necessary. Bridges to other blockchains, and
+// bridges run by other federations, have vaults of their own.
+func (b *Bridge) vault(ctx context.Context) (string, error) {
+	clientToken := "bridge-vault-" + b.Dest.Chain.InitialBlockHash.String() + "-" + b.federationID()
+	acc, err := b.Source.Accounts.Create(ctx, b.XPubs, b.Quorum, "", nil, nil, &clientToken)
+	if err != nil {
+		return "", errors.Wrap(err, "creating bridge vault account")
+	}
+	return acc.ID, nil
+}
+
+// federationID returns a hex-encoded hash identifying
+// the federation's keys and quorum.
+func (b *Bridge) federationID() string {
+	xpubs := append([]string(nil), b.XPubs...)
+	sort.Strings(xpubs)
+	var h [32]byte
+	sha3pool.Sum256(h[:], []byte(fmt.Sprintf("%d/%s", b.Quorum, strings.Join(xpubs, ","))))
+	return hex.EncodeToString(h[:])
+}
+
+// vaultPrograms returns the set of control programs in outs
+// that belong to the vault account.
+func (b *Bridge) vaultPrograms(ctx context.Context, vaultID string, outs []*bc.TxOutput) (map[string]bool, error) {
+	var progs pq.ByteaArray
+	for _, out := range outs {
+		progs = append(progs, out.ControlProgram)
+	}
+	const q = `
+		SELECT control_program FROM account_control_programs
+		WHERE signer_id=$1 AND control_program=ANY($2::bytea[])
+	`
+	found := make(map[string]bool)
+	err := pg.ForQueryRows(ctx, b.Source.DB, q, vaultID, progs, func(prog []byte) {
+		found[string(prog)] = true
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up vault control programs")
+	}
+	return found, nil
+}
+
+// wrappedAsset returns the ID of the asset that wraps source on the
+// destination blockchain, defining it if necessary.
+func (b *Bridge) wrappedAsset(ctx context.Context, source bc.AssetID) (bc.AssetID, error) {
+	def := map[string]interface{}{
+		"bridge_source": map[string]interface{}{
+			"blockchain_id": b.Source.Chain.InitialBlockHash,
+			"asset_id":      source,
+		},
+	}
+	clientToken := "bridge-" + b.Source.Chain.InitialBlockHash.String() + "-" + source.String() + "-" + b.federationID()
+	a, err := b.Dest.Assets.Define(ctx, b.XPubs, b.Quorum, def, "", nil, &clientToken)
+	if err != nil {
+		return bc.AssetID{}, errors.Wrap(err, "defining wrapped asset")
+	}
+
+	const q = `
+		INSERT INTO bridge_assets (asset_id, source_blockchain_id, source_asset_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (asset_id) DO NOTHING
+	`
+	_, err = b.Dest.DB.Exec(ctx, q, a.AssetID, b.Source.Chain.InitialBlockHash, source)
+	if err != nil {
+		return bc.AssetID{}, errors.Wrap(err, "recording wrapped asset")
+	}
+	return a.AssetID, nil
+}
+
+// sourceAssets maps the wrapped assets among outs
+// to the source assets they wrap.
+func (b *Bridge) sourceAssets(ctx context.Context, outs []*bc.TxOutput) (map[bc.AssetID]bc.AssetID, error) {
+	var ids pq.StringArray
+	for _, out := range outs {
+		ids = append(ids, out.AssetID.String())
+	}
+	const q = `
+		SELECT asset_id, source_asset_id FROM bridge_assets
+		WHERE asset_id=ANY($1::text[]) AND source_blockchain_id=$2
+	`
+	sources := make(map[bc.AssetID]bc.AssetID)
+	err := pg.ForQueryRows(ctx, b.Dest.DB, q, ids, b.Source.Chain.InitialBlockHash, func(wrapped, source bc.AssetID) {
+		sources[wrapped] = source
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "looking up wrapped assets")
+	}
+	return sources, nil
+}
+
+// bridgeDataOf returns the bridge data in out's reference data.
+// It returns false if out has none.
+func bridgeDataOf(out *bc.TxOutput) (bridgeData, bool) {
+	var data bridgeData
+	if json.Unmarshal(out.ReferenceData, &data) != nil {
+		return bridgeData{}, false
+	}
+	if len(data.Recipient) == 0 {
+		return bridgeData{}, false
+	}
+	return data, true
+}
@@ -0,0 +1,323 @@
+package bridge_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/bridge"
+	"chain/core/coretest"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+// testSide is one of two in-process blockchains,
+// each with its own Core database.
+type testSide struct {
+	bridge.Side
+	pins *pin.Store
+}
+
+func newTestSide(ctx context.Context, t *testing.T) *testSide {
+	_, db := pgtest.NewDB(t, pgtest.SchemaPath)
+	c := prottest.NewChain(t)
+	s := &testSide{
+		Side: bridge.Side{
+			DB:       db,
+			Chain:    c,
+			Accounts: account.NewManager(db, c),
+			Assets:   asset.NewRegistry(db, c),
+			Submit: func(ctx context.Context, tpl *txbuilder.Template) error {
+				return txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+			},
+		},
+		pins: &pin.Store{DB: db},
+	}
+	indexer := query.NewIndexer(db, c, s.pins)
+	s.Assets.IndexAssets(indexer, s.pins)
+	s.Accounts.IndexAccounts(indexer, s.pins)
+	go s.Accounts.ProcessBlocks(ctx)
+	return s
+}
+
+// makeBlock makes a block on s and waits for
+// the account indexer to process it.
+func (s *testSide) makeBlock(t *testing.T) *bc.Block {
+	b := prottest.MakeBlock(t, s.Chain)
+	<-s.pins.Pin(account.PinName).WaitForHeight(b.Height)
+	return b
+}
+
+func TestBridge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := newTestSide(ctx, t)
+	// Make sure the two blockchains have different initial blocks.
+	time.Sleep(2 * time.Millisecond)
+	dst := newTestSide(ctx, t)
+	if src.Chain.InitialBlockHash == dst.Chain.InitialBlockHash {
+		t.Fatal("source and destination blockchains are the same")
+	}
+
+	// The federation has two members, each with its own key,
+	// and both must sign.
+	xprv2, err := chainkd.NewXPrv(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	xprvs := []chainkd.XPrv{testutil.TestXPrv, xprv2}
+	b := &bridge.Bridge{
+		Source: src.Side,
+		Dest:   dst.Side,
+		Quorum: 2,
+	}
+	var members []bridge.Member
+	for _, xprv := range xprvs {
+		xprv := xprv
+		b.XPubs = append(b.XPubs, xprv.XPub().String())
+		members = append(members, &bridge.LocalMember{
+			Bridge: b,
+			XPubs:  []string{xprv.XPub().String()},
+			SignFn: func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+				return xprv.Derive(path).Sign(data[:]), nil
+			},
+		})
+	}
+
+	gold := coretest.CreateAsset(ctx, t, src.Assets, nil, "", nil)
+	aliceSrc := coretest.CreateAccount(ctx, t, src.Accounts, "", nil)
+	aliceDst := coretest.CreateAccount(ctx, t, dst.Accounts, "", nil)
+	coretest.IssueAssets(ctx, t, src.Chain, src.Assets, src.Accounts, gold, 10, aliceSrc)
+	src.makeBlock(t)
+
+	// Lock 6 gold on the source blockchain.
+	dstProg, err := dst.Accounts.CreateControlProgram(ctx, aliceDst, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	lock, err := b.NewLockAction(ctx, bc.AssetAmount{AssetID: gold, Amount: 6}, dstProg)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	lockTx := coretest.Transfer(ctx, t, src.Chain, []txbuilder.Action{
+		src.Accounts.NewSpendAction(bc.AssetAmount{AssetID: gold, Amount: 6}, aliceSrc, nil, nil),
+		lock,
+	})
+	lockProof := prove(ctx, t, src.Chain, src.makeBlock(t), lockTx.Hash)
+
+	// One member alone can't mint, and the claim is dropped.
+	_, err = b.Mint(ctx, lockProof, members[:1])
+	if errors.Root(err) != bridge.ErrNoQuorum {
+		t.Errorf("minting with one member: got error %v want %v", err, bridge.ErrNoQuorum)
+	}
+
+	// Issue 6 wrapped gold on the destination blockchain.
+	mint, err := b.Mint(ctx, lockProof, members)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	minted := findOutput(mint.Transaction, dstProg)
+	if minted == nil || minted.Amount != 6 {
+		t.Fatalf("mint transaction does not pay 6 units to the recipient: %+v", mint.Transaction.Outputs)
+	}
+	wrapped := minted.AssetID
+	dst.makeBlock(t)
+
+	_, err = b.Mint(ctx, lockProof, members)
+	if errors.Root(err) != bridge.ErrClaimed {
+		t.Errorf("minting twice: got error %v want %v", err, bridge.ErrClaimed)
+	}
+
+	// A member won't sign a transaction the proof doesn't call for.
+	tampered := *mint.Transaction
+	tampered.Outputs = []*bc.TxOutput{bc.NewTxOutput(wrapped, 7, dstProg, nil)}
+	err = members[1].SignMint(ctx, lockProof, &txbuilder.Template{Transaction: &tampered})
+	if errors.Root(err) != bridge.ErrBadTemplate {
+		t.Errorf("signing a tampered mint: got error %v want %v", err, bridge.ErrBadTemplate)
+	}
+
+	// A lock in the vault bound for another blockchain mints nothing.
+	var vaultProg []byte
+	for _, out := range lockTx.Outputs {
+		if len(out.ReferenceData) > 0 {
+			vaultProg = out.ControlProgram
+		}
+	}
+	strayData, err := json.Marshal(map[string]interface{}{
+		"bridge_recipient":   chainjson.HexBytes(dstProg),
+		"bridge_destination": bc.Hash{1},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	strayTx := coretest.Transfer(ctx, t, src.Chain, []txbuilder.Action{
+		src.Accounts.NewSpendAction(bc.AssetAmount{AssetID: gold, Amount: 1}, aliceSrc, nil, nil),
+		txbuilder.NewControlProgramAction(bc.AssetAmount{AssetID: gold, Amount: 1}, vaultProg, strayData),
+	})
+	_, err = b.Mint(ctx, prove(ctx, t, src.Chain, src.makeBlock(t), strayTx.Hash), members)
+	if errors.Root(err) != bridge.ErrBadProof {
+		t.Errorf("minting for another blockchain: got error %v want %v", err, bridge.ErrBadProof)
+	}
+
+	// A member that signed a mint too few others signed is bound
+	// to it until it can no longer land, then signs another.
+	lock, err = b.NewLockAction(ctx, bc.AssetAmount{AssetID: gold, Amount: 2}, dstProg)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	lockTx = coretest.Transfer(ctx, t, src.Chain, []txbuilder.Action{
+		src.Accounts.NewSpendAction(bc.AssetAmount{AssetID: gold, Amount: 2}, aliceSrc, nil, nil),
+		lock,
+	})
+	lockProof = prove(ctx, t, src.Chain, src.makeBlock(t), lockTx.Hash)
+	mintTemplate := func(ttl time.Duration) *txbuilder.Template {
+		var index int
+		for i, out := range lockTx.Outputs {
+			if len(out.ReferenceData) > 0 {
+				index = i
+			}
+		}
+		sourceData, err := json.Marshal(map[string]interface{}{
+			"bridge_source": bc.Outpoint{Hash: lockTx.Hash, Index: uint32(index)},
+		})
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		amt := bc.AssetAmount{AssetID: wrapped, Amount: 2}
+		tpl, err := txbuilder.Build(ctx, nil, []txbuilder.Action{
+			dst.Assets.NewIssueAction(amt, sourceData),
+			txbuilder.NewControlProgramAction(amt, dstProg, nil),
+		}, time.Now().Add(ttl))
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		return tpl
+	}
+	err = members[1].SignMint(ctx, lockProof, mintTemplate(time.Millisecond))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	retry := mintTemplate(time.Minute)
+	err = members[1].SignMint(ctx, lockProof, retry)
+	if errors.Root(err) != bridge.ErrClaimed {
+		t.Errorf("signing a second mint: got error %v want %v", err, bridge.ErrClaimed)
+	}
+	time.Sleep(2 * time.Millisecond)
+	dst.makeBlock(t)
+	err = members[1].SignMint(ctx, lockProof, retry)
+	if err != nil {
+		t.Errorf("signing a second mint after the first expired: %v", err)
+	}
+
+	// Redeem 4 wrapped gold back to the source blockchain.
+	srcProg, err := src.Accounts.CreateControlProgram(ctx, aliceSrc, false)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	redeem, err := b.NewRedeemAction(bc.AssetAmount{AssetID: wrapped, Amount: 4}, srcProg)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	redeemTx := coretest.Transfer(ctx, t, dst.Chain, []txbuilder.Action{
+		dst.Accounts.NewSpendAction(bc.AssetAmount{AssetID: wrapped, Amount: 4}, aliceDst, nil, nil),
+		redeem,
+	})
+	redeemProof := prove(ctx, t, dst.Chain, dst.makeBlock(t), redeemTx.Hash)
+
+	release, err := b.Release(ctx, redeemProof, members)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	released := findOutput(release.Transaction, srcProg)
+	if released == nil || released.AssetID != gold || released.Amount != 4 {
+		t.Fatalf("release transaction does not pay 4 gold to the recipient: %+v", release.Transaction.Outputs)
+	}
+	src.makeBlock(t)
+
+	_, err = b.Release(ctx, redeemProof, members)
+	if errors.Root(err) != bridge.ErrClaimed {
+		t.Errorf("releasing twice: got error %v want %v", err, bridge.ErrClaimed)
+	}
+
+	// A lock proof is not a redemption proof.
+	_, err = b.Release(ctx, lockProof, members)
+	if errors.Root(err) != bridge.ErrBadProof {
+		t.Errorf("releasing with a lock proof: got error %v want %v", err, bridge.ErrBadProof)
+	}
+}
+
+func TestProofVerify(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+
+	now := time.Now()
+	var txs []*bc.Tx
+	for i := 0; i < 3; i++ {
+		in := bc.NewIssuanceInput([]byte{byte(i)}, 1, nil, c.InitialBlockHash, []byte{0x51}, nil)
+		tx := bc.NewTx(bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{in},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(in.AssetID(), 1, []byte{0x51}, nil)},
+			MinTime: bc.Millis(now.Add(-time.Minute)),
+			MaxTime: bc.Millis(now.Add(time.Minute)),
+		})
+		err := c.AddTx(ctx, tx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		txs = append(txs, tx)
+	}
+	block := prottest.MakeBlock(t, c)
+
+	p := prove(ctx, t, c, block, txs[1].Hash)
+	err := p.Verify(ctx, c)
+	if err != nil {
+		t.Errorf("Verify() = %v want nil", err)
+	}
+
+	other := *p
+	other.Position = (p.Position + 1) % p.TxCount
+	if err := other.Verify(ctx, c); errors.Root(err) != bridge.ErrBadProof {
+		t.Errorf("wrong position: got error %v want %v", err, bridge.ErrBadProof)
+	}
+	other = *p
+	other.BlockchainID = bc.Hash{1}
+	if err := other.Verify(ctx, c); errors.Root(err) != bridge.ErrBadProof {
+		t.Errorf("wrong blockchain: got error %v want %v", err, bridge.ErrBadProof)
+	}
+	other = *p
+	other.Tx = &txs[0].TxData
+	if err := other.Verify(ctx, c); errors.Root(err) != bridge.ErrBadProof {
+		t.Errorf("wrong transaction: got error %v want %v", err, bridge.ErrBadProof)
+	}
+}
+
+func prove(ctx context.Context, t *testing.T, c *protocol.Chain, block *bc.Block, txID bc.Hash) *bridge.Proof {
+	p, err := bridge.Prove(ctx, c, block.Height, txID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	return p
+}
+
+func findOutput(tx *bc.TxData, prog []byte) *bc.TxOutput {
+	for _, out := range tx.Outputs {
+		if string(out.ControlProgram) == string(prog) {
+			return out
+		}
+	}
+	return nil
+}
@@ -33,6 +33,10 @@ var (
 	ErrBadSignerURL    = errors.New("block signer URL is invalid")
 	ErrBadSignerPubkey = errors.New("block signer pubkey is invalid")
 	ErrBadQuorum       = errors.New("quorum must be greater than 0 if there are signers")
+	ErrBadFailover     = errors.New("invalid backup generator configuration")
+	ErrBadBlockPolicy  = errors.New("invalid block policy")
+
+	ErrBadBlockSchedule = errors.New("invalid block schedule")
 )
 
 // Config encapsulates Core-level, persistent configuration options.
@@ -48,6 +52,31 @@ type Config struct {
 	Signers              []BlockSigner `json:"block_signer_urls"`
 	Quorum               int
 	MaxIssuanceWindow    time.Duration
+
+	// BlockPeriod is how often the generator makes a block. It
+	// skips empty blocks unless MakeEmptyBlocks is set, or
+	// MaxIdleInterval is positive and has passed since the latest
+	// block. If MaxPendingTxs is positive, the generator makes a
+	// block as soon as that many transactions are pending.
+	BlockPeriod     time.Duration `json:"block_period"`
+	MakeEmptyBlocks bool          `json:"make_empty_blocks"`
+	MaxIdleInterval time.Duration `json:"max_idle_interval"`
+	MaxPendingTxs   int           `json:"max_pending_txs"`
+
+	// BackupGenerators lists, in order, the Cores that take over
+	// block production if the generator stops producing blocks
+	// for FailoverTimeout. Every Core on the blockchain should be
+	// configured with the same list. A backup generator also needs
+	// Signers, to collect block signatures. GeneratorCoreID is the
+	// core ID of the generator itself, so that block signers can
+	// tell it apart from the backups; the generator sets its own.
+	GeneratorCoreID  string            `json:"generator_core_id"`
+	BackupGenerators []BackupGenerator `json:"backup_generators"`
+	FailoverTimeout  time.Duration     `json:"failover_timeout"`
+
+	// BlockPolicies are the rules, beyond validity, that a
+	// block signer applies to the blocks it signs.
+	BlockPolicies []BlockPolicy `json:"block_policies"`
 }
 
 type BlockSigner struct {
@@ -56,19 +85,80 @@ type BlockSigner struct {
 	URL         string             `json:"url"`
 }
 
+// A BackupGenerator is a Core, usually run by a different
+// organization than the generator, that can take over block
+// production.
+type BackupGenerator struct {
+	CoreID      string `json:"core_id"`
+	URL         string `json:"url"`
+	AccessToken string `json:"access_token"`
+}
+
+// Types of built-in block policies.
+const (
+	PolicySanctionedPrograms = "sanctioned_programs"
+	PolicyIssuanceCap        = "issuance_cap"
+)
+
+// A BlockPolicy configures one of the block signer's built-in
+// policies, which refuse to sign some valid blocks.
+type BlockPolicy struct {
+	Type string `json:"type"`
+
+	// ControlPrograms lists the control programs that a
+	// sanctioned_programs policy refuses to see spent or paid.
+	ControlPrograms []chainjson.HexBytes `json:"control_programs,omitempty"`
+
+	// AssetID and MaxAmount set the most of an asset that an
+	// issuance_cap policy allows to be issued in one block.
+	AssetID   *bc.AssetID `json:"asset_id,omitempty"`
+	MaxAmount uint64      `json:"max_amount,omitempty"`
+}
+
+// GeneratorRank returns the position of this Core in the order of
+// generators: 0 for the generator, 1 for the first backup generator,
+// and so on. It returns -1 if this Core isn't a generator or backup
+// generator.
+func (c *Config) GeneratorRank() int {
+	if c.IsGenerator {
+		return 0
+	}
+	for i, g := range c.BackupGenerators {
+		if g.CoreID == c.ID {
+			return i + 1
+		}
+	}
+	return -1
+}
+
 // Load loads the stored configuration, if any, from the database.
 func Load(ctx context.Context, db pg.DB) (*Config, error) {
-	const q = `
+	return load(ctx, db, false)
+}
+
+// load loads the stored configuration, locking its row until the
+// end of the database transaction if forUpdate is set.
+func load(ctx context.Context, db pg.DB, forUpdate bool) (*Config, error) {
+	q := `
 			SELECT id, is_signer, is_generator,
 			blockchain_id, generator_url, generator_access_token, block_xpub,
-			remote_block_signers, max_issuance_window_ms, configured_at
+			remote_block_signers, max_issuance_window_ms, configured_at,
+			backup_generators, failover_timeout_ms, block_policies,
+			block_period_ms, make_empty_blocks, max_idle_interval_ms,
+			max_pending_txs, generator_core_id
 			FROM config
 		`
+	if forUpdate {
+		q += " FOR UPDATE"
+	}
 
 	c := new(Config)
 	var (
 		blockSignerData []byte
-		miw             int64
+		backupData      []byte
+		policyData      []byte
+		miw, fot        int64
+		bp, mii         int64
 	)
 	err := db.QueryRow(ctx, q).Scan(
 		&c.ID,
@@ -81,6 +171,14 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 		&blockSignerData,
 		&miw,
 		&c.ConfiguredAt,
+		&backupData,
+		&fot,
+		&policyData,
+		&bp,
+		&c.MakeEmptyBlocks,
+		&mii,
+		&c.MaxPendingTxs,
+		&c.GeneratorCoreID,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -95,7 +193,19 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 		}
 	}
 
+	err = json.Unmarshal(backupData, &c.BackupGenerators)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	err = json.Unmarshal(policyData, &c.BlockPolicies)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
 	c.MaxIssuanceWindow = time.Duration(miw) * time.Millisecond
+	c.FailoverTimeout = time.Duration(fot) * time.Millisecond
+	c.BlockPeriod = time.Duration(bp) * time.Millisecond
+	c.MaxIdleInterval = time.Duration(mii) * time.Millisecond
 	return c, nil
 }
 
@@ -112,8 +222,16 @@ func Load(ctx context.Context, db pg.DB) (*Config, error) {
 // Otherwise, c.IsGenerator is false, and Configure makes a test request
 // to GeneratorURL to detect simple configuration mistakes.
 func Configure(ctx context.Context, db pg.DB, c *Config) error {
-	var err error
-	if !c.IsGenerator {
+	b := make([]byte, 10)
+	_, err := rand.Read(b)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	c.ID = hex.EncodeToString(b)
+
+	if c.IsGenerator {
+		c.GeneratorCoreID = c.ID
+	} else {
 		err = tryGenerator(
 			ctx,
 			c.GeneratorURL,
@@ -151,7 +269,7 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 		signingKeys = append(signingKeys, blockPub)
 	}
 
-	if c.IsGenerator {
+	if c.IsGenerator || len(c.BackupGenerators) > 0 {
 		for _, signer := range c.Signers {
 			_, err = url.Parse(signer.URL)
 			if err != nil {
@@ -162,7 +280,39 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 			}
 			signingKeys = append(signingKeys, ed25519.PublicKey(signer.Pubkey))
 		}
+	}
 
+	if len(c.BlockPolicies) > 0 {
+		if !c.IsSigner {
+			return errors.WithDetail(ErrBadBlockPolicy, "only a block signer has block policies")
+		}
+		err = checkPolicies(c.BlockPolicies)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.GeneratorRank() >= 0 {
+		err = checkBlockSchedule(c.BlockPeriod, c.MaxIdleInterval, c.MaxPendingTxs)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.BackupGenerators) > 0 {
+		err = checkFailover(c.GeneratorCoreID, c.BackupGenerators, c.FailoverTimeout, c.BlockPeriod)
+		if err != nil {
+			return err
+		}
+		if c.IsGenerator {
+			err = CheckFailoverQuorum(c.Quorum, len(signingKeys))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.IsGenerator {
 		if c.Quorum == 0 && len(signingKeys) > 0 {
 			return errors.Wrap(ErrBadQuorum)
 		}
@@ -197,19 +347,25 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 		}
 	}
 
-	b := make([]byte, 10)
-	_, err = rand.Read(b)
+	backupData, err := json.Marshal(c.BackupGenerators)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	policyData, err := json.Marshal(c.BlockPolicies)
 	if err != nil {
 		return errors.Wrap(err)
 	}
-	c.ID = hex.EncodeToString(b)
 
 	// TODO(tessr): rename block_xpub column
 	const q = `
 		INSERT INTO config (id, is_signer, block_xpub, is_generator,
 			blockchain_id, generator_url, generator_access_token,
-			remote_block_signers, max_issuance_window_ms, configured_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+			remote_block_signers, max_issuance_window_ms, configured_at,
+			backup_generators, failover_timeout_ms, block_policies,
+			block_period_ms, make_empty_blocks, max_idle_interval_ms,
+			max_pending_txs, generator_core_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), $10, $11, $12,
+			$13, $14, $15, $16, $17)
 	`
 	_, err = db.Exec(
 		ctx,
@@ -223,6 +379,14 @@ func Configure(ctx context.Context, db pg.DB, c *Config) error {
 		c.GeneratorAccessToken,
 		blockSignerData,
 		bc.DurationMillis(c.MaxIssuanceWindow),
+		backupData,
+		bc.DurationMillis(c.FailoverTimeout),
+		policyData,
+		bc.DurationMillis(c.BlockPeriod),
+		c.MakeEmptyBlocks,
+		bc.DurationMillis(c.MaxIdleInterval),
+		c.MaxPendingTxs,
+		c.GeneratorCoreID,
 	)
 	return err
 }
@@ -247,3 +411,77 @@ func tryGenerator(ctx context.Context, url, accessToken, blockchainID string) er
 
 	return nil
 }
+
+// checkFailover checks the generator's core ID, a list of backup
+// generators, and the failover timeout. Every generator needs a
+// distinct core ID. The active generator makes a block every half
+// timeout, so the timeout must be at least twice the block period.
+func checkFailover(generatorID string, backups []BackupGenerator, timeout, blockPeriod time.Duration) error {
+	if timeout <= 0 {
+		return errors.WithDetail(ErrBadFailover, "failover timeout must be positive")
+	}
+	if timeout < 2*blockPeriod {
+		return errors.WithDetail(ErrBadFailover, "failover timeout must be at least twice the block period")
+	}
+	if generatorID == "" {
+		return errors.WithDetail(ErrBadFailover, "failover needs the generator's core ID")
+	}
+	seen := map[string]bool{generatorID: true}
+	for _, g := range backups {
+		_, err := url.Parse(g.URL)
+		if err != nil || g.CoreID == "" {
+			return errors.WithDetailf(ErrBadFailover, "backup generator %q needs a core ID and valid URL", g.URL)
+		}
+		if seen[g.CoreID] {
+			return errors.WithDetailf(ErrBadFailover, "core ID %q appears more than once among the generators", g.CoreID)
+		}
+		seen[g.CoreID] = true
+	}
+	return nil
+}
+
+// CheckFailoverQuorum checks that failing over between generators
+// is safe with the given quorum of block signers. It is only if the
+// quorum is a majority: each signer signs one block per height, so
+// then two generators can't both get a quorum of signatures at the
+// same height.
+func CheckFailoverQuorum(quorum, nsigners int) error {
+	if 2*quorum <= nsigners {
+		return errors.WithDetailf(ErrBadFailover, "quorum %d is not a majority of %d block signers", quorum, nsigners)
+	}
+	return nil
+}
+
+// checkPolicies checks the settings of a list of block policies.
+func checkPolicies(policies []BlockPolicy) error {
+	for i, p := range policies {
+		switch p.Type {
+		case PolicySanctionedPrograms:
+			if len(p.ControlPrograms) == 0 {
+				return errors.WithDetailf(ErrBadBlockPolicy, "policy %d lists no control programs", i)
+			}
+		case PolicyIssuanceCap:
+			if p.AssetID == nil {
+				return errors.WithDetailf(ErrBadBlockPolicy, "policy %d has no asset ID", i)
+			}
+		default:
+			return errors.WithDetailf(ErrBadBlockPolicy, "policy %d has unknown type %q", i, p.Type)
+		}
+	}
+	return nil
+}
+
+// checkBlockSchedule checks the settings for when
+// the generator makes blocks.
+func checkBlockSchedule(period, maxIdle time.Duration, maxPending int) error {
+	if period < 10*time.Millisecond {
+		return errors.WithDetail(ErrBadBlockSchedule, "block period must be at least 10ms")
+	}
+	if maxIdle < 0 || maxIdle > 0 && maxIdle < period {
+		return errors.WithDetail(ErrBadBlockSchedule, "max idle interval must be 0 or at least the block period")
+	}
+	if maxPending < 0 {
+		return errors.WithDetail(ErrBadBlockSchedule, "max pending transactions must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"chain/errors"
+)
+
+func TestCheckBlockSchedule(t *testing.T) {
+	cases := []struct {
+		period, maxIdle time.Duration
+		maxPending      int
+		ok              bool
+	}{
+		{time.Second, 0, 0, true},
+		{time.Second, time.Minute, 100, true},
+		{time.Millisecond, 0, 0, false},
+		{time.Second, time.Millisecond, 0, false},
+		{time.Second, 0, -1, false},
+	}
+	for _, c := range cases {
+		err := checkBlockSchedule(c.period, c.maxIdle, c.maxPending)
+		if c.ok && err != nil {
+			t.Errorf("checkBlockSchedule(%v, %v, %d) = %v want nil", c.period, c.maxIdle, c.maxPending, err)
+		} else if !c.ok && errors.Root(err) != ErrBadBlockSchedule {
+			t.Errorf("checkBlockSchedule(%v, %v, %d) = %v want %v", c.period, c.maxIdle, c.maxPending, err, ErrBadBlockSchedule)
+		}
+	}
+}
+
+func TestCheckFailover(t *testing.T) {
+	backups := []BackupGenerator{{CoreID: "core2", URL: "https://backup.example.com"}}
+	err := checkFailover("core1", backups, time.Minute, time.Second)
+	if err != nil {
+		t.Errorf("checkFailover() = %v want nil", err)
+	}
+	err = checkFailover("core1", backups, time.Second, time.Second)
+	if errors.Root(err) != ErrBadFailover {
+		t.Errorf("checkFailover(short timeout) = %v want %v", err, ErrBadFailover)
+	}
+	err = checkFailover("core1", []BackupGenerator{{URL: "https://backup.example.com"}}, time.Minute, time.Second)
+	if errors.Root(err) != ErrBadFailover {
+		t.Errorf("checkFailover(no core ID) = %v want %v", err, ErrBadFailover)
+	}
+	err = checkFailover("", backups, time.Minute, time.Second)
+	if errors.Root(err) != ErrBadFailover {
+		t.Errorf("checkFailover(no generator ID) = %v want %v", err, ErrBadFailover)
+	}
+	err = checkFailover("core2", backups, time.Minute, time.Second)
+	if errors.Root(err) != ErrBadFailover {
+		t.Errorf("checkFailover(duplicate core ID) = %v want %v", err, ErrBadFailover)
+	}
+
+	if err := CheckFailoverQuorum(2, 3); err != nil {
+		t.Errorf("CheckFailoverQuorum(2, 3) = %v want nil", err)
+	}
+	if err := CheckFailoverQuorum(2, 4); errors.Root(err) != ErrBadFailover {
+		t.Errorf("CheckFailoverQuorum(2, 4) = %v want %v", err, ErrBadFailover)
+	}
+}
@@ -0,0 +1,391 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"time"
+
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/net/http/reqid"
+	"chain/protocol/bc"
+)
+
+// ErrBadUpdate is returned by ApplyUpdate for a change that is invalid,
+// or that can't be made to a configured Core.
+var ErrBadUpdate = errors.New("invalid configuration update")
+
+// An Update changes the settings of a configured Core that don't
+// affect consensus. Nil fields are left unchanged.
+//
+// Block signers are matched to the configured signers by public
+// key; only their URLs and access tokens can change, and an empty
+// access token leaves the current one. Adding or removing signers
+// changes the consensus program, and is done by rotating it instead.
+type Update struct {
+	GeneratorURL         *string             `json:"generator_url"`
+	GeneratorAccessToken *string             `json:"generator_access_token"`
+	Signers              []BlockSigner       `json:"block_signer_urls"`
+	MaxIssuanceWindow    *chainjson.Duration `json:"max_issuance_window"`
+	GeneratorCoreID      *string             `json:"generator_core_id"`
+	BackupGenerators     *[]BackupGenerator  `json:"backup_generators"`
+	FailoverTimeout      *chainjson.Duration `json:"failover_timeout"`
+	BlockPolicies        *[]BlockPolicy      `json:"block_policies"`
+	BlockPeriod          *chainjson.Duration `json:"block_period"`
+	MakeEmptyBlocks      *bool               `json:"make_empty_blocks"`
+	MaxIdleInterval      *chainjson.Duration `json:"max_idle_interval"`
+	MaxPendingTxs        *int                `json:"max_pending_txs"`
+}
+
+// UpdateRecord is an audit record of one configuration update.
+type UpdateRecord struct {
+	ID        int64                  `json:"id"`
+	Changes   map[string]interface{} `json:"changes"`
+	RequestID string                 `json:"request_id"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// errGeneratorChanged is returned by applyUpdate when the generator
+// settings it would store are not the ones ApplyUpdate checked.
+var errGeneratorChanged = errors.New("generator settings changed during update")
+
+// ApplyUpdate validates u, applies it to the stored configuration, and
+// records the change in the audit log. If the generator URL or
+// access token changes, the new ones must work. It returns the new
+// configuration. The stored configuration is locked while it is
+// updated, so concurrent updates apply one after another.
+//
+// The new generator settings are tried before taking the lock, so
+// that a slow or unreachable generator doesn't hold it. If another
+// update changes the generator settings in the meantime, they are
+// tried again.
+//
+// Running cored processes pick up the change with Watch.
+func ApplyUpdate(ctx context.Context, db *sql.DB, u *Update) (*Config, error) {
+	for {
+		var genURL, genToken string
+		if u.GeneratorURL != nil || u.GeneratorAccessToken != nil {
+			c, err := load(ctx, db, false)
+			if err != nil {
+				return nil, err
+			}
+			if c == nil {
+				return nil, errors.WithDetail(ErrBadUpdate, "core is not configured")
+			}
+			if c.IsGenerator {
+				return nil, errors.WithDetail(ErrBadUpdate, "a generator has no remote generator to change")
+			}
+			genURL, genToken = nextGenerator(c, u)
+			err = tryGenerator(ctx, genURL, genToken, c.BlockchainID.String())
+			if err != nil {
+				return nil, err
+			}
+		}
+		c, err := applyUpdate(ctx, db, u, genURL, genToken)
+		if err == errGeneratorChanged {
+			continue
+		}
+		return c, err
+	}
+}
+
+// nextGenerator returns the generator URL and access token c has
+// after applying u.
+func nextGenerator(c *Config, u *Update) (genURL, genToken string) {
+	genURL, genToken = c.GeneratorURL, c.GeneratorAccessToken
+	if u.GeneratorURL != nil {
+		genURL = *u.GeneratorURL
+	}
+	if u.GeneratorAccessToken != nil {
+		genToken = *u.GeneratorAccessToken
+	}
+	return genURL, genToken
+}
+
+// applyUpdate applies u with the stored configuration locked. If u
+// changes the generator settings, the resulting ones must be
+// genURL and genToken, which ApplyUpdate has tried.
+func applyUpdate(ctx context.Context, db *sql.DB, u *Update, genURL, genToken string) (*Config, error) {
+	dbtx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer dbtx.Rollback(ctx)
+
+	c, err := load(ctx, dbtx, true)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errors.WithDetail(ErrBadUpdate, "core is not configured")
+	}
+	next := *c
+	changes := make(map[string]interface{})
+
+	if u.GeneratorURL != nil || u.GeneratorAccessToken != nil {
+		if c.IsGenerator {
+			return nil, errors.WithDetail(ErrBadUpdate, "a generator has no remote generator to change")
+		}
+		next.GeneratorURL, next.GeneratorAccessToken = nextGenerator(c, u)
+		if next.GeneratorURL != genURL || next.GeneratorAccessToken != genToken {
+			return nil, errGeneratorChanged
+		}
+		if u.GeneratorURL != nil {
+			changes["generator_url"] = next.GeneratorURL
+		}
+		if u.GeneratorAccessToken != nil {
+			changes["generator_access_token"] = obfuscate(next.GeneratorAccessToken)
+		}
+	}
+
+	if u.Signers != nil {
+		if !c.IsGenerator {
+			return nil, errors.WithDetail(ErrBadUpdate, "only a generator has block signers")
+		}
+		next.Signers = append([]BlockSigner(nil), c.Signers...)
+		var changed []string
+		for _, s := range u.Signers {
+			_, err := url.Parse(s.URL)
+			if err != nil {
+				return nil, errors.Wrap(ErrBadSignerURL, err.Error())
+			}
+			i := signerIndex(next.Signers, s.Pubkey)
+			if i < 0 {
+				return nil, errors.WithDetailf(ErrBadUpdate, "no block signer with pubkey %x; rotate the consensus program to add signers", []byte(s.Pubkey))
+			}
+			if s.AccessToken == "" {
+				s.AccessToken = next.Signers[i].AccessToken
+			}
+			next.Signers[i] = s
+			changed = append(changed, s.URL)
+		}
+		changes["block_signer_urls"] = changed
+	}
+
+	if u.MaxIssuanceWindow != nil {
+		if !c.IsGenerator {
+			return nil, errors.WithDetail(ErrBadUpdate, "only a generator has a max issuance window")
+		}
+		if u.MaxIssuanceWindow.Duration <= 0 {
+			return nil, errors.WithDetail(ErrBadUpdate, "max issuance window must be positive")
+		}
+		next.MaxIssuanceWindow = u.MaxIssuanceWindow.Duration
+		changes["max_issuance_window"] = next.MaxIssuanceWindow.String()
+	}
+
+	if u.GeneratorCoreID != nil || u.BackupGenerators != nil || u.FailoverTimeout != nil {
+		if u.GeneratorCoreID != nil {
+			if c.IsGenerator {
+				return nil, errors.WithDetail(ErrBadUpdate, "the generator's core ID is its own")
+			}
+			next.GeneratorCoreID = *u.GeneratorCoreID
+			changes["generator_core_id"] = next.GeneratorCoreID
+		}
+		if u.BackupGenerators != nil {
+			next.BackupGenerators = *u.BackupGenerators
+			var ids []string
+			for _, g := range next.BackupGenerators {
+				ids = append(ids, g.CoreID)
+			}
+			changes["backup_generators"] = ids
+		}
+		if u.FailoverTimeout != nil {
+			next.FailoverTimeout = u.FailoverTimeout.Duration
+			changes["failover_timeout"] = next.FailoverTimeout.String()
+		}
+	}
+
+	if u.BlockPeriod != nil || u.MakeEmptyBlocks != nil || u.MaxIdleInterval != nil || u.MaxPendingTxs != nil {
+		if c.GeneratorRank() < 0 {
+			return nil, errors.WithDetail(ErrBadUpdate, "only a generator or backup generator makes blocks")
+		}
+		if u.BlockPeriod != nil {
+			next.BlockPeriod = u.BlockPeriod.Duration
+			changes["block_period"] = next.BlockPeriod.String()
+		}
+		if u.MakeEmptyBlocks != nil {
+			next.MakeEmptyBlocks = *u.MakeEmptyBlocks
+			changes["make_empty_blocks"] = next.MakeEmptyBlocks
+		}
+		if u.MaxIdleInterval != nil {
+			next.MaxIdleInterval = u.MaxIdleInterval.Duration
+			changes["max_idle_interval"] = next.MaxIdleInterval.String()
+		}
+		if u.MaxPendingTxs != nil {
+			next.MaxPendingTxs = *u.MaxPendingTxs
+			changes["max_pending_txs"] = next.MaxPendingTxs
+		}
+		err = checkBlockSchedule(next.BlockPeriod, next.MaxIdleInterval, next.MaxPendingTxs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(next.BackupGenerators) > 0 {
+		err = checkFailover(next.GeneratorCoreID, next.BackupGenerators, next.FailoverTimeout, next.BlockPeriod)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if u.BlockPolicies != nil {
+		if !c.IsSigner {
+			return nil, errors.WithDetail(ErrBadUpdate, "only a block signer has block policies")
+		}
+		err = checkPolicies(*u.BlockPolicies)
+		if err != nil {
+			return nil, err
+		}
+		next.BlockPolicies = *u.BlockPolicies
+		changes["block_policies"] = next.BlockPolicies
+	}
+
+	if len(changes) == 0 {
+		return c, nil
+	}
+
+	var signerData []byte
+	if len(next.Signers) > 0 {
+		signerData, err = json.Marshal(next.Signers)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+	backupData, err := json.Marshal(next.BackupGenerators)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	policyData, err := json.Marshal(next.BlockPolicies)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	changeData, err := json.Marshal(changes)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	const (
+		updateQ = `
+			UPDATE config SET generator_url=$1, generator_access_token=$2,
+				remote_block_signers=$3, max_issuance_window_ms=$4,
+				backup_generators=$5, failover_timeout_ms=$6,
+				block_policies=$7, block_period_ms=$8, make_empty_blocks=$9,
+				max_idle_interval_ms=$10, max_pending_txs=$11,
+				generator_core_id=$12
+		`
+		auditQ = `INSERT INTO config_updates (changes, request_id) VALUES ($1, $2)`
+	)
+	_, err = dbtx.Exec(ctx, updateQ,
+		next.GeneratorURL,
+		next.GeneratorAccessToken,
+		signerData,
+		bc.DurationMillis(next.MaxIssuanceWindow),
+		backupData,
+		bc.DurationMillis(next.FailoverTimeout),
+		policyData,
+		bc.DurationMillis(next.BlockPeriod),
+		next.MakeEmptyBlocks,
+		bc.DurationMillis(next.MaxIdleInterval),
+		next.MaxPendingTxs,
+		next.GeneratorCoreID,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating config")
+	}
+	_, err = dbtx.Exec(ctx, auditQ, changeData, reqid.FromContext(ctx))
+	if err != nil {
+		return nil, errors.Wrap(err, "recording config update")
+	}
+	err = dbtx.Commit(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "commit transaction")
+	}
+	log.Write(ctx, "at", "config updated", "changes", string(changeData))
+	return &next, nil
+}
+
+// Updates returns up to limit audit records of configuration
+// updates, most recent first, starting before the record with ID
+// before if it is positive.
+func Updates(ctx context.Context, db pg.DB, before int64, limit int) ([]*UpdateRecord, error) {
+	const q = `
+		SELECT id, changes, request_id, created_at FROM config_updates
+		WHERE ($1 <= 0 OR id < $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	var recs []*UpdateRecord
+	err := pg.ForQueryRows(ctx, db, q, before, limit, func(id int64, changes []byte, requestID string, createdAt time.Time) error {
+		r := &UpdateRecord{ID: id, RequestID: requestID, CreatedAt: createdAt}
+		err := json.Unmarshal(changes, &r.Changes)
+		if err != nil {
+			return errors.Wrap(err, "decoding changes")
+		}
+		recs = append(recs, r)
+		return nil
+	})
+	return recs, errors.Wrap(err, "querying config updates")
+}
+
+// Watch runs until ctx is canceled, checking for configuration
+// updates once per period, and calls f with the new configuration
+// after each one.
+func Watch(ctx context.Context, db pg.DB, period time.Duration, f func(*Config)) {
+	const q = `SELECT COALESCE(MAX(id), 0) FROM config_updates`
+	var last int64
+	err := db.QueryRow(ctx, q).Scan(&last)
+	if err != nil {
+		log.Error(ctx, err, "checking for config updates")
+	}
+
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+
+		var id int64
+		err := db.QueryRow(ctx, q).Scan(&id)
+		if err != nil {
+			log.Error(ctx, err, "checking for config updates")
+			continue
+		}
+		if id == last {
+			continue
+		}
+		c, err := Load(ctx, db)
+		if err != nil {
+			log.Error(ctx, err, "reloading config")
+			continue
+		}
+		last = id
+		f(c)
+	}
+}
+
+func signerIndex(signers []BlockSigner, pub []byte) int {
+	for i, s := range signers {
+		if bytes.Equal(s.Pubkey, pub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// obfuscate hides the secret part of an access token,
+// for the audit log.
+func obfuscate(token string) string {
+	toks := strings.SplitN(token, ":", 2)
+	if len(toks) > 1 {
+		return toks[0] + ":********"
+	}
+	return toks[0]
+}
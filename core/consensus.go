@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+
+	"chain/core/config"
+	"chain/core/generator"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+)
+
+type consensusApproval struct {
+	Height           uint64             `json:"height"`
+	ConsensusProgram chainjson.HexBytes `json:"consensus_program"`
+}
+
+// POST /propose-consensus-program
+//
+// proposeConsensusProgram proposes a new federation of block
+// signers, taking effect in the block at the given height. The
+// operator of each signer of both the current and the new
+// federation approves it with /approve-consensus-program on that
+// signer's Core, and the approvals are given to the generator with
+// /add-consensus-program-approvals.
+func (h *Handler) proposeConsensusProgram(ctx context.Context, req struct {
+	Height  uint64               `json:"height"`
+	Signers []config.BlockSigner `json:"block_signers"`
+	Quorum  int                  `json:"quorum"`
+}) (*generator.Rotation, error) {
+	if !h.Config.IsGenerator {
+		return nil, errors.WithDetail(generator.ErrBadRotation, "only the generator can propose a consensus program")
+	}
+	height := h.Chain.Height()
+	if req.Height <= height {
+		return nil, errors.WithDetailf(generator.ErrBadRotation, "height must be greater than the current height %d", height)
+	}
+	return generator.ProposeRotation(ctx, h.DB, h.Config, req.Height, req.Signers, req.Quorum)
+}
+
+// POST /approve-consensus-program
+//
+// approveConsensusProgram approves a proposed consensus program on
+// behalf of this Core's block signer, and returns its approval, to
+// be given to the generator.
+func (h *Handler) approveConsensusProgram(ctx context.Context, req consensusApproval) (map[string]chainjson.HexBytes, error) {
+	if h.ApproveConsensusProgram == nil {
+		return nil, errors.WithDetail(generator.ErrBadRotation, "this Core is not a block signer")
+	}
+	sig, err := h.ApproveConsensusProgram(ctx, req.Height, req.ConsensusProgram)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]chainjson.HexBytes{h.Config.BlockPub: sig}, nil
+}
+
+// POST /add-consensus-program-approvals
+//
+// addConsensusProgramApprovals adds signers' approvals, as returned
+// by /approve-consensus-program and keyed by hex block pubkey, to
+// the rotation at the given height. Invalid approvals are ignored.
+func (h *Handler) addConsensusProgramApprovals(ctx context.Context, req struct {
+	Height    uint64                        `json:"height"`
+	Approvals map[string]chainjson.HexBytes `json:"approvals"`
+}) (*generator.Rotation, error) {
+	if !h.Config.IsGenerator {
+		return nil, errors.WithDetail(generator.ErrBadRotation, "only the generator collects approvals")
+	}
+	rot, err := generator.FindRotation(ctx, h.DB, req.Height)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := h.Chain.GetBlock(ctx, h.Chain.Height())
+	if err != nil {
+		return nil, errors.Wrap(err, "getting latest block")
+	}
+	sigs := make(map[string][]byte, len(req.Approvals))
+	for pub, sig := range req.Approvals {
+		sigs[pub] = sig
+	}
+	err = rot.Approve(ctx, h.DB, h.Config.BlockchainID, latest, sigs)
+	return rot, err
+}
+
+// POST /get-consensus-program-rotation
+func (h *Handler) getConsensusProgramRotation(ctx context.Context, in struct {
+	Height uint64 `json:"height"`
+}) (*generator.Rotation, error) {
+	return generator.FindRotation(ctx, h.DB, in.Height)
+}
@@ -0,0 +1,527 @@
+// Package consolidate merges many small account UTXOs into a single
+// larger one by spending them back to the same account.
+//
+// Consolidation follows per-account, per-asset policies. A policy
+// is run on its schedule by the leader process, and can also be
+// triggered on demand.
+package consolidate
+
+import (
+	"context"
+	"database/sql"
+	stdjson "encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/account"
+	"chain/core/signers"
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+// maxInputs limits the size of each consolidation transaction.
+// Accounts with more candidate UTXOs are consolidated over several
+// runs.
+const maxInputs = 100
+
+// txTTL is how long the reservations made for a consolidation
+// transaction are held.
+const txTTL = 5 * time.Minute
+
+var ErrBadPolicy = errors.New("invalid consolidation policy")
+
+// Run statuses. A run is pending while its transaction has been
+// submitted but not yet seen in a block.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// A Policy says when to consolidate the UTXOs of one asset held by
+// one account.
+type Policy struct {
+	ID        string     `json:"id"`
+	AccountID string     `json:"account_id"`
+	AssetID   bc.AssetID `json:"asset_id"`
+
+	// MaxUTXOs is the number of candidate UTXOs the account may
+	// hold before a scheduled run consolidates them.
+	MaxUTXOs int `json:"max_utxos"`
+
+	// MinAmount, if nonzero, restricts consolidation to UTXOs
+	// smaller than this amount.
+	MinAmount uint64 `json:"min_amount"`
+
+	// Period is how often the policy is checked.
+	Period json.Duration `json:"period"`
+
+	Paused    bool       `json:"paused"`
+	LastRunAt *time.Time `json:"last_run_at"`
+}
+
+// A Run records one attempt to apply a policy.
+type Run struct {
+	ID         string    `json:"id"`
+	PolicyID   string    `json:"policy_id"`
+	Status     string    `json:"status"`
+	TxID       *bc.Hash  `json:"transaction_id"`
+	Inputs     int       `json:"inputs"`
+	Amount     uint64    `json:"amount"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// SubmitFunc finalizes and submits a signed transaction template.
+type SubmitFunc func(context.Context, *txbuilder.Template) error
+
+// Manager stores consolidation policies and runs them.
+type Manager struct {
+	DB       pg.DB
+	Chain    *protocol.Chain
+	Accounts *account.Manager
+}
+
+// CreatePolicy validates and stores a new policy.
+func (m *Manager) CreatePolicy(ctx context.Context, p *Policy) (*Policy, error) {
+	if p.MaxUTXOs < 1 {
+		return nil, errors.WithDetail(ErrBadPolicy, "max_utxos must be positive")
+	}
+	if p.Period.Duration < time.Minute {
+		return nil, errors.WithDetail(ErrBadPolicy, "period must be at least one minute")
+	}
+	if p.AssetID == (bc.AssetID{}) {
+		return nil, errors.WithDetail(ErrBadPolicy, "asset_id is required")
+	}
+	_, err := signers.Find(ctx, m.DB, "account", p.AccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding account")
+	}
+
+	const q = `
+		INSERT INTO consolidation_policies
+			(account_id, asset_id, max_utxos, min_amount, period_ms, paused)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+	err = m.DB.QueryRow(ctx, q,
+		p.AccountID, p.AssetID, p.MaxUTXOs, p.MinAmount,
+		int64(p.Period.Duration/time.Millisecond), p.Paused,
+	).Scan(&p.ID)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrBadPolicy, "a policy for this account and asset already exists")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "inserting consolidation policy")
+	}
+	return p, nil
+}
+
+// Policies returns all consolidation policies.
+func (m *Manager) Policies(ctx context.Context) ([]*Policy, error) {
+	return m.policies(ctx, "TRUE")
+}
+
+// Policy returns the policy with the given ID.
+func (m *Manager) Policy(ctx context.Context, id string) (*Policy, error) {
+	ps, err := m.policies(ctx, "id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "consolidation policy %s", id)
+	}
+	return ps[0], nil
+}
+
+func (m *Manager) policies(ctx context.Context, pred string, args ...interface{}) ([]*Policy, error) {
+	q := fmt.Sprintf(`
+		SELECT id, account_id, asset_id, max_utxos, min_amount, period_ms, paused, last_run_at
+		FROM consolidation_policies
+		WHERE %s
+		ORDER BY id
+	`, pred)
+	var ps []*Policy
+	scan := func(id, accountID string, assetID bc.AssetID, maxUTXOs int, minAmount uint64, periodMS int64, paused bool, lastRunAt *time.Time) {
+		ps = append(ps, &Policy{
+			ID:        id,
+			AccountID: accountID,
+			AssetID:   assetID,
+			MaxUTXOs:  maxUTXOs,
+			MinAmount: minAmount,
+			Period:    json.Duration{Duration: time.Duration(periodMS) * time.Millisecond},
+			Paused:    paused,
+			LastRunAt: lastRunAt,
+		})
+	}
+	err := pg.ForQueryRows(ctx, m.DB, q, append(args, scan)...)
+	return ps, errors.Wrap(err, "querying consolidation policies")
+}
+
+// SetPaused pauses or resumes the scheduled runs of a policy.
+// A paused policy can still be triggered.
+func (m *Manager) SetPaused(ctx context.Context, id string, paused bool) (*Policy, error) {
+	const q = `UPDATE consolidation_policies SET paused=$2 WHERE id=$1`
+	res, err := m.DB.Exec(ctx, q, id, paused)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating consolidation policy")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "consolidation policy %s", id)
+	}
+	return m.Policy(ctx, id)
+}
+
+// Runs returns up to limit runs of a policy, most recent first,
+// starting after the run with ID after if it is nonempty.
+func (m *Manager) Runs(ctx context.Context, policyID, after string, limit int) ([]*Run, error) {
+	const q = `
+		SELECT id, policy_id, status, tx_id, inputs, amount, error, started_at, finished_at
+		FROM consolidation_runs
+		WHERE policy_id=$1 AND ($2='' OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	var runs []*Run
+	err := pg.ForQueryRows(ctx, m.DB, q, policyID, after, limit, func(id, policyID, status string, txID sql.NullString, inputs int, amount uint64, errStr string, startedAt, finishedAt time.Time) error {
+		r := &Run{
+			ID:         id,
+			PolicyID:   policyID,
+			Status:     status,
+			Inputs:     inputs,
+			Amount:     amount,
+			Error:      errStr,
+			StartedAt:  startedAt,
+			FinishedAt: finishedAt,
+		}
+		if txID.Valid {
+			r.TxID = new(bc.Hash)
+			err := r.TxID.UnmarshalText([]byte(txID.String))
+			if err != nil {
+				return err
+			}
+		}
+		runs = append(runs, r)
+		return nil
+	})
+	return runs, errors.Wrap(err, "querying consolidation runs")
+}
+
+// Trigger runs a policy immediately, consolidating its candidate
+// UTXOs even if there are no more than MaxUTXOs of them.
+func (m *Manager) Trigger(ctx context.Context, id string, signFn txbuilder.SignFunc, submit SubmitFunc) (*Run, error) {
+	p, err := m.Policy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return m.run(ctx, p, true, signFn, submit)
+}
+
+// Run checks every unpaused policy once per period, running those
+// whose own period has elapsed since their last run. It blocks
+// until ctx is canceled, and should run only on the leader.
+func (m *Manager) Run(ctx context.Context, period time.Duration, signFn txbuilder.SignFunc, submit SubmitFunc) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, consolidation exiting")
+			return
+		case <-ticks:
+			err := m.reconcile(ctx, submit)
+			if err != nil {
+				log.Error(ctx, err)
+				continue
+			}
+			ps, err := m.Policies(ctx)
+			if err != nil {
+				log.Error(ctx, err)
+				continue
+			}
+			for _, p := range ps {
+				if p.Paused || (p.LastRunAt != nil && time.Since(*p.LastRunAt) < p.Period.Duration) {
+					continue
+				}
+				_, err := m.run(ctx, p, false, signFn, submit)
+				if err != nil {
+					log.Error(ctx, err, "consolidation policy ", p.ID)
+				}
+			}
+		}
+	}
+}
+
+// run applies p once and records the result. Failures to
+// consolidate are recorded in the run rather than returned.
+func (m *Manager) run(ctx context.Context, p *Policy, force bool, signFn txbuilder.SignFunc, submit SubmitFunc) (*Run, error) {
+	r := &Run{PolicyID: p.ID, StartedAt: time.Now()}
+	err := m.consolidate(ctx, p, force, r, signFn, submit)
+	if err != nil {
+		if r.Status != StatusPending {
+			r.Status = StatusFailed
+		}
+		r.Error = err.Error()
+	}
+	r.FinishedAt = time.Now()
+
+	const (
+		insertQ = `
+			INSERT INTO consolidation_runs
+				(policy_id, status, tx_id, inputs, amount, error, started_at, finished_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id
+		`
+		updateQ = `UPDATE consolidation_policies SET last_run_at=$2 WHERE id=$1`
+	)
+	if r.ID == "" {
+		var txID sql.NullString
+		if r.TxID != nil {
+			txID = sql.NullString{String: r.TxID.String(), Valid: true}
+		}
+		err = m.DB.QueryRow(ctx, insertQ,
+			r.PolicyID, r.Status, txID, r.Inputs, r.Amount, r.Error, r.StartedAt, r.FinishedAt,
+		).Scan(&r.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "recording consolidation run")
+		}
+	} else {
+		// The run was recorded before its transaction was
+		// submitted.
+		err = m.finish(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, err = m.DB.Exec(ctx, updateQ, p.ID, r.StartedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating consolidation policy")
+	}
+	return r, nil
+}
+
+func (m *Manager) consolidate(ctx context.Context, p *Policy, force bool, r *Run, signFn txbuilder.SignFunc, submit SubmitFunc) error {
+	const q = `
+		SELECT tx_hash, index, amount FROM account_utxos
+		WHERE account_id=$1 AND asset_id=$2 AND reservation_id IS NULL
+			AND confirmed_in IS NOT NULL
+			AND ($3::bigint=0 OR amount < $3::bigint)
+		ORDER BY amount
+	`
+	var (
+		outpoints []bc.Outpoint
+		amounts   []uint64
+	)
+	err := pg.ForQueryRows(ctx, m.DB, q, p.AccountID, p.AssetID, p.MinAmount, func(hash bc.Hash, index uint32, amount uint64) {
+		outpoints = append(outpoints, bc.Outpoint{Hash: hash, Index: index})
+		amounts = append(amounts, amount)
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying candidate utxos")
+	}
+	if len(outpoints) < 2 || (!force && len(outpoints) <= p.MaxUTXOs) {
+		r.Status = StatusSkipped
+		return nil
+	}
+	if len(outpoints) > maxInputs {
+		outpoints = outpoints[:maxInputs]
+	}
+
+	var actions []txbuilder.Action
+	for i, o := range outpoints {
+		actions = append(actions, m.Accounts.NewSpendUTXOAction(o))
+		r.Amount += amounts[i]
+	}
+	actions = append(actions, m.Accounts.NewControlAction(bc.AssetAmount{AssetID: p.AssetID, Amount: r.Amount}, p.AccountID, nil))
+
+	tpl, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(txTTL))
+	if err != nil {
+		return errors.Wrap(err, "building consolidation transaction")
+	}
+	r.Inputs = len(outpoints)
+
+	signer, err := signers.Find(ctx, m.DB, "account", p.AccountID)
+	if err != nil {
+		return errors.Wrap(err, "finding account")
+	}
+	var xpubs []string
+	for _, xpub := range signer.XPubs {
+		xpubs = append(xpubs, xpub.String())
+	}
+	err = txbuilder.Sign(ctx, tpl, xpubs, signFn)
+	if err != nil {
+		m.cancelReservations(ctx, outpoints)
+		return errors.Wrap(err, "signing consolidation transaction")
+	}
+
+	txID := tpl.Transaction.Hash()
+	r.TxID = &txID
+	err = m.recordTx(ctx, r, tpl)
+	if err != nil {
+		m.cancelReservations(ctx, outpoints)
+		return err
+	}
+	err = submit(ctx, tpl)
+	if errors.Root(err) == txbuilder.ErrRejected {
+		// The transaction conflicts with the blockchain,
+		// so it cannot land.
+		m.cancelReservations(ctx, outpoints)
+		r.Status = StatusFailed
+		return errors.Wrap(err, "submitting consolidation transaction")
+	} else if err != nil {
+		// The transaction may still land, so its UTXOs stay
+		// reserved and the run stays pending until reconcile
+		// finds out.
+		return errors.Wrap(err, "submitting consolidation transaction")
+	}
+	r.Status = StatusSucceeded
+	return nil
+}
+
+// recordTx saves r as pending, with its signed transaction and
+// the height from which to look for it in the blockchain, before
+// the transaction is submitted.
+func (m *Manager) recordTx(ctx context.Context, r *Run, tpl *txbuilder.Template) error {
+	const q = `
+		INSERT INTO consolidation_runs
+			(policy_id, status, tx_id, inputs, amount, started_at, finished_at, template, submit_height)
+		VALUES ($1, 'pending', $2, $3, $4, $5, $5, $6, $7)
+		RETURNING id
+	`
+	tplJSON, err := stdjson.Marshal(tpl)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	err = m.DB.QueryRow(ctx, q,
+		r.PolicyID, r.TxID.String(), r.Inputs, r.Amount, r.StartedAt, tplJSON, m.Chain.Height(),
+	).Scan(&r.ID)
+	if err != nil {
+		return errors.Wrap(err, "recording consolidation transaction")
+	}
+	r.Status = StatusPending
+	return nil
+}
+
+// finish records the outcome of the pending run r.
+func (m *Manager) finish(ctx context.Context, r *Run) error {
+	const q = `
+		UPDATE consolidation_runs SET status=$2, error=$3, finished_at=$4
+		WHERE id=$1 AND status='pending'
+	`
+	_, err := m.DB.Exec(ctx, q, r.ID, r.Status, r.Error, r.FinishedAt)
+	return errors.Wrap(err, "updating consolidation run")
+}
+
+// reconcile settles the runs left pending by an earlier run whose
+// submission failed or was interrupted. Each pending transaction is
+// looked for in the blockchain by its hash. If it is there, the run
+// succeeded. If it has expired without landing, or is rejected when
+// submitted again, the run failed. Otherwise it stays pending.
+func (m *Manager) reconcile(ctx context.Context, submit SubmitFunc) error {
+	const q = `
+		SELECT id, template, submit_height FROM consolidation_runs
+		WHERE status='pending'
+		ORDER BY id
+	`
+	type pending struct {
+		run    *Run
+		tpl    *txbuilder.Template
+		height uint64
+	}
+	var runs []pending
+	err := pg.ForQueryRows(ctx, m.DB, q, func(id string, tplJSON []byte, height uint64) error {
+		p := pending{run: &Run{ID: id}, tpl: new(txbuilder.Template), height: height}
+		runs = append(runs, p)
+		return stdjson.Unmarshal(tplJSON, p.tpl)
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying pending consolidation runs")
+	}
+
+	for _, p := range runs {
+		r := p.run
+		landed, expired, err := txbuilder.FindTx(ctx, m.Chain, p.tpl.Transaction, p.height)
+		if err != nil {
+			return err
+		}
+		switch {
+		case landed:
+			r.Status = StatusSucceeded
+		case expired:
+			r.Status, r.Error = StatusFailed, "transaction expired before confirmation"
+		default:
+			err = submit(ctx, p.tpl)
+			if errors.Root(err) == txbuilder.ErrRejected {
+				m.cancelReservations(ctx, spentOutpoints(p.tpl.Transaction))
+				r.Status, r.Error = StatusFailed, err.Error()
+			} else if err != nil {
+				log.Error(ctx, err, "resubmitting consolidation run ", r.ID)
+				continue
+			} else {
+				r.Status = StatusSucceeded
+			}
+		}
+		r.FinishedAt = time.Now()
+		err = m.finish(ctx, r)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// spentOutpoints returns the outpoints spent by tx.
+func spentOutpoints(tx *bc.TxData) []bc.Outpoint {
+	var outpoints []bc.Outpoint
+	for _, in := range tx.Inputs {
+		if !in.IsIssuance() {
+			outpoints = append(outpoints, in.Outpoint())
+		}
+	}
+	return outpoints
+}
+
+// cancelReservations releases the reservations a failed
+// consolidation transaction made on outpoints, so the UTXOs
+// don't stay locked until the reservations expire. Like a
+// build's rollback, it is best-effort.
+func (m *Manager) cancelReservations(ctx context.Context, outpoints []bc.Outpoint) {
+	const q = `
+		SELECT DISTINCT reservation_id FROM account_utxos
+		WHERE (tx_hash, index) IN (SELECT unnest($1::text[]), unnest($2::integer[]))
+			AND reservation_id IS NOT NULL
+	`
+	var (
+		hashes  pq.StringArray
+		indexes pq.Int64Array
+	)
+	for _, o := range outpoints {
+		hashes = append(hashes, o.Hash.String())
+		indexes = append(indexes, int64(o.Index))
+	}
+	var ids []int32
+	err := pg.ForQueryRows(ctx, m.DB, q, hashes, indexes, func(id int32) {
+		ids = append(ids, id)
+	})
+	if err != nil {
+		log.Error(ctx, err, "finding consolidation reservations")
+		return
+	}
+	for _, id := range ids {
+		_, err = m.Accounts.CancelReservation(ctx, id)
+		if err != nil {
+			log.Error(ctx, err, "canceling consolidation reservation ", id)
+		}
+	}
+}
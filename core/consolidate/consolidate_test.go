@@ -0,0 +1,160 @@
+package consolidate_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/consolidate"
+	"chain/core/coretest"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestCreatePolicyValidation(t *testing.T) {
+	m := &consolidate.Manager{}
+	cases := []consolidate.Policy{
+		{MaxUTXOs: 0, Period: json.Duration{Duration: time.Hour}, AssetID: bc.AssetID{1}},
+		{MaxUTXOs: 10, Period: json.Duration{Duration: time.Second}, AssetID: bc.AssetID{1}},
+		{MaxUTXOs: 10, Period: json.Duration{Duration: time.Hour}},
+	}
+	for i, p := range cases {
+		_, err := m.CreatePolicy(context.Background(), &p)
+		if errors.Root(err) != consolidate.ErrBadPolicy {
+			t.Errorf("case %d: got error %v want %v", i, err, consolidate.ErrBadPolicy)
+		}
+	}
+}
+
+func TestTrigger(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	for i := uint64(1); i <= 3; i++ {
+		coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, i, accID)
+	}
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	m := &consolidate.Manager{DB: db, Chain: c, Accounts: accounts}
+	p, err := m.CreatePolicy(ctx, &consolidate.Policy{
+		AccountID: accID,
+		AssetID:   assetID,
+		MaxUTXOs:  10,
+		Period:    json.Duration{Duration: time.Hour},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+	submit := func(ctx context.Context, tpl *txbuilder.Template) error {
+		return txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+	}
+	r, err := m.Trigger(ctx, p.ID, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if r.Status != consolidate.StatusSucceeded {
+		t.Fatalf("run status = %s (%s) want %s", r.Status, r.Error, consolidate.StatusSucceeded)
+	}
+	if r.Inputs != 3 || r.Amount != 6 {
+		t.Errorf("run consolidated %d inputs totaling %d, want 3 totaling 6", r.Inputs, r.Amount)
+	}
+
+	runs, err := m.Runs(ctx, p.ID, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(runs) != 1 || runs[0].ID != r.ID {
+		t.Errorf("got runs %v want [%s]", runs, r.ID)
+	}
+}
+
+func TestTriggerPending(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		accID   = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	for i := uint64(1); i <= 3; i++ {
+		coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, i, accID)
+	}
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	m := &consolidate.Manager{DB: db, Chain: c, Accounts: accounts}
+	p, err := m.CreatePolicy(ctx, &consolidate.Policy{
+		AccountID: accID,
+		AssetID:   assetID,
+		MaxUTXOs:  10,
+		Period:    json.Duration{Duration: time.Hour},
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+	// The transaction reaches the pool, but confirmation times out.
+	submit := func(ctx context.Context, tpl *txbuilder.Template) error {
+		err := txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+		if err != nil {
+			return err
+		}
+		return context.DeadlineExceeded
+	}
+	r, err := m.Trigger(ctx, p.ID, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if r.Status != consolidate.StatusPending || r.TxID == nil {
+		t.Fatalf("run status = %s, tx %v want %s with a transaction", r.Status, r.TxID, consolidate.StatusPending)
+	}
+
+	// The pending transaction's UTXOs stay reserved,
+	// so they aren't consolidated again.
+	r, err = m.Trigger(ctx, p.ID, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if r.Status != consolidate.StatusSkipped {
+		t.Errorf("second run status = %s (%s) want %s", r.Status, r.Error, consolidate.StatusSkipped)
+	}
+}
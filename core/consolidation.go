@@ -0,0 +1,95 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/consolidate"
+	"chain/core/txbuilder"
+	"chain/net/http/httpjson"
+)
+
+// consolidationSubmitTimeout bounds how long a consolidation run
+// waits for its transaction to be confirmed.
+const consolidationSubmitTimeout = time.Minute
+
+// RunConsolidation runs scheduled UTXO consolidation, checking the
+// consolidation policies once per period. It signs with the Mock
+// HSM. It blocks until ctx is canceled, and should run only on the
+// leader.
+func (h *Handler) RunConsolidation(ctx context.Context, period time.Duration) {
+	h.Consolidator.Run(ctx, period, h.mockhsmSignTemplate, h.submitConsolidation)
+}
+
+func (h *Handler) submitConsolidation(ctx context.Context, tpl *txbuilder.Template) error {
+	ctx, cancel := context.WithTimeout(ctx, consolidationSubmitTimeout)
+	defer cancel()
+	return h.finalizeTxWait(ctx, tpl, "confirmed")
+}
+
+// POST /create-consolidation-policy
+func (h *Handler) createConsolidationPolicy(ctx context.Context, in struct {
+	consolidate.Policy
+	AccountAlias string `json:"account_alias"`
+}) (*consolidate.Policy, error) {
+	if in.AccountID == "" && in.AccountAlias != "" {
+		acc, err := h.Accounts.FindByAlias(ctx, in.AccountAlias)
+		if err != nil {
+			return nil, err
+		}
+		in.AccountID = acc.ID
+	}
+	return h.Consolidator.CreatePolicy(ctx, &in.Policy)
+}
+
+// POST /list-consolidation-policies
+func (h *Handler) listConsolidationPolicies(ctx context.Context, in requestQuery) (page, error) {
+	policies, err := h.Consolidator.Policies(ctx)
+	if err != nil {
+		return page{}, err
+	}
+	return page{
+		Items:    httpjson.Array(policies),
+		LastPage: true,
+		Next:     in,
+	}, nil
+}
+
+// POST /update-consolidation-policy
+//
+// Only the paused state of a policy can be changed.
+func (h *Handler) updateConsolidationPolicy(ctx context.Context, in struct {
+	ID     string `json:"id"`
+	Paused bool   `json:"paused"`
+}) (*consolidate.Policy, error) {
+	return h.Consolidator.SetPaused(ctx, in.ID, in.Paused)
+}
+
+// POST /trigger-consolidation
+func (h *Handler) triggerConsolidation(ctx context.Context, in struct {
+	PolicyID string `json:"policy_id"`
+}) (*consolidate.Run, error) {
+	return h.Consolidator.Trigger(ctx, in.PolicyID, h.mockhsmSignTemplate, h.submitConsolidation)
+}
+
+// POST /list-consolidation-runs
+func (h *Handler) listConsolidationRuns(ctx context.Context, in struct {
+	PolicyID string `json:"policy_id"`
+	After    string `json:"after"`
+}) (interface{}, error) {
+	limit := defGenericPageSize
+	runs, err := h.Consolidator.Runs(ctx, in.PolicyID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(runs) > 0 {
+		next.After = runs[len(runs)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(runs), next, len(runs) < limit}, nil
+}
@@ -0,0 +1,554 @@
+// Package coordinate lets several Cores build and sign a single
+// transaction together, such as a two-Core atomic swap.
+//
+// One Core hosts a session holding the shared transaction template.
+// Each participant contributes actions, which extend the
+// template's transaction, and once every participant has
+// contributed, signs the complete transaction. When the collected
+// signatures satisfy every signing instruction, the host submits
+// the transaction.
+//
+// Participants authenticate to the host with secret tokens issued
+// when the session is created. Each participant remembers what it
+// contributed, and signs only its own inputs, and only if the
+// complete transaction still includes its contribution unchanged.
+package coordinate
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	stdsql "database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/crypto/sha3pool"
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+const tokenSize = 32
+
+var (
+	ErrBadContribution = errors.New("invalid contribution to coordination session")
+	ErrSessionState    = errors.New("coordination session is not in the required state")
+	ErrBadParticipant  = errors.New("invalid coordination session participant token")
+)
+
+// Session statuses.
+const (
+	StatusCollecting = "collecting"
+	StatusSigning    = "signing"
+	StatusSubmitted  = "submitted"
+	StatusFailed     = "failed"
+)
+
+// A Session is a transaction being built and signed by several
+// Cores.
+type Session struct {
+	ID           string              `json:"id"`
+	Status       string              `json:"status"`
+	Template     *txbuilder.Template `json:"template"`
+	Participants []*Participant      `json:"participants"`
+	TxID         *bc.Hash            `json:"transaction_id"`
+	Error        string              `json:"error,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// A Participant is a Core taking part in a session, identified by
+// its URL. It authenticates to the host with Token, which is set
+// only in the session returned by Create; the host keeps just its
+// hash.
+type Participant struct {
+	CoreURL     string `json:"core_url"`
+	Token       string `json:"token,omitempty"`
+	Contributed bool   `json:"contributed"`
+	Signed      bool   `json:"signed"`
+
+	hashedToken []byte
+}
+
+// storedParticipant is the form of a Participant kept in the
+// database.
+type storedParticipant struct {
+	CoreURL     string             `json:"core_url"`
+	HashedToken chainjson.HexBytes `json:"hashed_token"`
+	Contributed bool               `json:"contributed"`
+	Signed      bool               `json:"signed"`
+}
+
+// participant returns the participant authenticated by token.
+func (s *Session) participant(token string) (*Participant, error) {
+	var h [32]byte
+	sha3pool.Sum256(h[:], []byte(token))
+	for _, p := range s.Participants {
+		if len(p.hashedToken) > 0 && subtle.ConstantTimeCompare(p.hashedToken, h[:]) == 1 {
+			return p, nil
+		}
+	}
+	return nil, errors.WithDetailf(ErrBadParticipant, "token is not valid for session %s", s.ID)
+}
+
+// Manager stores coordination sessions hosted by this Core.
+type Manager struct {
+	DB *sql.DB
+}
+
+// Create starts a session among the Cores at the given URLs,
+// including the host itself if it will contribute. The returned
+// session holds each participant's token, which the caller must
+// pass on to that participant; it is not available afterward.
+func (m *Manager) Create(ctx context.Context, coreURLs []string) (*Session, error) {
+	if len(coreURLs) < 2 {
+		return nil, errors.WithDetail(ErrBadContribution, "a session needs at least two participants")
+	}
+	s := &Session{
+		Status: StatusCollecting,
+		Template: &txbuilder.Template{
+			Transaction:         &bc.TxData{Version: bc.CurrentTransactionVersion},
+			SigningInstructions: []*txbuilder.SigningInstruction{},
+		},
+	}
+	seen := make(map[string]bool)
+	for _, u := range coreURLs {
+		if u == "" || seen[u] {
+			return nil, errors.WithDetailf(ErrBadContribution, "participant URLs must be nonempty and distinct")
+		}
+		seen[u] = true
+		var secret [tokenSize]byte
+		_, err := rand.Read(secret[:])
+		if err != nil {
+			return nil, errors.Wrap(err, "generating participant token")
+		}
+		p := &Participant{CoreURL: u, Token: hex.EncodeToString(secret[:])}
+		var h [32]byte
+		sha3pool.Sum256(h[:], []byte(p.Token))
+		p.hashedToken = h[:]
+		s.Participants = append(s.Participants, p)
+	}
+
+	tplJSON, partsJSON, err := marshalSession(s)
+	if err != nil {
+		return nil, err
+	}
+	const q = `
+		INSERT INTO coordination_sessions (status, template, participants)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+	err = m.DB.QueryRow(ctx, q, s.Status, tplJSON, partsJSON).Scan(&s.ID, &s.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting coordination session")
+	}
+	return s, nil
+}
+
+// Find returns the session with the given ID.
+func (m *Manager) Find(ctx context.Context, id string) (*Session, error) {
+	ss, err := m.sessions(ctx, m.DB, "id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "coordination session %s", id)
+	}
+	return ss[0], nil
+}
+
+// List returns up to limit sessions, most recent first, starting
+// after the session with ID after if it is nonempty.
+func (m *Manager) List(ctx context.Context, after string, limit int) ([]*Session, error) {
+	return m.sessions(ctx, m.DB, `
+		($1='' OR id < $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`, after, limit)
+}
+
+func (m *Manager) sessions(ctx context.Context, db pg.DB, pred string, args ...interface{}) ([]*Session, error) {
+	q := fmt.Sprintf(`
+		SELECT id, status, template, participants, tx_id, error, created_at
+		FROM coordination_sessions
+		WHERE %s
+	`, pred)
+	var ss []*Session
+	scan := func(id, status string, tplJSON, partsJSON []byte, txID stdsql.NullString, errStr string, createdAt time.Time) error {
+		s := &Session{ID: id, Status: status, Error: errStr, CreatedAt: createdAt}
+		err := json.Unmarshal(tplJSON, &s.Template)
+		if err != nil {
+			return errors.Wrap(err, "decoding template")
+		}
+		var parts []storedParticipant
+		err = json.Unmarshal(partsJSON, &parts)
+		if err != nil {
+			return errors.Wrap(err, "decoding participants")
+		}
+		for _, sp := range parts {
+			s.Participants = append(s.Participants, &Participant{
+				CoreURL:     sp.CoreURL,
+				Contributed: sp.Contributed,
+				Signed:      sp.Signed,
+				hashedToken: sp.HashedToken,
+			})
+		}
+		if txID.Valid {
+			s.TxID = new(bc.Hash)
+			err = s.TxID.UnmarshalText([]byte(txID.String))
+			if err != nil {
+				return err
+			}
+		}
+		ss = append(ss, s)
+		return nil
+	}
+	err := pg.ForQueryRows(ctx, db, q, append(args, scan)...)
+	return ss, errors.Wrap(err, "querying coordination sessions")
+}
+
+// Contribute adds a participant's contribution to a session. The
+// contribution is a template built on top of the session's
+// transaction; its transaction must extend the session's, and its
+// signing instructions cover only the inputs it adds. Once every
+// participant has contributed, the session moves on to signing.
+func (m *Manager) Contribute(ctx context.Context, id, token string, tpl *txbuilder.Template) (*Session, error) {
+	return m.update(ctx, id, func(s *Session) error {
+		p, err := s.participant(token)
+		if err != nil {
+			return err
+		}
+		if s.Status != StatusCollecting {
+			return errors.WithDetailf(ErrSessionState, "session is %s", s.Status)
+		}
+		if p.Contributed {
+			return errors.WithDetailf(ErrBadContribution, "%s has already contributed", p.CoreURL)
+		}
+		if tpl == nil || tpl.Transaction == nil {
+			return errors.WithDetail(ErrBadContribution, "contribution has no transaction")
+		}
+		err = checkExtends(s.Template.Transaction, tpl.Transaction)
+		if err != nil {
+			return err
+		}
+		for _, si := range tpl.SigningInstructions {
+			if si.Position < len(s.Template.Transaction.Inputs) || si.Position >= len(tpl.Transaction.Inputs) {
+				return errors.WithDetailf(ErrBadContribution, "signing instruction for input %d is not for an added input", si.Position)
+			}
+		}
+
+		s.Template.Transaction = tpl.Transaction
+		s.Template.SigningInstructions = append(s.Template.SigningInstructions, tpl.SigningInstructions...)
+		p.Contributed = true
+
+		done := true
+		for _, p := range s.Participants {
+			done = done && p.Contributed
+		}
+		if done {
+			s.Status = StatusSigning
+		}
+		return nil
+	})
+}
+
+// AddSignatures merges a participant's signatures into a session.
+// The signed template must be for the session's complete
+// transaction, and may hold signing instructions for only some of
+// its inputs. It reports whether the session's template is now
+// fully signed and ready to submit.
+func (m *Manager) AddSignatures(ctx context.Context, id, token string, tpl *txbuilder.Template) (*Session, bool, error) {
+	var ready bool
+	s, err := m.update(ctx, id, func(s *Session) error {
+		p, err := s.participant(token)
+		if err != nil {
+			return err
+		}
+		if s.Status != StatusSigning {
+			return errors.WithDetailf(ErrSessionState, "session is %s", s.Status)
+		}
+		if tpl == nil || tpl.Transaction == nil || tpl.Transaction.Hash() != s.Template.Transaction.Hash() {
+			return errors.WithDetail(ErrBadContribution, "signed template is not for the session's transaction")
+		}
+		err = mergeSignatures(s.Template, tpl)
+		if err != nil {
+			return err
+		}
+		p.Signed = true
+		ready = fullySigned(s.Template)
+		return nil
+	})
+	return s, ready, err
+}
+
+// Finish records the outcome of submitting a session's
+// transaction.
+func (m *Manager) Finish(ctx context.Context, id string, txID bc.Hash, submitErr error) (*Session, error) {
+	return m.update(ctx, id, func(s *Session) error {
+		if submitErr != nil {
+			s.Status = StatusFailed
+			s.Error = submitErr.Error()
+			return nil
+		}
+		s.Status = StatusSubmitted
+		s.TxID = &txID
+		return nil
+	})
+}
+
+// update applies f to the session with the given ID and stores the
+// result, holding a lock on the session throughout.
+func (m *Manager) update(ctx context.Context, id string, f func(*Session) error) (*Session, error) {
+	dbtx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer dbtx.Rollback(ctx)
+
+	ss, err := m.sessions(ctx, dbtx, "id=$1 FOR UPDATE", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ss) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "coordination session %s", id)
+	}
+	s := ss[0]
+	err = f(s)
+	if err != nil {
+		return nil, err
+	}
+
+	tplJSON, partsJSON, err := marshalSession(s)
+	if err != nil {
+		return nil, err
+	}
+	var txID stdsql.NullString
+	if s.TxID != nil {
+		txID = stdsql.NullString{String: s.TxID.String(), Valid: true}
+	}
+	const q = `
+		UPDATE coordination_sessions
+		SET status=$2, template=$3, participants=$4, tx_id=$5, error=$6
+		WHERE id=$1
+	`
+	_, err = dbtx.Exec(ctx, q, s.ID, s.Status, tplJSON, partsJSON, txID, s.Error)
+	if err != nil {
+		return nil, errors.Wrap(err, "updating coordination session")
+	}
+	return s, errors.Wrap(dbtx.Commit(ctx))
+}
+
+func marshalSession(s *Session) (tplJSON, partsJSON []byte, err error) {
+	tplJSON, err = json.Marshal(s.Template)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encoding template")
+	}
+	parts := make([]storedParticipant, 0, len(s.Participants))
+	for _, p := range s.Participants {
+		parts = append(parts, storedParticipant{
+			CoreURL:     p.CoreURL,
+			HashedToken: p.hashedToken,
+			Contributed: p.Contributed,
+			Signed:      p.Signed,
+		})
+	}
+	partsJSON, err = json.Marshal(parts)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "encoding participants")
+	}
+	return tplJSON, partsJSON, nil
+}
+
+// checkExtends checks that next only adds inputs and outputs to
+// prev, and otherwise leaves it unchanged, except that it may set
+// reference data if prev has none and narrow the time range.
+func checkExtends(prev, next *bc.TxData) error {
+	if len(next.Inputs) < len(prev.Inputs) || len(next.Outputs) < len(prev.Outputs) {
+		return errors.WithDetail(ErrBadContribution, "contribution removes inputs or outputs")
+	}
+	if len(prev.ReferenceData) > 0 && string(prev.ReferenceData) != string(next.ReferenceData) {
+		return errors.WithDetail(ErrBadContribution, "contribution changes reference data")
+	}
+	if next.MinTime < prev.MinTime {
+		return errors.WithDetail(ErrBadContribution, "contribution lowers the minimum time")
+	}
+	if prev.MaxTime > 0 && (next.MaxTime == 0 || next.MaxTime > prev.MaxTime) {
+		return errors.WithDetail(ErrBadContribution, "contribution raises the maximum time")
+	}
+	prefix := *next
+	prefix.Inputs = next.Inputs[:len(prev.Inputs)]
+	prefix.Outputs = next.Outputs[:len(prev.Outputs)]
+	prefix.ReferenceData = prev.ReferenceData
+	prefix.MinTime = prev.MinTime
+	prefix.MaxTime = prev.MaxTime
+	if prefix.Hash() != prev.Hash() {
+		return errors.WithDetail(ErrBadContribution, "contribution modifies existing inputs or outputs")
+	}
+	return nil
+}
+
+// mergeSignatures copies into dst each valid signature in src that
+// dst lacks. Each signing instruction in src must match the one in
+// dst for the same input. The signature program for each witness is
+// computed from dst's transaction rather than taken from src, and
+// every signature is checked against it.
+func mergeSignatures(dst, src *txbuilder.Template) error {
+	for i, ssi := range src.SigningInstructions {
+		var dsi *txbuilder.SigningInstruction
+		for _, si := range dst.SigningInstructions {
+			if si.Position == ssi.Position {
+				dsi = si
+				break
+			}
+		}
+		if dsi == nil || len(ssi.WitnessComponents) != len(dsi.WitnessComponents) {
+			return errors.WithDetailf(ErrBadContribution, "signing instruction %d differs", i)
+		}
+		program := txbuilder.SigProgram(dst, dsi.Position)
+		var h [32]byte
+		sha3pool.Sum256(h[:], program)
+		for j, dc := range dsi.WitnessComponents {
+			dsw, ok := dc.(*txbuilder.SignatureWitness)
+			if !ok {
+				continue
+			}
+			ssw, ok := ssi.WitnessComponents[j].(*txbuilder.SignatureWitness)
+			if !ok || !sameKeys(ssw.Keys, dsw.Keys) || len(ssw.Sigs) > len(dsw.Keys) {
+				return errors.WithDetailf(ErrBadContribution, "witness component %d of signing instruction %d differs", j, i)
+			}
+			if len(ssw.Program) > 0 && string(ssw.Program) != string(program) {
+				return errors.WithDetailf(ErrBadContribution, "witness component %d of signing instruction %d signs the wrong program", j, i)
+			}
+			dsw.Program = program
+			if len(dsw.Sigs) < len(dsw.Keys) {
+				sigs := make([]chainjson.HexBytes, len(dsw.Keys))
+				copy(sigs, dsw.Sigs)
+				dsw.Sigs = sigs
+			}
+			for k, sig := range ssw.Sigs {
+				if len(dsw.Sigs[k]) > 0 || len(sig) == 0 {
+					continue
+				}
+				if !txbuilder.VerifySig(dsw.Keys[k], h, sig) {
+					return errors.WithDetailf(ErrBadContribution, "signature %d of witness component %d of signing instruction %d is invalid", k, j, i)
+				}
+				dsw.Sigs[k] = sig
+			}
+		}
+	}
+	return nil
+}
+
+func sameKeys(a, b []txbuilder.KeyID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].XPub != b[i].XPub || len(a[i].DerivationPath) != len(b[i].DerivationPath) {
+			return false
+		}
+		for j := range a[i].DerivationPath {
+			if string(a[i].DerivationPath[j]) != string(b[i].DerivationPath[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fullySigned reports whether every signature witness in tpl has
+// its quorum of signatures.
+func fullySigned(tpl *txbuilder.Template) bool {
+	for _, si := range tpl.SigningInstructions {
+		for _, c := range si.WitnessComponents {
+			sw, ok := c.(*txbuilder.SignatureWitness)
+			if !ok {
+				continue
+			}
+			var n int
+			for _, sig := range sw.Sigs {
+				if len(sig) > 0 {
+					n++
+				}
+			}
+			if n < sw.Quorum {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// RecordContribution stores the template this Core contributed to
+// the session with the given ID on the host at hostURL (empty if
+// this Core is the host), so that SigningTemplate can check the
+// session's complete transaction against it.
+func (m *Manager) RecordContribution(ctx context.Context, hostURL, sessionID string, tpl *txbuilder.Template) error {
+	tplJSON, err := json.Marshal(tpl)
+	if err != nil {
+		return errors.Wrap(err, "encoding template")
+	}
+	const q = `
+		INSERT INTO coordination_contributions (host_url, session_id, template)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (host_url, session_id) DO UPDATE SET template=excluded.template
+	`
+	_, err = m.DB.Exec(ctx, q, hostURL, sessionID, tplJSON)
+	return errors.Wrap(err, "recording coordination contribution")
+}
+
+// SigningTemplate returns a template for signing tx, the complete
+// transaction of the session with the given ID on the host at
+// hostURL, on behalf of this Core. See signingTemplate.
+func (m *Manager) SigningTemplate(ctx context.Context, hostURL, sessionID string, tx *bc.TxData) (*txbuilder.Template, error) {
+	const q = `
+		SELECT template FROM coordination_contributions
+		WHERE host_url=$1 AND session_id=$2
+	`
+	var tplJSON []byte
+	err := m.DB.QueryRow(ctx, q, hostURL, sessionID).Scan(&tplJSON)
+	if err == stdsql.ErrNoRows {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "contribution to coordination session %s", sessionID)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "loading coordination contribution")
+	}
+	var contrib txbuilder.Template
+	err = json.Unmarshal(tplJSON, &contrib)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding template")
+	}
+	return signingTemplate(&contrib, tx)
+}
+
+// signingTemplate returns a template for signing tx with only the
+// signing instructions of contrib, a contribution this Core made to
+// the session whose complete transaction is tx. It checks that tx
+// extends contrib's transaction, so that this Core's inputs and
+// outputs are present and unchanged. Signature programs are cleared,
+// so that signing computes them from tx.
+func signingTemplate(contrib *txbuilder.Template, tx *bc.TxData) (*txbuilder.Template, error) {
+	if contrib.Transaction == nil || tx == nil {
+		return nil, errors.WithDetail(ErrBadContribution, "missing transaction")
+	}
+	err := checkExtends(contrib.Transaction, tx)
+	if err != nil {
+		return nil, errors.WithDetail(err, "session transaction does not include this Core's contribution")
+	}
+	for _, si := range contrib.SigningInstructions {
+		for _, c := range si.WitnessComponents {
+			if sw, ok := c.(*txbuilder.SignatureWitness); ok {
+				sw.Program = nil
+				sw.Sigs = nil
+			}
+		}
+	}
+	return &txbuilder.Template{
+		Transaction:         tx,
+		SigningInstructions: contrib.SigningInstructions,
+	}, nil
+}
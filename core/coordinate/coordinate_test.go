@@ -0,0 +1,202 @@
+package coordinate
+
+import (
+	"context"
+	"testing"
+
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/crypto/sha3pool"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestCheckExtends(t *testing.T) {
+	var (
+		in1  = bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{1}, 5, nil, nil)
+		in2  = bc.NewSpendInput(bc.Hash{2}, 0, nil, bc.AssetID{2}, 7, nil, nil)
+		out1 = bc.NewTxOutput(bc.AssetID{2}, 7, []byte{1}, nil)
+		out2 = bc.NewTxOutput(bc.AssetID{1}, 5, []byte{2}, nil)
+		prev = &bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}, MinTime: 10, MaxTime: 100}
+	)
+	cases := []struct {
+		next *bc.TxData
+		ok   bool
+	}{
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1, in2}, Outputs: []*bc.TxOutput{out1, out2}, MinTime: 20, MaxTime: 50}, true},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}, ReferenceData: []byte("x"), MinTime: 10, MaxTime: 100}, true},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}, MinTime: 5, MaxTime: 100}, false},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}, MinTime: 10, MaxTime: 200}, false},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}, MinTime: 10}, false},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in2, in1}, Outputs: []*bc.TxOutput{out1, out2}}, false},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1, in2}, Outputs: []*bc.TxOutput{out2}}, false},
+		{&bc.TxData{Version: 1, Inputs: []*bc.TxInput{}, Outputs: []*bc.TxOutput{out1}}, false},
+	}
+	for i, c := range cases {
+		err := checkExtends(prev, c.next)
+		if c.ok && err != nil {
+			t.Errorf("case %d: unexpected error %v", i, err)
+		}
+		if !c.ok && errors.Root(err) != ErrBadContribution {
+			t.Errorf("case %d: got error %v want %v", i, err, ErrBadContribution)
+		}
+	}
+}
+
+func TestMergeSignatures(t *testing.T) {
+	var xprvs []chainkd.XPrv
+	var keys []txbuilder.KeyID
+	for i := 0; i < 3; i++ {
+		xprv, xpub, err := chainkd.NewXKeys(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xprvs = append(xprvs, xprv)
+		keys = append(keys, txbuilder.KeyID{XPub: xpub.String()})
+	}
+	tx := &bc.TxData{
+		Version: 1,
+		Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{1}, 5, nil, nil)},
+		Outputs: []*bc.TxOutput{bc.NewTxOutput(bc.AssetID{1}, 5, []byte{1}, nil)},
+	}
+	template := func() *txbuilder.Template {
+		return &txbuilder.Template{
+			Transaction: tx,
+			SigningInstructions: []*txbuilder.SigningInstruction{{
+				Position: 0,
+				WitnessComponents: []txbuilder.WitnessComponent{&txbuilder.SignatureWitness{
+					Quorum: 2,
+					Keys:   keys,
+				}},
+			}},
+		}
+	}
+	// signed returns a template signed by the keys at the given
+	// indexes.
+	signed := func(idx ...int) *txbuilder.Template {
+		tpl := template()
+		var xpubs []string
+		for _, i := range idx {
+			xpubs = append(xpubs, keys[i].XPub)
+		}
+		err := txbuilder.Sign(context.Background(), tpl, xpubs, func(_ context.Context, xpub string, path [][]byte, h [32]byte) ([]byte, error) {
+			for i, k := range keys {
+				if k.XPub == xpub {
+					return xprvs[i].Derive(path).Sign(h[:]), nil
+				}
+			}
+			return nil, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tpl
+	}
+
+	dst := template()
+	err := mergeSignatures(dst, signed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fullySigned(dst) {
+		t.Fatal("fullySigned = true with 1 of 2 signatures")
+	}
+	err = mergeSignatures(dst, signed(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fullySigned(dst) {
+		t.Fatal("fullySigned = false after merging second signature")
+	}
+
+	// A signature of some other program is rejected.
+	bad := template()
+	sw := bad.SigningInstructions[0].WitnessComponents[0].(*txbuilder.SignatureWitness)
+	sw.Program = []byte{1}
+	sw.Sigs = []chainjson.HexBytes{xprvs[0].Sign([]byte{1}), nil, nil}
+	err = mergeSignatures(template(), bad)
+	if errors.Root(err) != ErrBadContribution {
+		t.Errorf("mergeSignatures with wrong program = %v want %v", err, ErrBadContribution)
+	}
+	sw.Program = nil
+	err = mergeSignatures(template(), bad)
+	if errors.Root(err) != ErrBadContribution {
+		t.Errorf("mergeSignatures with invalid signature = %v want %v", err, ErrBadContribution)
+	}
+
+	bad = signed(0)
+	bad.SigningInstructions[0].Position = 1
+	err = mergeSignatures(template(), bad)
+	if errors.Root(err) != ErrBadContribution {
+		t.Errorf("mergeSignatures with mismatched instructions = %v want %v", err, ErrBadContribution)
+	}
+}
+
+func TestSigningTemplate(t *testing.T) {
+	var (
+		in1  = bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{1}, 5, nil, nil)
+		in2  = bc.NewSpendInput(bc.Hash{2}, 0, nil, bc.AssetID{2}, 7, nil, nil)
+		out1 = bc.NewTxOutput(bc.AssetID{2}, 7, []byte{1}, nil)
+		out2 = bc.NewTxOutput(bc.AssetID{1}, 5, []byte{2}, nil)
+	)
+	contrib := func() *txbuilder.Template {
+		return &txbuilder.Template{
+			Transaction: &bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1}},
+			SigningInstructions: []*txbuilder.SigningInstruction{{
+				Position: 0,
+				WitnessComponents: []txbuilder.WitnessComponent{&txbuilder.SignatureWitness{
+					Quorum:  1,
+					Keys:    make([]txbuilder.KeyID, 1),
+					Program: []byte{1},
+				}},
+			}},
+		}
+	}
+
+	final := &bc.TxData{Version: 1, Inputs: []*bc.TxInput{in1, in2}, Outputs: []*bc.TxOutput{out1, out2}}
+	tpl, err := signingTemplate(contrib(), final)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tpl.SigningInstructions) != 1 || tpl.SigningInstructions[0].Position != 0 {
+		t.Errorf("signing instructions = %+v, want only the contribution's", tpl.SigningInstructions)
+	}
+	sw := tpl.SigningInstructions[0].WitnessComponents[0].(*txbuilder.SignatureWitness)
+	if len(sw.Program) != 0 {
+		t.Errorf("program = %x, want it cleared", sw.Program)
+	}
+
+	cases := []*bc.TxData{
+		{Version: 1, Inputs: []*bc.TxInput{in2, in1}, Outputs: []*bc.TxOutput{out1, out2}},
+		{Version: 1, Inputs: []*bc.TxInput{in1, in2}, Outputs: []*bc.TxOutput{out2}},
+	}
+	for i, c := range cases {
+		_, err = signingTemplate(contrib(), c)
+		if errors.Root(err) != ErrBadContribution {
+			t.Errorf("case %d: got error %v want %v", i, err, ErrBadContribution)
+		}
+	}
+}
+
+func TestParticipant(t *testing.T) {
+	var h [32]byte
+	sha3pool.Sum256(h[:], []byte("secret"))
+	s := &Session{Participants: []*Participant{
+		{CoreURL: "a"},
+		{CoreURL: "b", hashedToken: h[:]},
+	}}
+	p, err := s.participant("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.CoreURL != "b" {
+		t.Errorf("participant = %s want b", p.CoreURL)
+	}
+	for _, token := range []string{"", "other"} {
+		_, err = s.participant(token)
+		if errors.Root(err) != ErrBadParticipant {
+			t.Errorf("participant(%q) = %v want %v", token, err, ErrBadParticipant)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"chain/core/coordinate"
+	"chain/core/rpc"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+// coordinationSubmitTimeout bounds how long adding the final
+// signatures to a coordination session waits for its transaction to
+// be submitted.
+const coordinationSubmitTimeout = time.Minute
+
+// POST /create-coordination-session
+func (h *Handler) createCoordinationSession(ctx context.Context, in struct {
+	Participants []string `json:"participants"`
+}) (*coordinate.Session, error) {
+	return h.Coordinator.Create(ctx, in.Participants)
+}
+
+// POST /get-coordination-session
+func (h *Handler) getCoordinationSession(ctx context.Context, in struct {
+	ID string `json:"id"`
+}) (*coordinate.Session, error) {
+	return h.Coordinator.Find(ctx, in.ID)
+}
+
+// POST /list-coordination-sessions
+func (h *Handler) listCoordinationSessions(ctx context.Context, in struct {
+	After string `json:"after"`
+}) (interface{}, error) {
+	limit := defGenericPageSize
+	sessions, err := h.Coordinator.List(ctx, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(sessions) > 0 {
+		next.After = sessions[len(sessions)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(sessions), next, len(sessions) < limit}, nil
+}
+
+type coordinationContribution struct {
+	ID               string              `json:"id"`
+	ParticipantToken string              `json:"participant_token"`
+	Template         *txbuilder.Template `json:"template"`
+}
+
+// POST /contribute-to-coordination-session
+func (h *Handler) contributeToCoordinationSession(ctx context.Context, in coordinationContribution) (*coordinate.Session, error) {
+	return h.Coordinator.Contribute(ctx, in.ID, in.ParticipantToken, in.Template)
+}
+
+// POST /add-coordination-session-signatures
+//
+// Once the session's template is fully signed, its transaction is
+// submitted before the response is sent.
+func (h *Handler) addCoordinationSessionSignatures(ctx context.Context, in coordinationContribution) (*coordinate.Session, error) {
+	s, ready, err := h.Coordinator.AddSignatures(ctx, in.ID, in.ParticipantToken, in.Template)
+	if err != nil || !ready {
+		return s, err
+	}
+
+	tpl := s.Template
+	err = txbuilder.Sign(ctx, tpl, nil, nil) // materializes witnesses
+	if err == nil {
+		subctx, cancel := context.WithTimeout(ctx, coordinationSubmitTimeout)
+		err = h.finalizeTxWait(subctx, tpl, "none")
+		cancel()
+	}
+	return h.Coordinator.Finish(ctx, s.ID, tpl.Transaction.Hash(), err)
+}
+
+// coordinationHost identifies a session hosted by another Core, or
+// by this one if HostURL is empty, and the token this Core uses to
+// take part in it.
+type coordinationHost struct {
+	HostURL          string `json:"host_url"`
+	AccessToken      string `json:"access_token"`
+	SessionID        string `json:"session_id"`
+	ParticipantToken string `json:"participant_token"`
+}
+
+func (h *Handler) coordinationCall(ctx context.Context, host coordinationHost, path string, req interface{}) (*coordinate.Session, error) {
+	if host.HostURL == "" {
+		switch path {
+		case "/get-coordination-session":
+			return h.Coordinator.Find(ctx, host.SessionID)
+		case "/contribute-to-coordination-session":
+			c := req.(coordinationContribution)
+			return h.Coordinator.Contribute(ctx, c.ID, c.ParticipantToken, c.Template)
+		case "/add-coordination-session-signatures":
+			return h.addCoordinationSessionSignatures(ctx, req.(coordinationContribution))
+		}
+		return nil, errors.New("unknown coordination call " + path)
+	}
+	client := &rpc.Client{
+		BaseURL:     host.HostURL,
+		AccessToken: host.AccessToken,
+	}
+	s := new(coordinate.Session)
+	err := client.Call(ctx, path, req, s)
+	return s, errors.Wrapf(err, "calling %s on coordination host", path)
+}
+
+// POST /join-coordination-session
+//
+// The actions are built on top of the session's current
+// transaction, and the result is recorded locally and contributed
+// to the session.
+func (h *Handler) joinCoordinationSession(ctx context.Context, in struct {
+	coordinationHost
+	Actions []map[string]interface{} `json:"actions"`
+	TTL     chainjson.Duration       `json:"ttl"`
+}) (*coordinate.Session, error) {
+	s, err := h.coordinationCall(ctx, in.coordinationHost, "/get-coordination-session", struct {
+		ID string `json:"id"`
+	}{in.SessionID})
+	if err != nil {
+		return nil, err
+	}
+	if s.Status != coordinate.StatusCollecting {
+		return nil, errors.WithDetailf(coordinate.ErrSessionState, "session is %s", s.Status)
+	}
+	tpl, err := h.buildSingle(ctx, &buildRequest{
+		Tx:      s.Template.Transaction,
+		Actions: in.Actions,
+		TTL:     in.TTL,
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = h.Coordinator.RecordContribution(ctx, in.HostURL, in.SessionID, tpl)
+	if err != nil {
+		return nil, err
+	}
+	return h.coordinationCall(ctx, in.coordinationHost, "/contribute-to-coordination-session", coordinationContribution{
+		ID:               in.SessionID,
+		ParticipantToken: in.ParticipantToken,
+		Template:         tpl,
+	})
+}
+
+// POST /sign-coordination-session
+//
+// The inputs this Core contributed to the session are signed with
+// the Mock HSM keys it holds, and the signatures are added to the
+// session. Nothing is signed unless the session's complete
+// transaction includes this Core's contribution unchanged.
+func (h *Handler) signCoordinationSession(ctx context.Context, in coordinationHost) (*coordinate.Session, error) {
+	s, err := h.coordinationCall(ctx, in, "/get-coordination-session", struct {
+		ID string `json:"id"`
+	}{in.SessionID})
+	if err != nil {
+		return nil, err
+	}
+	if s.Status != coordinate.StatusSigning {
+		return nil, errors.WithDetailf(coordinate.ErrSessionState, "session is %s", s.Status)
+	}
+	tpl, err := h.Coordinator.SigningTemplate(ctx, in.HostURL, in.SessionID, s.Template.Transaction)
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), h.mockhsmSignTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing")
+	}
+	return h.coordinationCall(ctx, in, "/add-coordination-session-signatures", coordinationContribution{
+		ID:               in.SessionID,
+		ParticipantToken: in.ParticipantToken,
+		Template:         tpl,
+	})
+}
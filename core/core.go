@@ -5,15 +5,19 @@ import (
 	"encoding/json"
 	"expvar"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"chain/core/config"
+	"chain/core/failover"
 	"chain/core/fetch"
+	"chain/core/generator"
 	"chain/core/leader"
 	"chain/errors"
 	"chain/log"
 	"chain/net/http/httpjson"
+	"chain/protocol/vmutil"
 )
 
 var (
@@ -53,6 +57,64 @@ func (h *Handler) reset(ctx context.Context, req struct {
 	panic("unreached")
 }
 
+// stepDown makes the leader process stop generating or fetching
+// blocks and give up its leadership, so that another process can
+// take over without waiting for the leader's lease to expire. If a
+// successor address is given, that process is favored to become
+// the next leader.
+func (h *Handler) stepDown(ctx context.Context, req struct {
+	Successor string `json:"successor"`
+}) error {
+	if !leader.IsLeading() {
+		return h.forwardToLeader(ctx, "/step-down", req, nil)
+	}
+	err := leader.StepDown(ctx, req.Successor)
+	if errors.Root(err) == leader.ErrNotLeader {
+		// We were deposed in the meantime.
+		return errLeaderElection
+	}
+	return err
+}
+
+// POST /list-block-signers
+//
+// listBlockSigners reports how each block signer has been responding
+// to the generator's requests for signatures.
+func (h *Handler) listBlockSigners(ctx context.Context) ([]*generator.SignerStatus, error) {
+	if !h.Config.IsGenerator {
+		return nil, errors.WithDetail(httpjson.ErrBadRequest, "only the generator tracks block signers")
+	}
+	if !leader.IsLeading() {
+		var resp []*generator.SignerStatus
+		err := h.forwardToLeader(ctx, "/list-block-signers", nil, &resp)
+		return resp, err
+	}
+	return h.SignerMonitor.Statuses(), nil
+}
+
+// POST /rpc/generator-status
+//
+// generatorStatusRPC tells other generators and backup generators
+// whether this Core made its latest block, so they can tell which
+// generator is active.
+func (h *Handler) generatorStatusRPC(ctx context.Context) (*failover.Status, error) {
+	h.configMu.Lock()
+	rank := h.Config.GeneratorRank()
+	h.configMu.Unlock()
+
+	height := h.Chain.Height()
+	st := &failover.Status{Height: height}
+	if rank < 0 || height == 0 {
+		return st, nil
+	}
+	b, err := h.Chain.GetBlock(ctx, height)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting latest block")
+	}
+	st.Generating, err = generator.Generated(ctx, h.DB, b)
+	return st, errors.Wrap(err, "checking latest block")
+}
+
 func (h *Handler) info(ctx context.Context) (map[string]interface{}, error) {
 	if h.Config == nil {
 		// never configured
@@ -97,6 +159,10 @@ func (h *Handler) leaderInfo(ctx context.Context) (map[string]interface{}, error
 		}
 	}
 
+	h.configMu.Lock()
+	generatorURL, generatorToken := h.Config.GeneratorURL, h.Config.GeneratorAccessToken
+	h.configMu.Unlock()
+
 	buildCommit := json.RawMessage(expvar.Get("buildcommit").String())
 	buildDate := json.RawMessage(expvar.Get("builddate").String())
 
@@ -105,8 +171,8 @@ func (h *Handler) leaderInfo(ctx context.Context) (map[string]interface{}, error
 		"configured_at":                     h.Config.ConfiguredAt,
 		"is_signer":                         h.Config.IsSigner,
 		"is_generator":                      h.Config.IsGenerator,
-		"generator_url":                     h.Config.GeneratorURL,
-		"generator_access_token":            obfuscateTokenSecret(h.Config.GeneratorAccessToken),
+		"generator_url":                     generatorURL,
+		"generator_access_token":            obfuscateTokenSecret(generatorToken),
 		"blockchain_id":                     h.Config.BlockchainID,
 		"block_height":                      localHeight,
 		"generator_block_height":            generatorHeight,
@@ -119,6 +185,17 @@ func (h *Handler) leaderInfo(ctx context.Context) (map[string]interface{}, error
 		"health":                            h.health(),
 	}
 
+	if h.Leader != nil {
+		status, err := h.Leader.Status(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting leader status")
+		}
+		m["leader"] = status
+	}
+	if h.Config.IsGenerator && h.SignerMonitor != nil {
+		m["block_signers"] = h.SignerMonitor.Statuses()
+	}
+
 	// Add in snapshot information if we're downloading a snapshot.
 	if snapshot != nil {
 		m["snapshot"] = map[string]interface{}{
@@ -137,9 +214,15 @@ func (h *Handler) configure(ctx context.Context, x *config.Config) error {
 		return errAlreadyConfigured
 	}
 
-	if x.IsGenerator && x.MaxIssuanceWindow == 0 {
+	if x.GeneratorRank() >= 0 && x.MaxIssuanceWindow == 0 {
 		x.MaxIssuanceWindow = 24 * time.Hour
 	}
+	if x.BlockPeriod == 0 {
+		x.BlockPeriod = time.Second
+	}
+	if len(x.BackupGenerators) > 0 && x.FailoverTimeout == 0 {
+		x.FailoverTimeout = time.Minute
+	}
 
 	err := config.Configure(ctx, h.DB, x)
 	if err != nil {
@@ -151,6 +234,80 @@ func (h *Handler) configure(ctx context.Context, x *config.Config) error {
 	panic("unreached")
 }
 
+// POST /update-configuration
+//
+// updateConfiguration changes settings of a configured Core that
+// don't affect consensus. Each cored process of the Core applies
+// the change without restarting, within a few seconds.
+func (h *Handler) updateConfiguration(ctx context.Context, u *config.Update) error {
+	if u.BackupGenerators != nil && len(*u.BackupGenerators) > 0 {
+		// Failover is only safe if the block signers' quorum
+		// is a majority.
+		b, err := h.Chain.GetBlock(ctx, h.Chain.Height())
+		if err != nil {
+			return errors.Wrap(err, "getting latest block")
+		}
+		pubkeys, quorum, err := vmutil.ParseBlockMultiSigProgram(b.ConsensusProgram)
+		if err != nil {
+			return errors.Wrap(err, "parsing consensus program")
+		}
+		err = config.CheckFailoverQuorum(quorum, len(pubkeys))
+		if err != nil {
+			return err
+		}
+	}
+	_, err := config.ApplyUpdate(ctx, h.DB, u)
+	return err
+}
+
+// POST /list-configuration-updates
+func (h *Handler) listConfigurationUpdates(ctx context.Context, in struct {
+	After string `json:"after"`
+}) (interface{}, error) {
+	var before int64
+	if in.After != "" {
+		var err error
+		before, err = strconv.ParseInt(in.After, 10, 64)
+		if err != nil {
+			return nil, errors.WithDetailf(httpjson.ErrBadRequest, "invalid after value %q", in.After)
+		}
+	}
+	limit := defGenericPageSize
+	recs, err := config.Updates(ctx, h.DB, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(recs) > 0 {
+		next.After = strconv.FormatInt(recs[len(recs)-1].ID, 10)
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(recs), next, len(recs) < limit}, nil
+}
+
+// SetConfig applies the settings of c that can change at runtime
+// to h.Config. It is safe to call while h is serving requests.
+func (h *Handler) SetConfig(c *config.Config) {
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+	h.Config.GeneratorURL = c.GeneratorURL
+	h.Config.GeneratorAccessToken = c.GeneratorAccessToken
+	h.Config.Signers = c.Signers
+	h.Config.MaxIssuanceWindow = c.MaxIssuanceWindow
+	h.Config.GeneratorCoreID = c.GeneratorCoreID
+	h.Config.BackupGenerators = c.BackupGenerators
+	h.Config.FailoverTimeout = c.FailoverTimeout
+	h.Config.BlockPolicies = c.BlockPolicies
+	h.Config.BlockPeriod = c.BlockPeriod
+	h.Config.MakeEmptyBlocks = c.MakeEmptyBlocks
+	h.Config.MaxIdleInterval = c.MaxIdleInterval
+	h.Config.MaxPendingTxs = c.MaxPendingTxs
+}
+
 func closeConnOK(w http.ResponseWriter, req *http.Request) {
 	w.Header().Add("Connection", "close")
 	w.WriteHeader(http.StatusNoContent)
@@ -19,7 +19,7 @@ import (
 
 func CreateAccount(ctx context.Context, t testing.TB, accounts *account.Manager, alias string, tags map[string]interface{}) string {
 	keys := []string{testutil.TestXPub.String()}
-	acc, err := accounts.Create(ctx, keys, 1, alias, tags, nil)
+	acc, err := accounts.Create(ctx, keys, 1, alias, tags, nil, nil)
 	if err != nil {
 		testutil.FatalErr(t, err)
 	}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"chain/core/txbuilder"
+	"chain/crypto/sha3pool"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+// decodedTemplate is a human-readable summary of a transaction
+// template, for review before signing.
+type decodedTemplate struct {
+	Transaction            map[string]interface{} `json:"transaction"`
+	NetEffect              []*netEffect           `json:"net_effect"`
+	SigningInstructions    []*decodedSigInst      `json:"signing_instructions"`
+	AllowAdditionalActions bool                   `json:"allow_additional_actions"`
+	Diff                   *templateDiff          `json:"diff,omitempty"`
+}
+
+// netEffect is the net change in one local account's balance of one
+// asset if the transaction is confirmed.
+type netEffect struct {
+	AccountID    string `json:"account_id"`
+	AccountAlias string `json:"account_alias,omitempty"`
+	AssetID      string `json:"asset_id"`
+	AssetAlias   string `json:"asset_alias,omitempty"`
+	Amount       int64  `json:"amount"`
+}
+
+type decodedSigInst struct {
+	Position          int                        `json:"position"`
+	WitnessComponents []*decodedWitnessComponent `json:"witness_components"`
+}
+
+type decodedWitnessComponent struct {
+	Type   string `json:"type"`
+	Quorum int    `json:"quorum,omitempty"`
+
+	// Signatures counts the signatures that verify against the
+	// signature program computed from the template's transaction.
+	// InvalidSignatures counts the others.
+	Signatures        int `json:"signatures"`
+	InvalidSignatures int `json:"invalid_signatures,omitempty"`
+
+	// Commitments are the conditions committed to by the signature
+	// program computed from the template's transaction, which is
+	// what signing the template signs.
+	Commitments []txbuilder.Commitment `json:"commitments,omitempty"`
+
+	// ProgramMismatch is set if the template supplies a signature
+	// program other than the computed one.
+	ProgramMismatch bool `json:"program_mismatch,omitempty"`
+}
+
+// templateDiff lists the changes from a previous version of a
+// template. Inputs and outputs are compared by content, not
+// position.
+type templateDiff struct {
+	AddedInputs          []interface{} `json:"added_inputs"`
+	RemovedInputs        []interface{} `json:"removed_inputs"`
+	AddedOutputs         []interface{} `json:"added_outputs"`
+	RemovedOutputs       []interface{} `json:"removed_outputs"`
+	MinTimeChanged       bool          `json:"min_time_changed"`
+	MaxTimeChanged       bool          `json:"max_time_changed"`
+	ReferenceDataChanged bool          `json:"reference_data_changed"`
+}
+
+// POST /decode-transaction-template
+func (h *Handler) decodeTxTemplate(ctx context.Context, in struct {
+	Template         *txbuilder.Template `json:"template"`
+	PreviousTemplate *txbuilder.Template `json:"previous_template"`
+}) (*decodedTemplate, error) {
+	if in.Template == nil || in.Template.Transaction == nil {
+		return nil, errors.Wrap(txbuilder.ErrMissingRawTx)
+	}
+	tpl := in.Template
+	tx, err := h.Indexer.AnnotateTx(ctx, bc.NewTx(*tpl.Transaction))
+	if err != nil {
+		return nil, err
+	}
+	sigInsts, err := decodeSigInsts(tpl)
+	if err != nil {
+		return nil, err
+	}
+	res := &decodedTemplate{
+		Transaction:            tx,
+		NetEffect:              netEffects(tx),
+		SigningInstructions:    sigInsts,
+		AllowAdditionalActions: tpl.AllowAdditional,
+	}
+
+	if prev := in.PreviousTemplate; prev != nil {
+		if prev.Transaction == nil {
+			return nil, errors.WithDetail(txbuilder.ErrMissingRawTx, "previous template has no transaction")
+		}
+		prevTx, err := h.Indexer.AnnotateTx(ctx, bc.NewTx(*prev.Transaction))
+		if err != nil {
+			return nil, err
+		}
+		res.Diff = diffTemplates(prev.Transaction, tpl.Transaction, prevTx, tx)
+	}
+	return res, nil
+}
+
+// netEffects sums the inputs and outputs of an annotated transaction
+// by local account and asset.
+func netEffects(tx map[string]interface{}) []*netEffect {
+	effects := make(map[[2]string]*netEffect)
+	add := func(items interface{}, sign int64) {
+		list, _ := items.([]interface{})
+		for _, item := range list {
+			m, _ := item.(map[string]interface{})
+			accountID, _ := m["account_id"].(string)
+			if accountID == "" {
+				continue
+			}
+			assetID, _ := m["asset_id"].(string)
+			amount, _ := m["amount"].(uint64)
+			k := [2]string{accountID, assetID}
+			e := effects[k]
+			if e == nil {
+				e = &netEffect{AccountID: accountID, AssetID: assetID}
+				e.AccountAlias, _ = m["account_alias"].(string)
+				e.AssetAlias, _ = m["asset_alias"].(string)
+				effects[k] = e
+			}
+			e.Amount += sign * int64(amount)
+		}
+	}
+	add(tx["inputs"], -1)
+	add(tx["outputs"], 1)
+
+	res := make([]*netEffect, 0, len(effects))
+	for _, e := range effects {
+		res = append(res, e)
+	}
+	sort.Sort(byAccountAsset(res))
+	return res
+}
+
+type byAccountAsset []*netEffect
+
+func (a byAccountAsset) Len() int      { return len(a) }
+func (a byAccountAsset) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byAccountAsset) Less(i, j int) bool {
+	if a[i].AccountID != a[j].AccountID {
+		return a[i].AccountID < a[j].AccountID
+	}
+	return a[i].AssetID < a[j].AssetID
+}
+
+// decodeSigInsts summarizes the signing instructions of tpl. It
+// reports the commitments of the signature program computed from
+// tpl's transaction, not a program the template supplies, and
+// checks supplied programs and signatures against it.
+func decodeSigInsts(tpl *txbuilder.Template) ([]*decodedSigInst, error) {
+	res := make([]*decodedSigInst, 0, len(tpl.SigningInstructions))
+	for i, si := range tpl.SigningInstructions {
+		if si.Position < 0 || si.Position >= len(tpl.Transaction.Inputs) {
+			return nil, errors.WithDetailf(txbuilder.ErrBadTxInputIdx, "signing instruction %d references missing tx input %d", i, si.Position)
+		}
+		d := &decodedSigInst{Position: si.Position}
+		for _, c := range si.WitnessComponents {
+			switch c := c.(type) {
+			case *txbuilder.SignatureWitness:
+				program := txbuilder.SigProgram(tpl, si.Position)
+				var h [32]byte
+				sha3pool.Sum256(h[:], program)
+				wc := &decodedWitnessComponent{
+					Type:            "signature",
+					Quorum:          c.Quorum,
+					Commitments:     txbuilder.ParseCommitments(program),
+					ProgramMismatch: len(c.Program) > 0 && !bytes.Equal(c.Program, program),
+				}
+				for k, sig := range c.Sigs {
+					if len(sig) == 0 {
+						continue
+					}
+					if k < len(c.Keys) && txbuilder.VerifySig(c.Keys[k], h, sig) {
+						wc.Signatures++
+					} else {
+						wc.InvalidSignatures++
+					}
+				}
+				d.WitnessComponents = append(d.WitnessComponents, wc)
+			case txbuilder.DataWitness:
+				d.WitnessComponents = append(d.WitnessComponents, &decodedWitnessComponent{Type: "data"})
+			}
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// diffTemplates compares the transactions of two versions of a
+// template. The annotated forms supply the entries reported as added
+// or removed.
+func diffTemplates(prev, next *bc.TxData, prevAnnotated, nextAnnotated map[string]interface{}) *templateDiff {
+	d := &templateDiff{
+		AddedInputs:          []interface{}{},
+		RemovedInputs:        []interface{}{},
+		AddedOutputs:         []interface{}{},
+		RemovedOutputs:       []interface{}{},
+		MinTimeChanged:       prev.MinTime != next.MinTime,
+		MaxTimeChanged:       prev.MaxTime != next.MaxTime,
+		ReferenceDataChanged: string(prev.ReferenceData) != string(next.ReferenceData),
+	}
+
+	prevIns, nextIns := make([]string, len(prev.Inputs)), make([]string, len(next.Inputs))
+	for i, in := range prev.Inputs {
+		prevIns[i] = inputKey(in)
+	}
+	for i, in := range next.Inputs {
+		nextIns[i] = inputKey(in)
+	}
+	removed, added := diffKeys(prevIns, nextIns)
+	d.RemovedInputs = pick(prevAnnotated["inputs"], removed)
+	d.AddedInputs = pick(nextAnnotated["inputs"], added)
+
+	prevOuts, nextOuts := make([]string, len(prev.Outputs)), make([]string, len(next.Outputs))
+	for i, out := range prev.Outputs {
+		prevOuts[i] = outputKey(out)
+	}
+	for i, out := range next.Outputs {
+		nextOuts[i] = outputKey(out)
+	}
+	removed, added = diffKeys(prevOuts, nextOuts)
+	d.RemovedOutputs = pick(prevAnnotated["outputs"], removed)
+	d.AddedOutputs = pick(nextAnnotated["outputs"], added)
+	return d
+}
+
+// inputKey identifies an input by its content, excluding its
+// witness.
+func inputKey(in *bc.TxInput) string {
+	return string(in.InputCommitmentBytes()) + "\x00" + string(in.ReferenceData)
+}
+
+func outputKey(out *bc.TxOutput) string {
+	return fmt.Sprintf("%x:%d:%x:%x", out.AssetID[:], out.Amount, out.ControlProgram, out.ReferenceData)
+}
+
+// diffKeys returns the indexes of the entries of a not in b, and of
+// the entries of b not in a, treating each as a multiset.
+func diffKeys(a, b []string) (onlyA, onlyB []int) {
+	counts := make(map[string]int)
+	for _, k := range b {
+		counts[k]++
+	}
+	for i, k := range a {
+		if counts[k] > 0 {
+			counts[k]--
+		} else {
+			onlyA = append(onlyA, i)
+		}
+	}
+	counts = make(map[string]int)
+	for _, k := range a {
+		counts[k]++
+	}
+	for i, k := range b {
+		if counts[k] > 0 {
+			counts[k]--
+		} else {
+			onlyB = append(onlyB, i)
+		}
+	}
+	return onlyA, onlyB
+}
+
+func pick(items interface{}, indexes []int) []interface{} {
+	list, _ := items.([]interface{})
+	res := make([]interface{}, 0, len(indexes))
+	for _, i := range indexes {
+		if i < len(list) {
+			res = append(res, list[i])
+		}
+	}
+	return res
+}
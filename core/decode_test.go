@@ -0,0 +1,125 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"chain/core/txbuilder"
+	"chain/crypto/ed25519/chainkd"
+	"chain/crypto/sha3pool"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+)
+
+func TestNetEffects(t *testing.T) {
+	tx := map[string]interface{}{
+		"inputs": []interface{}{
+			map[string]interface{}{"asset_id": "a1", "amount": uint64(10), "account_id": "acc1", "account_alias": "alice"},
+			map[string]interface{}{"asset_id": "a2", "amount": uint64(5)},
+		},
+		"outputs": []interface{}{
+			map[string]interface{}{"asset_id": "a1", "amount": uint64(3), "account_id": "acc1", "account_alias": "alice"},
+			map[string]interface{}{"asset_id": "a2", "amount": uint64(5), "account_id": "acc1", "account_alias": "alice"},
+			map[string]interface{}{"asset_id": "a1", "amount": uint64(7)},
+		},
+	}
+	got := netEffects(tx)
+	want := []*netEffect{
+		{AccountID: "acc1", AccountAlias: "alice", AssetID: "a1", Amount: -7},
+		{AccountID: "acc1", AccountAlias: "alice", AssetID: "a2", Amount: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("netEffects = %+v want %+v", got, want)
+	}
+}
+
+func TestDiffTemplates(t *testing.T) {
+	var (
+		in1  = bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{1}, 5, nil, nil)
+		in2  = bc.NewSpendInput(bc.Hash{2}, 0, nil, bc.AssetID{2}, 7, nil, nil)
+		out1 = bc.NewTxOutput(bc.AssetID{2}, 7, []byte{1}, nil)
+		out2 = bc.NewTxOutput(bc.AssetID{1}, 5, []byte{2}, nil)
+		out3 = bc.NewTxOutput(bc.AssetID{1}, 5, []byte{3}, nil)
+		prev = &bc.TxData{Inputs: []*bc.TxInput{in1}, Outputs: []*bc.TxOutput{out1, out2}, MaxTime: 10}
+		next = &bc.TxData{Inputs: []*bc.TxInput{in1, in2}, Outputs: []*bc.TxOutput{out3, out1}, MaxTime: 10}
+	)
+	annotated := func(tx *bc.TxData) map[string]interface{} {
+		var ins, outs []interface{}
+		for i := range tx.Inputs {
+			ins = append(ins, i)
+		}
+		for _, out := range tx.Outputs {
+			outs = append(outs, out.ControlProgram[0])
+		}
+		return map[string]interface{}{"inputs": ins, "outputs": outs}
+	}
+
+	got := diffTemplates(prev, next, annotated(prev), annotated(next))
+	want := &templateDiff{
+		AddedInputs:    []interface{}{1},
+		RemovedInputs:  []interface{}{},
+		AddedOutputs:   []interface{}{byte(3)},
+		RemovedOutputs: []interface{}{byte(2)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffTemplates = %+v want %+v", got, want)
+	}
+}
+
+func TestDecodeSigInsts(t *testing.T) {
+	var (
+		keys  []txbuilder.KeyID
+		xprvs []chainkd.XPrv
+	)
+	for i := 0; i < 2; i++ {
+		xprv, xpub, err := chainkd.NewXKeys(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xprvs = append(xprvs, xprv)
+		keys = append(keys, txbuilder.KeyID{XPub: xpub.String()})
+	}
+	tpl := &txbuilder.Template{
+		Transaction: &bc.TxData{
+			Version: 1,
+			Inputs:  []*bc.TxInput{bc.NewSpendInput(bc.Hash{1}, 0, nil, bc.AssetID{1}, 5, nil, nil)},
+			Outputs: []*bc.TxOutput{bc.NewTxOutput(bc.AssetID{1}, 5, []byte{1}, nil)},
+		},
+		AllowAdditional: true,
+	}
+	program := txbuilder.SigProgram(tpl, 0)
+	var h [32]byte
+	sha3pool.Sum256(h[:], program)
+	sw := &txbuilder.SignatureWitness{
+		Quorum:  2,
+		Keys:    keys,
+		Program: []byte{0x51}, // not the program signed below
+		Sigs:    []chainjson.HexBytes{xprvs[0].Sign(h[:]), xprvs[0].Sign(h[:])},
+	}
+	tpl.SigningInstructions = []*txbuilder.SigningInstruction{{
+		Position:          0,
+		WitnessComponents: []txbuilder.WitnessComponent{sw},
+	}}
+
+	got, err := decodeSigInsts(tpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wc := got[0].WitnessComponents[0]
+	if wc.Signatures != 1 || wc.InvalidSignatures != 1 {
+		t.Errorf("got %d valid, %d invalid signatures want 1, 1", wc.Signatures, wc.InvalidSignatures)
+	}
+	if !wc.ProgramMismatch {
+		t.Error("supplied program not flagged")
+	}
+	if want := txbuilder.ParseCommitments(program); !reflect.DeepEqual(wc.Commitments, want) {
+		t.Errorf("got commitments %+v want %+v", wc.Commitments, want)
+	}
+
+	tpl.SigningInstructions[0].Position = 1
+	_, err = decodeSigInsts(tpl)
+	if errors.Root(err) != txbuilder.ErrBadTxInputIdx {
+		t.Errorf("got error %v want %v", err, txbuilder.ErrBadTxInputIdx)
+	}
+}
@@ -9,10 +9,16 @@ import (
 	"chain/core/asset"
 	"chain/core/blocksigner"
 	"chain/core/config"
+	"chain/core/consolidate"
+	"chain/core/coordinate"
+	"chain/core/generator"
 	"chain/core/mockhsm"
+	"chain/core/payment"
 	"chain/core/query"
 	"chain/core/query/filter"
 	"chain/core/rpc"
+	"chain/core/schedule"
+	"chain/core/signerfault"
 	"chain/core/signers"
 	"chain/core/txbuilder"
 	"chain/core/txfeed"
@@ -20,6 +26,7 @@ import (
 	"chain/errors"
 	"chain/net/http/httpjson"
 	"chain/protocol"
+	"chain/protocol/bc"
 )
 
 // errorInfo contains a set of error codes to send to the user.
@@ -81,18 +88,29 @@ var (
 		mockhsm.ErrDuplicateKeyAlias: errorInfo{400, "CH050", "Alias already exists"},
 
 		// Core error namespace
-		errUnconfigured:                errorInfo{400, "CH100", "This core still needs to be configured"},
-		errAlreadyConfigured:           errorInfo{400, "CH101", "This core has already been configured"},
-		config.ErrBadGenerator:         errorInfo{400, "CH102", "Generator URL returned an invalid response"},
-		errBadBlockPub:                 errorInfo{400, "CH103", "Provided Block XPub is invalid"},
-		rpc.ErrWrongNetwork:            errorInfo{502, "CH104", "A peer core is operating on a different blockchain network"},
-		protocol.ErrTheDistantFuture:   errorInfo{400, "CH105", "Requested height is too far ahead"},
-		config.ErrBadSignerURL:         errorInfo{400, "CH106", "Block signer URL is invalid"},
-		config.ErrBadSignerPubkey:      errorInfo{400, "CH107", "Block signer pubkey is invalid"},
-		config.ErrBadQuorum:            errorInfo{400, "CH108", "Quorum must be greater than 0 if there are signers"},
-		errProdReset:                   errorInfo{400, "CH110", "Reset can only be called in a development system"},
-		errNoClientTokens:              errorInfo{400, "CH120", "Cannot enable client authentication with no client tokens"},
-		blocksigner.ErrConsensusChange: errorInfo{400, "CH150", "Refuse to sign block with consensus change"},
+		errUnconfigured:                    errorInfo{400, "CH100", "This core still needs to be configured"},
+		errAlreadyConfigured:               errorInfo{400, "CH101", "This core has already been configured"},
+		config.ErrBadGenerator:             errorInfo{400, "CH102", "Generator URL returned an invalid response"},
+		errBadBlockPub:                     errorInfo{400, "CH103", "Provided Block XPub is invalid"},
+		rpc.ErrWrongNetwork:                errorInfo{502, "CH104", "A peer core is operating on a different blockchain network"},
+		protocol.ErrTheDistantFuture:       errorInfo{400, "CH105", "Requested height is too far ahead"},
+		config.ErrBadSignerURL:             errorInfo{400, "CH106", "Block signer URL is invalid"},
+		config.ErrBadSignerPubkey:          errorInfo{400, "CH107", "Block signer pubkey is invalid"},
+		config.ErrBadQuorum:                errorInfo{400, "CH108", "Quorum must be greater than 0 if there are signers"},
+		bc.ErrNonCanonical:                 errorInfo{400, "CH109", "Transaction or block is not canonically encoded"},
+		errProdReset:                       errorInfo{400, "CH110", "Reset can only be called in a development system"},
+		config.ErrBadUpdate:                errorInfo{400, "CH111", "Invalid configuration update"},
+		config.ErrBadFailover:              errorInfo{400, "CH112", "Invalid backup generator configuration"},
+		config.ErrBadBlockPolicy:           errorInfo{400, "CH113", "Invalid block policy"},
+		config.ErrBadBlockSchedule:         errorInfo{400, "CH114", "Invalid block schedule"},
+		errNoClientTokens:                  errorInfo{400, "CH120", "Cannot enable client authentication with no client tokens"},
+		blocksigner.ErrConsensusChange:     errorInfo{400, "CH150", "Refuse to sign block with consensus change"},
+		generator.ErrBadRotation:           errorInfo{400, "CH151", "Invalid consensus program rotation"},
+		generator.ErrRotationPending:       errorInfo{400, "CH152", "Another consensus program rotation is pending"},
+		blocksigner.ErrBadConsensusProgram: errorInfo{400, "CH153", "Invalid consensus program proposal"},
+		signerfault.ErrBadEvidence:         errorInfo{400, "CH155", "Invalid signer fault evidence"},
+		blocksigner.ErrNotActiveGenerator:  errorInfo{400, "CH156", "Refuse to sign block from a generator that is not active"},
+		blocksigner.ErrPolicyRefusal:       errorInfo{400, "CH157", "Refuse to sign block by signing policy"},
 
 		// Signers error namespace (2xx)
 		signers.ErrBadQuorum: errorInfo{400, "CH200", "Quorum must be greater than 1 and less than or equal to the length of xpubs"},
@@ -101,12 +119,26 @@ var (
 		signers.ErrBadType:   errorInfo{400, "CH203", "Retrieved type does not match expected type"},
 		signers.ErrDupeXPub:  errorInfo{400, "CH204", "Root XPubs cannot contain the same key more than once"},
 
+		// Account creation errors share the signers namespace
+		account.ErrBadProgramTemplate: errorInfo{400, "CH205", "Invalid control program template"},
+		account.ErrBadSpendingPolicy:  errorInfo{400, "CH206", "Invalid account spending policy"},
+		account.ErrPolicyViolation:    errorInfo{400, "CH207", "Spend violates account spending policy"},
+
 		// Access token error namespace (3xx)
 		accesstoken.ErrBadID:       errorInfo{400, "CH300", "Malformed or empty access token id"},
 		accesstoken.ErrBadType:     errorInfo{400, "CH301", "Access tokens must be type client or network"},
 		accesstoken.ErrDuplicateID: errorInfo{400, "CH302", "Access token id is already in use"},
 		errCurrentToken:            errorInfo{400, "CH310", "The access token used to authenticate this request cannot be deleted"},
 
+		// Asset error namespace (4xx)
+		asset.ErrBadDefinition:          errorInfo{400, "CH400", "Invalid asset definition"},
+		asset.ErrDefinitionVersion:      errorInfo{400, "CH401", "Asset definition version must follow the latest published version"},
+		asset.ErrBadDefinitionSignature: errorInfo{400, "CH402", "Asset definition is not signed by a quorum of the issuance keys"},
+		asset.ErrBadDecimals:            errorInfo{400, "CH403", "Asset precision must be an integer between 0 and 18"},
+		asset.ErrBadDecimalAmount:       errorInfo{400, "CH404", "Invalid decimal amount"},
+		asset.ErrBadIssuanceCap:         errorInfo{400, "CH405", "Invalid issuance cap"},
+		asset.ErrIssuanceCap:            errorInfo{400, "CH406", "Issuance would exceed the asset's issuance cap"},
+
 		// Query error namespace (6xx)
 		query.ErrBadAfter:               errorInfo{400, "CH600", "Malformed pagination parameter `after`"},
 		query.ErrParameterCountMismatch: errorInfo{400, "CH601", "Incorrect number of parameters to filter"},
@@ -114,13 +146,14 @@ var (
 
 		// Transaction error namespace (7xx)
 		// Build error namespace (70x)
-		txbuilder.ErrBadRefData: errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
-		errBadActionType:        errorInfo{400, "CH701", "Invalid action type"},
-		errBadAlias:             errorInfo{400, "CH702", "Invalid alias on action"},
-		errBadAction:            errorInfo{400, "CH703", "Invalid action object"},
-		txbuilder.ErrBadAmount:  errorInfo{400, "CH704", "Invalid asset amount"},
-		txbuilder.ErrBlankCheck: errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
-		txbuilder.ErrAction:     errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadRefData:  errorInfo{400, "CH700", "Reference data does not match previous transaction's reference data"},
+		errBadActionType:         errorInfo{400, "CH701", "Invalid action type"},
+		errBadAlias:              errorInfo{400, "CH702", "Invalid alias on action"},
+		errBadAction:             errorInfo{400, "CH703", "Invalid action object"},
+		txbuilder.ErrBadAmount:   errorInfo{400, "CH704", "Invalid asset amount"},
+		txbuilder.ErrBlankCheck:  errorInfo{400, "CH705", "Unsafe transaction: leaves assets to be taken without requiring payment"},
+		txbuilder.ErrAction:      errorInfo{400, "CH706", "One or more actions had an error: see attached data"},
+		txbuilder.ErrBadContract: errorInfo{400, "CH707", "Invalid contract"},
 
 		// Submit error namespace (73x)
 		txbuilder.ErrMissingRawTx:          errorInfo{400, "CH730", "Missing raw transaction"},
@@ -130,9 +163,22 @@ var (
 		txbuilder.ErrRejected:              errorInfo{400, "CH735", "Transaction rejected"},
 		txbuilder.ErrNoTxSighashCommitment: errorInfo{400, "CH736", "Transaction is not final, additional actions still allowed"},
 
+		// Coordination error namespace (74x)
+		coordinate.ErrBadContribution: errorInfo{400, "CH740", "Invalid contribution to coordination session"},
+		coordinate.ErrSessionState:    errorInfo{400, "CH741", "Coordination session is not in the required state"},
+		coordinate.ErrBadParticipant:  errorInfo{400, "CH742", "Invalid coordination session participant token"},
+
 		// account action error namespace (76x)
 		utxodb.ErrInsufficient: errorInfo{400, "CH760", "Insufficient funds for tx"},
 		utxodb.ErrReserved:     errorInfo{400, "CH761", "Some outputs are reserved; try again"},
+		utxodb.ErrBadSelector:  errorInfo{400, "CH762", "Unknown coin selection strategy"},
+
+		// Consolidation error namespace (77x)
+		consolidate.ErrBadPolicy: errorInfo{400, "CH770", "Invalid consolidation policy"},
+
+		payment.ErrBadPayment: errorInfo{400, "CH780", "Invalid payment"},
+
+		schedule.ErrBadSchedule: errorInfo{400, "CH790", "Invalid scheduled transaction"},
 
 		// Mock HSM error namespace (80x)
 		mockhsm.ErrInvalidAfter:         errorInfo{400, "CH801", "Invalid `after` in query"},
@@ -155,6 +201,12 @@ func errInfo(err error) (body detailedError, info errorInfo) {
 			body = detailedError{infoInternal, "", nil, true}
 		}
 	}()
+	if r, ok := root.(*rpc.ErrorResponse); ok {
+		// An error from another process of this Core,
+		// passed through as is.
+		info = errorInfo{r.StatusCode, r.ChainCode, r.Message}
+		return detailedError{info, r.Detail, r.Data, r.Temporary}, info
+	}
 	info, ok := errorInfoTab[root]
 	if !ok {
 		info = infoInternal
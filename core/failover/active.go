@@ -0,0 +1,34 @@
+package failover
+
+import (
+	"context"
+
+	"chain/database/pg"
+	"chain/database/sql"
+	"chain/errors"
+)
+
+// SaveActive records the rank of the generator that the leader
+// process of a Core is following, so that the Core's other
+// processes can follow it too.
+func SaveActive(ctx context.Context, db pg.DB, rank int) error {
+	const q = `
+		INSERT INTO active_generator (rank, updated_at) VALUES ($1, NOW())
+		ON CONFLICT (singleton) DO UPDATE SET rank = $1, updated_at = NOW()
+	`
+	_, err := db.Exec(ctx, q, rank)
+	return errors.Wrap(err, "saving active generator")
+}
+
+// LoadActive returns the rank of the generator most recently saved
+// with SaveActive. It returns false if none has been saved.
+func LoadActive(ctx context.Context, db pg.DB) (rank int, ok bool, err error) {
+	const q = `SELECT rank FROM active_generator`
+	err = db.QueryRow(ctx, q).Scan(&rank)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, errors.Wrap(err, "loading active generator")
+	}
+	return rank, true, nil
+}
@@ -0,0 +1,168 @@
+// Package failover moves block production between an ordered set of
+// generators: the blockchain's generator, of rank 0, and its backup
+// generators, of rank 1 and up, usually run by different
+// organizations.
+//
+// One generator at a time, the active one, makes blocks, and every
+// other Core fetches blocks from it. The active generator makes a
+// block at least every half timeout, even if it has no transactions,
+// so that silence means it has failed. Taking the generators in
+// order as a ring, starting after the active generator, the one at
+// distance d takes over after d timeouts without a new block. A Core
+// switches to fetching from any other generator that is making
+// blocks ahead of the active one.
+//
+// Block signers follow the same rule (see blocksigner), signing for
+// a new generator only after the same silence, and never signing two
+// blocks at one height. With a quorum that is a majority of the
+// signers, two generators can't both make a block at the same
+// height.
+package failover
+
+import (
+	"context"
+	"time"
+
+	"chain/log"
+)
+
+// Distance returns how many places generator to is after generator
+// from, in the ring of n generators.
+func Distance(from, to, n int) int {
+	return ((to-from)%n + n) % n
+}
+
+// Status is the state of a generator, as reported to its peers.
+type Status struct {
+	Height     uint64 `json:"block_height"`
+	Generating bool   `json:"generating"` // it made its latest block
+}
+
+// A Set is the set of generators as seen by one Core.
+type Set struct {
+	// Self is the rank of this Core, or -1 if it isn't
+	// a generator or backup generator.
+	Self int
+
+	// N is the number of generators, including the backups.
+	N int
+
+	// Timeout is how long a generator may go without making
+	// a block before the next one takes over.
+	Timeout time.Duration
+
+	// Status returns the status of another generator.
+	Status func(ctx context.Context, rank int) (Status, error)
+
+	// Local returns the height of the local blockchain.
+	Local func() uint64
+
+	// Generate makes blocks until ctx is canceled, and Fetch fetches
+	// blocks from another generator until ctx is canceled.
+	Generate func(ctx context.Context)
+	Fetch    func(ctx context.Context, rank int)
+}
+
+// Run makes or fetches blocks, following the active generator,
+// until ctx is canceled.
+func (s *Set) Run(ctx context.Context) {
+	active := s.initial(ctx)
+	w := &watch{height: s.Local(), progress: time.Now()}
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func(rank int) {
+			defer close(done)
+			if rank == s.Self {
+				s.Generate(runCtx)
+			} else {
+				s.Fetch(runCtx, rank)
+			}
+		}(active)
+
+		next := s.watch(ctx, active, w)
+		cancel()
+		<-done
+		if ctx.Err() != nil {
+			return
+		}
+		log.Messagef(ctx, "Generator failover from rank %d to rank %d", active, next)
+		active = next
+	}
+}
+
+// initial returns the generator to start with: the one making the
+// highest blocks, or the generator of rank 0 if none is.
+func (s *Set) initial(ctx context.Context) int {
+	var (
+		best       int
+		bestHeight uint64
+	)
+	for r := 0; r < s.N; r++ {
+		if r == s.Self {
+			continue
+		}
+		st, err := s.Status(ctx, r)
+		if err == nil && st.Generating && st.Height > bestHeight {
+			best, bestHeight = r, st.Height
+		}
+	}
+	return best
+}
+
+type watch struct {
+	height   uint64
+	progress time.Time // when height last changed
+}
+
+// watch returns the next generator to follow when the active one is
+// overtaken or goes silent, or active when ctx is canceled.
+func (s *Set) watch(ctx context.Context, active int, w *watch) int {
+	ticks := time.NewTicker(s.Timeout / 4)
+	defer ticks.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return active
+		case <-ticks.C:
+		}
+
+		local := s.Local()
+		if local > w.height {
+			w.height, w.progress = local, time.Now()
+		}
+
+		// Another generator is making blocks ahead of the active one,
+		// or in place of it.
+		cur := Status{Height: local, Generating: active == s.Self}
+		if active != s.Self {
+			st, err := s.Status(ctx, active)
+			if err == nil {
+				cur = st
+			} else {
+				cur.Generating = false
+			}
+		}
+		for r := 0; r < s.N; r++ {
+			if r == active || r == s.Self {
+				continue
+			}
+			st, err := s.Status(ctx, r)
+			if err != nil || !st.Generating {
+				continue
+			}
+			if !cur.Generating || st.Height > cur.Height {
+				return r
+			}
+		}
+
+		// The active generator has gone silent long enough for
+		// this one to take over.
+		if s.Self >= 0 && s.Self != active {
+			d := Distance(active, s.Self, s.N)
+			if time.Since(w.progress) >= time.Duration(d)*s.Timeout {
+				return s.Self
+			}
+		}
+	}
+}
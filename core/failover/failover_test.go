@@ -0,0 +1,161 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDistance(t *testing.T) {
+	cases := []struct{ from, to, n, want int }{
+		{0, 1, 3, 1},
+		{0, 2, 3, 2},
+		{2, 0, 3, 1},
+		{1, 0, 3, 2},
+		{1, 1, 3, 0},
+	}
+	for _, c := range cases {
+		if got := Distance(c.from, c.to, c.n); got != c.want {
+			t.Errorf("Distance(%d, %d, %d) = %d want %d", c.from, c.to, c.n, got, c.want)
+		}
+	}
+}
+
+// testCore simulates a Core's blockchain height.
+type testCore struct {
+	mu         sync.Mutex
+	height     uint64
+	dead       bool
+	generating bool
+}
+
+func (c *testCore) status() (Status, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.dead {
+		return Status{}, errors.New("unreachable")
+	}
+	return Status{Height: c.height, Generating: c.generating}, nil
+}
+
+func (c *testCore) local() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height
+}
+
+func (c *testCore) isGenerating() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generating
+}
+
+func runTestCore(ctx context.Context, cores []*testCore, self int, core *testCore) {
+	const blockPeriod = 5 * time.Millisecond
+	s := &Set{
+		Self:    self,
+		N:       3,
+		Timeout: 100 * time.Millisecond,
+		Status: func(ctx context.Context, rank int) (Status, error) {
+			return cores[rank].status()
+		},
+		Local: core.local,
+		Generate: func(ctx context.Context) {
+			core.mu.Lock()
+			core.generating = true
+			core.mu.Unlock()
+			defer func() {
+				core.mu.Lock()
+				core.generating = false
+				core.mu.Unlock()
+			}()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(blockPeriod):
+				}
+				core.mu.Lock()
+				core.height++
+				core.mu.Unlock()
+			}
+		},
+		Fetch: func(ctx context.Context, rank int) {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(blockPeriod):
+				}
+				st, err := cores[rank].status()
+				core.mu.Lock()
+				if err == nil && st.Height > core.height {
+					core.height = st.Height
+				}
+				core.mu.Unlock()
+			}
+		},
+	}
+	s.Run(ctx)
+}
+
+func TestFailover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cores := []*testCore{new(testCore), new(testCore), new(testCore)}
+	participant := new(testCore)
+
+	var (
+		wg         sync.WaitGroup
+		primaryCtx context.Context
+		crash      context.CancelFunc
+	)
+	primaryCtx, crash = context.WithCancel(ctx)
+	start := func(ctx context.Context, self int, core *testCore) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runTestCore(ctx, cores, self, core)
+		}()
+	}
+	start(primaryCtx, 0, cores[0])
+	start(ctx, 1, cores[1])
+	start(ctx, 2, cores[2])
+	start(ctx, -1, participant)
+
+	time.Sleep(100 * time.Millisecond)
+	for i, c := range cores {
+		if got, want := c.isGenerating(), i == 0; got != want {
+			t.Errorf("before failover: core %d generating = %v want %v", i, got, want)
+		}
+	}
+	if participant.local() == 0 {
+		t.Error("before failover: participant has no blocks")
+	}
+
+	// The primary crashes. The first backup should take over,
+	// and the other Cores follow it.
+	crash()
+	cores[0].mu.Lock()
+	cores[0].dead = true
+	cores[0].mu.Unlock()
+
+	time.Sleep(600 * time.Millisecond)
+	if !cores[1].isGenerating() {
+		t.Error("after failover: backup 1 is not generating")
+	}
+	if cores[2].isGenerating() {
+		t.Error("after failover: backup 2 is generating")
+	}
+	h1 := participant.local()
+	time.Sleep(50 * time.Millisecond)
+	if h2 := participant.local(); h2 <= h1 {
+		t.Errorf("after failover: participant height stuck at %d", h2)
+	}
+
+	cancel()
+	wg.Wait()
+}
@@ -14,12 +14,16 @@ import (
 	"time"
 
 	"chain/core/rpc"
+	"chain/core/signerfault"
 	"chain/core/txdb"
+	"chain/database/pg"
+	chainjson "chain/encoding/json"
 	"chain/errors"
 	"chain/log"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/state"
+	"chain/protocol/vmutil"
 )
 
 const heightPollingPeriod = 3 * time.Second
@@ -54,7 +58,11 @@ func SnapshotProgress() *Snapshot {
 // It returns when its context is canceled.
 // After each attempt to fetch and apply a block, it calls health
 // to report either an error or nil to indicate success.
-func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func(error)) {
+//
+// If the peer's blockchain diverges from the local one, Fetch
+// looks for block signers that signed both, and saves the evidence
+// in db. If it finds any, it stops fetching.
+func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, db pg.DB, health func(error)) {
 	// Fetch the generator height periodically.
 	go pollGeneratorHeight(ctx, peer)
 
@@ -100,6 +108,18 @@ func Fetch(ctx context.Context, c *protocol.Chain, peer *rpc.Client, health func
 			health(err)
 			logNetworkError(ctx, err)
 		case b := <-blockch:
+			if prevBlock != nil && b.PreviousBlockHash != prevBlock.Hash() {
+				err = checkFork(ctx, c, peer, db, prevBlock)
+				if errors.Root(err) == signerfault.ErrEquivocation {
+					health(err)
+					log.Error(ctx, err)
+					<-ctx.Done()
+					log.Messagef(ctx, "Deposed, Fetch exiting")
+					return
+				} else if err != nil {
+					log.Error(ctx, err)
+				}
+			}
 			for {
 				prevSnapshot, prevBlock, err = applyBlock(ctx, c, prevSnapshot, prevBlock, b)
 				if err == protocol.ErrBadBlock {
@@ -227,18 +247,64 @@ func timeoutBackoffDur(n uint) time.Duration {
 	return baseTimeout + time.Duration(d)
 }
 
+// checkFork compares prev, the latest local block, with the peer's
+// block at the same height, once the peer's blockchain is found to
+// have diverged after it. It saves evidence of any signer that signed
+// both blocks, reports it to the peer, and returns ErrEquivocation.
+func checkFork(ctx context.Context, c *protocol.Chain, peer *rpc.Client, db pg.DB, prev *bc.Block) error {
+	if prev.Height < 2 {
+		return nil // the initial block has no signatures
+	}
+	parent, err := c.GetBlock(ctx, prev.Height-1)
+	if err != nil {
+		return errors.Wrap(err, "getting block")
+	}
+	keys, _, err := vmutil.ParseBlockMultiSigProgram(parent.ConsensusProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing consensus program")
+	}
+	theirs, err := getBlock(ctx, peer, prev.Height, timeoutBackoffDur(0))
+	if err != nil || theirs == nil {
+		return errors.Wrap(err, "getting peer block for comparison")
+	}
+
+	faults, err := signerfault.Detect(keys, &prev.BlockHeader, &theirs.BlockHeader)
+	if err != nil {
+		return err
+	}
+	for _, f := range faults {
+		err = signerfault.Save(ctx, db, f)
+		if err != nil {
+			return err
+		}
+		err = peer.Call(ctx, "/rpc/report-signer-fault", f, nil)
+		if err != nil {
+			log.Error(ctx, err, "reporting signer fault to peer")
+		}
+	}
+	if len(faults) == 0 {
+		return nil
+	}
+	return errors.Wrapf(signerfault.ErrEquivocation, "%d signers at height %d", len(faults), prev.Height)
+}
+
 // getBlock sends a get-block RPC request to another Core
 // for the next block.
 func getBlock(ctx context.Context, peer *rpc.Client, height uint64, timeout time.Duration) (*bc.Block, error) {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	var block *bc.Block
-	err := peer.Call(ctx, "/rpc/get-block", height, &block)
+	var raw chainjson.HexBytes
+	err := peer.Call(ctx, "/rpc/get-block", height, &raw)
 	if ctx.Err() == context.DeadlineExceeded {
 		return nil, nil
 	}
-	return block, errors.Wrap(err, "get blocks rpc")
+	if err != nil {
+		return nil, errors.Wrap(err, "get blocks rpc")
+	}
+	block := new(bc.Block)
+	err = block.UnmarshalCanonical(raw)
+	return block, errors.Wrap(err, "decoding block")
 }
 
 // getHeight sends a get-height RPC request to another Core for
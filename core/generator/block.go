@@ -3,9 +3,12 @@ package generator
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"chain/core/blocksigner"
+	"chain/core/config"
 	"chain/crypto/ed25519"
 	"chain/database/pg"
 	"chain/database/sql"
@@ -43,13 +46,29 @@ func (g *generator) makeBlock(ctx context.Context) error {
 	t0 := time.Now()
 	defer recordSince(t0)
 
-	b, s, err := g.chain.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, time.Now())
+	b, s, err := g.generateBlock(ctx)
 	if err != nil {
-		return errors.Wrap(err, "generate")
+		return err
 	}
-	if len(b.Transactions) == 0 {
+	rot, err := approvedRotation(ctx, g.db)
+	if err != nil {
+		return errors.Wrap(err, "loading consensus program rotation")
+	}
+	// A rotation takes effect only in the block at its height, so
+	// that block is made even if it would be empty.
+	atRotation := rot != nil && rot.Height == b.Height
+	if len(b.Transactions) == 0 && !g.sched.MakeEmpty && !g.idleTooLong() && !atRotation {
 		return nil // don't bother making an empty block
 	}
+	if atRotation {
+		b.ConsensusProgram = rot.ConsensusProgram
+	} else if rot != nil && rot.Height < b.Height {
+		log.Write(ctx, "error", "consensus program rotation missed its height", "height", rot.Height)
+		err = setRotationStatus(ctx, g.db, rot.Height, RotationExpired)
+		if err != nil {
+			return errors.Wrap(err, "expiring consensus program rotation")
+		}
+	}
 	err = savePendingBlock(ctx, g.db, b)
 	if err != nil {
 		return err
@@ -57,6 +76,142 @@ func (g *generator) makeBlock(ctx context.Context) error {
 	return g.commitBlock(ctx, b, s)
 }
 
+// generateBlock makes the next block from the pending pool. A block
+// signer whose policy refuses one of the block's transactions
+// withholds its signature from the block. If the signers left can't
+// make a quorum, generateBlock evicts refused transactions, returns
+// the rest to the pool, and makes the block again. It does this
+// before any signer has signed the block, since a signer signs only
+// one block at each height.
+func (g *generator) generateBlock(ctx context.Context) (*bc.Block, *state.Snapshot, error) {
+	var quorum int
+	if g.latestBlock != nil {
+		var err error
+		_, quorum, err = vmutil.ParseBlockMultiSigProgram(g.latestBlock.ConsensusProgram)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "parsing consensus program")
+		}
+	}
+	for {
+		b, s, err := g.chain.GenerateBlock(ctx, g.latestBlock, g.latestSnapshot, time.Now())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "generate")
+		}
+		evicted := toEvict(g.checkBlock(ctx, b), len(g.signers), quorum)
+		if len(evicted) == 0 {
+			return b, s, nil
+		}
+		if g.evict(ctx, b, evicted) == 0 {
+			// The refused transactions aren't in the block;
+			// let the signers' responses tell the rest.
+			return b, s, nil
+		}
+	}
+}
+
+// checkBlock asks the signers that are BlockCheckers whether they
+// would refuse b, and returns the IDs of the transactions they
+// refuse, each with the number of signers refusing it. A signer
+// refuses at most one transaction.
+func (g *generator) checkBlock(ctx context.Context, b *bc.Block) map[bc.Hash]int {
+	if len(b.Transactions) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, blockCheckTimeout)
+	defer cancel()
+
+	var checkers []BlockChecker
+	for _, s := range g.signers {
+		if c, ok := s.(BlockChecker); ok {
+			checkers = append(checkers, c)
+		}
+	}
+	errs := make(chan error, len(checkers))
+	for _, c := range checkers {
+		go func(c BlockChecker) {
+			errs <- c.CheckBlock(ctx, b)
+		}(c)
+	}
+
+	refused := make(map[bc.Hash]int)
+	for range checkers {
+		err := <-errs
+		r := blocksigner.RefusalOf(err)
+		if r != nil && r.TxID != nil {
+			refused[*r.TxID]++
+		} else if err != nil {
+			log.Write(ctx, "error", err, "at", "checking block")
+		}
+	}
+	return refused
+}
+
+// toEvict returns the refused transactions to evict from a block
+// so that enough of its nsigners signers are willing to sign it to
+// make quorum. If the signers that refuse nothing can make quorum
+// already, it returns none; otherwise it picks the transactions
+// refused by the most signers first.
+func toEvict(refused map[bc.Hash]int, nsigners, quorum int) map[bc.Hash]bool {
+	willing := nsigners
+	ids := make([]bc.Hash, 0, len(refused))
+	for id, n := range refused {
+		willing -= n
+		ids = append(ids, id)
+	}
+	sort.Sort(byRefusals{ids, refused})
+	evicted := make(map[bc.Hash]bool)
+	for _, id := range ids {
+		if willing >= quorum {
+			break
+		}
+		evicted[id] = true
+		willing += refused[id]
+	}
+	return evicted
+}
+
+type byRefusals struct {
+	ids     []bc.Hash
+	refused map[bc.Hash]int
+}
+
+func (a byRefusals) Len() int      { return len(a.ids) }
+func (a byRefusals) Swap(i, j int) { a.ids[i], a.ids[j] = a.ids[j], a.ids[i] }
+func (a byRefusals) Less(i, j int) bool {
+	ni, nj := a.refused[a.ids[i]], a.refused[a.ids[j]]
+	if ni != nj {
+		return ni > nj
+	}
+	return a.ids[i].String() < a.ids[j].String()
+}
+
+// evict returns b's transactions to the pending pool, except for
+// the evicted ones, and returns how many it left out.
+func (g *generator) evict(ctx context.Context, b *bc.Block, evicted map[bc.Hash]bool) int {
+	var n int
+	for _, tx := range b.Transactions {
+		if evicted[tx.Hash] {
+			log.Write(ctx, "at", "evicting refused transaction", "tx", tx.Hash)
+			n++
+			continue
+		}
+		err := g.chain.AddTx(ctx, tx)
+		if err != nil {
+			log.Error(ctx, errors.Wrap(err, "returning transaction to pool"), "tx", tx.Hash)
+		}
+	}
+	return n
+}
+
+// idleTooLong reports whether it's time to make a block, even an
+// empty one, to show that the generator is alive.
+func (g *generator) idleTooLong() bool {
+	if g.sched.MaxIdle <= 0 || g.latestBlock == nil {
+		return false
+	}
+	return time.Since(g.latestBlock.Time()) >= g.sched.MaxIdle
+}
+
 func (g *generator) commitBlock(ctx context.Context, b *bc.Block, s *state.Snapshot) error {
 	err := g.getAndAddBlockSignatures(ctx, b, g.latestBlock)
 	if err != nil {
@@ -70,9 +225,36 @@ func (g *generator) commitBlock(ctx context.Context, b *bc.Block, s *state.Snaps
 
 	g.latestBlock = b
 	g.latestSnapshot = s
+	return g.finishRotation(ctx, b)
+}
+
+// finishRotation applies the approved consensus program rotation,
+// if b put it into effect, and switches to the new federation's
+// signers.
+func (g *generator) finishRotation(ctx context.Context, b *bc.Block) error {
+	rot, err := approvedRotation(ctx, g.db)
+	if err != nil {
+		return errors.Wrap(err, "loading consensus program rotation")
+	}
+	if rot == nil || !rot.rotatesAt(b) {
+		return nil
+	}
+	err = applyRotation(ctx, g.db, rot)
+	if err != nil {
+		return errors.Wrap(err, "applying consensus program rotation")
+	}
+	log.Messagef(ctx, "Consensus program rotated at height %d", rot.Height)
+	g.setRemoteSigners(rot.Signers)
 	return nil
 }
 
+func (g *generator) setRemoteSigners(remote []config.BlockSigner) {
+	g.signers = append([]BlockSigner(nil), g.local...)
+	for _, s := range remote {
+		g.signers = append(g.signers, g.dial(s))
+	}
+}
+
 func (g *generator) getAndAddBlockSignatures(ctx context.Context, b, prevBlock *bc.Block) error {
 	if prevBlock == nil && b.Height == 1 {
 		return nil // no signatures needed for initial block
@@ -83,6 +265,7 @@ func (g *generator) getAndAddBlockSignatures(ctx context.Context, b, prevBlock *
 		return errors.Wrap(err, "parsing prevblock output script")
 	}
 	if len(g.signers) < quorum {
+		g.monitor.check(g.signers, quorum)
 		return errTooFewSigners
 	}
 
@@ -95,12 +278,13 @@ func (g *generator) getAndAddBlockSignatures(ctx context.Context, b, prevBlock *
 	replies := make([][]byte, len(g.signers))
 	done := make(chan int, len(g.signers))
 	for i, signer := range g.signers {
-		go getSig(ctx, signer, b, &replies[i], i, done)
+		go getSig(ctx, g.monitor, signer, b, &replies[i], i, done)
 	}
 
 	nready := 0
 	for i := 0; i < len(g.signers) && nready < quorum; i++ {
-		sig := replies[<-done]
+		j := <-done
+		sig := replies[j]
 		if sig == nil {
 			continue
 		}
@@ -109,9 +293,11 @@ func (g *generator) getAndAddBlockSignatures(ctx context.Context, b, prevBlock *
 			goodSigs[k] = sig
 			nready++
 		} else if k < 0 {
-			log.Write(ctx, "error", "invalid signature", "block", b.Hash(), "signature", sig)
+			log.Write(ctx, "error", "invalid signature", "block", b.Hash(), "signature", sig, "signer", g.signers[j])
+			g.monitor.recordInvalid(g.signers[j])
 		}
 	}
+	g.monitor.check(g.signers, quorum)
 
 	if nready < quorum {
 		return fmt.Errorf("got %d of %d needed signatures", nready, quorum)
@@ -129,10 +315,17 @@ func indexKey(keys []ed25519.PublicKey, msg, sig []byte) int {
 	return -1
 }
 
-func getSig(ctx context.Context, signer BlockSigner, b *bc.Block, sig *[]byte, i int, done chan int) {
+func getSig(ctx context.Context, m *SignerMonitor, signer BlockSigner, b *bc.Block, sig *[]byte, i int, done chan int) {
+	t0 := time.Now()
 	var err error
 	*sig, err = signer.SignBlock(ctx, b)
-	if err != nil && ctx.Err() != context.Canceled {
+	if err != nil && ctx.Err() == context.Canceled {
+		// The generator has enough signatures without this one.
+		done <- i
+		return
+	}
+	m.record(signer, b.Height, time.Since(t0), err)
+	if err != nil {
 		log.Write(ctx, "error", err, "signer", signer)
 	}
 	done <- i
@@ -160,6 +353,17 @@ func getPendingBlock(ctx context.Context, db pg.DB) (*bc.Block, error) {
 	return &block, nil
 }
 
+// Generated reports whether b was made by this Core's generator,
+// according to its record of the last block it made. Other Cores
+// take it as a sign of which generator is active.
+func Generated(ctx context.Context, db pg.DB, b *bc.Block) (bool, error) {
+	p, err := getPendingBlock(ctx, db)
+	if err != nil || p == nil {
+		return false, err
+	}
+	return p.Height == b.Height && p.HashForSig() == b.HashForSig(), nil
+}
+
 // savePendingBlock persists a pending, uncommitted block to the database.
 // The generator should save a pending block *before* asking signers to
 // sign the block.
@@ -8,6 +8,8 @@ import (
 	"context"
 	"time"
 
+	"chain/core/config"
+	"chain/core/txdb"
 	"chain/database/pg"
 	"chain/log"
 	"chain/protocol"
@@ -24,6 +26,43 @@ type BlockSigner interface {
 	SignBlock(context.Context, *bc.Block) (signature []byte, err error)
 }
 
+// A BlockChecker is a BlockSigner that can apply its block policies
+// to a block without signing it. The generator checks each block
+// with the signers that implement it before asking for signatures.
+// It leaves out refused transactions only if the signers that would
+// sign the block can't make a quorum without the refusing ones.
+type BlockChecker interface {
+	// CheckBlock returns an error carrying a blocksigner.Refusal
+	// if the signer would refuse to sign the block.
+	CheckBlock(context.Context, *bc.Block) error
+}
+
+// blockCheckTimeout is how long the generator waits for block
+// signers to check a block before going on to ask for signatures.
+const blockCheckTimeout = 5 * time.Second
+
+// poolCheckPeriod is how often the generator checks the size of the
+// pending pool, to cut a block early.
+const poolCheckPeriod = 100 * time.Millisecond
+
+// A Schedule says when the generator makes blocks.
+type Schedule struct {
+	// Period is how often the generator makes a block.
+	Period time.Duration
+
+	// MakeEmpty makes the generator make a block every period,
+	// even with no transactions. Otherwise it skips empty blocks,
+	// unless MaxIdle is positive and that long has passed since
+	// the latest block.
+	MakeEmpty bool
+	MaxIdle   time.Duration
+
+	// MaxPending, if positive, is the number of pending
+	// transactions at which the generator makes a block
+	// without waiting for the end of the period.
+	MaxPending int
+}
+
 // generator produces new blocks on an interval.
 type generator struct {
 	// config
@@ -31,6 +70,18 @@ type generator struct {
 	chain   *protocol.Chain
 	signers []BlockSigner
 
+	// local signers are in-process; the rest of signers are
+	// remote, made by dial from the Core's configuration. After a
+	// consensus program rotation, the remote signers are replaced.
+	local []BlockSigner
+	dial  func(config.BlockSigner) BlockSigner
+
+	// monitor, if set, tracks how the signers respond.
+	monitor *SignerMonitor
+
+	sched Schedule
+	pool  *txdb.Pool
+
 	// latestBlock and latestSnapshot are current as long as this
 	// process remains the leader process. If the process is demoted,
 	// generator.Generate() should return and this struct should be
@@ -40,16 +91,22 @@ type generator struct {
 }
 
 // Generate runs in a loop, making one new block
-// every block period. It returns when its context
-// is canceled.
+// every block period, as set by sched. It returns
+// when its context is canceled.
 // After each attempt to make a block, it calls health
 // to report either an error or nil to indicate success.
+//
+// Blocks are signed by the local signers in s, and by the remote
+// block signers in the Core's configuration, using dial to reach
+// them. If m is not nil, it tracks how the signers respond.
 func Generate(
 	ctx context.Context,
 	c *protocol.Chain,
 	s []BlockSigner,
+	dial func(config.BlockSigner) BlockSigner,
+	m *SignerMonitor,
 	db pg.DB,
-	period time.Duration,
+	sched Schedule,
 	health func(error),
 ) {
 	// This process just became leader, so it's responsible
@@ -62,11 +119,33 @@ func Generate(
 	g := &generator{
 		db:             db,
 		chain:          c,
-		signers:        s,
+		local:          s,
+		dial:           dial,
+		monitor:        m,
+		sched:          sched,
+		pool:           txdb.NewPool(db),
 		latestBlock:    recoveredBlock,
 		latestSnapshot: recoveredSnapshot,
 	}
 
+	// Finish applying a consensus program rotation, in case the
+	// previous leader exited in the middle of it.
+	if g.latestBlock != nil {
+		err = g.finishRotation(ctx, g.latestBlock)
+		if err != nil {
+			log.Fatal(ctx, log.KeyError, err)
+		}
+	}
+	conf, err := config.Load(ctx, db)
+	if err != nil {
+		log.Fatal(ctx, log.KeyError, err)
+	}
+	var remote []config.BlockSigner
+	if conf != nil {
+		remote = conf.Signers
+	}
+	g.setRemoteSigners(remote)
+
 	// Check to see if we already have a pending, generated block.
 	// This can happen if the leader process exits between generating
 	// the block and committing the signed block to the blockchain.
@@ -88,18 +167,43 @@ func Generate(
 		}
 	}
 
-	ticks := time.Tick(period)
+	check := sched.Period
+	if sched.MaxPending > 0 && poolCheckPeriod < check {
+		check = poolCheckPeriod
+	}
+	ticks := time.NewTicker(check)
+	defer ticks.Stop()
+	last := time.Now() // tick of the latest attempt to make a block
 	for {
+		var now time.Time
 		select {
 		case <-ctx.Done():
 			log.Messagef(ctx, "Deposed, Generate exiting")
 			return
-		case <-ticks:
-			err := g.makeBlock(ctx)
-			health(err)
-			if err != nil {
-				log.Error(ctx, err)
-			}
+		case now = <-ticks.C:
+		}
+		if now.Sub(last) < sched.Period && !g.poolFull(ctx) {
+			continue
 		}
+		last = now
+		err := g.makeBlock(ctx)
+		health(err)
+		if err != nil {
+			log.Error(ctx, err)
+		}
+	}
+}
+
+// poolFull reports whether the pending pool has reached the size
+// at which to cut a block early.
+func (g *generator) poolFull(ctx context.Context) bool {
+	if g.sched.MaxPending <= 0 {
+		return false
+	}
+	n, err := g.pool.Count(ctx)
+	if err != nil {
+		log.Error(ctx, err)
+		return false
 	}
+	return n >= g.sched.MaxPending
 }
@@ -2,17 +2,21 @@ package generator
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
+	"chain/core/blocksigner"
 	"chain/crypto/ed25519"
 	"chain/database/pg/pgtest"
+	"chain/errors"
 	"chain/protocol"
 	"chain/protocol/bc"
 	"chain/protocol/prottest"
 	"chain/protocol/state"
 	"chain/protocol/validation"
 	"chain/protocol/vm"
+	"chain/protocol/vmutil"
 	"chain/testutil"
 )
 
@@ -36,7 +40,7 @@ func TestGeneratorRecovery(t *testing.T) {
 	// Start Generate which should notice the pending block and commit it.
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	go Generate(ctx, c, nil, dbtx, time.Second, func(error) {})
+	go Generate(ctx, c, nil, nil, nil, dbtx, Schedule{Period: time.Second}, func(error) {})
 
 	// Wait for the block to land, and then make sure it's the same block
 	// that was pending before we ran Generate.
@@ -114,6 +118,119 @@ func TestGetAndAddBlockSignaturesInitialBlock(t *testing.T) {
 	}
 }
 
+func TestGenerateBlockEvictsRefused(t *testing.T) {
+	pubkey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consensusProg, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{pubkey}, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	cases := []struct {
+		willing int // signers that refuse nothing
+		want    []int
+	}{
+		// The refusing signer is needed for quorum.
+		{0, []int{0, 2}},
+		// Another signer can make quorum without it.
+		{1, []int{0, 1, 2}},
+	}
+	for i, c := range cases {
+		ctx := context.Background()
+		chain := prottest.NewChain(t)
+		tip, snapshot := chain.State()
+		tip = &bc.Block{BlockHeader: tip.BlockHeader, Transactions: tip.Transactions}
+		tip.ConsensusProgram = consensusProg
+
+		trueProg := []byte{byte(vm.OP_TRUE)}
+		assetID := bc.ComputeAssetID(trueProg, chain.InitialBlockHash, 1)
+		now := time.Now()
+		var txs []*bc.Tx
+		for j := byte(0); j < 3; j++ {
+			tx := bc.NewTx(bc.TxData{
+				Version: 1,
+				Inputs:  []*bc.TxInput{bc.NewIssuanceInput([]byte{j}, 1, nil, chain.InitialBlockHash, trueProg, nil)},
+				Outputs: []*bc.TxOutput{bc.NewTxOutput(assetID, 1, trueProg, nil)},
+				MinTime: bc.Millis(now.Add(-time.Minute)),
+				MaxTime: bc.Millis(now.Add(time.Hour)),
+			})
+			err := chain.AddTx(ctx, tx)
+			if err != nil {
+				testutil.FatalErr(t, err)
+			}
+			txs = append(txs, tx)
+		}
+
+		signers := []BlockSigner{refusingSigner{txs[1].Hash}}
+		for j := 0; j < c.willing; j++ {
+			signers = append(signers, refusingSigner{}) // refuses no tx
+		}
+		g := &generator{
+			chain:          chain,
+			signers:        signers,
+			latestBlock:    tip,
+			latestSnapshot: snapshot,
+		}
+		b, _, err := g.generateBlock(ctx)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		got := make(map[bc.Hash]bool)
+		for _, tx := range b.Transactions {
+			got[tx.Hash] = true
+		}
+		want := make(map[bc.Hash]bool)
+		for _, j := range c.want {
+			want[txs[j].Hash] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("case %d: block transactions = %v want %v", i, got, want)
+		}
+	}
+}
+
+func TestToEvict(t *testing.T) {
+	a, b := bc.Hash{1}, bc.Hash{2}
+	cases := []struct {
+		refused  map[bc.Hash]int
+		nsigners int
+		quorum   int
+		want     map[bc.Hash]bool
+	}{
+		{map[bc.Hash]int{a: 1}, 3, 2, map[bc.Hash]bool{}},
+		{map[bc.Hash]int{a: 1, b: 1}, 3, 2, map[bc.Hash]bool{a: true}},
+		{map[bc.Hash]int{a: 1, b: 2}, 3, 2, map[bc.Hash]bool{b: true}},
+		{map[bc.Hash]int{a: 1, b: 2}, 3, 3, map[bc.Hash]bool{a: true, b: true}},
+	}
+	for i, c := range cases {
+		got := toEvict(c.refused, c.nsigners, c.quorum)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("case %d: toEvict = %v want %v", i, got, c.want)
+		}
+	}
+}
+
+type refusingSigner struct {
+	txID bc.Hash
+}
+
+func (s refusingSigner) SignBlock(ctx context.Context, b *bc.Block) ([]byte, error) {
+	return nil, errors.New("not signing in this test")
+}
+
+func (s refusingSigner) CheckBlock(ctx context.Context, b *bc.Block) error {
+	for _, tx := range b.Transactions {
+		if tx.Hash == s.txID {
+			id := tx.Hash
+			r := &blocksigner.Refusal{Policy: "test", Reason: "refused", TxID: &id}
+			return errors.WithData(blocksigner.ErrPolicyRefusal, "refusal", r)
+		}
+	}
+	return nil
+}
+
 type testSigner struct {
 	pubKey  ed25519.PublicKey
 	privKey ed25519.PrivateKey
@@ -0,0 +1,271 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"chain/core/blocksigner"
+	"chain/core/config"
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+// Rotation statuses.
+const (
+	RotationProposed = "proposed" // waiting for approvals
+	RotationApproved = "approved" // approved by both federations
+	RotationApplied  = "applied"  // in effect on the blockchain
+	RotationExpired  = "expired"  // its height passed before it was approved
+)
+
+var (
+	// ErrBadRotation is returned for an invalid consensus program
+	// rotation proposal.
+	ErrBadRotation = errors.New("invalid consensus program rotation")
+
+	// ErrRotationPending is returned when proposing a rotation while
+	// another is still proposed or approved.
+	ErrRotationPending = errors.New("another consensus program rotation is pending")
+)
+
+// A Rotation changes the consensus program of the blockchain, and
+// with it the federation of block signers. The block at Height is
+// the first to carry the new program, so it is signed by the current
+// federation, and the blocks after it by the new one.
+//
+// A rotation takes effect only once it is approved by a quorum of
+// both the current and the new federation.
+type Rotation struct {
+	Height           uint64                        `json:"height"`
+	ConsensusProgram chainjson.HexBytes            `json:"consensus_program"`
+	Quorum           int                           `json:"quorum"`
+	Signers          []config.BlockSigner          `json:"block_signers"`
+	Approvals        map[string]chainjson.HexBytes `json:"approvals"` // hex pubkey -> signature
+	Status           string                        `json:"status"`
+	CreatedAt        time.Time                     `json:"created_at"`
+}
+
+// ProposeRotation saves a proposed rotation of the consensus program
+// to the federation of the given remote signers and quorum, plus
+// this Core's own block key if it is a signer. Proposing the same
+// rotation again leaves its approvals intact.
+func ProposeRotation(ctx context.Context, db pg.DB, conf *config.Config, height uint64, signers []config.BlockSigner, quorum int) (*Rotation, error) {
+	var pubkeys []ed25519.PublicKey
+	if conf.IsSigner {
+		pub, err := hex.DecodeString(conf.BlockPub)
+		if err != nil {
+			return nil, errors.Wrap(err, "decoding block pubkey")
+		}
+		pubkeys = append(pubkeys, pub)
+	}
+	for _, s := range signers {
+		if len(s.Pubkey) != ed25519.PublicKeySize {
+			return nil, errors.WithDetailf(ErrBadRotation, "bad pubkey for signer %s", s.URL)
+		}
+		pubkeys = append(pubkeys, ed25519.PublicKey(s.Pubkey))
+	}
+	prog, err := vmutil.BlockMultiSigProgram(pubkeys, quorum)
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadRotation, err.Error())
+	}
+
+	signerData, err := json.Marshal(signers)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	const (
+		pendingQ = `
+			SELECT 1 FROM consensus_rotations
+			WHERE status IN ('proposed', 'approved')
+				AND NOT (height = $1 AND consensus_program = $2)
+		`
+		insertQ = `
+			INSERT INTO consensus_rotations (height, consensus_program, quorum, block_signers, status)
+			VALUES ($1, $2, $3, $4, 'proposed')
+			ON CONFLICT (height) DO UPDATE SET block_signers = $4
+				WHERE consensus_rotations.consensus_program = $2
+		`
+	)
+	var x int
+	err = db.QueryRow(ctx, pendingQ, height, prog).Scan(&x)
+	if err == nil {
+		return nil, errors.Wrap(ErrRotationPending)
+	} else if err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "checking for pending rotation")
+	}
+	res, err := db.Exec(ctx, insertQ, height, prog, quorum, signerData)
+	if err != nil {
+		return nil, errors.Wrap(err, "saving rotation")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err, "saving rotation")
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadRotation, "a different rotation was proposed for height %d", height)
+	}
+	return FindRotation(ctx, db, height)
+}
+
+// FindRotation returns the rotation for the given height.
+func FindRotation(ctx context.Context, db pg.DB, height uint64) (*Rotation, error) {
+	rots, err := rotations(ctx, db, "height = $1", height)
+	if err != nil {
+		return nil, err
+	}
+	if len(rots) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "height %d", height)
+	}
+	return rots[0], nil
+}
+
+// Approve checks the approval signatures in sigs, keyed by hex
+// pubkey, and adds the valid ones to the rotation. It marks the
+// rotation approved once a quorum of both the current federation,
+// given by the consensus program of the latest block, and the new
+// federation have approved it.
+func (r *Rotation) Approve(ctx context.Context, db pg.DB, blockchainID bc.Hash, latest *bc.Block, sigs map[string][]byte) error {
+	if r.Status != RotationProposed {
+		return nil
+	}
+	if latest.Height >= r.Height {
+		r.Status = RotationExpired
+		return errors.Wrap(setRotationStatus(ctx, db, r.Height, RotationExpired))
+	}
+
+	curKeys, curQuorum, err := vmutil.ParseBlockMultiSigProgram(latest.ConsensusProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing current consensus program")
+	}
+	newKeys, newQuorum, err := vmutil.ParseBlockMultiSigProgram(r.ConsensusProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing new consensus program")
+	}
+
+	hash := blocksigner.RotationHash(blockchainID, r.Height, r.ConsensusProgram)
+	if r.Approvals == nil {
+		r.Approvals = make(map[string]chainjson.HexBytes)
+	}
+	for pub, sig := range sigs {
+		key, err := hex.DecodeString(pub)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(key), hash[:], sig) {
+			r.Approvals[pub] = sig
+		}
+	}
+
+	status := RotationProposed
+	if r.approvedBy(curKeys) >= curQuorum && r.approvedBy(newKeys) >= newQuorum {
+		status = RotationApproved
+	}
+
+	approvals, err := json.Marshal(r.Approvals)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	const q = `
+		UPDATE consensus_rotations SET approvals = $2, status = $3
+		WHERE height = $1 AND status = 'proposed'
+	`
+	_, err = db.Exec(ctx, q, r.Height, approvals, status)
+	if err != nil {
+		return errors.Wrap(err, "saving approvals")
+	}
+	r.Status = status
+	return nil
+}
+
+func (r *Rotation) approvedBy(keys []ed25519.PublicKey) (n int) {
+	for _, k := range keys {
+		if _, ok := r.Approvals[hex.EncodeToString(k)]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// approvedRotation returns the approved rotation not yet in effect,
+// if any.
+func approvedRotation(ctx context.Context, db pg.DB) (*Rotation, error) {
+	rots, err := rotations(ctx, db, "status = 'approved'")
+	if err != nil || len(rots) == 0 {
+		return nil, err
+	}
+	return rots[0], nil
+}
+
+// applyRotation records that rot is in effect, and replaces the
+// remote block signers in the Core's configuration with the new
+// federation's. It is idempotent, so if interrupted it can be
+// retried after recovery.
+func applyRotation(ctx context.Context, db pg.DB, rot *Rotation) error {
+	signerData, err := json.Marshal(rot.Signers)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	const q = `UPDATE config SET remote_block_signers = $1`
+	_, err = db.Exec(ctx, q, signerData)
+	if err != nil {
+		return errors.Wrap(err, "updating block signers")
+	}
+	return errors.Wrap(setRotationStatus(ctx, db, rot.Height, RotationApplied), "updating rotation status")
+}
+
+func setRotationStatus(ctx context.Context, db pg.DB, height uint64, status string) error {
+	const q = `UPDATE consensus_rotations SET status = $2 WHERE height = $1`
+	_, err := db.Exec(ctx, q, height, status)
+	return err
+}
+
+func rotations(ctx context.Context, db pg.DB, pred string, args ...interface{}) ([]*Rotation, error) {
+	q := `
+		SELECT height, consensus_program, quorum, block_signers, approvals, status, created_at
+		FROM consensus_rotations WHERE ` + pred + `
+		ORDER BY height
+	`
+	var rots []*Rotation
+	scan := func(
+		height uint64,
+		prog []byte,
+		quorum int,
+		signerData, approvalData []byte,
+		status string,
+		createdAt time.Time,
+	) error {
+		r := &Rotation{
+			Height:           height,
+			ConsensusProgram: prog,
+			Quorum:           quorum,
+			Status:           status,
+			CreatedAt:        createdAt,
+		}
+		err := json.Unmarshal(signerData, &r.Signers)
+		if err != nil {
+			return errors.Wrap(err, "decoding block signers")
+		}
+		err = json.Unmarshal(approvalData, &r.Approvals)
+		if err != nil {
+			return errors.Wrap(err, "decoding approvals")
+		}
+		rots = append(rots, r)
+		return nil
+	}
+	err := pg.ForQueryRows(ctx, db, q, append(args, scan)...)
+	return rots, errors.Wrap(err, "querying rotations")
+}
+
+// rotatesAt reports whether b carries rot's consensus program.
+func (r *Rotation) rotatesAt(b *bc.Block) bool {
+	return b.Height >= r.Height && bytes.Equal(b.ConsensusProgram, r.ConsensusProgram)
+}
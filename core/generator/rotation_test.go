@@ -0,0 +1,157 @@
+package generator
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"chain/core/blocksigner"
+	"chain/core/config"
+	"chain/crypto/ed25519"
+	"chain/database/pg/pgtest"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/protocol/state"
+	"chain/protocol/vmutil"
+	"chain/testutil"
+)
+
+func TestRotationApproval(t *testing.T) {
+	ctx := context.Background()
+	dbtx := pgtest.NewTx(t)
+
+	curPub, curPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	newPub, newPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	curProg, err := vmutil.BlockMultiSigProgram([]ed25519.PublicKey{curPub}, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	latest := &bc.Block{BlockHeader: bc.BlockHeader{Height: 5, ConsensusProgram: curProg}}
+
+	signers := []config.BlockSigner{{URL: "http://signer.example", Pubkey: chainjson.HexBytes(newPub)}}
+	rot, err := ProposeRotation(ctx, dbtx, &config.Config{}, 10, signers, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	_, err = ProposeRotation(ctx, dbtx, &config.Config{}, 11, signers, 1)
+	if errors.Root(err) != ErrRotationPending {
+		t.Errorf("second proposal: got error %v want %v", err, ErrRotationPending)
+	}
+
+	var (
+		blockchainID = bc.Hash{1}
+		hash         = blocksigner.RotationHash(blockchainID, rot.Height, rot.ConsensusProgram)
+		curSig       = ed25519.Sign(curPriv, hash[:])
+		newSig       = ed25519.Sign(newPriv, hash[:])
+		wrongSig     = ed25519.Sign(newPriv, []byte("wrong"))
+	)
+
+	// The current federation alone isn't enough.
+	err = rot.Approve(ctx, dbtx, blockchainID, latest, map[string][]byte{
+		hex.EncodeToString(curPub): curSig,
+		hex.EncodeToString(newPub): wrongSig,
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if rot.Status != RotationProposed {
+		t.Errorf("status = %s want %s", rot.Status, RotationProposed)
+	}
+
+	err = rot.Approve(ctx, dbtx, blockchainID, latest, map[string][]byte{
+		hex.EncodeToString(newPub): newSig,
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	got, err := FindRotation(ctx, dbtx, 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Status != RotationApproved {
+		t.Errorf("status = %s want %s", got.Status, RotationApproved)
+	}
+	if len(got.Approvals) != 2 {
+		t.Errorf("got %d approvals want 2", len(got.Approvals))
+	}
+
+	b := &bc.Block{BlockHeader: bc.BlockHeader{Height: 10, ConsensusProgram: rot.ConsensusProgram}}
+	if !got.rotatesAt(b) {
+		t.Errorf("rotatesAt(block %d) = false want true", b.Height)
+	}
+}
+
+func TestMakeBlockAtRotationHeight(t *testing.T) {
+	ctx := context.Background()
+	dbtx := pgtest.NewTx(t)
+	c := prottest.NewChain(t)
+	b1, err := c.GetBlock(ctx, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	newPub, newPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	g := &generator{
+		db:             dbtx,
+		chain:          c,
+		dial:           func(config.BlockSigner) BlockSigner { return testSigner{newPub, newPriv} },
+		latestBlock:    b1,
+		latestSnapshot: state.Empty(),
+		sched:          Schedule{Period: time.Second},
+	}
+
+	// With nothing to do, the generator makes no block.
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.Height(); h != 1 {
+		t.Fatalf("height = %d want 1", h)
+	}
+
+	signers := []config.BlockSigner{{URL: "http://signer.example", Pubkey: chainjson.HexBytes(newPub)}}
+	rot, err := ProposeRotation(ctx, dbtx, &config.Config{}, 2, signers, 1)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = setRotationStatus(ctx, dbtx, rot.Height, RotationApproved)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	// An empty block is made at the rotation height, carrying the
+	// new consensus program.
+	err = g.makeBlock(ctx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if h := c.Height(); h != 2 {
+		t.Fatalf("height = %d want 2", h)
+	}
+	b2, err := c.GetBlock(ctx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if !rot.rotatesAt(b2) {
+		t.Errorf("block 2 consensus program = %x want %x", b2.ConsensusProgram, rot.ConsensusProgram)
+	}
+	got, err := FindRotation(ctx, dbtx, 2)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Status != RotationApplied {
+		t.Errorf("status = %s want %s", got.Status, RotationApplied)
+	}
+}
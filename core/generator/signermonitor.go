@@ -0,0 +1,148 @@
+package generator
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"chain/errors"
+)
+
+// errTooFewResponding is reported to SignerMonitor.Health when the
+// number of responding block signers is within the quorum margin.
+var errTooFewResponding = errors.New("too few block signers responding")
+
+// A SignerMonitor tracks how the block signers respond to the
+// generator's requests for signatures. Its methods are safe to call
+// concurrently. A nil SignerMonitor tracks nothing.
+type SignerMonitor struct {
+	// QuorumMargin is the number of responding signers, beyond the
+	// quorum, below which the monitor reports an error to Health.
+	QuorumMargin int
+
+	// Health, if set, is called after each block is signed, with
+	// an error if too few signers are responding or nil otherwise.
+	Health func(error)
+
+	mu      sync.Mutex
+	stats   map[string]*SignerStatus
+	current []string // signers asked to sign the latest block, in order
+}
+
+// SignerStatus describes the recent behavior of one block signer.
+type SignerStatus struct {
+	Signer            string     `json:"signer"`
+	Responding        bool       `json:"responding"`
+	Requests          uint64     `json:"requests"`
+	Failures          uint64     `json:"failures"`
+	InvalidSignatures uint64     `json:"invalid_signatures"`
+	LastLatencyMS     int64      `json:"last_latency_ms"`
+	MeanLatencyMS     int64      `json:"mean_latency_ms"`
+	LastSeenHeight    uint64     `json:"last_seen_height"`
+	LastSeenAt        *time.Time `json:"last_seen_at"`
+	LastError         string     `json:"last_error,omitempty"`
+
+	totalLatency time.Duration
+}
+
+// Statuses returns the status of each signer the generator currently
+// asks to sign blocks.
+func (m *SignerMonitor) Statuses() []*SignerStatus {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var a []*SignerStatus
+	for _, name := range m.current {
+		s := *m.status(name)
+		a = append(a, &s)
+	}
+	return a
+}
+
+// status returns the status of the named signer, creating it if
+// necessary. The caller must hold m.mu.
+func (m *SignerMonitor) status(name string) *SignerStatus {
+	if m.stats == nil {
+		m.stats = make(map[string]*SignerStatus)
+	}
+	s := m.stats[name]
+	if s == nil {
+		s = &SignerStatus{Signer: name}
+		m.stats[name] = s
+	}
+	return s
+}
+
+// record records a signer's response to a request to sign the block
+// at height, which took latency.
+func (m *SignerMonitor) record(signer BlockSigner, height uint64, latency time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.status(signerName(signer))
+	s.Requests++
+	s.totalLatency += latency
+	s.LastLatencyMS = int64(latency / time.Millisecond)
+	s.MeanLatencyMS = int64(s.totalLatency / time.Duration(s.Requests) / time.Millisecond)
+	if err != nil {
+		s.Failures++
+		s.Responding = false
+		s.LastError = err.Error()
+		return
+	}
+	now := time.Now()
+	s.Responding = true
+	s.LastSeenHeight = height
+	s.LastSeenAt = &now
+	s.LastError = ""
+}
+
+// recordInvalid records that a signer's signature didn't verify.
+// It must come after the record call for the same response.
+func (m *SignerMonitor) recordInvalid(signer BlockSigner) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.status(signerName(signer))
+	s.InvalidSignatures++
+	s.Responding = false
+	s.LastError = "invalid signature"
+}
+
+// check compares the number of responding signers among signers
+// with the quorum, and reports the result to m.Health.
+func (m *SignerMonitor) check(signers []BlockSigner, quorum int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.current = m.current[:0]
+	var n int
+	for _, signer := range signers {
+		name := signerName(signer)
+		m.current = append(m.current, name)
+		if m.status(name).Responding {
+			n++
+		}
+	}
+	m.mu.Unlock()
+
+	if m.Health == nil {
+		return
+	}
+	var err error
+	if n < quorum+m.QuorumMargin {
+		err = errors.Wrapf(errTooFewResponding, "%d of %d responding, quorum is %d", n, len(signers), quorum)
+	}
+	m.Health(err)
+}
+
+func signerName(signer BlockSigner) string {
+	return fmt.Sprint(signer)
+}
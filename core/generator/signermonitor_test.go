@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"chain/protocol/bc"
+)
+
+type namedSigner string
+
+func (s namedSigner) SignBlock(context.Context, *bc.Block) ([]byte, error) { return nil, nil }
+func (s namedSigner) String() string                                       { return string(s) }
+
+func TestSignerMonitor(t *testing.T) {
+	var healthErr error
+	m := &SignerMonitor{
+		QuorumMargin: 1,
+		Health:       func(err error) { healthErr = err },
+	}
+	a, b, c := namedSigner("a"), namedSigner("b"), namedSigner("c")
+	signers := []BlockSigner{a, b, c}
+
+	m.record(a, 5, 10*time.Millisecond, nil)
+	m.record(b, 5, 30*time.Millisecond, nil)
+	m.record(c, 5, 20*time.Millisecond, errors.New("connection refused"))
+	m.check(signers, 1)
+	if healthErr != nil {
+		t.Errorf("health error = %v want nil", healthErr)
+	}
+
+	m.record(b, 6, 10*time.Millisecond, nil)
+	m.recordInvalid(b)
+	m.check(signers, 1)
+	if healthErr == nil {
+		t.Error("health error = nil, want too few responding")
+	}
+
+	got := m.Statuses()
+	if len(got) != 3 {
+		t.Fatalf("got %d statuses want 3", len(got))
+	}
+	if s := got[1]; s.Signer != "b" || s.Requests != 2 || s.InvalidSignatures != 1 || s.Responding || s.LastSeenHeight != 6 || s.MeanLatencyMS != 20 {
+		t.Errorf("status of b = %+v", s)
+	}
+	if s := got[2]; s.Failures != 1 || s.Responding || s.LastError != "connection refused" || s.LastSeenAt != nil {
+		t.Errorf("status of c = %+v", s)
+	}
+
+	// After a rotation, only the new signers are listed.
+	m.check([]BlockSigner{a}, 1)
+	if got := m.Statuses(); len(got) != 1 || got[0].Signer != "a" {
+		t.Errorf("statuses after rotation = %+v", got)
+	}
+
+	// A nil monitor does nothing.
+	var nilMonitor *SignerMonitor
+	nilMonitor.record(a, 1, time.Millisecond, nil)
+	nilMonitor.check(signers, 1)
+	if got := nilMonitor.Statuses(); got != nil {
+		t.Errorf("nil monitor statuses = %+v want nil", got)
+	}
+}
@@ -3,6 +3,7 @@ package core
 import (
 	"context"
 
+	"chain/core/asset"
 	"chain/core/mockhsm"
 	"chain/core/txbuilder"
 	"chain/crypto/ed25519/chainkd"
@@ -73,3 +74,20 @@ func (h *Handler) mockhsmSignTemplate(ctx context.Context, xpubstr string, path
 	}
 	return sigBytes, err
 }
+
+func (h *Handler) mockhsmSignAssetDefinitions(ctx context.Context, x struct {
+	Defs  []*asset.Definition `json:"definitions"`
+	XPubs []string            `json:"xpubs"`
+}) []interface{} {
+	resp := make([]interface{}, 0, len(x.Defs))
+	for _, def := range x.Defs {
+		err := h.Assets.SignDefinition(ctx, def, x.XPubs, h.mockhsmSignTemplate)
+		if err != nil {
+			info, _ := errInfo(err)
+			resp = append(resp, info)
+		} else {
+			resp = append(resp, def)
+		}
+	}
+	return resp
+}
@@ -34,7 +34,7 @@ func TestMockHSM(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	acct1, err := accounts.Create(ctx, []string{xpub1.XPub.String()}, 1, "", nil, nil)
+	acct1, err := accounts.Create(ctx, []string{xpub1.XPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -43,7 +43,7 @@ func TestMockHSM(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	acct2, err := accounts.Create(ctx, []string{xpub2.String()}, 1, "", nil, nil)
+	acct2, err := accounts.Create(ctx, []string{xpub2.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -27,121 +27,214 @@ func IsLeading() bool {
 	return l
 }
 
+func setLeading(l bool) {
+	lock.Lock()
+	isLeading = l
+	lock.Unlock()
+}
+
+// A LeaderElector decides which process of a Core is its leader.
+type LeaderElector interface {
+	// Campaign tries to become or remain the leader. It reports
+	// whether this process is the leader afterward. It is called
+	// periodically by RunElector.
+	Campaign(ctx context.Context) (bool, error)
+
+	// Status reports the current leadership as this process
+	// understands it.
+	Status(ctx context.Context) (*Status, error)
+
+	// Resign gives up this process's leadership, so that another
+	// process can take over without waiting for the lease to
+	// expire. If successor is not empty, the process with that
+	// address is favored to become the next leader.
+	Resign(ctx context.Context, successor string) error
+}
+
+// ErrNotLeader is returned by StepDown when this process is not
+// the leader.
+var ErrNotLeader = errors.New("not the core leader")
+
+// stepDownHoldoff is how long a process that stepped down waits
+// before campaigning again, giving the others a chance to take over.
+const stepDownHoldoff = 10 * time.Second
+
+type stepDownReq struct {
+	ctx       context.Context
+	successor string
+	restart   bool // start leading again instead of resigning
+	errc      chan error
+}
+
+var stepDowns = make(chan *stepDownReq)
+
+// Status describes the leadership of a Core.
+type Status struct {
+	// Backend names the election mechanism, "postgres" or "raft".
+	Backend string `json:"backend"`
+
+	// Term increases each time leadership changes hands.
+	Term uint64 `json:"term"`
+
+	// LeaderAddress is the address of the current leader, or empty
+	// if there is none.
+	LeaderAddress string `json:"leader_address"`
+
+	// IsLeader reports whether this process is the leader.
+	IsLeader bool `json:"is_leader"`
+
+	// LeaseExpiry is when the leader's lease runs out unless it is
+	// renewed.
+	LeaseExpiry time.Time `json:"lease_expires_at"`
+}
+
 // Run runs as a goroutine, trying once every five seconds to become
 // the leader for the core.  If it succeeds, then it calls the
 // function lead (for generating or fetching blocks, and for
 // expiring reservations) and enters a leadership-keepalive loop.
 //
 // Function lead is called when the local process becomes the leader.
-// Its context is canceled when the process is deposed as leader.
+// Its context is canceled when the process is deposed as leader,
+// or when it steps down. When stepping down, leadership is not
+// released until lead returns, so lead should wait for the work it
+// starts to stop.
 //
 // The Chain Core has up to a 10-second refractory period after
 // shutdown, during which no process can become the new leader.
 func Run(db *sql.DB, addr string, lead func(context.Context)) {
-	ctx := context.Background()
 	// We use our process's address as the key, because it's unique
 	// among all processes within a Core and it allows a restarted
 	// leader to immediately return to its leadership.
-	l := &leader{
-		db:      db,
-		key:     addr,
-		lead:    lead,
-		address: addr,
-	}
-	log.Messagef(ctx, "Using leaderKey: %q", l.key)
+	log.Messagef(context.Background(), "Using leaderKey: %q", addr)
+	RunElector(NewPostgres(db, addr), 5*time.Second, lead)
+}
 
+// RunElector runs as a goroutine, campaigning with e once every
+// period. It calls lead when this process becomes the leader, and
+// cancels lead's context when it is deposed, as Run does.
+func RunElector(e LeaderElector, period time.Duration, lead func(context.Context)) {
+	ctx := context.Background()
+	l := &leader{elector: e, lead: lead}
 	update(ctx, l)
-	for range time.Tick(5 * time.Second) {
-		update(ctx, l)
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ticks:
+			update(ctx, l)
+		case req := <-stepDowns:
+			req.errc <- stepDown(ctx, l, req)
+		}
 	}
 }
 
+// StepDown stops this process's leadership duties, waiting for
+// them to finish, and then gives up leadership, nominating the
+// process at address successor if it is not empty. The process
+// doesn't campaign again for a while afterward.
+//
+// It returns ErrNotLeader if this process is not the leader.
+func StepDown(ctx context.Context, successor string) error {
+	return sendStepDown(ctx, &stepDownReq{ctx: ctx, successor: successor})
+}
+
+// Restart stops this process's leadership duties, waiting for them
+// to finish, and starts them again, without giving up leadership.
+// It is used to apply configuration changes.
+//
+// It returns ErrNotLeader if this process is not the leader.
+func Restart(ctx context.Context) error {
+	return sendStepDown(ctx, &stepDownReq{ctx: ctx, restart: true})
+}
+
+func sendStepDown(ctx context.Context, req *stepDownReq) error {
+	req.errc = make(chan error, 1)
+	select {
+	case stepDowns <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return <-req.errc
+}
+
+func stepDown(ctx context.Context, l *leader, req *stepDownReq) error {
+	if !l.leading {
+		return ErrNotLeader
+	}
+	if req.restart {
+		log.Messagef(ctx, "Restarting core leader")
+	} else {
+		log.Messagef(ctx, "Stepping down as core leader")
+	}
+	l.cancel()
+	stopped := true
+	select {
+	case <-l.done:
+	case <-req.ctx.Done():
+		// Resign anyway. The next leader recovers from whatever
+		// was left unfinished, as it would after a crash. We can't
+		// restart, though, while the old duties might still run.
+		log.Error(ctx, req.ctx.Err(), "waiting for leader to stop")
+		stopped = false
+	}
+	if req.restart && stopped {
+		l.start(ctx)
+		return nil
+	}
+	l.leading = false
+	setLeading(false)
+	l.cancel = nil
+	l.holdUntil = time.Now().Add(stepDownHoldoff)
+	return errors.Wrap(l.elector.Resign(ctx, req.successor), "resigning leadership")
+}
+
 type leader struct {
 	// config
-	db      *sql.DB
-	key     string
+	elector LeaderElector
 	lead    func(context.Context)
-	address string
 
 	// state
-	leading bool
-	cancel  func()
+	leading   bool
+	cancel    func()
+	done      chan struct{} // closed when lead returns
+	holdUntil time.Time     // don't campaign before this, after stepping down
 }
 
 func update(ctx context.Context, l *leader) {
-	const (
-		insertQ = `
-			INSERT INTO leader (leader_key, address, expiry) VALUES ($1, $2, CURRENT_TIMESTAMP + INTERVAL '10 seconds')
-			ON CONFLICT (singleton) DO UPDATE SET leader_key = $1, address = $2, expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds'
-				WHERE leader.expiry < CURRENT_TIMESTAMP
-		`
-		updateQ = `
-			UPDATE leader SET expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds'
-				WHERE leader_key = $1
-		`
-	)
-
-	if l.leading {
-		res, err := l.db.Exec(ctx, updateQ, l.key)
-		if err == nil {
-			rowsAffected, err := res.RowsAffected()
-			if err == nil && rowsAffected > 0 {
-				// still leading
-				return
-			}
-		}
-
-		// Either the UPDATE affected no rows, or it (or RowsAffected)
-		// produced an error.
+	if time.Now().Before(l.holdUntil) {
+		return
+	}
+	leading, err := l.elector.Campaign(ctx)
+	if err != nil {
+		log.Error(ctx, err)
+	}
 
-		if err != nil {
-			log.Error(ctx, err)
-		}
+	switch {
+	case l.leading && !leading:
 		log.Messagef(ctx, "No longer core leader")
 		l.cancel()
 		l.leading = false
-
-		lock.Lock()
-		isLeading = false
-		lock.Unlock()
-
+		setLeading(false)
 		l.cancel = nil
-	} else {
-		// Try to put this process's key into the leader table.  It
-		// succeeds if the table's empty or the existing row (there can be
-		// only one) is expired.  It fails otherwise.
-		//
-		// On success, this process's leadership expires in 10 seconds
-		// unless it's renewed in the UPDATE query above.
-		// That extends it for another 10 seconds.
-		res, err := l.db.Exec(ctx, insertQ, l.key, l.address)
-		if err != nil {
-			log.Error(ctx, err)
-			return
-		}
-		rowsAffected, err := res.RowsAffected()
-		if err != nil {
-			log.Error(ctx, err)
-			return
-		}
-
-		if rowsAffected == 0 {
-			return
-		}
-
+	case !l.leading && leading:
 		log.Messagef(ctx, "I am the core leader")
-
 		l.leading = true
-
-		lock.Lock()
-		isLeading = true
-		lock.Unlock()
-
-		ctx, l.cancel = context.WithCancel(ctx)
-		go l.lead(ctx)
+		setLeading(true)
+		l.start(ctx)
 	}
 }
 
+// start calls l.lead in a new goroutine.
+func (l *leader) start(ctx context.Context) {
+	var leadCtx context.Context
+	leadCtx, l.cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	l.done = done
+	go func() {
+		l.lead(leadCtx)
+		close(done)
+	}()
+}
+
 // Address retrieves the IP address of the current
 // core leader.
 func Address(ctx context.Context, db pg.DB) (string, error) {
@@ -0,0 +1,123 @@
+package leader
+
+import (
+	"context"
+	stdsql "database/sql"
+	"time"
+
+	"chain/database/sql"
+	"chain/errors"
+)
+
+// Postgres elects a leader by racing to claim the singleton row of
+// the leader table. The winner holds the row for 10 seconds at a
+// time, and must renew its claim before it expires.
+type Postgres struct {
+	db      *sql.DB
+	key     string
+	address string
+	leading bool
+}
+
+// NewPostgres returns a LeaderElector for the process with the
+// given address, using the Core's database. The address doubles as
+// the process's key.
+func NewPostgres(db *sql.DB, addr string) *Postgres {
+	return &Postgres{db: db, key: addr, address: addr}
+}
+
+// Campaign implements LeaderElector.
+func (p *Postgres) Campaign(ctx context.Context) (bool, error) {
+	const (
+		insertQ = `
+			INSERT INTO leader (leader_key, address, expiry, term) VALUES ($1, $2, CURRENT_TIMESTAMP + INTERVAL '10 seconds', 1)
+			ON CONFLICT (singleton) DO UPDATE SET leader_key = $1, address = $2, expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds', term = leader.term + 1
+				WHERE leader.expiry < CURRENT_TIMESTAMP OR (leader.leader_key = $1 AND leader.address = '')
+		`
+		updateQ = `
+			UPDATE leader SET expiry = CURRENT_TIMESTAMP + INTERVAL '10 seconds'
+				WHERE leader_key = $1
+		`
+	)
+
+	if p.leading {
+		res, err := p.db.Exec(ctx, updateQ, p.key)
+		if err == nil {
+			var rowsAffected int64
+			rowsAffected, err = res.RowsAffected()
+			if err == nil && rowsAffected > 0 {
+				// still leading
+				return true, nil
+			}
+		}
+
+		// Either the UPDATE affected no rows, or it (or RowsAffected)
+		// produced an error.
+		p.leading = false
+		return false, errors.Wrap(err, "renewing leadership")
+	}
+
+	// Try to put this process's key into the leader table.  It
+	// succeeds if the table's empty, the existing row (there can be
+	// only one) is expired, or the previous leader nominated this
+	// process as its successor.  It fails otherwise.
+	//
+	// On success, this process's leadership expires in 10 seconds
+	// unless it's renewed in the UPDATE query above.
+	// That extends it for another 10 seconds.
+	res, err := p.db.Exec(ctx, insertQ, p.key, p.address)
+	if err != nil {
+		return false, errors.Wrap(err, "claiming leadership")
+	}
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "claiming leadership")
+	}
+	p.leading = rowsAffected > 0
+	return p.leading, nil
+}
+
+// Status implements LeaderElector.
+func (p *Postgres) Status(ctx context.Context) (*Status, error) {
+	const q = `SELECT leader_key, address, expiry, term FROM leader`
+	var (
+		key    string
+		s      = &Status{Backend: "postgres"}
+		expiry time.Time
+	)
+	err := p.db.QueryRow(ctx, q).Scan(&key, &s.LeaderAddress, &expiry, &s.Term)
+	if err == stdsql.ErrNoRows {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "querying leader")
+	}
+	s.LeaseExpiry = expiry
+	s.IsLeader = key == p.key && p.leading
+	return s, nil
+}
+
+// Resign implements LeaderElector. It expires this process's claim
+// on the leader row. If successor is not empty, the row is handed
+// to that process's key instead, with an empty address until the
+// successor claims it.
+func (p *Postgres) Resign(ctx context.Context, successor string) error {
+	const (
+		expireQ = `
+			UPDATE leader SET expiry = CURRENT_TIMESTAMP
+				WHERE leader_key = $1
+		`
+		nominateQ = `
+			UPDATE leader SET leader_key = $2, address = ''
+				WHERE leader_key = $1
+		`
+	)
+	p.leading = false
+	var err error
+	if successor == "" {
+		_, err = p.db.Exec(ctx, expireQ, p.key)
+	} else {
+		_, err = p.db.Exec(ctx, nominateQ, p.key, successor)
+	}
+	return errors.Wrap(err, "releasing leadership")
+}
@@ -0,0 +1,378 @@
+package leader
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Raft elects a leader among the processes of a Core by the leader
+// election half of the Raft consensus algorithm, without a
+// replicated log. Processes talk to each other directly, so the
+// database is not involved.
+//
+// A leader holds a lease, renewed each time a majority of processes
+// acknowledge its heartbeat. A process that has heard from the
+// leader within the election timeout will not vote for another, so
+// no other process can be elected while the lease is valid (up to
+// clock drift between processes). The leader steps down when its
+// lease runs out, however long its peers take to answer; each
+// message to a peer times out after HeartbeatInterval.
+//
+// Campaign must be called at least once per HeartbeatInterval.
+type Raft struct {
+	// Address is this process's address, by which its peers know it.
+	Address string
+
+	// Peers are the addresses of the other processes.
+	Peers []string
+
+	Transport RaftTransport
+
+	// ElectionTimeout is the minimum time without a heartbeat
+	// before a process starts an election. Each process waits a
+	// random duration between ElectionTimeout and twice that.
+	ElectionTimeout time.Duration
+
+	mu          sync.Mutex
+	term        uint64
+	votedFor    string
+	leaderAddr  string
+	leading     bool
+	lastContact time.Time // last heartbeat from the leader
+	leaseExpiry time.Time
+	deadline    time.Time // when to start an election
+	now         func() time.Time
+}
+
+// A RaftTransport carries Raft messages between processes.
+type RaftTransport interface {
+	RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error)
+	Heartbeat(ctx context.Context, peer string, req *HeartbeatRequest) (*HeartbeatResponse, error)
+}
+
+// VoteRequest asks a process for its vote in an election.
+type VoteRequest struct {
+	Term      uint64 `json:"term"`
+	Candidate string `json:"candidate"`
+
+	// PreVote asks whether the process would grant its vote, without
+	// changing its state.
+	PreVote bool `json:"pre_vote"`
+}
+
+// VoteResponse answers a VoteRequest.
+type VoteResponse struct {
+	Term    uint64 `json:"term"`
+	Granted bool   `json:"granted"`
+}
+
+// HeartbeatRequest asserts a leader's leadership.
+type HeartbeatRequest struct {
+	Term   uint64 `json:"term"`
+	Leader string `json:"leader"`
+
+	// Resign announces that the leader is stepping down, so the
+	// other processes needn't wait out its lease. If Successor is
+	// set, that process starts an election right away.
+	Resign    bool   `json:"resign,omitempty"`
+	Successor string `json:"successor,omitempty"`
+}
+
+// HeartbeatResponse answers a HeartbeatRequest.
+type HeartbeatResponse struct {
+	Term uint64 `json:"term"`
+	OK   bool   `json:"ok"`
+}
+
+// HeartbeatInterval is how often the leader must send heartbeats to
+// keep its lease.
+func (r *Raft) HeartbeatInterval() time.Duration {
+	return r.ElectionTimeout / 4
+}
+
+func (r *Raft) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+func (r *Raft) majority() int {
+	return (len(r.Peers)+1)/2 + 1
+}
+
+// resetDeadline must be called with r.mu held.
+func (r *Raft) resetDeadline(now time.Time) {
+	r.deadline = now.Add(r.ElectionTimeout + time.Duration(rand.Int63n(int64(r.ElectionTimeout))))
+}
+
+// observeTerm steps down if term is newer than ours. It must be
+// called with r.mu held.
+func (r *Raft) observeTerm(term uint64) {
+	if term > r.term {
+		r.term = term
+		r.votedFor = ""
+		r.leading = false
+		r.leaderAddr = ""
+	}
+}
+
+// Campaign implements LeaderElector. A leader sends heartbeats to
+// renew its lease; any other process starts an election if it has
+// not heard from a leader within its election timeout.
+func (r *Raft) Campaign(ctx context.Context) (bool, error) {
+	r.mu.Lock()
+	now := r.clock()
+	if r.deadline.IsZero() {
+		r.resetDeadline(now)
+	}
+	switch {
+	case r.leading && !now.Before(r.leaseExpiry):
+		r.stepDown(now)
+		r.mu.Unlock()
+		return false, nil
+	case r.leading:
+		term := r.term
+		r.mu.Unlock()
+		return r.heartbeat(ctx, term, now), nil
+	case now.Before(r.deadline):
+		r.mu.Unlock()
+		return false, nil
+	}
+
+	// Ask for votes without disturbing anyone first, so that a
+	// process cut off from the others doesn't inflate its term and
+	// depose the leader when it rejoins.
+	term := r.term + 1
+	r.resetDeadline(now)
+	r.mu.Unlock()
+	if r.requestVotes(ctx, &VoteRequest{Term: term, Candidate: r.Address, PreVote: true}) < r.majority() {
+		return false, nil
+	}
+
+	// Start an election.
+	r.mu.Lock()
+	if r.leading || r.term >= term {
+		// Something happened while we were asking.
+		r.mu.Unlock()
+		return false, nil
+	}
+	r.term = term
+	r.votedFor = r.Address
+	r.leaderAddr = ""
+	r.mu.Unlock()
+	votes := r.requestVotes(ctx, &VoteRequest{Term: term, Candidate: r.Address})
+
+	r.mu.Lock()
+	won := votes >= r.majority() && r.term == term && !r.leading
+	if won {
+		r.leading = true
+		r.leaderAddr = r.Address
+	}
+	r.mu.Unlock()
+	if !won {
+		return false, nil
+	}
+	// Establish the lease right away.
+	return r.heartbeat(ctx, term, now), nil
+}
+
+// requestVotes sends req to every peer and returns the number of
+// votes granted, including our own.
+func (r *Raft) requestVotes(ctx context.Context, req *VoteRequest) int {
+	votes := 1 // our own
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, peer := range r.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, r.HeartbeatInterval())
+			defer cancel()
+			resp, err := r.Transport.RequestVote(ctx, peer, req)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !req.PreVote {
+				r.mu.Lock()
+				r.observeTerm(resp.Term)
+				r.mu.Unlock()
+			}
+			if resp.Granted {
+				votes++
+			}
+		}(peer)
+	}
+	wg.Wait()
+	return votes
+}
+
+// heartbeat sends heartbeats for term, begun at time start, and
+// renews the lease if a majority acknowledges them. It reports
+// whether this process is still the leader. It stops waiting for
+// acknowledgements when the current lease runs out.
+func (r *Raft) heartbeat(ctx context.Context, term uint64, start time.Time) bool {
+	req := &HeartbeatRequest{Term: term, Leader: r.Address}
+	replies := make(chan bool, len(r.Peers))
+	for _, peer := range r.Peers {
+		go func(peer string) {
+			ctx, cancel := context.WithTimeout(ctx, r.HeartbeatInterval())
+			defer cancel()
+			resp, err := r.Transport.Heartbeat(ctx, peer, req)
+			if err != nil {
+				replies <- false
+				return
+			}
+			r.mu.Lock()
+			r.observeTerm(resp.Term)
+			r.mu.Unlock()
+			replies <- resp.OK
+		}(peer)
+	}
+
+	r.mu.Lock()
+	var expired <-chan time.Time
+	if d := r.leaseExpiry.Sub(r.clock()); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		expired = t.C
+	}
+	r.mu.Unlock()
+	acks := 1 // our own
+wait:
+	for i := 0; i < len(r.Peers); i++ {
+		select {
+		case ok := <-replies:
+			if ok {
+				acks++
+			}
+		case <-expired:
+			break wait
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.leading || r.term != term {
+		return false
+	}
+	if acks >= r.majority() {
+		r.leaseExpiry = start.Add(r.ElectionTimeout)
+	}
+	if now := r.clock(); !now.Before(r.leaseExpiry) {
+		// Lost contact with a majority for a whole lease.
+		r.stepDown(now)
+		return false
+	}
+	return true
+}
+
+// stepDown gives up leadership after the lease has run out. It must
+// be called with r.mu held.
+func (r *Raft) stepDown(now time.Time) {
+	r.leading = false
+	r.leaderAddr = ""
+	r.resetDeadline(now)
+}
+
+// HandleRequestVote answers a peer's VoteRequest.
+func (r *Raft) HandleRequestVote(req *VoteRequest) *VoteResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.clock()
+
+	// Don't disrupt a leader we've heard from recently, whose lease
+	// may still be valid.
+	if !r.lastContact.IsZero() && now.Sub(r.lastContact) < r.ElectionTimeout && req.Candidate != r.leaderAddr {
+		return &VoteResponse{Term: r.term}
+	}
+	if r.leading && now.Before(r.leaseExpiry) {
+		return &VoteResponse{Term: r.term}
+	}
+
+	if req.PreVote {
+		return &VoteResponse{Term: r.term, Granted: req.Term > r.term}
+	}
+	r.observeTerm(req.Term)
+	if req.Term < r.term || (r.votedFor != "" && r.votedFor != req.Candidate) {
+		return &VoteResponse{Term: r.term}
+	}
+	r.votedFor = req.Candidate
+	r.resetDeadline(now)
+	return &VoteResponse{Term: r.term, Granted: true}
+}
+
+// HandleHeartbeat answers a leader's HeartbeatRequest.
+func (r *Raft) HandleHeartbeat(req *HeartbeatRequest) *HeartbeatResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if req.Term < r.term {
+		return &HeartbeatResponse{Term: r.term}
+	}
+	r.observeTerm(req.Term)
+	now := r.clock()
+	r.leading = false
+	if req.Resign {
+		r.leaderAddr = ""
+		r.lastContact = time.Time{}
+		r.leaseExpiry = now
+		r.resetDeadline(now)
+		if req.Successor == r.Address {
+			r.deadline = now
+		}
+		return &HeartbeatResponse{Term: r.term, OK: true}
+	}
+	r.leaderAddr = req.Leader
+	r.lastContact = now
+	r.leaseExpiry = now.Add(r.ElectionTimeout)
+	r.resetDeadline(now)
+	return &HeartbeatResponse{Term: r.term, OK: true}
+}
+
+// Resign implements LeaderElector. It steps down and tells the
+// other processes, so they can elect a new leader right away.
+func (r *Raft) Resign(ctx context.Context, successor string) error {
+	r.mu.Lock()
+	if !r.leading {
+		r.mu.Unlock()
+		return nil
+	}
+	now := r.clock()
+	req := &HeartbeatRequest{Term: r.term, Leader: r.Address, Resign: true, Successor: successor}
+	r.leading = false
+	r.leaderAddr = ""
+	r.leaseExpiry = now
+	// Leave the election to the others.
+	r.deadline = now.Add(2 * r.ElectionTimeout)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, peer := range r.Peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, r.HeartbeatInterval())
+			defer cancel()
+			r.Transport.Heartbeat(ctx, peer, req)
+		}(peer)
+	}
+	wg.Wait()
+	return nil
+}
+
+// Status implements LeaderElector.
+func (r *Raft) Status(ctx context.Context) (*Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Status{
+		Backend:       "raft",
+		Term:          r.term,
+		LeaderAddress: r.leaderAddr,
+		IsLeader:      r.leading && r.clock().Before(r.leaseExpiry),
+		LeaseExpiry:   r.leaseExpiry,
+	}, nil
+}
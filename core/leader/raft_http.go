@@ -0,0 +1,37 @@
+package leader
+
+import (
+	"context"
+	"strings"
+
+	"chain/core/rpc"
+)
+
+// HTTPTransport carries Raft messages between Core processes over
+// their network RPC API.
+type HTTPTransport struct {
+	// AccessToken is a network access token accepted by the peers.
+	AccessToken string
+}
+
+// RequestVote implements RaftTransport.
+func (t *HTTPTransport) RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	resp := new(VoteResponse)
+	err := t.client(peer).Call(ctx, "/rpc/leader/request-vote", req, resp)
+	return resp, err
+}
+
+// Heartbeat implements RaftTransport.
+func (t *HTTPTransport) Heartbeat(ctx context.Context, peer string, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	resp := new(HeartbeatResponse)
+	err := t.client(peer).Call(ctx, "/rpc/leader/heartbeat", req, resp)
+	return resp, err
+}
+
+func (t *HTTPTransport) client(peer string) *rpc.Client {
+	// Peers without a scheme are reached over plain HTTP.
+	if !strings.Contains(peer, "://") {
+		peer = "http://" + peer
+	}
+	return &rpc.Client{BaseURL: peer, AccessToken: t.AccessToken}
+}
@@ -0,0 +1,244 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memTransport connects Raft processes in memory. Processes marked
+// down neither send nor receive messages. Messages to processes
+// marked hung never get an answer.
+type memTransport struct {
+	mu    sync.Mutex
+	nodes map[string]*Raft
+	down  map[string]bool
+	hung  map[string]bool
+}
+
+var errUnreachable = errors.New("unreachable")
+
+func (t *memTransport) peer(ctx context.Context, from, to string) (*Raft, error) {
+	t.mu.Lock()
+	hung := t.hung[to]
+	down := t.down[from] || t.down[to]
+	t.mu.Unlock()
+	if hung {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	if down {
+		return nil, errUnreachable
+	}
+	return t.nodes[to], nil
+}
+
+func (t *memTransport) from(addr string) RaftTransport {
+	return &memSender{t, addr}
+}
+
+type memSender struct {
+	t    *memTransport
+	addr string
+}
+
+func (s *memSender) RequestVote(ctx context.Context, peer string, req *VoteRequest) (*VoteResponse, error) {
+	r, err := s.t.peer(ctx, s.addr, peer)
+	if err != nil {
+		return nil, err
+	}
+	return r.HandleRequestVote(req), nil
+}
+
+func (s *memSender) Heartbeat(ctx context.Context, peer string, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	r, err := s.t.peer(ctx, s.addr, peer)
+	if err != nil {
+		return nil, err
+	}
+	return r.HandleHeartbeat(req), nil
+}
+
+// testCluster is a set of Raft processes connected in memory,
+// driven by a fake clock.
+type testCluster struct {
+	timeout time.Duration
+	now     time.Time
+	trans   *memTransport
+	nodes   []*Raft
+}
+
+func newTestCluster(addrs ...string) *testCluster {
+	c := &testCluster{
+		timeout: 100 * time.Millisecond,
+		now:     time.Unix(1e9, 0),
+		trans:   &memTransport{nodes: make(map[string]*Raft), down: make(map[string]bool), hung: make(map[string]bool)},
+	}
+	for _, addr := range addrs {
+		var peers []string
+		for _, p := range addrs {
+			if p != addr {
+				peers = append(peers, p)
+			}
+		}
+		r := &Raft{
+			Address:         addr,
+			Peers:           peers,
+			Transport:       c.trans.from(addr),
+			ElectionTimeout: c.timeout,
+			now:             func() time.Time { return c.now },
+		}
+		c.trans.nodes[addr] = r
+		c.nodes = append(c.nodes, r)
+	}
+	return c
+}
+
+// run advances the clock in heartbeat-sized steps for d,
+// campaigning on every process at each step.
+func (c *testCluster) run(d time.Duration) {
+	for end := c.now.Add(d); c.now.Before(end); c.now = c.now.Add(c.timeout / 4) {
+		for _, r := range c.nodes {
+			r.Campaign(context.Background())
+		}
+	}
+}
+
+func (c *testCluster) leaders() (n int, leader *Raft) {
+	for _, r := range c.nodes {
+		s, _ := r.Status(context.Background())
+		if s.IsLeader {
+			n++
+			leader = r
+		}
+	}
+	return n, leader
+}
+
+func TestRaftElection(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+	var (
+		ctx     = context.Background()
+		timeout = c.timeout
+		trans   = c.trans
+		nodes   = c.nodes
+		run     = c.run
+		leaders = c.leaders
+	)
+
+	run(5 * timeout)
+	n, first := leaders()
+	if n != 1 {
+		t.Fatalf("got %d leaders want 1", n)
+	}
+	for _, r := range nodes {
+		s, _ := r.Status(ctx)
+		if s.LeaderAddress != first.Address {
+			t.Errorf("%s: leader address = %q want %q", r.Address, s.LeaderAddress, first.Address)
+		}
+	}
+	firstStatus, _ := first.Status(ctx)
+
+	// Leadership is stable while the leader is reachable.
+	run(5 * timeout)
+	if n, l := leaders(); n != 1 || l != first {
+		t.Fatalf("leadership changed without a failure")
+	}
+
+	// Cut the leader off. It steps down once its lease runs out, and
+	// the others elect a new leader in a later term.
+	trans.down[first.Address] = true
+	run(5 * timeout)
+	n, second := leaders()
+	if n != 1 || second == first {
+		t.Fatalf("after partition: got %d leaders, first leader still leading: %v", n, second == first)
+	}
+	s, _ := second.Status(ctx)
+	if s.Term <= firstStatus.Term {
+		t.Errorf("new leader term = %d want > %d", s.Term, firstStatus.Term)
+	}
+
+	// When the old leader rejoins, it follows the new one.
+	trans.down[first.Address] = false
+	run(timeout)
+	if n, l := leaders(); n != 1 || l != second {
+		t.Errorf("after rejoin: got %d leaders, want only the second leader", n)
+	}
+	s, _ = first.Status(ctx)
+	if s.LeaderAddress != second.Address {
+		t.Errorf("rejoined process follows %q want %q", s.LeaderAddress, second.Address)
+	}
+}
+
+func TestRaftResign(t *testing.T) {
+	ctx := context.Background()
+	c := newTestCluster("a", "b", "c")
+	c.run(5 * c.timeout)
+	n, first := c.leaders()
+	if n != 1 {
+		t.Fatalf("got %d leaders want 1", n)
+	}
+	var successor *Raft
+	for _, r := range c.nodes {
+		if r != first {
+			successor = r
+			break
+		}
+	}
+
+	err := first.Resign(ctx, successor.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.leaders(); n != 0 {
+		t.Fatalf("got %d leaders after resigning, want 0", n)
+	}
+
+	// The successor takes over well before the old lease would
+	// have run out.
+	c.run(c.timeout / 2)
+	if n, l := c.leaders(); n != 1 || l != successor {
+		t.Errorf("after resigning: got %d leaders, want only the successor", n)
+	}
+}
+
+func TestRaftHungPeers(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+	c.run(5 * c.timeout)
+	n, first := c.leaders()
+	if n != 1 {
+		t.Fatalf("got %d leaders want 1", n)
+	}
+	for _, r := range c.nodes {
+		if r != first {
+			c.trans.hung[r.Address] = true
+		}
+	}
+
+	// Heartbeats to peers that never answer time out, and the
+	// leader keeps its lease until it runs out.
+	begin := time.Now()
+	leading, _ := first.Campaign(context.Background())
+	if !leading {
+		t.Error("leader stepped down before its lease ran out")
+	}
+	if d := time.Since(begin); d >= c.timeout {
+		t.Errorf("heartbeat took %s, want less than the election timeout %s", d, c.timeout)
+	}
+
+	// Once the lease has run out, the leader steps down without
+	// waiting for its peers.
+	c.now = c.now.Add(c.timeout)
+	if n, _ := c.leaders(); n != 0 {
+		t.Errorf("got %d leaders after the lease ran out, want 0", n)
+	}
+	begin = time.Now()
+	leading, _ = first.Campaign(context.Background())
+	if leading {
+		t.Error("leader kept leading after its lease ran out")
+	}
+	if d := time.Since(begin); d >= first.HeartbeatInterval() {
+		t.Errorf("stepping down took %s, want no wait for peers", d)
+	}
+}
@@ -30,4 +30,265 @@ var migrations = []migration{
 			height bigint DEFAULT 0 NOT NULL
 		);
 	`},
+	{Name: "2016-11-01.0.core.add-account-program-templates.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN program_template jsonb;
+	`},
+	{Name: "2016-11-02.0.core.add-asset-definitions.sql", SQL: `
+		CREATE TABLE asset_definitions (
+			asset_id text NOT NULL,
+			version bigint NOT NULL,
+			name text NOT NULL,
+			decimals integer NOT NULL,
+			issuer text NOT NULL,
+			documents_hash bytea NOT NULL,
+			signatures bytea[] NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (asset_id, version)
+		);
+	`},
+	{Name: "2016-11-03.0.core.add-account-coin-selection.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN coin_selection text;
+	`},
+	{Name: "2016-11-04.0.core.add-consolidation.sql", SQL: `
+		CREATE TABLE consolidation_policies (
+			id text DEFAULT next_chain_id('cpol'::text) NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			max_utxos integer NOT NULL,
+			min_amount bigint DEFAULT 0 NOT NULL,
+			period_ms bigint NOT NULL,
+			paused boolean DEFAULT false NOT NULL,
+			last_run_at timestamp with time zone,
+			UNIQUE (account_id, asset_id)
+		);
+		CREATE TABLE consolidation_runs (
+			id text DEFAULT next_chain_id('crun'::text) NOT NULL PRIMARY KEY,
+			policy_id text NOT NULL,
+			status text NOT NULL,
+			tx_id text,
+			inputs integer DEFAULT 0 NOT NULL,
+			amount bigint DEFAULT 0 NOT NULL,
+			error text DEFAULT ''::text NOT NULL,
+			started_at timestamp with time zone NOT NULL,
+			finished_at timestamp with time zone NOT NULL
+		);
+		CREATE INDEX consolidation_runs_policy_id_id_idx ON consolidation_runs USING btree (policy_id, id);
+	`},
+	{Name: "2016-11-05.0.core.add-payments.sql", SQL: `
+		CREATE TABLE payments (
+			id text DEFAULT next_chain_id('pay'::text) NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			amount bigint NOT NULL,
+			control_account_id text,
+			control_program bytea,
+			reference_data jsonb DEFAULT '{}'::jsonb NOT NULL,
+			status text DEFAULT 'pending'::text NOT NULL,
+			tx_id text,
+			error text DEFAULT ''::text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		CREATE INDEX payments_status_account_id_idx ON payments USING btree (status, account_id);
+	`},
+	{Name: "2016-11-06.0.core.add-scheduled-txs.sql", SQL: `
+		CREATE TABLE scheduled_txs (
+			id text DEFAULT next_chain_id('sch'::text) NOT NULL PRIMARY KEY,
+			alias text UNIQUE,
+			actions jsonb NOT NULL,
+			ttl_ms bigint DEFAULT 0 NOT NULL,
+			start_at timestamp with time zone NOT NULL,
+			interval_ms bigint DEFAULT 0 NOT NULL,
+			max_retries integer NOT NULL,
+			status text DEFAULT 'active'::text NOT NULL,
+			next_run_at timestamp with time zone NOT NULL,
+			attempt integer DEFAULT 0 NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		CREATE INDEX scheduled_txs_status_next_run_at_idx ON scheduled_txs USING btree (status, next_run_at);
+		CREATE TABLE scheduled_tx_runs (
+			id text DEFAULT next_chain_id('schr'::text) NOT NULL PRIMARY KEY,
+			scheduled_tx_id text NOT NULL,
+			attempt integer NOT NULL,
+			status text NOT NULL,
+			tx_id text,
+			error text DEFAULT ''::text NOT NULL,
+			started_at timestamp with time zone NOT NULL
+		);
+		CREATE INDEX scheduled_tx_runs_scheduled_tx_id_id_idx ON scheduled_tx_runs USING btree (scheduled_tx_id, id);
+	`},
+	{Name: "2016-11-07.0.core.add-account-spending-policies.sql", SQL: `
+		ALTER TABLE accounts ADD COLUMN spending_policy jsonb;
+		CREATE TABLE account_spending_decisions (
+			id text DEFAULT next_chain_id('spd'::text) NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			asset_id text NOT NULL,
+			amount bigint NOT NULL,
+			decision text NOT NULL,
+			reason text DEFAULT ''::text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		CREATE INDEX account_spending_decisions_account_id_id_idx ON account_spending_decisions USING btree (account_id, id);
+		CREATE INDEX account_spending_decisions_account_id_asset_id_created_at_idx ON account_spending_decisions USING btree (account_id, asset_id, created_at);
+	`},
+	{Name: "2016-11-08.0.core.add-coordination-sessions.sql", SQL: `
+		CREATE TABLE coordination_sessions (
+			id text DEFAULT next_chain_id('cs'::text) NOT NULL PRIMARY KEY,
+			status text NOT NULL,
+			template jsonb NOT NULL,
+			participants jsonb NOT NULL,
+			tx_id text,
+			error text DEFAULT ''::text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+	`},
+	{Name: "2016-11-09.0.core.add-reservation-metadata.sql", SQL: `
+		ALTER TABLE reservations
+			ADD COLUMN request_id text DEFAULT ''::text NOT NULL,
+			ADD COLUMN created_at timestamp with time zone DEFAULT now() NOT NULL;
+	`},
+	{Name: "2016-11-10.0.core.add-leader-term.sql", SQL: `
+		ALTER TABLE leader ADD COLUMN term bigint DEFAULT 0 NOT NULL;
+	`},
+	{Name: "2016-11-11.0.core.add-consensus-rotations.sql", SQL: `
+		CREATE TABLE consensus_rotations (
+			height bigint NOT NULL PRIMARY KEY,
+			consensus_program bytea NOT NULL,
+			quorum integer NOT NULL,
+			block_signers jsonb NOT NULL,
+			approvals jsonb DEFAULT '{}'::jsonb NOT NULL,
+			status text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		CREATE TABLE signer_consensus_approvals (
+			block_height bigint NOT NULL PRIMARY KEY,
+			consensus_program bytea NOT NULL,
+			approved_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+	`},
+	{Name: "2016-11-12.0.core.add-config-updates.sql", SQL: `
+		CREATE TABLE config_updates (
+			id bigserial PRIMARY KEY,
+			changes jsonb NOT NULL,
+			request_id text DEFAULT ''::text NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+	`},
+	{Name: "2016-11-13.0.core.add-signer-faults.sql", SQL: `
+		CREATE TABLE signer_faults (
+			id bigserial PRIMARY KEY,
+			pubkey bytea NOT NULL,
+			height bigint NOT NULL,
+			evidence jsonb NOT NULL,
+			detected_at timestamp with time zone DEFAULT now() NOT NULL,
+			UNIQUE (pubkey, height)
+		);
+	`},
+	{Name: "2016-11-14.0.core.add-generator-failover.sql", SQL: `
+		ALTER TABLE config
+			ADD COLUMN backup_generators jsonb DEFAULT '[]'::jsonb NOT NULL,
+			ADD COLUMN failover_timeout_ms bigint DEFAULT 0 NOT NULL;
+		CREATE TABLE signer_generator (
+			singleton boolean DEFAULT true NOT NULL PRIMARY KEY,
+			rank integer NOT NULL,
+			last_signed_at timestamp with time zone NOT NULL,
+			CONSTRAINT signer_generator_singleton CHECK (singleton)
+		);
+	`},
+	{Name: "2016-11-15.0.core.add-block-policies.sql", SQL: `
+		ALTER TABLE config ADD COLUMN block_policies jsonb DEFAULT '[]'::jsonb NOT NULL;
+	`},
+	{Name: "2016-11-16.0.core.add-block-schedule.sql", SQL: `
+		ALTER TABLE config
+			ADD COLUMN block_period_ms bigint DEFAULT 1000 NOT NULL,
+			ADD COLUMN make_empty_blocks boolean DEFAULT false NOT NULL,
+			ADD COLUMN max_idle_interval_ms bigint DEFAULT 0 NOT NULL,
+			ADD COLUMN max_pending_txs integer DEFAULT 0 NOT NULL;
+	`},
+	{Name: "2016-11-17.0.core.add-asset-supply.sql", SQL: `
+		CREATE TABLE asset_supply (
+			asset_id text NOT NULL PRIMARY KEY,
+			issued numeric DEFAULT 0 NOT NULL,
+			retired numeric DEFAULT 0 NOT NULL,
+			block_height bigint NOT NULL
+		);
+		ALTER TABLE assets ADD COLUMN issuance_cap bigint;
+		-- Reprocess every block with the asset indexer
+		-- to count the supply issued so far.
+		UPDATE block_processors SET height = 0 WHERE name = 'asset';
+	`},
+	{Name: "2016-11-18.0.core.add-bridge.sql", SQL: `
+		CREATE TABLE bridge_claims (
+			blockchain_id text NOT NULL,
+			tx_hash text NOT NULL,
+			claim_tx_hash text,
+			claimed_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (blockchain_id, tx_hash)
+		);
+		CREATE TABLE bridge_assets (
+			asset_id text NOT NULL PRIMARY KEY,
+			source_blockchain_id text NOT NULL,
+			source_asset_id text NOT NULL
+		);
+	`},
+	{Name: "2016-11-19.0.core.add-payment-batches.sql", SQL: `
+		CREATE TABLE payment_batches (
+			id text NOT NULL PRIMARY KEY,
+			account_id text NOT NULL,
+			tx_id text NOT NULL,
+			template jsonb NOT NULL,
+			submit_height bigint NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL
+		);
+		ALTER TABLE payments
+			ADD COLUMN batch_id text,
+			ADD COLUMN claimed_at timestamp with time zone;
+		CREATE INDEX payments_batch_id_idx ON payments USING btree (batch_id);
+	`},
+	{Name: "2016-11-19.1.core.add-scheduled-tx-run-claims.sql", SQL: `
+		ALTER TABLE scheduled_txs ADD COLUMN occurrence_at timestamp with time zone;
+		UPDATE scheduled_txs SET occurrence_at = next_run_at;
+		ALTER TABLE scheduled_txs ALTER COLUMN occurrence_at SET NOT NULL;
+		ALTER TABLE scheduled_tx_runs
+			ADD COLUMN occurrence_at timestamp with time zone,
+			ADD COLUMN template jsonb,
+			ADD COLUMN submit_height bigint,
+			ADD UNIQUE (scheduled_tx_id, occurrence_at, attempt);
+	`},
+	{Name: "2016-11-19.2.core.add-coordination-contributions.sql", SQL: `
+		CREATE TABLE coordination_contributions (
+			host_url text NOT NULL,
+			session_id text NOT NULL,
+			template jsonb NOT NULL,
+			created_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (host_url, session_id)
+		);
+	`},
+	{Name: "2016-11-20.0.core.add-active-generator.sql", SQL: `
+		ALTER TABLE config ADD COLUMN generator_core_id text DEFAULT '' NOT NULL;
+		CREATE TABLE active_generator (
+			singleton boolean DEFAULT true NOT NULL PRIMARY KEY,
+			rank integer NOT NULL,
+			updated_at timestamp with time zone NOT NULL,
+			CONSTRAINT active_generator_singleton CHECK (singleton)
+		);
+	`},
+	{Name: "2016-11-20.1.core.add-pending-issuances.sql", SQL: `
+		CREATE TABLE pending_issuances (
+			asset_id text NOT NULL,
+			nonce bytea NOT NULL,
+			amount bigint NOT NULL,
+			expires_at timestamp with time zone NOT NULL,
+			PRIMARY KEY (asset_id, nonce)
+		);
+	`},
+	{Name: "2016-11-20.2.core.add-consolidation-run-templates.sql", SQL: `
+		ALTER TABLE consolidation_runs
+			ADD COLUMN template jsonb,
+			ADD COLUMN submit_height bigint;
+	`},
+	{Name: "2016-11-20.3.core.add-bridge-claim-txs.sql", SQL: `
+		ALTER TABLE bridge_claims
+			ADD COLUMN claim_tx bytea,
+			ADD COLUMN claim_height bigint;
+	`},
 }
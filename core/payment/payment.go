@@ -0,0 +1,511 @@
+// Package payment queues outgoing payments from accounts and
+// periodically combines the pending payments of each account into a
+// single transaction.
+//
+// Batching reduces the number of transactions a high-volume payout
+// flow produces, and the contention on UTXO reservations that comes
+// from building many transactions at once from the same account.
+package payment
+
+import (
+	"context"
+	"database/sql"
+	stdjson "encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"chain/core/account"
+	"chain/core/signers"
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+// maxBatchSize limits the number of payments combined into one
+// transaction. Any remaining pending payments wait for a later
+// batch.
+const maxBatchSize = 500
+
+// txTTL is how long the reservations made for a batch transaction
+// are held.
+const txTTL = 5 * time.Minute
+
+var ErrBadPayment = errors.New("invalid payment")
+
+// Payment statuses.
+const (
+	StatusPending    = "pending"
+	StatusSubmitting = "submitting"
+	StatusSubmitted  = "submitted"
+	StatusFailed     = "failed"
+)
+
+// A Payment is a transfer from an account to either another account
+// or a control program.
+type Payment struct {
+	ID               string        `json:"id"`
+	AccountID        string        `json:"account_id"`
+	AssetID          bc.AssetID    `json:"asset_id"`
+	Amount           uint64        `json:"amount"`
+	ControlAccountID string        `json:"control_account_id,omitempty"`
+	ControlProgram   json.HexBytes `json:"control_program,omitempty"`
+	ReferenceData    json.Map      `json:"reference_data"`
+	Status           string        `json:"status"`
+	TxID             *bc.Hash      `json:"transaction_id"`
+	Error            string        `json:"error,omitempty"`
+	CreatedAt        time.Time     `json:"created_at"`
+}
+
+// SubmitFunc finalizes and submits a signed transaction template.
+type SubmitFunc func(context.Context, *txbuilder.Template) error
+
+// Queue stores payments and submits them in batches.
+type Queue struct {
+	DB       pg.DB
+	Chain    *protocol.Chain
+	Accounts *account.Manager
+}
+
+// Enqueue validates p and adds it to the queue as a pending
+// payment.
+func (q *Queue) Enqueue(ctx context.Context, p *Payment) (*Payment, error) {
+	if p.Amount == 0 {
+		return nil, errors.WithDetail(ErrBadPayment, "amount must be positive")
+	}
+	if p.AssetID == (bc.AssetID{}) {
+		return nil, errors.WithDetail(ErrBadPayment, "asset_id is required")
+	}
+	if (p.ControlAccountID == "") == (len(p.ControlProgram) == 0) {
+		return nil, errors.WithDetail(ErrBadPayment, "exactly one of control_account_id and control_program is required")
+	}
+	_, err := signers.Find(ctx, q.DB, "account", p.AccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding account")
+	}
+	if p.ControlAccountID != "" {
+		_, err = signers.Find(ctx, q.DB, "account", p.ControlAccountID)
+		if err != nil {
+			return nil, errors.Wrap(err, "finding control account")
+		}
+	}
+	if len(p.ReferenceData) == 0 {
+		p.ReferenceData = json.Map(`{}`)
+	}
+
+	const insertQ = `
+		INSERT INTO payments
+			(account_id, asset_id, amount, control_account_id, control_program, reference_data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at
+	`
+	err = q.DB.QueryRow(ctx, insertQ,
+		p.AccountID, p.AssetID, p.Amount,
+		sql.NullString{String: p.ControlAccountID, Valid: p.ControlAccountID != ""},
+		[]byte(p.ControlProgram), []byte(p.ReferenceData),
+	).Scan(&p.ID, &p.Status, &p.CreatedAt)
+	if err != nil {
+		return nil, errors.Wrap(err, "inserting payment")
+	}
+	return p, nil
+}
+
+// List returns up to limit payments, most recent first, starting
+// after the payment with ID after if it is nonempty. Empty
+// accountID and status match any account and status.
+func (q *Queue) List(ctx context.Context, accountID, status, after string, limit int) ([]*Payment, error) {
+	return q.payments(ctx, `
+		($1='' OR account_id=$1) AND ($2='' OR status=$2) AND ($3='' OR id < $3)
+		ORDER BY id DESC
+		LIMIT $4
+	`, accountID, status, after, limit)
+}
+
+func (q *Queue) payments(ctx context.Context, pred string, args ...interface{}) ([]*Payment, error) {
+	query := fmt.Sprintf(`
+		SELECT id, account_id, asset_id, amount, control_account_id, control_program,
+			reference_data, status, tx_id, error, created_at
+		FROM payments
+		WHERE %s
+	`, pred)
+	var ps []*Payment
+	scan := func(id, accountID string, assetID bc.AssetID, amount uint64, controlAccountID sql.NullString, controlProgram []byte, refData []byte, status string, txID sql.NullString, errStr string, createdAt time.Time) error {
+		p := &Payment{
+			ID:               id,
+			AccountID:        accountID,
+			AssetID:          assetID,
+			Amount:           amount,
+			ControlAccountID: controlAccountID.String,
+			ControlProgram:   controlProgram,
+			ReferenceData:    refData,
+			Status:           status,
+			Error:            errStr,
+			CreatedAt:        createdAt,
+		}
+		if txID.Valid {
+			p.TxID = new(bc.Hash)
+			err := p.TxID.UnmarshalText([]byte(txID.String))
+			if err != nil {
+				return err
+			}
+		}
+		ps = append(ps, p)
+		return nil
+	}
+	err := pg.ForQueryRows(ctx, q.DB, query, append(args, scan)...)
+	return ps, errors.Wrap(err, "querying payments")
+}
+
+// Run submits a batch for each account with pending payments once
+// per period. It blocks until ctx is canceled, and should run only
+// on the leader.
+func (q *Queue) Run(ctx context.Context, period time.Duration, signFn txbuilder.SignFunc, submit SubmitFunc) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, payment batching exiting")
+			return
+		case <-ticks:
+			err := q.Flush(ctx, signFn, submit)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+// Flush settles any batches left unfinished by an earlier Flush,
+// then submits one batch for each account with pending payments.
+// A payment whose own output cannot be built fails, and the rest of
+// its batch is tried again without it. A batch that cannot be built
+// or signed for any other reason, such as insufficient or reserved
+// funds, returns its payments to pending for a later Flush. A batch
+// whose submission fails stays submitting until a later Flush finds
+// out whether its transaction landed. None of these failures is
+// returned, and an error with one account's batch doesn't stop the
+// others.
+func (q *Queue) Flush(ctx context.Context, signFn txbuilder.SignFunc, submit SubmitFunc) error {
+	err := q.reconcile(ctx, submit)
+	if err != nil {
+		return err
+	}
+
+	var accountIDs []string
+	err = pg.ForQueryRows(ctx, q.DB, `SELECT DISTINCT account_id FROM payments WHERE status='pending'`, func(id string) {
+		accountIDs = append(accountIDs, id)
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying pending payments")
+	}
+	for _, accountID := range accountIDs {
+		err = q.flushAccount(ctx, accountID, signFn, submit)
+		if err != nil {
+			log.Error(ctx, err, "payment batch for account ", accountID)
+		}
+	}
+	return nil
+}
+
+func (q *Queue) flushAccount(ctx context.Context, accountID string, signFn txbuilder.SignFunc, submit SubmitFunc) error {
+	for {
+		batchID, ps, err := q.claim(ctx, accountID)
+		if err != nil {
+			return err
+		}
+		if len(ps) == 0 {
+			return nil
+		}
+
+		tpl, err := q.buildBatch(ctx, accountID, ps, signFn)
+		if err != nil {
+			log.Error(ctx, err, "payment batch for account ", accountID)
+			invalid := invalidPayments(err, ps)
+			for id, paymentErr := range invalid {
+				err = q.setStatus(ctx, []string{id}, StatusFailed, nil, paymentErr.Error())
+				if err != nil {
+					return err
+				}
+			}
+			err = q.releaseBatch(ctx, batchID)
+			if err != nil {
+				return err
+			}
+			if len(invalid) == 0 {
+				// Nothing in the batch is invalid, so
+				// the failure is likely to be transient.
+				return nil
+			}
+			continue
+		}
+		return q.submitBatch(ctx, batchID, accountID, tpl, submit)
+	}
+}
+
+// submitBatch records and submits the transaction of a claimed
+// batch.
+func (q *Queue) submitBatch(ctx context.Context, batchID, accountID string, tpl *txbuilder.Template, submit SubmitFunc) error {
+	recorded, err := q.recordBatch(ctx, batchID, accountID, tpl)
+	if err != nil {
+		return err
+	}
+	if !recorded {
+		// Another process released the claim as stale
+		// before the transaction was recorded. Nothing
+		// has been submitted, so the payments are pending
+		// again and will be paid by a later batch.
+		return nil
+	}
+
+	err = submit(ctx, tpl)
+	if err != nil {
+		// The transaction may still land, so the payments
+		// stay claimed until reconcile finds out.
+		log.Error(ctx, err, "payment batch for account ", accountID)
+		return nil
+	}
+	return q.setBatchStatus(ctx, batchID, StatusSubmitted)
+}
+
+// claim marks up to maxBatchSize pending payments from accountID as
+// submitting, in a single statement, so that no other process can
+// put them in a batch too. It returns the new batch's ID and its
+// payments.
+func (q *Queue) claim(ctx context.Context, accountID string) (string, []*Payment, error) {
+	const claimQ = `
+		WITH batch AS (SELECT next_chain_id('pbt') AS id)
+		UPDATE payments SET status='submitting', batch_id=batch.id, claimed_at=now()
+		FROM batch
+		WHERE payments.id IN (
+			SELECT id FROM payments
+			WHERE account_id=$1 AND status='pending'
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING batch.id
+	`
+	var batchID string
+	err := pg.ForQueryRows(ctx, q.DB, claimQ, accountID, maxBatchSize, func(id string) {
+		batchID = id
+	})
+	if err != nil {
+		return "", nil, errors.Wrap(err, "claiming pending payments")
+	}
+	if batchID == "" {
+		return "", nil, nil
+	}
+	ps, err := q.payments(ctx, `batch_id=$1 ORDER BY id`, batchID)
+	return batchID, ps, err
+}
+
+// totals returns the total amount of each asset ps pay,
+// and the IDs of those assets in order.
+func totals(ps []*Payment) (map[bc.AssetID]uint64, []bc.AssetID) {
+	totals := make(map[bc.AssetID]uint64)
+	var assetIDs []bc.AssetID
+	for _, p := range ps {
+		if _, ok := totals[p.AssetID]; !ok {
+			assetIDs = append(assetIDs, p.AssetID)
+		}
+		totals[p.AssetID] += p.Amount
+	}
+	sort.Sort(byAssetID(assetIDs))
+	return totals, assetIDs
+}
+
+// buildBatch builds and signs one transaction paying ps from
+// accountID. The transaction has one spend per asset, so at most
+// one change output per asset, followed by an output for each
+// payment.
+func (q *Queue) buildBatch(ctx context.Context, accountID string, ps []*Payment, signFn txbuilder.SignFunc) (*txbuilder.Template, error) {
+	totals, assetIDs := totals(ps)
+
+	var actions []txbuilder.Action
+	for _, assetID := range assetIDs {
+		amt := bc.AssetAmount{AssetID: assetID, Amount: totals[assetID]}
+		actions = append(actions, q.Accounts.NewSpendAction(amt, accountID, nil, nil))
+	}
+	for _, p := range ps {
+		amt := bc.AssetAmount{AssetID: p.AssetID, Amount: p.Amount}
+		if p.ControlAccountID != "" {
+			actions = append(actions, q.Accounts.NewControlAction(amt, p.ControlAccountID, p.ReferenceData))
+		} else {
+			actions = append(actions, txbuilder.NewControlProgramAction(amt, p.ControlProgram, p.ReferenceData))
+		}
+	}
+
+	tpl, err := txbuilder.Build(ctx, nil, actions, time.Now().Add(txTTL))
+	if err != nil {
+		return nil, errors.Wrap(err, "building batch transaction")
+	}
+
+	signer, err := signers.Find(ctx, q.DB, "account", accountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "finding account")
+	}
+	var xpubs []string
+	for _, xpub := range signer.XPubs {
+		xpubs = append(xpubs, xpub.String())
+	}
+	err = txbuilder.Sign(ctx, tpl, xpubs, signFn)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing batch transaction")
+	}
+	return tpl, nil
+}
+
+// invalidPayments returns the payments in ps whose own outputs
+// could not be built, according to err, the error buildBatch
+// returned for them, and the error for each.
+func invalidPayments(err error, ps []*Payment) map[string]error {
+	_, assetIDs := totals(ps)
+	actionErrs, _ := errors.Data(err)["actions"].([]error)
+	invalid := make(map[string]error)
+	for _, actionErr := range actionErrs {
+		i, ok := errors.Data(actionErr)["index"].(int)
+		if !ok || i < len(assetIDs) || i-len(assetIDs) >= len(ps) {
+			// The error is in one of the spends.
+			continue
+		}
+		invalid[ps[i-len(assetIDs)].ID] = actionErr
+	}
+	return invalid
+}
+
+// recordBatch saves the signed transaction of a claimed batch,
+// and the height from which to look for it in the blockchain,
+// before it is submitted. It reports false if the claim has
+// been released in the meantime.
+func (q *Queue) recordBatch(ctx context.Context, batchID, accountID string, tpl *txbuilder.Template) (bool, error) {
+	const recordQ = `
+		WITH claimed AS (
+			UPDATE payments SET tx_id=$2
+			WHERE batch_id=$1 AND status='submitting' AND tx_id IS NULL
+			RETURNING id
+		)
+		INSERT INTO payment_batches (id, account_id, tx_id, template, submit_height)
+		SELECT $1, $3, $2, $4, $5 WHERE EXISTS (SELECT 1 FROM claimed)
+	`
+	tplJSON, err := stdjson.Marshal(tpl)
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	txID := tpl.Transaction.Hash()
+	res, err := q.DB.Exec(ctx, recordQ, batchID, txID.String(), accountID, tplJSON, q.Chain.Height())
+	if err != nil {
+		return false, errors.Wrap(err, "recording payment batch")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+	return n > 0, nil
+}
+
+// reconcile settles the batches left submitting by an earlier
+// Flush that failed, crashed, or was deposed part way through.
+//
+// A claim whose transaction was never recorded cannot have been
+// submitted; once it is older than txTTL its payments are pending
+// again. A recorded batch is looked for in the blockchain by its
+// transaction hash. If it is there, its payments are submitted.
+// If it has expired without landing, its payments are pending
+// again. Otherwise the same transaction is submitted again, which
+// cannot pay anything twice.
+func (q *Queue) reconcile(ctx context.Context, submit SubmitFunc) error {
+	const releaseQ = `
+		UPDATE payments SET status='pending', batch_id=NULL, claimed_at=NULL
+		WHERE status='submitting' AND tx_id IS NULL AND claimed_at < now() - $1::interval
+	`
+	_, err := q.DB.Exec(ctx, releaseQ, fmt.Sprintf("%d milliseconds", txTTL/time.Millisecond))
+	if err != nil {
+		return errors.Wrap(err, "releasing stale payment claims")
+	}
+
+	const batchesQ = `
+		SELECT id, template, submit_height FROM payment_batches
+		WHERE id IN (SELECT batch_id FROM payments WHERE status='submitting' AND tx_id IS NOT NULL)
+		ORDER BY id
+	`
+	type batch struct {
+		id     string
+		tpl    *txbuilder.Template
+		height uint64
+	}
+	var batches []batch
+	err = pg.ForQueryRows(ctx, q.DB, batchesQ, func(id string, tplJSON []byte, height uint64) error {
+		b := batch{id: id, tpl: new(txbuilder.Template), height: height}
+		batches = append(batches, b)
+		return stdjson.Unmarshal(tplJSON, b.tpl)
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying unsettled payment batches")
+	}
+
+	for _, b := range batches {
+		landed, expired, err := txbuilder.FindTx(ctx, q.Chain, b.tpl.Transaction, b.height)
+		if err != nil {
+			return err
+		}
+		switch {
+		case landed:
+			err = q.setBatchStatus(ctx, b.id, StatusSubmitted)
+		case expired:
+			err = q.releaseBatch(ctx, b.id)
+		default:
+			err = submit(ctx, b.tpl)
+			if err != nil {
+				log.Error(ctx, err, "resubmitting payment batch ", b.id)
+				continue
+			}
+			err = q.setBatchStatus(ctx, b.id, StatusSubmitted)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *Queue) setBatchStatus(ctx context.Context, batchID, status string) error {
+	const updateQ = `UPDATE payments SET status=$2 WHERE batch_id=$1 AND status='submitting'`
+	_, err := q.DB.Exec(ctx, updateQ, batchID, status)
+	return errors.Wrap(err, "updating payment status")
+}
+
+// releaseBatch returns the payments of a batch that could not be
+// built, or whose transaction expired without landing, to the queue.
+func (q *Queue) releaseBatch(ctx context.Context, batchID string) error {
+	const releaseQ = `
+		UPDATE payments SET status='pending', batch_id=NULL, tx_id=NULL, claimed_at=NULL
+		WHERE batch_id=$1 AND status='submitting'
+	`
+	_, err := q.DB.Exec(ctx, releaseQ, batchID)
+	return errors.Wrap(err, "releasing expired payment batch")
+}
+
+func (q *Queue) setStatus(ctx context.Context, ids []string, status string, txID *bc.Hash, errStr string) error {
+	const updateQ = `
+		UPDATE payments SET status=$2, tx_id=$3, error=$4
+		WHERE id=ANY($1)
+	`
+	var txIDStr sql.NullString
+	if txID != nil {
+		txIDStr = sql.NullString{String: txID.String(), Valid: true}
+	}
+	_, err := q.DB.Exec(ctx, updateQ, pq.StringArray(ids), status, txIDStr, errStr)
+	return errors.Wrap(err, "updating payment status")
+}
+
+type byAssetID []bc.AssetID
+
+func (a byAssetID) Len() int           { return len(a) }
+func (a byAssetID) Less(i, j int) bool { return a[i].String() < a[j].String() }
+func (a byAssetID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
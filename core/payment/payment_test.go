@@ -0,0 +1,250 @@
+package payment_test
+
+import (
+	"context"
+	"testing"
+
+	"chain/core/account"
+	"chain/core/asset"
+	"chain/core/coretest"
+	"chain/core/payment"
+	"chain/core/pin"
+	"chain/core/query"
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestEnqueueValidation(t *testing.T) {
+	q := &payment.Queue{}
+	cases := []payment.Payment{
+		{AssetID: bc.AssetID{1}, ControlAccountID: "acc1"},
+		{Amount: 1, ControlAccountID: "acc1"},
+		{Amount: 1, AssetID: bc.AssetID{1}},
+		{Amount: 1, AssetID: bc.AssetID{1}, ControlAccountID: "acc1", ControlProgram: []byte{1}},
+	}
+	for i, p := range cases {
+		_, err := q.Enqueue(context.Background(), &p)
+		if errors.Root(err) != payment.ErrBadPayment {
+			t.Errorf("case %d: got error %v want %v", i, err, payment.ErrBadPayment)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		dst     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 10, src)
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	q := &payment.Queue{DB: db, Chain: c, Accounts: accounts}
+	for _, p := range []*payment.Payment{
+		{AccountID: src, AssetID: assetID, Amount: 2, ControlAccountID: dst},
+		{AccountID: src, AssetID: assetID, Amount: 3, ControlProgram: []byte{0x51}},
+	} {
+		_, err := q.Enqueue(ctx, p)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+	}
+
+	var submitted []*txbuilder.Template
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+	submit := func(ctx context.Context, tpl *txbuilder.Template) error {
+		submitted = append(submitted, tpl)
+		return txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+	}
+	err := q.Flush(ctx, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("submitted %d transactions, want 1", len(submitted))
+	}
+	// Two payments and one change output.
+	if n := len(submitted[0].Transaction.Outputs); n != 3 {
+		t.Errorf("batch transaction has %d outputs, want 3", n)
+	}
+
+	ps, err := q.List(ctx, src, "", "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	txID := submitted[0].Transaction.Hash()
+	for _, p := range ps {
+		if p.Status != payment.StatusSubmitted || p.TxID == nil || *p.TxID != txID {
+			t.Errorf("payment %s: status %s tx %v, want %s tx %s", p.ID, p.Status, p.TxID, payment.StatusSubmitted, txID)
+		}
+	}
+}
+
+func TestFlushAfterFailedSubmit(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 10, src)
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	q := &payment.Queue{DB: db, Chain: c, Accounts: accounts}
+	_, err := q.Enqueue(ctx, &payment.Payment{AccountID: src, AssetID: assetID, Amount: 2, ControlProgram: []byte{0x51}})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+
+	// The transaction reaches the pool, but the submitter
+	// reports an error, as it would after a timeout.
+	var submitted []*txbuilder.Template
+	err = q.Flush(ctx, signFn, func(ctx context.Context, tpl *txbuilder.Template) error {
+		submitted = append(submitted, tpl)
+		err := txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+		if err != nil {
+			return err
+		}
+		return errors.New("timed out")
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("submitted %d transactions, want 1", len(submitted))
+	}
+	txID := submitted[0].Transaction.Hash()
+	checkStatus(ctx, t, q, src, payment.StatusSubmitting, txID)
+
+	prottest.MakeBlock(t, c)
+
+	// The next flush must find the transaction in the
+	// blockchain rather than pay again.
+	err = q.Flush(ctx, signFn, func(ctx context.Context, tpl *txbuilder.Template) error {
+		t.Errorf("submitted transaction %s again", tpl.Transaction.Hash())
+		return nil
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	checkStatus(ctx, t, q, src, payment.StatusSubmitted, txID)
+}
+
+func TestFlushInvalidPayment(t *testing.T) {
+	var (
+		_, db    = pgtest.NewDB(t, pgtest.SchemaPath)
+		ctx      = context.Background()
+		c        = prottest.NewChain(t)
+		accounts = account.NewManager(db, c)
+		assets   = asset.NewRegistry(db, c)
+		pinStore = &pin.Store{DB: db}
+		indexer  = query.NewIndexer(db, c, pinStore)
+
+		src     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		dst     = coretest.CreateAccount(ctx, t, accounts, "", nil)
+		assetID = coretest.CreateAsset(ctx, t, assets, nil, "", nil)
+	)
+	coretest.IssueAssets(ctx, t, c, assets, accounts, assetID, 10, src)
+
+	assets.IndexAssets(indexer, pinStore)
+	accounts.IndexAccounts(indexer, pinStore)
+	go accounts.ProcessBlocks(ctx)
+	prottest.MakeBlock(t, c)
+	<-pinStore.Pin(account.PinName).WaitForHeight(c.Height())
+
+	q := &payment.Queue{DB: db, Chain: c, Accounts: accounts}
+	good, err := q.Enqueue(ctx, &payment.Payment{AccountID: src, AssetID: assetID, Amount: 2, ControlProgram: []byte{0x51}})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	bad, err := q.Enqueue(ctx, &payment.Payment{AccountID: src, AssetID: assetID, Amount: 3, ControlAccountID: dst})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	// Make the second payment's destination invalid.
+	_, err = db.Exec(ctx, `UPDATE payments SET control_account_id='acc-missing' WHERE id=$1`, bad.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	signFn := func(_ context.Context, _ string, path [][]byte, data [32]byte) ([]byte, error) {
+		return testutil.TestXPrv.Derive(path).Sign(data[:]), nil
+	}
+	submit := func(ctx context.Context, tpl *txbuilder.Template) error {
+		return txbuilder.FinalizeTx(ctx, c, bc.NewTx(*tpl.Transaction))
+	}
+	err = q.Flush(ctx, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	checkPayment(ctx, t, q, src, good.ID, payment.StatusSubmitted)
+	checkPayment(ctx, t, q, src, bad.ID, payment.StatusFailed)
+
+	// A shortfall in funds leaves the payment pending.
+	short, err := q.Enqueue(ctx, &payment.Payment{AccountID: src, AssetID: assetID, Amount: 100, ControlProgram: []byte{0x51}})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	err = q.Flush(ctx, signFn, submit)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	checkPayment(ctx, t, q, src, short.ID, payment.StatusPending)
+}
+
+func checkPayment(ctx context.Context, t *testing.T, q *payment.Queue, accountID, id, status string) {
+	ps, err := q.List(ctx, accountID, "", "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for _, p := range ps {
+		if p.ID == id && p.Status != status {
+			t.Errorf("payment %s: status %s (%s) want %s", p.ID, p.Status, p.Error, status)
+		}
+	}
+}
+
+func checkStatus(ctx context.Context, t *testing.T, q *payment.Queue, accountID, status string, txID bc.Hash) {
+	ps, err := q.List(ctx, accountID, "", "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	for _, p := range ps {
+		if p.Status != status || p.TxID == nil || *p.TxID != txID {
+			t.Errorf("payment %s: status %s tx %v, want %s tx %s", p.ID, p.Status, p.TxID, status, txID)
+		}
+	}
+}
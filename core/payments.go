@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"chain/core/payment"
+	"chain/core/txbuilder"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/net/http/reqid"
+)
+
+// paymentSubmitTimeout bounds how long a payment batch waits for
+// its transaction to be submitted.
+const paymentSubmitTimeout = time.Minute
+
+// RunPaymentBatching submits batches of queued payments once per
+// period. It signs with the Mock HSM. It blocks until ctx is
+// canceled, and should run only on the leader.
+func (h *Handler) RunPaymentBatching(ctx context.Context, period time.Duration) {
+	h.Payments.Run(ctx, period, h.mockhsmSignTemplate, h.submitPaymentBatch)
+}
+
+func (h *Handler) submitPaymentBatch(ctx context.Context, tpl *txbuilder.Template) error {
+	ctx, cancel := context.WithTimeout(ctx, paymentSubmitTimeout)
+	defer cancel()
+	return h.finalizeTxWait(ctx, tpl, "none")
+}
+
+// POST /enqueue-payment
+func (h *Handler) enqueuePayments(ctx context.Context, ins []struct {
+	payment.Payment
+	AccountAlias        string `json:"account_alias"`
+	AssetAlias          string `json:"asset_alias"`
+	ControlAccountAlias string `json:"control_account_alias"`
+}) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			in := &ins[i]
+			if in.AccountID == "" && in.AccountAlias != "" {
+				acc, err := h.Accounts.FindByAlias(subctx, in.AccountAlias)
+				if err != nil {
+					responses[i] = errors.WithDetailf(err, "invalid account alias %s", in.AccountAlias)
+					return
+				}
+				in.AccountID = acc.ID
+			}
+			if in.ControlAccountID == "" && in.ControlAccountAlias != "" {
+				acc, err := h.Accounts.FindByAlias(subctx, in.ControlAccountAlias)
+				if err != nil {
+					responses[i] = errors.WithDetailf(err, "invalid control account alias %s", in.ControlAccountAlias)
+					return
+				}
+				in.ControlAccountID = acc.ID
+			}
+			if in.AssetAlias != "" {
+				a, err := h.Assets.FindByAlias(subctx, in.AssetAlias)
+				if err != nil {
+					responses[i] = errors.WithDetailf(err, "invalid asset alias %s", in.AssetAlias)
+					return
+				}
+				in.AssetID = a.AssetID
+			}
+			in.ID, in.Status, in.TxID, in.Error = "", "", nil, ""
+
+			p, err := h.Payments.Enqueue(subctx, &in.Payment)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = p
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// POST /list-payments
+//
+// Payments may be filtered by source account and by status.
+func (h *Handler) listPayments(ctx context.Context, in struct {
+	AccountID string `json:"account_id"`
+	Status    string `json:"status"`
+	After     string `json:"after"`
+}) (interface{}, error) {
+	switch in.Status {
+	case "", payment.StatusPending, payment.StatusSubmitted, payment.StatusFailed:
+	default:
+		return nil, errors.WithDetailf(httpjson.ErrBadRequest, "unknown payment status %q", in.Status)
+	}
+	limit := defGenericPageSize
+	payments, err := h.Payments.List(ctx, in.AccountID, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(payments) > 0 {
+		next.After = payments[len(payments)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(payments), next, len(payments) < limit}, nil
+}
@@ -10,6 +10,7 @@ import (
 	"chain/core/query/filter"
 	"chain/errors"
 	"chain/net/http/httpjson"
+	"chain/protocol/bc"
 )
 
 // These types enforce the ordering of JSON fields in API output.
@@ -102,6 +103,11 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 		}
 	}
 
+	amounts, err := h.newAmountFormatter(in.AmountFormat)
+	if err != nil {
+		return result, err
+	}
+
 	limit := defGenericPageSize
 	txns, nextAfter, err := h.Indexer.Transactions(ctx, p, in.FilterParams, after, limit, in.AscLongPoll)
 	if err != nil {
@@ -118,7 +124,7 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 			return result, fmt.Errorf("unexpected nil in Indexer.Transactions output")
 		}
 		var tx map[string]interface{}
-		err = json.Unmarshal(*tjson, &tx)
+		err = decodeAnnotated(*tjson, &tx)
 		if err != nil {
 			return result, errors.Wrap(err, "decoding Indexer.Transactions output")
 		}
@@ -153,6 +159,10 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 
 		inResps := make([]*txinResp, 0, len(inputs))
 		for _, in := range inputs {
+			amount, err := amounts.format(ctx, in["asset_id"], in["amount"])
+			if err != nil {
+				return result, err
+			}
 			r := &txinResp{
 				Type:            in["type"],
 				AssetID:         in["asset_id"],
@@ -160,7 +170,7 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 				AssetDefinition: in["asset_definition"],
 				AssetTags:       in["asset_tags"],
 				AssetIsLocal:    in["asset_is_local"],
-				Amount:          in["amount"],
+				Amount:          amount,
 				IssuanceProgram: in["issuance_program"],
 				SpentOutput:     in["spent_output"],
 				txAccount:       txAccountFromMap(in),
@@ -171,6 +181,10 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 		}
 		outResps := make([]*txoutResp, 0, len(outputs))
 		for _, out := range outputs {
+			amount, err := amounts.format(ctx, out["asset_id"], out["amount"])
+			if err != nil {
+				return result, err
+			}
 			r := &txoutResp{
 				Type:            out["type"],
 				Purpose:         out["purpose"],
@@ -180,7 +194,7 @@ func (h *Handler) listTransactions(ctx context.Context, in requestQuery) (result
 				AssetDefinition: out["asset_definition"],
 				AssetTags:       out["asset_tags"],
 				AssetIsLocal:    out["asset_is_local"],
-				Amount:          out["amount"],
+				Amount:          amount,
 				txAccount:       txAccountFromMap(out),
 				ControlProgram:  out["control_program"],
 				ReferenceData:   out["reference_data"],
@@ -254,6 +268,10 @@ func (h *Handler) listAccounts(ctx context.Context, in requestQuery) (page, erro
 			Keys:   orderedKeys,
 			Quorum: a["quorum"],
 			Tags:   a["tags"],
+
+			ProgramTemplate: a["program_template"],
+			CoinSelection:   a["coin_selection"],
+			SpendingPolicy:  a["spending_policy"],
 		}
 		result = append(result, r)
 	}
@@ -268,6 +286,12 @@ func (h *Handler) listAccounts(ctx context.Context, in requestQuery) (page, erro
 	}, nil
 }
 
+// This type enforces the ordering of JSON fields in API output.
+type balanceResp struct {
+	SumBy  interface{} `json:"sum_by,omitempty"`
+	Amount interface{} `json:"amount"`
+}
+
 // POST /list-balances
 func (h *Handler) listBalances(ctx context.Context, in requestQuery) (result page, err error) {
 	var p filter.Predicate
@@ -298,11 +322,33 @@ func (h *Handler) listBalances(ctx context.Context, in requestQuery) (result pag
 		return result, errors.WithDetail(httpjson.ErrBadRequest, "timestamp is too large")
 	}
 
+	amounts, err := h.newAmountFormatter(in.AmountFormat)
+	if err != nil {
+		return result, err
+	}
+	if amounts.decimal && !contains(in.SumBy, "asset_id") {
+		return result, errors.WithDetail(httpjson.ErrBadRequest, "decimal amounts require sum_by to include asset_id")
+	}
+
 	// TODO(jackson): paginate this endpoint.
 	balances, err := h.Indexer.Balances(ctx, p, in.FilterParams, sumBy, timestampMS)
 	if err != nil {
 		return result, err
 	}
+	if amounts.decimal {
+		for i, b := range balances {
+			b := b.(query.Balance)
+			var assetID interface{}
+			if id, ok := b.SumBy["asset_id"].(**string); ok && *id != nil {
+				assetID = **id
+			}
+			amount, err := amounts.format(ctx, assetID, b.Amount)
+			if err != nil {
+				return result, err
+			}
+			balances[i] = balanceResp{SumBy: b.SumBy, Amount: amount}
+		}
+	}
 
 	result.Items = httpjson.Array(balances)
 	result.LastPage = true
@@ -352,6 +398,11 @@ func (h *Handler) listUnspentOutputs(ctx context.Context, in requestQuery) (resu
 	} else if timestampMS > math.MaxInt64 {
 		return result, errors.WithDetail(httpjson.ErrBadRequest, "timestamp is too large")
 	}
+	amounts, err := h.newAmountFormatter(in.AmountFormat)
+	if err != nil {
+		return result, err
+	}
+
 	limit := defGenericPageSize
 	outputs, nextAfter, err := h.Indexer.Outputs(ctx, p, in.FilterParams, timestampMS, after, limit)
 	if err != nil {
@@ -368,10 +419,14 @@ func (h *Handler) listUnspentOutputs(ctx context.Context, in requestQuery) (resu
 			return result, fmt.Errorf("unexpected nil in Indexer.Outputs output")
 		}
 		var out map[string]interface{}
-		err = json.Unmarshal(*ojson, &out)
+		err = decodeAnnotated(*ojson, &out)
 		if err != nil {
 			return result, errors.Wrap(err, "decoding Indexer.Outputs output")
 		}
+		amount, err := amounts.format(ctx, out["asset_id"], out["amount"])
+		if err != nil {
+			return result, err
+		}
 		r := &utxoResp{
 			Type:            out["type"],
 			Purpose:         out["purpose"],
@@ -382,7 +437,7 @@ func (h *Handler) listUnspentOutputs(ctx context.Context, in requestQuery) (resu
 			AssetDefinition: out["asset_definition"],
 			AssetTags:       out["asset_tags"],
 			AssetIsLocal:    out["asset_is_local"],
-			Amount:          out["amount"],
+			Amount:          amount,
 			AccountID:       out["account_id"],
 			AccountAlias:    out["account_alias"],
 			AccountTags:     out["account_tags"],
@@ -423,8 +478,19 @@ func (h *Handler) listAssets(ctx context.Context, in requestQuery) (page, error)
 		return page{}, errors.Wrap(err, "running asset query")
 	}
 
+	assetIDs := make([]bc.AssetID, len(assets))
+	for i, a := range assets {
+		if id, ok := a["id"].(string); ok {
+			assetIDs[i].UnmarshalText([]byte(id))
+		}
+	}
+	supplies, err := h.Assets.Supplies(ctx, assetIDs)
+	if err != nil {
+		return page{}, errors.Wrap(err, "looking up asset supply")
+	}
+
 	result := make([]*assetResponse, 0, len(assets))
-	for _, a := range assets {
+	for i, a := range assets {
 		var orderedKeys []assetKey
 		keys, ok := a["keys"].([]interface{})
 		if ok {
@@ -452,6 +518,7 @@ func (h *Handler) listAssets(ctx context.Context, in requestQuery) (page, error)
 		if alias, ok := a["alias"].(string); ok && alias != "" {
 			r.Alias = &alias
 		}
+		r.Supply = supplies[assetIDs[i]]
 		result = append(result, r)
 	}
 
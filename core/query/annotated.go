@@ -22,7 +22,34 @@ func transactionObject(orig *bc.Tx, b *bc.Block, indexInBlock uint32) map[string
 		"position":       indexInBlock,
 		"reference_data": unmarshalReferenceData(orig.ReferenceData),
 	}
+	addInputsOutputs(m, orig)
+	return m
+}
+
+// AnnotateTx annotates a transaction that is not in a block, such
+// as one in a transaction template, with the same annotators used
+// for indexed transactions.
+func (ind *Indexer) AnnotateTx(ctx context.Context, tx *bc.Tx) (map[string]interface{}, error) {
+	m := map[string]interface{}{
+		"id":             tx.Hash.String(),
+		"min_time":       tx.MinTime,
+		"max_time":       tx.MaxTime,
+		"reference_data": unmarshalReferenceData(tx.ReferenceData),
+	}
+	addInputsOutputs(m, tx)
 
+	txs := []map[string]interface{}{m}
+	for _, annotator := range ind.annotators {
+		err := annotator(ctx, txs)
+		if err != nil {
+			return nil, errors.Wrap(err, "adding external annotations")
+		}
+	}
+	localAnnotator(ctx, txs)
+	return m, nil
+}
+
+func addInputsOutputs(m map[string]interface{}, orig *bc.Tx) {
 	inputs := make([]interface{}, 0, len(orig.Inputs))
 	for _, in := range orig.Inputs {
 		inputs = append(inputs, transactionInput(in))
@@ -33,8 +60,6 @@ func transactionObject(orig *bc.Tx, b *bc.Block, indexInBlock uint32) map[string
 	}
 	m["inputs"] = inputs
 	m["outputs"] = outputs
-
-	return m
 }
 
 func transactionInput(in *bc.TxInput) map[string]interface{} {
@@ -12,7 +12,15 @@ import (
 	"chain/errors"
 )
 
+// Balance is one item of the result of a balances query.
+// This type enforces JSON field ordering in API output.
+type Balance struct {
+	SumBy  map[string]interface{} `json:"sum_by,omitempty"`
+	Amount uint64                 `json:"amount"`
+}
+
 // Balances performs a balances query against the annotated_outputs.
+// Each item of the result is a Balance.
 func (ind *Indexer) Balances(ctx context.Context, p filter.Predicate, vals []interface{}, sumBy []filter.Field, timestampMS uint64) ([]interface{}, error) {
 	if len(vals) != p.Parameters {
 		return nil, ErrParameterCountMismatch
@@ -47,13 +55,7 @@ func (ind *Indexer) Balances(ctx context.Context, p filter.Predicate, vals []int
 		for i, f := range sumBy {
 			sumByValues[f.String()] = scanArguments[i+1]
 		}
-		// This struct enforces JSON field ordering in API output.
-		item := struct {
-			SumBy  map[string]interface{} `json:"sum_by,omitempty"`
-			Amount uint64                 `json:"amount"`
-		}{
-			Amount: balance,
-		}
+		item := Balance{Amount: balance}
 		if len(sumByValues) > 0 {
 			item.SumBy = sumByValues
 		}
@@ -30,12 +30,12 @@ func setupQueryTest(t *testing.T) (context.Context, *Indexer, time.Time, time.Ti
 	go assets.ProcessBlocks(ctx)
 	go indexer.ProcessBlocks(ctx)
 
-	acct1, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil)
+	acct1, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	acct2, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil)
+	acct2, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
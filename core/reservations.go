@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"strconv"
+
+	"chain/core/account/utxodb"
+	"chain/errors"
+	"chain/net/http/httpjson"
+)
+
+// POST /list-reservations
+func (h *Handler) listReservations(ctx context.Context, in struct {
+	AccountID   string `json:"account_id"`
+	AssetID     string `json:"asset_id"`
+	ClientToken string `json:"client_token"`
+	After       string `json:"after"`
+}) (interface{}, error) {
+	var after int64
+	if in.After != "" {
+		var err error
+		after, err = strconv.ParseInt(in.After, 10, 32)
+		if err != nil {
+			return nil, errors.WithDetailf(httpjson.ErrBadRequest, "invalid after value %q", in.After)
+		}
+	}
+	limit := defGenericPageSize
+	f := utxodb.ReservationFilter{
+		AccountID:   in.AccountID,
+		AssetID:     in.AssetID,
+		ClientToken: in.ClientToken,
+	}
+	rs, err := h.Accounts.Reservations(ctx, f, int32(after), limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(rs) > 0 {
+		next.After = strconv.Itoa(int(rs[len(rs)-1].ID))
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(rs), next, len(rs) < limit}, nil
+}
+
+// POST /cancel-reservation
+func (h *Handler) cancelReservation(ctx context.Context, in struct {
+	ID int32 `json:"id"`
+}) (*utxodb.Reservation, error) {
+	return h.Accounts.CancelReservation(ctx, in.ID)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"chain/core/leader"
 	chainjson "chain/encoding/json"
 	"chain/errors"
 	"chain/net/http/httpjson"
@@ -29,6 +30,20 @@ func (h *Handler) getBlockRPC(ctx context.Context, height uint64) (chainjson.Hex
 	return rawBlock, nil
 }
 
+// submitRPC adds a transaction received from another Core to the
+// pool. Since the sender controls the raw bytes, it is decoded
+// strictly: anything other than the canonical serialization is
+// rejected.
+func (h *Handler) submitRPC(ctx context.Context, raw chainjson.HexBytes) error {
+	var tx bc.Tx
+	err := tx.TxData.UnmarshalCanonical(raw)
+	if err != nil {
+		return errors.Wrap(err, "decoding transaction")
+	}
+	tx.Hash = tx.TxData.Hash()
+	return h.Chain.AddTx(ctx, &tx)
+}
+
 // getBlocksRPC -- DEPRECATED: use getBlock instead
 func (h *Handler) getBlocksRPC(ctx context.Context, afterHeight uint64) ([]chainjson.HexBytes, error) {
 	block, err := h.getBlockRPC(ctx, afterHeight+1)
@@ -79,3 +94,23 @@ func (h *Handler) getSnapshotRPC(rw http.ResponseWriter, req *http.Request) {
 	rw.Header().Set("Content-Type", "application/x-protobuf")
 	rw.Write(data)
 }
+
+// requestVoteRPC answers a vote request from another process of
+// this Core during a Raft leader election.
+func (h *Handler) requestVoteRPC(ctx context.Context, req *leader.VoteRequest) (*leader.VoteResponse, error) {
+	r, ok := h.Leader.(*leader.Raft)
+	if !ok {
+		return nil, errNotFound
+	}
+	return r.HandleRequestVote(req), nil
+}
+
+// heartbeatRPC answers a heartbeat from the Raft leader among the
+// processes of this Core.
+func (h *Handler) heartbeatRPC(ctx context.Context, req *leader.HeartbeatRequest) (*leader.HeartbeatResponse, error) {
+	r, ok := h.Leader.(*leader.Raft)
+	if !ok {
+		return nil, errNotFound
+	}
+	return r.HandleHeartbeat(req), nil
+}
@@ -49,11 +49,42 @@ func (c Client) userAgent() string {
 type errStatusCode struct {
 	URL        string
 	StatusCode int
+	Response   *ErrorResponse // nil if the body wasn't a Chain error
 }
 
 func (e errStatusCode) Error() string {
-	return fmt.Sprintf("Request to `%s` responded with %d %s",
+	msg := fmt.Sprintf("Request to `%s` responded with %d %s",
 		e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Response != nil {
+		msg += ": " + e.Response.Error()
+	}
+	return msg
+}
+
+// ErrorResponse is the body of an unsuccessful response
+// from another Core.
+type ErrorResponse struct {
+	StatusCode int                    `json:"-"`
+	ChainCode  string                 `json:"code"`
+	Message    string                 `json:"message"`
+	Detail     string                 `json:"detail,omitempty"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Temporary  bool                   `json:"temporary"`
+}
+
+func (e *ErrorResponse) Error() string {
+	msg := e.ChainCode + " " + e.Message
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Response returns the body of the unsuccessful response
+// that caused err, or nil if there is none.
+func Response(err error) *ErrorResponse {
+	e, _ := errors.Root(err).(errStatusCode)
+	return e.Response
 }
 
 // Call calls a remote procedure on another node, specified by the path.
@@ -130,11 +161,17 @@ func (c *Client) CallRaw(ctx context.Context, path string, request interface{})
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		resp.Body.Close()
-		return nil, errStatusCode{
+		defer resp.Body.Close()
+		err := errStatusCode{
 			URL:        cleanedURLString(u),
 			StatusCode: resp.StatusCode,
 		}
+		var body ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&body) == nil && body.ChainCode != "" {
+			body.StatusCode = resp.StatusCode
+			err.Response = &body
+		}
+		return nil, err
 	}
 	return resp.Body, nil
 }
@@ -0,0 +1,535 @@
+// Package schedule stores transaction build requests to be carried
+// out by Core at a later time, once or at a regular interval.
+//
+// Scheduled transactions are executed by the leader process. A
+// failed execution is retried a limited number of times before the
+// occurrence is given up on. Every attempt is recorded.
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	stdjson "encoding/json"
+	"fmt"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/database/pg"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol"
+	"chain/protocol/bc"
+)
+
+// retryDelay is how long to wait after the first failed attempt
+// before retrying. The delay grows linearly with each attempt.
+const retryDelay = 30 * time.Second
+
+// defaultMaxRetries is the number of retries of each occurrence
+// when the schedule doesn't say.
+const defaultMaxRetries = 3
+
+// interruptedAge is how long an attempt may go without recording
+// its transaction before reconcile takes it to have been
+// interrupted.
+const interruptedAge = 5 * time.Minute
+
+var ErrBadSchedule = errors.New("invalid schedule")
+
+// Statuses of a scheduled transaction.
+const (
+	StatusActive    = "active"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+)
+
+// Statuses of a single attempt.
+const (
+	RunRunning    = "running"
+	RunSubmitting = "submitting"
+	RunSucceeded  = "succeeded"
+	RunFailed     = "failed"
+)
+
+// A Transaction is a transaction build request and the schedule on
+// which to carry it out.
+type Transaction struct {
+	ID    string `json:"id"`
+	Alias string `json:"alias,omitempty"`
+
+	// Actions are the actions of the build request, as accepted by
+	// /build-transaction.
+	Actions stdjson.RawMessage `json:"actions"`
+
+	// TTL is the time to live of each built transaction.
+	TTL json.Duration `json:"ttl"`
+
+	// At is when to run the transaction first.
+	At time.Time `json:"at"`
+
+	// Interval, if nonzero, repeats the transaction this often
+	// after At.
+	Interval json.Duration `json:"interval"`
+
+	// MaxRetries is the number of times a failed occurrence is
+	// retried.
+	MaxRetries *int `json:"max_retries"`
+
+	Status    string    `json:"status"`
+	NextRunAt time.Time `json:"next_run_at"`
+	Attempt   int       `json:"attempt"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// occurrence is the scheduled time of the current
+	// occurrence. Unlike NextRunAt, retries don't change it.
+	occurrence time.Time
+}
+
+// A Run records one attempt to carry out a scheduled transaction.
+type Run struct {
+	ID                     string    `json:"id"`
+	ScheduledTransactionID string    `json:"scheduled_transaction_id"`
+	Attempt                int       `json:"attempt"`
+	Status                 string    `json:"status"`
+	TxID                   *bc.Hash  `json:"transaction_id"`
+	Error                  string    `json:"error,omitempty"`
+	StartedAt              time.Time `json:"started_at"`
+}
+
+// BuildFunc builds and signs a transaction from a build request's
+// actions, using clientToken to make its reservations idempotent.
+type BuildFunc func(ctx context.Context, actions []byte, ttl time.Duration, clientToken string) (*txbuilder.Template, error)
+
+// SubmitFunc finalizes and submits a signed transaction template.
+type SubmitFunc func(context.Context, *txbuilder.Template) error
+
+// Scheduler stores scheduled transactions and runs them when due.
+type Scheduler struct {
+	DB    pg.DB
+	Chain *protocol.Chain
+}
+
+// Create validates and stores a new scheduled transaction. An At
+// in the past, or zero, runs the transaction at the next check.
+func (s *Scheduler) Create(ctx context.Context, t *Transaction) (*Transaction, error) {
+	if len(t.Actions) == 0 {
+		return nil, errors.WithDetail(ErrBadSchedule, "actions are required")
+	}
+	if t.Interval.Duration != 0 && t.Interval.Duration < time.Minute {
+		return nil, errors.WithDetail(ErrBadSchedule, "interval must be at least one minute")
+	}
+	if t.MaxRetries == nil {
+		n := defaultMaxRetries
+		t.MaxRetries = &n
+	}
+	if *t.MaxRetries < 0 {
+		return nil, errors.WithDetail(ErrBadSchedule, "max_retries must not be negative")
+	}
+	if t.At.IsZero() {
+		t.At = time.Now()
+	}
+
+	const q = `
+		INSERT INTO scheduled_txs
+			(alias, actions, ttl_ms, start_at, interval_ms, max_retries, next_run_at, occurrence_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $4, $4)
+		RETURNING id, status, next_run_at, created_at
+	`
+	err := s.DB.QueryRow(ctx, q,
+		sql.NullString{String: t.Alias, Valid: t.Alias != ""},
+		[]byte(t.Actions),
+		int64(t.TTL.Duration/time.Millisecond),
+		t.At,
+		int64(t.Interval.Duration/time.Millisecond),
+		*t.MaxRetries,
+	).Scan(&t.ID, &t.Status, &t.NextRunAt, &t.CreatedAt)
+	if pg.IsUniqueViolation(err) {
+		return nil, errors.WithDetail(ErrBadSchedule, "alias already exists")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "inserting scheduled transaction")
+	}
+	return t, nil
+}
+
+// List returns up to limit scheduled transactions, most recent
+// first, starting after the one with ID after if it is nonempty.
+// An empty status matches any status.
+func (s *Scheduler) List(ctx context.Context, status, after string, limit int) ([]*Transaction, error) {
+	return s.transactions(ctx, `
+		($1='' OR status=$1) AND ($2='' OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, status, after, limit)
+}
+
+// Find returns the scheduled transaction with the given ID.
+func (s *Scheduler) Find(ctx context.Context, id string) (*Transaction, error) {
+	ts, err := s.transactions(ctx, "id=$1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(ts) == 0 {
+		return nil, errors.WithDetailf(pg.ErrUserInputNotFound, "scheduled transaction %s", id)
+	}
+	return ts[0], nil
+}
+
+func (s *Scheduler) transactions(ctx context.Context, pred string, args ...interface{}) ([]*Transaction, error) {
+	q := fmt.Sprintf(`
+		SELECT id, COALESCE(alias, ''), actions, ttl_ms, start_at, interval_ms, max_retries,
+			status, next_run_at, attempt, created_at, occurrence_at
+		FROM scheduled_txs
+		WHERE %s
+	`, pred)
+	var ts []*Transaction
+	scan := func(id, alias string, actions []byte, ttlMS int64, at time.Time, intervalMS int64, maxRetries int, status string, nextRunAt time.Time, attempt int, createdAt, occurrence time.Time) {
+		ts = append(ts, &Transaction{
+			ID:         id,
+			Alias:      alias,
+			Actions:    actions,
+			TTL:        json.Duration{Duration: time.Duration(ttlMS) * time.Millisecond},
+			At:         at,
+			Interval:   json.Duration{Duration: time.Duration(intervalMS) * time.Millisecond},
+			MaxRetries: &maxRetries,
+			Status:     status,
+			NextRunAt:  nextRunAt,
+			Attempt:    attempt,
+			CreatedAt:  createdAt,
+			occurrence: occurrence,
+		})
+	}
+	err := pg.ForQueryRows(ctx, s.DB, q, append(args, scan)...)
+	return ts, errors.Wrap(err, "querying scheduled transactions")
+}
+
+// Cancel stops a scheduled transaction from running again.
+func (s *Scheduler) Cancel(ctx context.Context, id string) (*Transaction, error) {
+	const q = `UPDATE scheduled_txs SET status='canceled' WHERE id=$1 AND status='active'`
+	res, err := s.DB.Exec(ctx, q, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "canceling scheduled transaction")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	t, err := s.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.WithDetailf(ErrBadSchedule, "scheduled transaction is %s", t.Status)
+	}
+	return t, nil
+}
+
+// Runs returns up to limit attempts of a scheduled transaction, most
+// recent first, starting after the one with ID after if it is
+// nonempty.
+func (s *Scheduler) Runs(ctx context.Context, id, after string, limit int) ([]*Run, error) {
+	const q = `
+		SELECT id, scheduled_tx_id, attempt, status, tx_id, error, started_at
+		FROM scheduled_tx_runs
+		WHERE scheduled_tx_id=$1 AND ($2='' OR id < $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`
+	var runs []*Run
+	err := pg.ForQueryRows(ctx, s.DB, q, id, after, limit, func(id, schedID string, attempt int, status string, txID sql.NullString, errStr string, startedAt time.Time) error {
+		r := &Run{
+			ID:                     id,
+			ScheduledTransactionID: schedID,
+			Attempt:                attempt,
+			Status:                 status,
+			Error:                  errStr,
+			StartedAt:              startedAt,
+		}
+		if txID.Valid {
+			r.TxID = new(bc.Hash)
+			err := r.TxID.UnmarshalText([]byte(txID.String))
+			if err != nil {
+				return err
+			}
+		}
+		runs = append(runs, r)
+		return nil
+	})
+	return runs, errors.Wrap(err, "querying scheduled transaction runs")
+}
+
+// Run executes due scheduled transactions, checking for them once
+// per period. It blocks until ctx is canceled, and should run only
+// on the leader.
+func (s *Scheduler) Run(ctx context.Context, period time.Duration, build BuildFunc, submit SubmitFunc) {
+	ticks := time.Tick(period)
+	for {
+		select {
+		case <-ctx.Done():
+			log.Messagef(ctx, "Deposed, scheduler exiting")
+			return
+		case <-ticks:
+			err := s.RunDue(ctx, time.Now(), build, submit)
+			if err != nil {
+				log.Error(ctx, err)
+			}
+		}
+	}
+}
+
+// RunDue settles any attempts left unfinished by an earlier
+// RunDue, then executes every active scheduled transaction due at
+// or before now that has no unfinished attempt.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time, build BuildFunc, submit SubmitFunc) error {
+	err := s.reconcile(ctx, now, submit)
+	if err != nil {
+		return err
+	}
+
+	ts, err := s.transactions(ctx, `
+		status='active' AND next_run_at <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM scheduled_tx_runs
+				WHERE scheduled_tx_id=scheduled_txs.id AND status IN ('running', 'submitting')
+			)
+		ORDER BY next_run_at
+	`, now)
+	if err != nil {
+		return err
+	}
+	for _, t := range ts {
+		err = s.execute(ctx, t, now, build, submit)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientToken returns the client token for building the
+// occurrence at the given time of the scheduled transaction with
+// the given ID. Every attempt at the same occurrence uses the same
+// token, so they reserve the same outputs and at most one of them
+// can land.
+func clientToken(id string, occurrence time.Time) string {
+	return fmt.Sprintf("%s-%d", id, bc.Millis(occurrence))
+}
+
+// execute makes one attempt at t and advances t's schedule.
+//
+// The attempt is recorded before anything is built, and the signed
+// transaction before it is submitted. If execute is interrupted,
+// reconcile finishes the attempt rather than starting a new one.
+func (s *Scheduler) execute(ctx context.Context, t *Transaction, now time.Time, build BuildFunc, submit SubmitFunc) error {
+	r := &Run{ScheduledTransactionID: t.ID, Attempt: t.Attempt + 1, StartedAt: now}
+	claimed, err := s.claim(ctx, t, r)
+	if err != nil || !claimed {
+		return err
+	}
+
+	tpl, err := build(ctx, t.Actions, t.TTL.Duration, clientToken(t.ID, t.occurrence))
+	if err != nil {
+		return s.finish(ctx, t, r, now, nil, err)
+	}
+	err = s.recordTx(ctx, r, tpl)
+	if err != nil {
+		return err
+	}
+	err = submit(ctx, tpl)
+	if errors.Root(err) == txbuilder.ErrRejected {
+		// The transaction conflicts with the blockchain,
+		// so it cannot land.
+		return s.finish(ctx, t, r, now, nil, err)
+	} else if err != nil {
+		// The transaction may still land. Leave the attempt
+		// for reconcile.
+		log.Error(ctx, err, "scheduled transaction ", t.ID)
+		return nil
+	}
+	txID := tpl.Transaction.Hash()
+	return s.finish(ctx, t, r, now, &txID, nil)
+}
+
+// claim records the start of attempt r at t's current occurrence.
+// It reports false if another process has already made the same
+// attempt.
+func (s *Scheduler) claim(ctx context.Context, t *Transaction, r *Run) (bool, error) {
+	const q = `
+		INSERT INTO scheduled_tx_runs
+			(scheduled_tx_id, occurrence_at, attempt, status, started_at)
+		VALUES ($1, $2, $3, 'running', $4)
+		ON CONFLICT (scheduled_tx_id, occurrence_at, attempt) DO NOTHING
+		RETURNING id
+	`
+	err := s.DB.QueryRow(ctx, q, t.ID, t.occurrence, r.Attempt, r.StartedAt).Scan(&r.ID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, errors.Wrap(err, "recording scheduled transaction run")
+}
+
+// recordTx saves the signed transaction of r, and the height from
+// which to look for it in the blockchain, before it is submitted.
+func (s *Scheduler) recordTx(ctx context.Context, r *Run, tpl *txbuilder.Template) error {
+	const q = `
+		UPDATE scheduled_tx_runs SET status='submitting', tx_id=$2, template=$3, submit_height=$4
+		WHERE id=$1
+	`
+	tplJSON, err := stdjson.Marshal(tpl)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	_, err = s.DB.Exec(ctx, q, r.ID, tpl.Transaction.Hash().String(), tplJSON, s.Chain.Height())
+	return errors.Wrap(err, "recording scheduled transaction")
+}
+
+// finish records the outcome of r and advances t's schedule.
+// A nil txID means the attempt failed with runErr.
+func (s *Scheduler) finish(ctx context.Context, t *Transaction, r *Run, now time.Time, txID *bc.Hash, runErr error) error {
+	if txID == nil {
+		r.Status = RunFailed
+		r.Error = runErr.Error()
+	} else {
+		r.Status = RunSucceeded
+		r.TxID = txID
+	}
+
+	status, next, attempt := advance(t, r, now)
+	occurrence := next
+	if attempt > 0 {
+		// A retry belongs to the same occurrence.
+		occurrence = t.occurrence
+	}
+
+	const (
+		runQ = `
+			UPDATE scheduled_tx_runs SET status=$2, tx_id=$3, error=$4
+			WHERE id=$1
+		`
+		updateQ = `
+			UPDATE scheduled_txs SET status=$2, next_run_at=$3, attempt=$4, occurrence_at=$5
+			WHERE id=$1 AND status='active'
+		`
+	)
+	var txIDStr sql.NullString
+	if r.TxID != nil {
+		txIDStr = sql.NullString{String: r.TxID.String(), Valid: true}
+	}
+	_, err := s.DB.Exec(ctx, runQ, r.ID, r.Status, txIDStr, r.Error)
+	if err != nil {
+		return errors.Wrap(err, "recording scheduled transaction run")
+	}
+	_, err = s.DB.Exec(ctx, updateQ, t.ID, status, next, attempt, occurrence)
+	return errors.Wrap(err, "updating scheduled transaction")
+}
+
+// reconcile finishes the attempts left unfinished by an earlier
+// execute that failed, crashed, or was deposed part way through.
+//
+// An attempt interrupted before its transaction was recorded
+// cannot have been submitted, so once it is older than
+// interruptedAge it is finished as failed. A recorded transaction
+// is looked for in the blockchain by its hash. If it is there, the
+// attempt succeeded. If it has expired without landing, the
+// attempt failed. Otherwise the same transaction is submitted
+// again, which cannot run the occurrence twice.
+func (s *Scheduler) reconcile(ctx context.Context, now time.Time, submit SubmitFunc) error {
+	const q = `
+		SELECT id, scheduled_tx_id, attempt, status, started_at, template, submit_height
+		FROM scheduled_tx_runs
+		WHERE status IN ('running', 'submitting')
+		ORDER BY id
+	`
+	type pending struct {
+		run    *Run
+		tpl    []byte
+		height uint64
+	}
+	var runs []pending
+	err := pg.ForQueryRows(ctx, s.DB, q, func(id, schedID string, attempt int, status string, startedAt time.Time, tpl []byte, height sql.NullInt64) {
+		runs = append(runs, pending{
+			run: &Run{
+				ID:                     id,
+				ScheduledTransactionID: schedID,
+				Attempt:                attempt,
+				Status:                 status,
+				StartedAt:              startedAt,
+			},
+			tpl:    tpl,
+			height: uint64(height.Int64),
+		})
+	})
+	if err != nil {
+		return errors.Wrap(err, "querying unfinished scheduled transaction runs")
+	}
+
+	for _, p := range runs {
+		r := p.run
+		t, err := s.Find(ctx, r.ScheduledTransactionID)
+		if err != nil {
+			return err
+		}
+		if r.Status == RunRunning {
+			if now.Sub(r.StartedAt) < interruptedAge {
+				continue
+			}
+			err = s.finish(ctx, t, r, now, nil, errors.New("interrupted before submission"))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		tpl := new(txbuilder.Template)
+		err = stdjson.Unmarshal(p.tpl, tpl)
+		if err != nil {
+			return errors.Wrap(err, "decoding scheduled transaction")
+		}
+		landed, expired, err := txbuilder.FindTx(ctx, s.Chain, tpl.Transaction, p.height)
+		if err != nil {
+			return err
+		}
+		txID := tpl.Transaction.Hash()
+		switch {
+		case landed:
+			err = s.finish(ctx, t, r, now, &txID, nil)
+		case expired:
+			err = s.finish(ctx, t, r, now, nil, errors.New("transaction expired before confirmation"))
+		default:
+			err = submit(ctx, tpl)
+			if errors.Root(err) == txbuilder.ErrRejected {
+				err = s.finish(ctx, t, r, now, nil, err)
+			} else if err != nil {
+				log.Error(ctx, err, "resubmitting scheduled transaction ", t.ID)
+				continue
+			} else {
+				err = s.finish(ctx, t, r, now, &txID, nil)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// advance returns the status, next run time, and failed attempt
+// count of t after the attempt r made at now.
+func advance(t *Transaction, r *Run, now time.Time) (status string, next time.Time, attempt int) {
+	if r.Status == RunFailed && r.Attempt <= *t.MaxRetries {
+		return StatusActive, now.Add(time.Duration(r.Attempt) * retryDelay), r.Attempt
+	}
+	if t.Interval.Duration == 0 {
+		if r.Status == RunFailed {
+			return StatusFailed, t.NextRunAt, r.Attempt
+		}
+		return StatusCompleted, t.NextRunAt, 0
+	}
+
+	// Occurrences are measured from At, so retries don't shift the
+	// schedule. Any occurrences missed while Core was down or while
+	// retrying are skipped rather than run in a burst.
+	n := now.Sub(t.At)/t.Interval.Duration + 1
+	return StatusActive, t.At.Add(n * t.Interval.Duration), 0
+}
@@ -0,0 +1,130 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/core/txbuilder"
+	"chain/database/pg/pgtest"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/prottest"
+	"chain/testutil"
+)
+
+func TestAdvance(t *testing.T) {
+	var (
+		start   = time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC)
+		retries = 2
+		hour    = json.Duration{Duration: time.Hour}
+	)
+	cases := []struct {
+		interval    json.Duration
+		attempt     int
+		runStatus   string
+		now         time.Time
+		wantStatus  string
+		wantNext    time.Time
+		wantAttempt int
+	}{
+		// One-time transactions.
+		{json.Duration{}, 1, RunSucceeded, start, StatusCompleted, start, 0},
+		{json.Duration{}, 1, RunFailed, start, StatusActive, start.Add(retryDelay), 1},
+		{json.Duration{}, 2, RunFailed, start, StatusActive, start.Add(2 * retryDelay), 2},
+		{json.Duration{}, 3, RunFailed, start, StatusFailed, start, 3},
+
+		// Recurring transactions stay on schedule.
+		{hour, 1, RunSucceeded, start.Add(time.Second), StatusActive, start.Add(time.Hour), 0},
+		{hour, 1, RunSucceeded, start.Add(3*time.Hour + time.Minute), StatusActive, start.Add(4 * time.Hour), 0},
+		{hour, 3, RunFailed, start.Add(2 * time.Minute), StatusActive, start.Add(time.Hour), 0},
+	}
+	for i, c := range cases {
+		tx := &Transaction{At: start, NextRunAt: start, Interval: c.interval, MaxRetries: &retries}
+		r := &Run{Attempt: c.attempt, Status: c.runStatus}
+		status, next, attempt := advance(tx, r, c.now)
+		if status != c.wantStatus || !next.Equal(c.wantNext) || attempt != c.wantAttempt {
+			t.Errorf("case %d: advance = %s, %s, %d want %s, %s, %d", i, status, next, attempt, c.wantStatus, c.wantNext, c.wantAttempt)
+		}
+	}
+}
+
+func TestExecuteAfterFailedSubmit(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+	s := &Scheduler{DB: pgtest.NewTx(t), Chain: c}
+
+	sched, err := s.Create(ctx, &Transaction{Actions: []byte(`[]`)})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+
+	now := time.Now()
+	in := bc.NewIssuanceInput(nil, 1, nil, c.InitialBlockHash, []byte{0x51}, nil)
+	tpl := &txbuilder.Template{Transaction: &bc.TxData{
+		Version: 1,
+		Inputs:  []*bc.TxInput{in},
+		Outputs: []*bc.TxOutput{bc.NewTxOutput(in.AssetID(), 1, []byte{0x51}, nil)},
+		MinTime: bc.Millis(now.Add(-time.Minute)),
+		MaxTime: bc.Millis(now.Add(time.Minute)),
+	}}
+	var builds int
+	build := func(_ context.Context, _ []byte, _ time.Duration, token string) (*txbuilder.Template, error) {
+		builds++
+		if want := clientToken(sched.ID, sched.At); token != want {
+			t.Errorf("client token = %q want %q", token, want)
+		}
+		return tpl, nil
+	}
+
+	// The transaction reaches the pool, but the submitter
+	// reports an error, as it would after a timeout.
+	err = s.RunDue(ctx, now, build, func(ctx context.Context, tpl *txbuilder.Template) error {
+		err := c.AddTx(ctx, bc.NewTx(*tpl.Transaction))
+		if err != nil {
+			return err
+		}
+		return errors.New("timed out")
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	runs, err := s.Runs(ctx, sched.ID, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(runs) != 1 || runs[0].Status != RunSubmitting {
+		t.Fatalf("after failed submit: runs = %+v want one %s run", runs, RunSubmitting)
+	}
+
+	prottest.MakeBlock(t, c)
+
+	// The next check must find the transaction in the
+	// blockchain rather than build or submit it again.
+	err = s.RunDue(ctx, now, build, func(ctx context.Context, tpl *txbuilder.Template) error {
+		t.Errorf("submitted transaction %s again", tpl.Transaction.Hash())
+		return nil
+	})
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if builds != 1 {
+		t.Errorf("built %d transactions, want 1", builds)
+	}
+	runs, err = s.Runs(ctx, sched.ID, "", 10)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	txID := tpl.Transaction.Hash()
+	if len(runs) != 1 || runs[0].Status != RunSucceeded || runs[0].TxID == nil || *runs[0].TxID != txID {
+		t.Errorf("after reconcile: runs = %+v want one %s run of tx %s", runs, RunSucceeded, txID)
+	}
+	got, err := s.Find(ctx, sched.ID)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if got.Status != StatusCompleted {
+		t.Errorf("status = %s want %s", got.Status, StatusCompleted)
+	}
+}
@@ -0,0 +1,179 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"chain/core/schedule"
+	"chain/core/txbuilder"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/net/http/reqid"
+)
+
+// scheduledTxSubmitTimeout bounds how long executing a scheduled
+// transaction waits for it to be submitted.
+const scheduledTxSubmitTimeout = time.Minute
+
+// RunScheduler executes scheduled transactions as they come due,
+// checking for them once per period. It signs with the Mock HSM. It
+// blocks until ctx is canceled, and should run only on the leader.
+func (h *Handler) RunScheduler(ctx context.Context, period time.Duration) {
+	h.Scheduler.Run(ctx, period, h.buildScheduledTx, h.submitScheduledTx)
+}
+
+// buildScheduledTx builds a transaction from actions as
+// /build-transaction would, and signs it with every Mock HSM key it
+// requires. Spend actions without a client token get one derived
+// from clientToken.
+func (h *Handler) buildScheduledTx(ctx context.Context, actions []byte, ttl time.Duration, clientToken string) (*txbuilder.Template, error) {
+	req := &buildRequest{TTL: chainjson.Duration{Duration: ttl}}
+	err := json.Unmarshal(actions, &req.Actions)
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding actions")
+	}
+	for i, act := range req.Actions {
+		switch act["type"] {
+		case "spend_account", "spend_account_unspent_output":
+			if _, ok := act["client_token"]; !ok {
+				act["client_token"] = fmt.Sprintf("%s-%d", clientToken, i)
+			}
+		}
+	}
+	tpl, err := h.buildSingle(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	err = txbuilder.Sign(ctx, tpl, templateXPubs(tpl), h.mockhsmSignTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing")
+	}
+	return tpl, nil
+}
+
+func (h *Handler) submitScheduledTx(ctx context.Context, tpl *txbuilder.Template) error {
+	ctx, cancel := context.WithTimeout(ctx, scheduledTxSubmitTimeout)
+	defer cancel()
+	return h.finalizeTxWait(ctx, tpl, "none")
+}
+
+// templateXPubs returns the xpubs of every key that may sign tpl.
+func templateXPubs(tpl *txbuilder.Template) []string {
+	var xpubs []string
+	for _, sigInst := range tpl.SigningInstructions {
+		for _, c := range sigInst.WitnessComponents {
+			sw, ok := c.(*txbuilder.SignatureWitness)
+			if !ok {
+				continue
+			}
+			for _, k := range sw.Keys {
+				if !contains(xpubs, k.XPub) {
+					xpubs = append(xpubs, k.XPub)
+				}
+			}
+		}
+	}
+	return xpubs
+}
+
+// POST /create-scheduled-transaction
+func (h *Handler) createScheduledTxs(ctx context.Context, ins []*schedule.Transaction) interface{} {
+	responses := make([]interface{}, len(ins))
+	var wg sync.WaitGroup
+	wg.Add(len(responses))
+
+	for i := range responses {
+		go func(i int) {
+			subctx := reqid.NewSubContext(ctx, reqid.New())
+			defer wg.Done()
+			defer batchRecover(subctx, &responses[i])
+
+			err := h.checkScheduledActions(ins[i].Actions)
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			t, err := h.Scheduler.Create(subctx, ins[i])
+			if err != nil {
+				responses[i] = err
+				return
+			}
+			responses[i] = t
+		}(i)
+	}
+
+	wg.Wait()
+	return responses
+}
+
+// checkScheduledActions checks that actions is a list of actions of
+// known types. Actions are fully checked only when they are built.
+func (h *Handler) checkScheduledActions(actions json.RawMessage) error {
+	var acts []map[string]interface{}
+	err := json.Unmarshal(actions, &acts)
+	if err != nil {
+		return errors.WithDetail(schedule.ErrBadSchedule, "actions must be a list of action objects")
+	}
+	for i, act := range acts {
+		typ, _ := act["type"].(string)
+		if _, ok := h.actionDecoders[typ]; !ok {
+			return errors.WithDetailf(errBadActionType, "unknown action type %q on action %d", typ, i)
+		}
+	}
+	return nil
+}
+
+// POST /list-scheduled-transactions
+func (h *Handler) listScheduledTxs(ctx context.Context, in struct {
+	Status string `json:"status"`
+	After  string `json:"after"`
+}) (interface{}, error) {
+	limit := defGenericPageSize
+	txs, err := h.Scheduler.List(ctx, in.Status, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(txs) > 0 {
+		next.After = txs[len(txs)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(txs), next, len(txs) < limit}, nil
+}
+
+// POST /cancel-scheduled-transaction
+func (h *Handler) cancelScheduledTx(ctx context.Context, in struct {
+	ID string `json:"id"`
+}) (*schedule.Transaction, error) {
+	return h.Scheduler.Cancel(ctx, in.ID)
+}
+
+// POST /list-scheduled-transaction-runs
+func (h *Handler) listScheduledTxRuns(ctx context.Context, in struct {
+	ID    string `json:"id"`
+	After string `json:"after"`
+}) (interface{}, error) {
+	limit := defGenericPageSize
+	runs, err := h.Scheduler.Runs(ctx, in.ID, in.After, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(runs) > 0 {
+		next.After = runs[len(runs)-1].ID
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(runs), next, len(runs) < limit}, nil
+}
@@ -338,6 +338,21 @@ CREATE TABLE account_control_programs (
 );
 
 
+--
+-- Name: account_spending_decisions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE account_spending_decisions (
+    id text DEFAULT next_chain_id('spd'::text) NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    amount bigint NOT NULL,
+    decision text NOT NULL,
+    reason text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: account_utxos; Type: TABLE; Schema: public; Owner: -
 --
@@ -366,7 +381,22 @@ CREATE TABLE account_utxos (
 CREATE TABLE accounts (
     account_id text NOT NULL,
     tags jsonb,
-    alias text
+    alias text,
+    program_template jsonb,
+    coin_selection text,
+    spending_policy jsonb
+);
+
+
+--
+-- Name: active_generator; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE active_generator (
+    singleton boolean DEFAULT true NOT NULL,
+    rank integer NOT NULL,
+    updated_at timestamp with time zone NOT NULL,
+    CONSTRAINT active_generator_singleton CHECK (singleton)
 );
 
 
@@ -417,6 +447,34 @@ CREATE TABLE annotated_txs (
 );
 
 
+--
+-- Name: asset_definitions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE asset_definitions (
+    asset_id text NOT NULL,
+    version bigint NOT NULL,
+    name text NOT NULL,
+    decimals integer NOT NULL,
+    issuer text NOT NULL,
+    documents_hash bytea NOT NULL,
+    signatures bytea[] NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: asset_supply; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE asset_supply (
+    asset_id text NOT NULL,
+    issued numeric DEFAULT 0 NOT NULL,
+    retired numeric DEFAULT 0 NOT NULL,
+    block_height bigint NOT NULL
+);
+
+
 --
 -- Name: asset_tags; Type: TABLE; Schema: public; Owner: -
 --
@@ -442,7 +500,8 @@ CREATE TABLE assets (
     signer_id text,
     definition jsonb,
     alias text,
-    first_block_height bigint
+    first_block_height bigint,
+    issuance_cap bigint
 );
 
 
@@ -480,6 +539,31 @@ CREATE TABLE blocks (
 );
 
 
+--
+-- Name: bridge_assets; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE bridge_assets (
+    asset_id text NOT NULL,
+    source_blockchain_id text NOT NULL,
+    source_asset_id text NOT NULL
+);
+
+
+--
+-- Name: bridge_claims; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE bridge_claims (
+    blockchain_id text NOT NULL,
+    tx_hash text NOT NULL,
+    claim_tx_hash text,
+    claimed_at timestamp with time zone DEFAULT now() NOT NULL,
+    claim_tx bytea,
+    claim_height bigint
+);
+
+
 --
 -- Name: chain_id_seq; Type: SEQUENCE; Schema: public; Owner: -
 --
@@ -508,10 +592,126 @@ CREATE TABLE config (
     generator_access_token text DEFAULT ''::text NOT NULL,
     max_issuance_window_ms bigint,
     id text NOT NULL,
+    backup_generators jsonb DEFAULT '[]'::jsonb NOT NULL,
+    failover_timeout_ms bigint DEFAULT 0 NOT NULL,
+    block_policies jsonb DEFAULT '[]'::jsonb NOT NULL,
+    block_period_ms bigint DEFAULT 1000 NOT NULL,
+    make_empty_blocks boolean DEFAULT false NOT NULL,
+    max_idle_interval_ms bigint DEFAULT 0 NOT NULL,
+    max_pending_txs integer DEFAULT 0 NOT NULL,
+    generator_core_id text DEFAULT ''::text NOT NULL,
     CONSTRAINT config_singleton CHECK (singleton)
 );
 
 
+--
+-- Name: config_updates; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE config_updates (
+    id bigint NOT NULL,
+    changes jsonb NOT NULL,
+    request_id text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: config_updates_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE config_updates_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: config_updates_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE config_updates_id_seq OWNED BY config_updates.id;
+
+
+--
+-- Name: consensus_rotations; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE consensus_rotations (
+    height bigint NOT NULL,
+    consensus_program bytea NOT NULL,
+    quorum integer NOT NULL,
+    block_signers jsonb NOT NULL,
+    approvals jsonb DEFAULT '{}'::jsonb NOT NULL,
+    status text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: consolidation_policies; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE consolidation_policies (
+    id text DEFAULT next_chain_id('cpol'::text) NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    max_utxos integer NOT NULL,
+    min_amount bigint DEFAULT 0 NOT NULL,
+    period_ms bigint NOT NULL,
+    paused boolean DEFAULT false NOT NULL,
+    last_run_at timestamp with time zone
+);
+
+
+--
+-- Name: consolidation_runs; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE consolidation_runs (
+    id text DEFAULT next_chain_id('crun'::text) NOT NULL,
+    policy_id text NOT NULL,
+    status text NOT NULL,
+    tx_id text,
+    inputs integer DEFAULT 0 NOT NULL,
+    amount bigint DEFAULT 0 NOT NULL,
+    error text DEFAULT ''::text NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    finished_at timestamp with time zone NOT NULL,
+    template jsonb,
+    submit_height bigint
+);
+
+
+--
+-- Name: coordination_contributions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE coordination_contributions (
+    host_url text NOT NULL,
+    session_id text NOT NULL,
+    template jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: coordination_sessions; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE coordination_sessions (
+    id text DEFAULT next_chain_id('cs'::text) NOT NULL,
+    status text NOT NULL,
+    template jsonb NOT NULL,
+    participants jsonb NOT NULL,
+    tx_id text,
+    error text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
 --
 -- Name: generator_pending_block; Type: TABLE; Schema: public; Owner: -
 --
@@ -532,6 +732,7 @@ CREATE TABLE leader (
     leader_key text NOT NULL,
     expiry timestamp with time zone DEFAULT '1970-01-01 00:00:00-08'::timestamp with time zone NOT NULL,
     address text NOT NULL,
+    term bigint DEFAULT 0 NOT NULL,
     CONSTRAINT leader_singleton CHECK (singleton)
 );
 
@@ -572,6 +773,41 @@ CREATE TABLE mockhsm (
 );
 
 
+--
+-- Name: payment_batches; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE payment_batches (
+    id text NOT NULL,
+    account_id text NOT NULL,
+    tx_id text NOT NULL,
+    template jsonb NOT NULL,
+    submit_height bigint NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: payments; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE payments (
+    id text DEFAULT next_chain_id('pay'::text) NOT NULL,
+    account_id text NOT NULL,
+    asset_id text NOT NULL,
+    amount bigint NOT NULL,
+    control_account_id text,
+    control_program bytea,
+    reference_data jsonb DEFAULT '{}'::jsonb NOT NULL,
+    status text DEFAULT 'pending'::text NOT NULL,
+    tx_id text,
+    error text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    batch_id text,
+    claimed_at timestamp with time zone
+);
+
+
 --
 -- Name: pool_tx_sort_id_seq; Type: SEQUENCE; Schema: public; Owner: -
 --
@@ -584,6 +820,18 @@ CREATE SEQUENCE pool_tx_sort_id_seq
     CACHE 1;
 
 
+--
+-- Name: pending_issuances; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE pending_issuances (
+    asset_id text NOT NULL,
+    nonce bytea NOT NULL,
+    amount bigint NOT NULL,
+    expires_at timestamp with time zone NOT NULL
+);
+
+
 --
 -- Name: pool_txs; Type: TABLE; Schema: public; Owner: -
 --
@@ -627,7 +875,47 @@ CREATE TABLE reservations (
     account_id text,
     expiry timestamp with time zone DEFAULT '1970-01-01 00:00:00-08'::timestamp with time zone NOT NULL,
     change bigint DEFAULT 0 NOT NULL,
-    idempotency_key text
+    idempotency_key text,
+    request_id text DEFAULT ''::text NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: scheduled_tx_runs; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE scheduled_tx_runs (
+    id text DEFAULT next_chain_id('schr'::text) NOT NULL,
+    scheduled_tx_id text NOT NULL,
+    attempt integer NOT NULL,
+    status text NOT NULL,
+    tx_id text,
+    error text DEFAULT ''::text NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    occurrence_at timestamp with time zone,
+    template jsonb,
+    submit_height bigint
+);
+
+
+--
+-- Name: scheduled_txs; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE scheduled_txs (
+    id text DEFAULT next_chain_id('sch'::text) NOT NULL,
+    alias text,
+    actions jsonb NOT NULL,
+    ttl_ms bigint DEFAULT 0 NOT NULL,
+    start_at timestamp with time zone NOT NULL,
+    interval_ms bigint DEFAULT 0 NOT NULL,
+    max_retries integer NOT NULL,
+    status text DEFAULT 'active'::text NOT NULL,
+    next_run_at timestamp with time zone NOT NULL,
+    attempt integer DEFAULT 0 NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    occurrence_at timestamp with time zone NOT NULL
 );
 
 
@@ -641,6 +929,61 @@ CREATE TABLE signed_blocks (
 );
 
 
+--
+-- Name: signer_consensus_approvals; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE signer_consensus_approvals (
+    block_height bigint NOT NULL,
+    consensus_program bytea NOT NULL,
+    approved_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: signer_faults; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE signer_faults (
+    id bigint NOT NULL,
+    pubkey bytea NOT NULL,
+    height bigint NOT NULL,
+    evidence jsonb NOT NULL,
+    detected_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+
+--
+-- Name: signer_faults_id_seq; Type: SEQUENCE; Schema: public; Owner: -
+--
+
+CREATE SEQUENCE signer_faults_id_seq
+    START WITH 1
+    INCREMENT BY 1
+    NO MINVALUE
+    NO MAXVALUE
+    CACHE 1;
+
+
+--
+-- Name: signer_faults_id_seq; Type: SEQUENCE OWNED BY; Schema: public; Owner: -
+--
+
+ALTER SEQUENCE signer_faults_id_seq OWNED BY signer_faults.id;
+
+
+--
+-- Name: signer_generator; Type: TABLE; Schema: public; Owner: -
+--
+
+CREATE TABLE signer_generator (
+    singleton boolean DEFAULT true NOT NULL,
+    rank integer NOT NULL,
+    last_signed_at timestamp with time zone NOT NULL,
+    CONSTRAINT signer_generator_singleton CHECK (singleton)
+);
+
+
 --
 -- Name: signers; Type: TABLE; Schema: public; Owner: -
 --
@@ -708,6 +1051,20 @@ CREATE TABLE txfeeds (
 );
 
 
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY config_updates ALTER COLUMN id SET DEFAULT nextval('config_updates_id_seq'::regclass);
+
+
+--
+-- Name: id; Type: DEFAULT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_faults ALTER COLUMN id SET DEFAULT nextval('signer_faults_id_seq'::regclass);
+
+
 --
 -- Name: key_index; Type: DEFAULT; Schema: public; Owner: -
 --
@@ -723,6 +1080,14 @@ ALTER TABLE ONLY access_tokens
     ADD CONSTRAINT access_tokens_pkey PRIMARY KEY (id);
 
 
+--
+-- Name: account_spending_decisions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY account_spending_decisions
+    ADD CONSTRAINT account_spending_decisions_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: account_tags_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -747,6 +1112,14 @@ ALTER TABLE ONLY accounts
     ADD CONSTRAINT accounts_alias_key UNIQUE (alias);
 
 
+--
+-- Name: active_generator_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY active_generator
+    ADD CONSTRAINT active_generator_pkey PRIMARY KEY (singleton);
+
+
 --
 -- Name: annotated_accounts_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -779,6 +1152,22 @@ ALTER TABLE ONLY annotated_txs
     ADD CONSTRAINT annotated_txs_pkey PRIMARY KEY (block_height, tx_pos);
 
 
+--
+-- Name: asset_definitions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY asset_definitions
+    ADD CONSTRAINT asset_definitions_pkey PRIMARY KEY (asset_id, version);
+
+
+--
+-- Name: asset_supply_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY asset_supply
+    ADD CONSTRAINT asset_supply_pkey PRIMARY KEY (asset_id);
+
+
 --
 -- Name: asset_tags_asset_id_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -835,6 +1224,22 @@ ALTER TABLE ONLY blocks
     ADD CONSTRAINT blocks_pkey PRIMARY KEY (block_hash);
 
 
+--
+-- Name: bridge_assets_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY bridge_assets
+    ADD CONSTRAINT bridge_assets_pkey PRIMARY KEY (asset_id);
+
+
+--
+-- Name: bridge_claims_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY bridge_claims
+    ADD CONSTRAINT bridge_claims_pkey PRIMARY KEY (blockchain_id, tx_hash);
+
+
 --
 -- Name: config_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -843,6 +1248,62 @@ ALTER TABLE ONLY config
     ADD CONSTRAINT config_pkey PRIMARY KEY (singleton);
 
 
+--
+-- Name: config_updates_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY config_updates
+    ADD CONSTRAINT config_updates_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: consensus_rotations_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY consensus_rotations
+    ADD CONSTRAINT consensus_rotations_pkey PRIMARY KEY (height);
+
+
+--
+-- Name: consolidation_policies_account_id_asset_id_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY consolidation_policies
+    ADD CONSTRAINT consolidation_policies_account_id_asset_id_key UNIQUE (account_id, asset_id);
+
+
+--
+-- Name: consolidation_policies_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY consolidation_policies
+    ADD CONSTRAINT consolidation_policies_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: consolidation_runs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY consolidation_runs
+    ADD CONSTRAINT consolidation_runs_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: coordination_contributions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY coordination_contributions
+    ADD CONSTRAINT coordination_contributions_pkey PRIMARY KEY (host_url, session_id);
+
+
+--
+-- Name: coordination_sessions_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY coordination_sessions
+    ADD CONSTRAINT coordination_sessions_pkey PRIMARY KEY (id);
+
+
 --
 -- Name: generator_pending_block_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -883,6 +1344,30 @@ ALTER TABLE ONLY mockhsm
     ADD CONSTRAINT mockhsm_pkey PRIMARY KEY (pub);
 
 
+--
+-- Name: payment_batches_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY payment_batches
+    ADD CONSTRAINT payment_batches_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: payments_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY payments
+    ADD CONSTRAINT payments_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: pending_issuances_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY pending_issuances
+    ADD CONSTRAINT pending_issuances_pkey PRIMARY KEY (asset_id, nonce);
+
+
 --
 -- Name: pool_txs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -923,6 +1408,70 @@ ALTER TABLE ONLY reservations
     ADD CONSTRAINT reservations_pkey PRIMARY KEY (reservation_id);
 
 
+--
+-- Name: scheduled_tx_runs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_tx_runs
+    ADD CONSTRAINT scheduled_tx_runs_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: scheduled_tx_runs_scheduled_tx_id_occurrence_at_attempt_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_tx_runs
+    ADD CONSTRAINT scheduled_tx_runs_scheduled_tx_id_occurrence_at_attempt_key UNIQUE (scheduled_tx_id, occurrence_at, attempt);
+
+
+--
+-- Name: scheduled_txs_alias_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_txs
+    ADD CONSTRAINT scheduled_txs_alias_key UNIQUE (alias);
+
+
+--
+-- Name: scheduled_txs_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY scheduled_txs
+    ADD CONSTRAINT scheduled_txs_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: signer_consensus_approvals_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_consensus_approvals
+    ADD CONSTRAINT signer_consensus_approvals_pkey PRIMARY KEY (block_height);
+
+
+--
+-- Name: signer_faults_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_faults
+    ADD CONSTRAINT signer_faults_pkey PRIMARY KEY (id);
+
+
+--
+-- Name: signer_faults_pubkey_height_key; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_faults
+    ADD CONSTRAINT signer_faults_pubkey_height_key UNIQUE (pubkey, height);
+
+
+--
+-- Name: signer_generator_pkey; Type: CONSTRAINT; Schema: public; Owner: -
+--
+
+ALTER TABLE ONLY signer_generator
+    ADD CONSTRAINT signer_generator_pkey PRIMARY KEY (singleton);
+
+
 --
 -- Name: signers_client_token_key; Type: CONSTRAINT; Schema: public; Owner: -
 --
@@ -994,6 +1543,20 @@ ALTER TABLE ONLY txfeeds
 CREATE INDEX account_control_programs_control_program_idx ON account_control_programs USING btree (control_program);
 
 
+--
+-- Name: account_spending_decisions_account_id_asset_id_created_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX account_spending_decisions_account_id_asset_id_created_at_idx ON account_spending_decisions USING btree (account_id, asset_id, created_at);
+
+
+--
+-- Name: account_spending_decisions_account_id_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX account_spending_decisions_account_id_id_idx ON account_spending_decisions USING btree (account_id, id);
+
+
 --
 -- Name: account_utxos_account_id; Type: INDEX; Schema: public; Owner: -
 --
@@ -1078,6 +1641,27 @@ CREATE INDEX annotated_txs_data ON annotated_txs USING gin (data);
 CREATE INDEX assets_sort_id ON assets USING btree (sort_id);
 
 
+--
+-- Name: consolidation_runs_policy_id_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX consolidation_runs_policy_id_id_idx ON consolidation_runs USING btree (policy_id, id);
+
+
+--
+-- Name: payments_batch_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX payments_batch_id_idx ON payments USING btree (batch_id);
+
+
+--
+-- Name: payments_status_account_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX payments_status_account_id_idx ON payments USING btree (status, account_id);
+
+
 --
 -- Name: query_blocks_timestamp_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -1099,6 +1683,20 @@ CREATE INDEX reservations_asset_id_account_id_idx ON reservations USING btree (a
 CREATE INDEX reservations_expiry ON reservations USING btree (expiry);
 
 
+--
+-- Name: scheduled_tx_runs_scheduled_tx_id_id_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX scheduled_tx_runs_scheduled_tx_id_id_idx ON scheduled_tx_runs USING btree (scheduled_tx_id, id);
+
+
+--
+-- Name: scheduled_txs_status_next_run_at_idx; Type: INDEX; Schema: public; Owner: -
+--
+
+CREATE INDEX scheduled_txs_status_next_run_at_idx ON scheduled_txs USING btree (status, next_run_at);
+
+
 --
 -- Name: signed_blocks_block_height_idx; Type: INDEX; Schema: public; Owner: -
 --
@@ -1128,3 +1726,28 @@ ALTER TABLE ONLY account_utxos
 insert into migrations (filename, hash) values ('2016-10-17.0.core.schema-snapshot.sql', 'cff5210e2d6af410719c223a76443f73c5c12fe875f0efecb9a0a5937cf029cd');
 insert into migrations (filename, hash) values ('2016-10-19.0.core.add-core-id.sql', '9353da072a571d7a633140f2a44b6ac73ffe9e27223f7c653ccdef8df3e8139e');
 insert into migrations (filename, hash) values ('2016-10-31.0.core.add-block-processors.sql', '9e9488e0039337967ef810b09a8f7822e23b3918a49a6308f02db24ddf3e490f');
+insert into migrations (filename, hash) values ('2016-11-01.0.core.add-account-program-templates.sql', 'e6f6eb2f38795b51bba030c28338114b38dc7c1bb15f17ba5bd8cd048d2fe4a0');
+insert into migrations (filename, hash) values ('2016-11-02.0.core.add-asset-definitions.sql', '47f21c29ed7ec2336bc6bf46438e44807a0a9e3da4536c517752fcaebe1647a5');
+insert into migrations (filename, hash) values ('2016-11-03.0.core.add-account-coin-selection.sql', '80af47e7c0d30863930e49bf0242209bbba6003ae5205a43a191c8b50961e268');
+insert into migrations (filename, hash) values ('2016-11-04.0.core.add-consolidation.sql', '39d1ab83ff2f843ebfa4a6e349c00d6bc31db8597b554e07e539ae5a6c497f58');
+insert into migrations (filename, hash) values ('2016-11-05.0.core.add-payments.sql', '87e0da2ed4e35daaec2e51808d72fbd4497d5daf260ac504f9a2b9ae73b2c9fb');
+insert into migrations (filename, hash) values ('2016-11-06.0.core.add-scheduled-txs.sql', 'a8fca018418bde4fb301189a9bbe0a0e4218614c311b6e0ef128f2d890418935');
+insert into migrations (filename, hash) values ('2016-11-07.0.core.add-account-spending-policies.sql', '649f9ddd8f15bcf9243d2579ee33a93bd034519db77d7d71cee1895ab812324a');
+insert into migrations (filename, hash) values ('2016-11-08.0.core.add-coordination-sessions.sql', '5dca89911cff373362f94a549058f56669cf0149c674e20a0cc9132d5079a16a');
+insert into migrations (filename, hash) values ('2016-11-09.0.core.add-reservation-metadata.sql', '76c905f17403dc6fc3852ce0283ffa9b9edc3fa7bf67e06acd55ca014c8c1cd8');
+insert into migrations (filename, hash) values ('2016-11-10.0.core.add-leader-term.sql', '4a3bb8676fc615922c1c14c9755ffa905e80667f93c25b3177f234f000fc76ea');
+insert into migrations (filename, hash) values ('2016-11-11.0.core.add-consensus-rotations.sql', '17b7eb4a95e6bae12ba88bdb0f4e8a66b1695545fdf0e326a378a4629ad0d092');
+insert into migrations (filename, hash) values ('2016-11-12.0.core.add-config-updates.sql', 'aa5ad798933a2931b0cc505106241e6e6719e82bc8a46289c9f36796ef73f911');
+insert into migrations (filename, hash) values ('2016-11-13.0.core.add-signer-faults.sql', '1f7051ce7a663b89bea66d418ceaf4f650f2340484b8f62b5abbf4ae168d2456');
+insert into migrations (filename, hash) values ('2016-11-14.0.core.add-generator-failover.sql', '8295d29d599068f05a2ee6615cd75c874bdcbd54f4a8ddf627451ab20c2a11fd');
+insert into migrations (filename, hash) values ('2016-11-15.0.core.add-block-policies.sql', '5918c159a7d31f4fbdced8b66ef14e79c3a0605e68fd4061c93aecba4ce28a3b');
+insert into migrations (filename, hash) values ('2016-11-16.0.core.add-block-schedule.sql', '124806f3b4f236412adc1e13e0ee298eb393378998f5e6b14e113b088025f9a1');
+insert into migrations (filename, hash) values ('2016-11-17.0.core.add-asset-supply.sql', '19f0dff9eb44f45a03cbecf0ce4893ee38fc55e3630d28472dad8663a5a375d5');
+insert into migrations (filename, hash) values ('2016-11-18.0.core.add-bridge.sql', '1052e2b4187e0bf0e1060a23f0fb87c4befa23ebec9aa840d8dc03aa20206ef4');
+insert into migrations (filename, hash) values ('2016-11-19.0.core.add-payment-batches.sql', '405b800f39bc48df75ea2adde27ffb9888d498fb50bc16dae57b3dcfd15dc94b');
+insert into migrations (filename, hash) values ('2016-11-19.1.core.add-scheduled-tx-run-claims.sql', '9f8031908e7a59847222c5cf54d51f04f6719125b11f504ba4e54c1cbb1d7821');
+insert into migrations (filename, hash) values ('2016-11-19.2.core.add-coordination-contributions.sql', '11d8574dffaab2959db23394ff6910e26425926e13193878e32307b84d99da2d');
+insert into migrations (filename, hash) values ('2016-11-20.0.core.add-active-generator.sql', '27bf31ed9a1decd08e2caed508710a178cf5d4a4fabf3fdd51eef2ceea53cd63');
+insert into migrations (filename, hash) values ('2016-11-20.1.core.add-pending-issuances.sql', '44f4c0da995fd103341f492c99bdb60a346edf31e0153df4c77d83c9bff3837a');
+insert into migrations (filename, hash) values ('2016-11-20.2.core.add-consolidation-run-templates.sql', 'af02c5684e5827ee01fe970cfc05cdf45db5e3d26f0193c3d5ef3f39da62837b');
+insert into migrations (filename, hash) values ('2016-11-20.3.core.add-bridge-claim-txs.sql', '2e6fec83d66006d21344e389c7344d781d49c8d4b6f51a7a862c5d9ae6981b44');
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"context"
+	"strconv"
+
+	"chain/core/signerfault"
+	"chain/errors"
+	"chain/net/http/httpjson"
+	"chain/protocol/vmutil"
+)
+
+// POST /list-signer-faults
+//
+// listSignerFaults lists the evidence, found by this Core or
+// reported to it, of block signers signing conflicting blocks.
+func (h *Handler) listSignerFaults(ctx context.Context, in struct {
+	After string `json:"after"`
+}) (interface{}, error) {
+	var before int64
+	if in.After != "" {
+		var err error
+		before, err = strconv.ParseInt(in.After, 10, 64)
+		if err != nil {
+			return nil, errors.WithDetailf(httpjson.ErrBadRequest, "invalid after value %q", in.After)
+		}
+	}
+	limit := defGenericPageSize
+	faults, err := signerfault.List(ctx, h.DB, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	next := in
+	if len(faults) > 0 {
+		next.After = strconv.FormatInt(faults[len(faults)-1].ID, 10)
+	}
+	// This type enforces JSON field ordering in API output.
+	return struct {
+		Items    interface{} `json:"items"`
+		Next     interface{} `json:"next"`
+		LastPage bool        `json:"last_page"`
+	}{httpjson.Array(faults), next, len(faults) < limit}, nil
+}
+
+// reportSignerFaultRPC accepts evidence of a signer fault found by
+// another Core, typically a participant fetching blocks from this
+// one. The evidence is saved only if it checks out against the
+// consensus program in effect at its height.
+func (h *Handler) reportSignerFaultRPC(ctx context.Context, f *signerfault.Fault) error {
+	if f.Height < 2 || f.Height > h.Chain.Height()+1 {
+		return errors.WithDetailf(signerfault.ErrBadEvidence, "no signers known for height %d", f.Height)
+	}
+	parent, err := h.Chain.GetBlock(ctx, f.Height-1)
+	if err != nil {
+		return errors.Wrap(err, "getting block")
+	}
+	keys, _, err := vmutil.ParseBlockMultiSigProgram(parent.ConsensusProgram)
+	if err != nil {
+		return errors.Wrap(err, "parsing consensus program")
+	}
+	err = f.Verify(keys)
+	if err != nil {
+		return err
+	}
+	err = signerfault.Save(ctx, h.DB, f)
+	if err != nil {
+		return err
+	}
+	h.setHealth("signer_faults", signerfault.Health(ctx, h.DB))
+	return nil
+}
@@ -0,0 +1,205 @@
+// Package signerfault collects cryptographic evidence of block
+// signers that sign two different blocks at the same height.
+//
+// An honest signer never does this (see blocksigner's
+// lockBlockHeight), so the evidence proves that the signer's
+// operator, or whoever has its key, misbehaved.
+package signerfault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"chain/crypto/ed25519"
+	"chain/database/pg"
+	"chain/database/sql"
+	chainjson "chain/encoding/json"
+	"chain/errors"
+	"chain/log"
+	"chain/protocol/bc"
+)
+
+var (
+	// ErrEquivocation is the health error reported once a signer
+	// fault is found.
+	ErrEquivocation = errors.New("block signer signed conflicting blocks")
+
+	// ErrBadEvidence is returned by Verify for a fault whose
+	// evidence doesn't prove that the signer equivocated.
+	ErrBadEvidence = errors.New("invalid signer fault evidence")
+)
+
+// A SignedHeader is a block header, including its witness, with the
+// faulty signer's signature on it.
+type SignedHeader struct {
+	BlockHash bc.Hash            `json:"block_hash"`
+	Header    chainjson.HexBytes `json:"block_header"`
+	Signature chainjson.HexBytes `json:"signature"`
+}
+
+// A Fault is proof that the block signer with Pubkey signed two
+// different blocks at Height. Anyone who knows the signer's public
+// key can check it with Verify.
+type Fault struct {
+	ID         int64              `json:"id"`
+	Pubkey     chainjson.HexBytes `json:"pubkey"`
+	Height     uint64             `json:"height"`
+	Evidence   [2]SignedHeader    `json:"evidence"`
+	DetectedAt time.Time          `json:"detected_at"`
+}
+
+// Detect returns a fault for each of keys that signed both a and b,
+// two block headers at the same height.
+func Detect(keys []ed25519.PublicKey, a, b *bc.BlockHeader) ([]*Fault, error) {
+	if a.Height != b.Height {
+		return nil, nil
+	}
+	hashA, hashB := a.HashForSig(), b.HashForSig()
+	if hashA == hashB {
+		return nil, nil
+	}
+	var faults []*Fault
+	for _, k := range keys {
+		sigA := findSig(k, hashA, a.Witness)
+		sigB := findSig(k, hashB, b.Witness)
+		if sigA == nil || sigB == nil {
+			continue
+		}
+		shA, err := signedHeader(a, sigA)
+		if err != nil {
+			return nil, err
+		}
+		shB, err := signedHeader(b, sigB)
+		if err != nil {
+			return nil, err
+		}
+		faults = append(faults, &Fault{
+			Pubkey:   chainjson.HexBytes(k),
+			Height:   a.Height,
+			Evidence: [2]SignedHeader{shA, shB},
+		})
+	}
+	return faults, nil
+}
+
+func findSig(key ed25519.PublicKey, hash bc.Hash, sigs [][]byte) []byte {
+	for _, sig := range sigs {
+		if ed25519.Verify(key, hash[:], sig) {
+			return sig
+		}
+	}
+	return nil
+}
+
+func signedHeader(bh *bc.BlockHeader, sig []byte) (SignedHeader, error) {
+	raw, err := bh.Value()
+	if err != nil {
+		return SignedHeader{}, errors.Wrap(err, "serializing block header")
+	}
+	return SignedHeader{
+		BlockHash: bh.Hash(),
+		Header:    raw.([]byte),
+		Signature: sig,
+	}, nil
+}
+
+// Verify checks that f proves its signer signed two different
+// blocks at its height, and that the signer is one of keys.
+func (f *Fault) Verify(keys []ed25519.PublicKey) error {
+	var known bool
+	for _, k := range keys {
+		if bytes.Equal(k, f.Pubkey) {
+			known = true
+			break
+		}
+	}
+	if !known || len(f.Pubkey) != ed25519.PublicKeySize {
+		return errors.WithDetailf(ErrBadEvidence, "unknown signer %x", []byte(f.Pubkey))
+	}
+
+	var hashes [2]bc.Hash
+	for i, sh := range f.Evidence {
+		var bh bc.BlockHeader
+		err := bh.Scan([]byte(sh.Header))
+		if err != nil {
+			return errors.WithDetailf(ErrBadEvidence, "block header %d: %s", i, err)
+		}
+		if bh.Height != f.Height {
+			return errors.WithDetailf(ErrBadEvidence, "block header %d has height %d, not %d", i, bh.Height, f.Height)
+		}
+		hashes[i] = bh.HashForSig()
+		if !ed25519.Verify(ed25519.PublicKey(f.Pubkey), hashes[i][:], sh.Signature) {
+			return errors.WithDetailf(ErrBadEvidence, "bad signature on block header %d", i)
+		}
+	}
+	if hashes[0] == hashes[1] {
+		return errors.WithDetail(ErrBadEvidence, "block headers are the same")
+	}
+	return nil
+}
+
+// Save stores f, unless there is already a fault for its signer and
+// height. It logs each new fault.
+func Save(ctx context.Context, db pg.DB, f *Fault) error {
+	evidence, err := json.Marshal(f.Evidence)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	const q = `
+		INSERT INTO signer_faults (pubkey, height, evidence) VALUES ($1, $2, $3)
+		ON CONFLICT (pubkey, height) DO NOTHING
+		RETURNING id, detected_at
+	`
+	err = db.QueryRow(ctx, q, []byte(f.Pubkey), f.Height, evidence).Scan(&f.ID, &f.DetectedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "saving signer fault")
+	}
+	log.Write(ctx,
+		"at", "signer fault",
+		"pubkey", f.Pubkey,
+		"height", f.Height,
+		"blocks", []bc.Hash{f.Evidence[0].BlockHash, f.Evidence[1].BlockHash},
+	)
+	return nil
+}
+
+// List returns up to limit signer faults, most recently detected
+// first, starting before the fault with ID before if it is positive.
+func List(ctx context.Context, db pg.DB, before int64, limit int) ([]*Fault, error) {
+	const q = `
+		SELECT id, pubkey, height, evidence, detected_at FROM signer_faults
+		WHERE ($1 <= 0 OR id < $1)
+		ORDER BY id DESC
+		LIMIT $2
+	`
+	var faults []*Fault
+	err := pg.ForQueryRows(ctx, db, q, before, limit, func(id int64, pubkey []byte, height uint64, evidence []byte, detectedAt time.Time) error {
+		f := &Fault{ID: id, Pubkey: pubkey, Height: height, DetectedAt: detectedAt}
+		err := json.Unmarshal(evidence, &f.Evidence)
+		if err != nil {
+			return errors.Wrap(err, "decoding evidence")
+		}
+		faults = append(faults, f)
+		return nil
+	})
+	return faults, errors.Wrap(err, "querying signer faults")
+}
+
+// Health returns ErrEquivocation if any signer faults have been
+// found, and nil otherwise.
+func Health(ctx context.Context, db pg.DB) error {
+	const q = `SELECT COUNT(*) FROM signer_faults`
+	var n int
+	err := db.QueryRow(ctx, q).Scan(&n)
+	if err != nil {
+		return errors.Wrap(err, "counting signer faults")
+	}
+	if n == 0 {
+		return nil
+	}
+	return errors.Wrapf(ErrEquivocation, "%d signer faults found; see /list-signer-faults", n)
+}
@@ -0,0 +1,77 @@
+package signerfault
+
+import (
+	"bytes"
+	"testing"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/testutil"
+)
+
+func TestDetect(t *testing.T) {
+	pub1, priv1, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	pub2, priv2, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	keys := []ed25519.PublicKey{pub1, pub2}
+
+	a := &bc.BlockHeader{Height: 5, TimestampMS: 1000}
+	b := &bc.BlockHeader{Height: 5, TimestampMS: 2000}
+	sign(a, priv1, priv2)
+	sign(b, priv2)
+
+	faults, err := Detect(keys, a, b)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	if len(faults) != 1 {
+		t.Fatalf("got %d faults want 1", len(faults))
+	}
+	f := faults[0]
+	if !bytes.Equal(f.Pubkey, pub2) {
+		t.Errorf("fault pubkey = %x want %x", []byte(f.Pubkey), []byte(pub2))
+	}
+	if f.Evidence[0].BlockHash != a.Hash() || f.Evidence[1].BlockHash != b.Hash() {
+		t.Errorf("evidence block hashes = %x, %x want %x, %x", f.Evidence[0].BlockHash, f.Evidence[1].BlockHash, a.Hash(), b.Hash())
+	}
+
+	err = f.Verify(keys)
+	if err != nil {
+		t.Errorf("Verify() = %v want nil", err)
+	}
+	err = f.Verify([]ed25519.PublicKey{pub1})
+	if errors.Root(err) != ErrBadEvidence {
+		t.Errorf("Verify(unknown signer) = %v want %v", err, ErrBadEvidence)
+	}
+	f.Evidence[1] = f.Evidence[0]
+	err = f.Verify(keys)
+	if errors.Root(err) != ErrBadEvidence {
+		t.Errorf("Verify(same header) = %v want %v", err, ErrBadEvidence)
+	}
+
+	// The same block, or blocks at different heights, aren't evidence.
+	c := &bc.BlockHeader{Height: 6, TimestampMS: 1000}
+	sign(c, priv1, priv2)
+	for _, other := range []*bc.BlockHeader{a, c} {
+		faults, err = Detect(keys, a, other)
+		if err != nil {
+			testutil.FatalErr(t, err)
+		}
+		if len(faults) != 0 {
+			t.Errorf("Detect(height %d) got %d faults want 0", other.Height, len(faults))
+		}
+	}
+}
+
+func sign(bh *bc.BlockHeader, privs ...ed25519.PrivateKey) {
+	hash := bh.HashForSig()
+	for _, priv := range privs {
+		bh.Witness = append(bh.Witness, ed25519.Sign(priv, hash[:]))
+	}
+}
@@ -24,6 +24,10 @@ func (h *Handler) buildSingle(ctx context.Context, req *buildRequest) (*txbuilde
 	if err != nil {
 		return nil, err
 	}
+	err = h.parseDecimalAmounts(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 	actions := make([]txbuilder.Action, 0, len(req.Actions))
 	for i, act := range req.Actions {
 		typ, ok := act["type"].(string)
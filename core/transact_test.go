@@ -24,7 +24,7 @@ func TestLocalAccountTransfer(t *testing.T) {
 	accounts := account.NewManager(db, c)
 	h := &Handler{Assets: assets, Accounts: accounts, DB: db, Chain: c}
 
-	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil)
+	acc, err := accounts.Create(ctx, []string{testutil.TestXPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
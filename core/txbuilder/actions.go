@@ -7,6 +7,7 @@ import (
 
 	"chain/encoding/json"
 	"chain/protocol/bc"
+	"chain/protocol/vmutil"
 )
 
 func DecodeControlProgramAction(data []byte) (Action, error) {
@@ -15,6 +16,12 @@ func DecodeControlProgramAction(data []byte) (Action, error) {
 	return a, err
 }
 
+// NewControlProgramAction returns an action that pays amt to the
+// given control program.
+func NewControlProgramAction(amt bc.AssetAmount, program []byte, refData json.Map) Action {
+	return &controlProgramAction{AssetAmount: amt, Program: program, ReferenceData: refData}
+}
+
 type controlProgramAction struct {
 	bc.AssetAmount
 	Program       json.HexBytes `json:"control_program"`
@@ -26,6 +33,38 @@ func (c *controlProgramAction) Build(ctx context.Context, maxTime time.Time) (*B
 	return &BuildResult{Outputs: []*bc.TxOutput{out}}, nil
 }
 
+func DecodeRetireAction(data []byte) (Action, error) {
+	a := new(retireAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+// NewRetireAction returns an action that retires amt,
+// paying it to the canonical unspendable control program.
+func NewRetireAction(amt bc.AssetAmount, refData json.Map) Action {
+	return &retireAction{AssetAmount: amt, ReferenceData: refData}
+}
+
+type retireAction struct {
+	bc.AssetAmount
+	ReferenceData json.Map `json:"reference_data"`
+}
+
+func (a *retireAction) Build(ctx context.Context, maxTime time.Time) (*BuildResult, error) {
+	var missing []string
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if a.Amount == 0 {
+		missing = append(missing, "amount")
+	}
+	if len(missing) > 0 {
+		return nil, MissingFieldsError(missing...)
+	}
+	out := bc.NewTxOutput(a.AssetID, a.Amount, vmutil.RetireProgram(), a.ReferenceData)
+	return &BuildResult{Outputs: []*bc.TxOutput{out}}, nil
+}
+
 func DecodeSetTxRefDataAction(data []byte) (Action, error) {
 	a := new(setTxRefDataAction)
 	err := stdjson.Unmarshal(data, a)
@@ -0,0 +1,43 @@
+package txbuilder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vmutil"
+)
+
+func TestRetireAction(t *testing.T) {
+	ctx := context.Background()
+	maxTime := time.Now().Add(time.Minute)
+
+	a, err := DecodeRetireAction([]byte(`{"asset_id":"0100000000000000000000000000000000000000000000000000000000000000","amount":5,"reference_data":{"redeem":"ref-123"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := a.Build(ctx, maxTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Outputs) != 1 {
+		t.Fatalf("got %d outputs want 1", len(res.Outputs))
+	}
+	out := res.Outputs[0]
+	if out.AssetID != (bc.AssetID{1}) || out.Amount != 5 {
+		t.Errorf("got output of %d units of %s, want 5 units of %s", out.Amount, out.AssetID, bc.AssetID{1})
+	}
+	if !vmutil.IsUnspendable(out.ControlProgram) {
+		t.Errorf("retire output control program %x is spendable", out.ControlProgram)
+	}
+	if len(out.ReferenceData) == 0 {
+		t.Error("retire output has no reference data")
+	}
+
+	_, err = NewRetireAction(bc.AssetAmount{}, nil).Build(ctx, maxTime)
+	if errors.Root(err) != ErrMissingFields {
+		t.Errorf("got error %v want %v", err, ErrMissingFields)
+	}
+}
@@ -0,0 +1,141 @@
+package txbuilder
+
+import (
+	"chain/encoding/json"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+)
+
+// A Commitment is one condition that a signature program imposes on
+// the transaction it signs.
+type Commitment struct {
+	// Type is one of "txsighash", "min_time", "max_time", "outpoint",
+	// "transaction_reference_data", "input_reference_data", "output",
+	// or "unrecognized".
+	Type string `json:"type"`
+
+	Hash              *bc.Hash      `json:"hash,omitempty"`
+	TimeMS            uint64        `json:"time_ms,omitempty"`
+	Outpoint          *bc.Outpoint  `json:"outpoint,omitempty"`
+	Position          *int          `json:"position,omitempty"`
+	AssetID           *bc.AssetID   `json:"asset_id,omitempty"`
+	Amount            *uint64       `json:"amount,omitempty"`
+	ControlProgram    json.HexBytes `json:"control_program,omitempty"`
+	ReferenceDataHash *bc.Hash      `json:"reference_data_hash,omitempty"`
+	Program           json.HexBytes `json:"program,omitempty"`
+}
+
+// ParseCommitments reports the conditions committed to by a signature
+// program built by this package. It recognizes a txsighash program
+// (committing to the whole transaction) and each kind of constraint
+// used when additional actions are allowed. Any remainder of the
+// program it does not recognize is reported in a single commitment
+// of type "unrecognized".
+func ParseCommitments(prog []byte) []Commitment {
+	insts, err := vm.ParseProgram(prog)
+	if err != nil {
+		return []Commitment{{Type: "unrecognized", Program: prog}}
+	}
+
+	var (
+		res []Commitment
+		pc  uint32 // byte offset of insts[0] in prog
+	)
+	for len(insts) > 0 {
+		c, n := parseCommitment(insts)
+		if n == 0 && (insts[0].Op == vm.OP_VERIFY || insts[0].Op == vm.OP_TRUE) {
+			// Constraints are joined by OP_VERIFY, and an empty
+			// time constraint is just OP_TRUE.
+			pc += insts[0].Len
+			insts = insts[1:]
+			continue
+		}
+		if n == 0 {
+			res = append(res, Commitment{Type: "unrecognized", Program: prog[pc:]})
+			break
+		}
+		res = append(res, c)
+		for _, inst := range insts[:n] {
+			pc += inst.Len
+		}
+		insts = insts[n:]
+	}
+	return res
+}
+
+// parseCommitment recognizes the constraint at the beginning of
+// insts. It returns the number of instructions consumed, or 0 if it
+// recognizes none.
+func parseCommitment(insts []vm.Instruction) (Commitment, int) {
+	match := func(ops ...vm.Op) bool {
+		if len(insts) < len(ops) {
+			return false
+		}
+		for i, op := range ops {
+			if op == opPush {
+				if !isPush(insts[i]) {
+					return false
+				}
+			} else if insts[i].Op != op {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case match(opPush, vm.OP_TXSIGHASH, vm.OP_EQUAL):
+		return Commitment{Type: "txsighash", Hash: hashData(insts[0].Data)}, 3
+	case match(vm.OP_MINTIME, opPush, vm.OP_GREATERTHANOREQUAL):
+		n, _ := vm.AsInt64(insts[1].Data)
+		return Commitment{Type: "min_time", TimeMS: uint64(n)}, 3
+	case match(vm.OP_MAXTIME, opPush, vm.OP_LESSTHANOREQUAL):
+		n, _ := vm.AsInt64(insts[1].Data)
+		return Commitment{Type: "max_time", TimeMS: uint64(n)}, 3
+	case match(opPush, opPush, vm.OP_OUTPOINT, vm.OP_ROT, vm.OP_NUMEQUAL, vm.OP_VERIFY, vm.OP_EQUAL):
+		o := new(bc.Outpoint)
+		copy(o.Hash[:], insts[0].Data)
+		n, _ := vm.AsInt64(insts[1].Data)
+		o.Index = uint32(n)
+		return Commitment{Type: "outpoint", Outpoint: o}, 7
+	case match(opPush, vm.OP_TXREFDATAHASH, vm.OP_EQUAL):
+		return Commitment{Type: "transaction_reference_data", Hash: hashData(insts[0].Data)}, 3
+	case match(opPush, vm.OP_REFDATAHASH, vm.OP_EQUAL):
+		return Commitment{Type: "input_reference_data", Hash: hashData(insts[0].Data)}, 3
+	case match(opPush, opPush, opPush, opPush, opPush, opPush, vm.OP_CHECKOUTPUT):
+		index, _ := vm.AsInt64(insts[0].Data)
+		amount, _ := vm.AsInt64(insts[2].Data)
+		var (
+			pos     = int(index)
+			amt     = uint64(amount)
+			assetID bc.AssetID
+		)
+		copy(assetID[:], insts[3].Data)
+		c := Commitment{
+			Type:           "output",
+			Position:       &pos,
+			AssetID:        &assetID,
+			Amount:         &amt,
+			ControlProgram: insts[5].Data,
+		}
+		if len(insts[1].Data) > 0 {
+			c.ReferenceDataHash = hashData(insts[1].Data)
+		}
+		return c, 7
+	}
+	return Commitment{}, 0
+}
+
+// opPush matches any data-pushing instruction in parseCommitment.
+// OP_NOP is otherwise never produced by this package.
+const opPush = vm.OP_NOP
+
+func isPush(inst vm.Instruction) bool {
+	return inst.Op <= vm.OP_PUSHDATA4 || (inst.Op >= vm.OP_1 && inst.Op <= vm.OP_16)
+}
+
+func hashData(data []byte) *bc.Hash {
+	var h bc.Hash
+	copy(h[:], data)
+	return &h
+}
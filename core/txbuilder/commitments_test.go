@@ -0,0 +1,64 @@
+package txbuilder
+
+import (
+	"reflect"
+	"testing"
+
+	"chain/crypto/sha3pool"
+	"chain/protocol/bc"
+)
+
+func TestParseCommitments(t *testing.T) {
+	tpl := &Template{
+		Transaction: &bc.TxData{
+			Version: 1,
+			MinTime: 5,
+			MaxTime: 10,
+			Inputs: []*bc.TxInput{
+				bc.NewSpendInput(bc.Hash{1}, 3, nil, bc.AssetID{2}, 7, nil, []byte("in")),
+			},
+			Outputs: []*bc.TxOutput{
+				bc.NewTxOutput(bc.AssetID{2}, 4, []byte{0x51}, nil),
+				bc.NewTxOutput(bc.AssetID{2}, 3, []byte{0x52}, []byte("out")),
+			},
+		},
+		AllowAdditional: true,
+	}
+
+	var (
+		got       = ParseCommitments(buildSigProgram(tpl, 0))
+		pos0      = 0
+		pos1      = 1
+		amt4      = uint64(4)
+		amt3      = uint64(3)
+		assetID   = bc.AssetID{2}
+		inRefHash bc.Hash
+		outRef    bc.Hash
+	)
+	sha3pool.Sum256(inRefHash[:], []byte("in"))
+	sha3pool.Sum256(outRef[:], []byte("out"))
+	want := []Commitment{
+		{Type: "min_time", TimeMS: 5},
+		{Type: "max_time", TimeMS: 10},
+		{Type: "outpoint", Outpoint: &bc.Outpoint{Hash: bc.Hash{1}, Index: 3}},
+		{Type: "input_reference_data", Hash: &inRefHash},
+		{Type: "output", Position: &pos0, AssetID: &assetID, Amount: &amt4, ControlProgram: []byte{0x51}},
+		{Type: "output", Position: &pos1, AssetID: &assetID, Amount: &amt3, ControlProgram: []byte{0x52}, ReferenceDataHash: &outRef},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCommitments(constraints) =\n%+v\nwant\n%+v", got, want)
+	}
+
+	tpl.AllowAdditional = false
+	got = ParseCommitments(buildSigProgram(tpl, 0))
+	h := tpl.Hash(0)
+	want = []Commitment{{Type: "txsighash", Hash: &h}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseCommitments(txsighash) = %+v want %+v", got, want)
+	}
+
+	got = ParseCommitments([]byte{0xff})
+	if len(got) != 1 || got[0].Type != "unrecognized" {
+		t.Errorf("ParseCommitments(garbage) = %+v want one unrecognized commitment", got)
+	}
+}
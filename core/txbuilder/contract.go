@@ -0,0 +1,211 @@
+package txbuilder
+
+import (
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+
+	"chain/crypto/ed25519"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+var ErrBadContract = errors.New("invalid contract")
+
+// Contract describes a contract program to be built from one of the
+// templates in vmutil.
+type Contract struct {
+	// Type is one of "hash_lock", "time_lock", "htlc" or
+	// "multisig_refund".
+	Type string `json:"type"`
+
+	Pubkeys []json.HexBytes `json:"pubkeys"`
+	Quorum  int             `json:"quorum"`
+
+	// Hash is the SHA3-256 hash of the secret preimage, for
+	// "hash_lock" and "htlc".
+	Hash json.HexBytes `json:"hash"`
+
+	// NotBefore and NotAfter bound the spending window of a
+	// "time_lock", in milliseconds since the epoch.
+	NotBefore uint64 `json:"not_before"`
+	NotAfter  uint64 `json:"not_after"`
+
+	// Timeout is the time, in milliseconds since the epoch, from
+	// which an "htlc" or "multisig_refund" can be reclaimed by
+	// RefundPubkeys.
+	Timeout       uint64          `json:"timeout"`
+	RefundPubkeys []json.HexBytes `json:"refund_pubkeys"`
+	RefundQuorum  int             `json:"refund_quorum"`
+}
+
+// Program returns the control program for c.
+func (c *Contract) Program() ([]byte, error) {
+	var (
+		prog []byte
+		err  error
+	)
+	switch c.Type {
+	case "hash_lock":
+		prog, err = vmutil.HashLockProgram(c.Hash, pubkeys(c.Pubkeys), c.Quorum)
+	case "time_lock":
+		prog, err = vmutil.TimeLockProgram(c.NotBefore, c.NotAfter, pubkeys(c.Pubkeys), c.Quorum)
+	case "htlc":
+		prog, err = vmutil.HTLCProgram(c.Hash, pubkeys(c.Pubkeys), c.Quorum, c.Timeout, pubkeys(c.RefundPubkeys), c.RefundQuorum)
+	case "multisig_refund":
+		prog, err = vmutil.MultiSigRefundProgram(pubkeys(c.Pubkeys), c.Quorum, c.Timeout, pubkeys(c.RefundPubkeys), c.RefundQuorum)
+	default:
+		return nil, errors.WithDetailf(ErrBadContract, "unknown contract type %q", c.Type)
+	}
+	if err != nil {
+		return nil, errors.WithDetail(ErrBadContract, errors.Detail(err))
+	}
+	return prog, nil
+}
+
+func pubkeys(keys []json.HexBytes) []ed25519.PublicKey {
+	res := make([]ed25519.PublicKey, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, ed25519.PublicKey(k))
+	}
+	return res
+}
+
+func DecodeControlContractAction(data []byte) (Action, error) {
+	a := new(controlContractAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+type controlContractAction struct {
+	bc.AssetAmount
+	Contract      *Contract `json:"contract"`
+	ReferenceData json.Map  `json:"reference_data"`
+}
+
+func (a *controlContractAction) Build(ctx context.Context, maxTime time.Time) (*BuildResult, error) {
+	var missing []string
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if a.Contract == nil {
+		missing = append(missing, "contract")
+	}
+	if len(missing) > 0 {
+		return nil, MissingFieldsError(missing...)
+	}
+	prog, err := a.Contract.Program()
+	if err != nil {
+		return nil, err
+	}
+	out := bc.NewTxOutput(a.AssetID, a.Amount, prog, a.ReferenceData)
+	return &BuildResult{Outputs: []*bc.TxOutput{out}}, nil
+}
+
+func DecodeSpendContractAction(data []byte) (Action, error) {
+	a := new(spendContractAction)
+	err := stdjson.Unmarshal(data, a)
+	return a, err
+}
+
+// spendContractAction spends an output locked by one of the contract
+// templates. The caller supplies the output itself, since contract
+// outputs are not tracked by any account.
+type spendContractAction struct {
+	TxHash *bc.Hash `json:"transaction_id"`
+	TxOut  *uint32  `json:"position"`
+	bc.AssetAmount
+	Program json.HexBytes `json:"control_program"`
+
+	// Refund selects the refund branch of an "htlc" or
+	// "multisig_refund" contract.
+	Refund bool `json:"refund"`
+
+	// Preimage is the secret for a "hash_lock" or the redeem branch
+	// of an "htlc".
+	Preimage json.HexBytes `json:"preimage"`
+
+	// Keys identify the keys that will sign for the chosen branch.
+	Keys []KeyID `json:"keys"`
+
+	ReferenceData json.Map `json:"reference_data"`
+}
+
+func (a *spendContractAction) Build(ctx context.Context, maxTime time.Time) (*BuildResult, error) {
+	var missing []string
+	if a.TxHash == nil {
+		missing = append(missing, "transaction_id")
+	}
+	if a.TxOut == nil {
+		missing = append(missing, "position")
+	}
+	if a.AssetID == (bc.AssetID{}) {
+		missing = append(missing, "asset_id")
+	}
+	if len(a.Program) == 0 {
+		missing = append(missing, "control_program")
+	}
+	if len(missing) > 0 {
+		return nil, MissingFieldsError(missing...)
+	}
+
+	branch, selector, err := contractBranch(a.Program, a.Refund)
+	if err != nil {
+		return nil, err
+	}
+	if branch.Hash != nil {
+		h := sha3.Sum256(a.Preimage)
+		if !bytes.Equal(h[:], branch.Hash) {
+			return nil, errors.WithDetail(ErrBadContract, "preimage does not match contract hash")
+		}
+	}
+
+	in := bc.NewSpendInput(*a.TxHash, *a.TxOut, nil, a.AssetID, a.Amount, a.Program, a.ReferenceData)
+	sigInst := &SigningInstruction{AssetAmount: a.AssetAmount}
+	sigInst.AddWitnessKeys(a.Keys, branch.Quorum)
+	if branch.Hash != nil {
+		sigInst.WitnessComponents = append(sigInst.WitnessComponents, DataWitness(a.Preimage))
+	}
+	if selector != nil {
+		sigInst.WitnessComponents = append(sigInst.WitnessComponents, DataWitness(selector))
+	}
+
+	return &BuildResult{
+		Inputs:              []*bc.TxInput{in},
+		SigningInstructions: []*SigningInstruction{sigInst},
+		MinTimeMS:           branch.NotBefore,
+		MaxTimeMS:           branch.NotAfter,
+	}, nil
+}
+
+// contractBranch parses prog and returns the branch to be spent,
+// along with the selector argument for two-branch programs (nil
+// otherwise).
+func contractBranch(prog []byte, refund bool) (b vmutil.Branch, selector []byte, err error) {
+	main, alt, err := vmutil.ParseTwoBranchProgram(prog)
+	if err != nil {
+		if refund {
+			return b, nil, errors.WithDetail(ErrBadContract, "contract has no refund branch")
+		}
+		b, err = vmutil.ParseBranchProgram(prog)
+		if err != nil {
+			return b, nil, errors.WithDetail(ErrBadContract, errors.Detail(err))
+		}
+		return b, nil, nil
+	}
+	branchProg := main
+	if refund {
+		branchProg = alt
+	}
+	b, err = vmutil.ParseBranchProgram(branchProg)
+	if err != nil {
+		return b, nil, errors.WithDetail(ErrBadContract, errors.Detail(err))
+	}
+	return b, vm.BoolBytes(refund), nil
+}
@@ -0,0 +1,94 @@
+package txbuilder
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+
+	"chain/crypto/ed25519"
+	"chain/encoding/json"
+	"chain/errors"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+	"chain/protocol/vmutil"
+)
+
+func TestContractActions(t *testing.T) {
+	ctx := context.Background()
+	recipPub, _, _ := ed25519.GenerateKey(nil)
+	refundPub, _, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("secret")
+	hash := sha3.Sum256(preimage)
+	assetAmt := bc.AssetAmount{AssetID: bc.AssetID{1}, Amount: 5}
+	expiryTime := time.Now().Add(time.Minute)
+	timeout := bc.Millis(expiryTime.Add(-30 * time.Second))
+
+	lock := &controlContractAction{
+		AssetAmount: assetAmt,
+		Contract: &Contract{
+			Type:          "htlc",
+			Pubkeys:       []json.HexBytes{json.HexBytes(recipPub)},
+			Quorum:        1,
+			Hash:          hash[:],
+			Timeout:       timeout,
+			RefundPubkeys: []json.HexBytes{json.HexBytes(refundPub)},
+			RefundQuorum:  1,
+		},
+	}
+	res, err := lock.Build(ctx, expiryTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := res.Outputs[0].ControlProgram
+	want, _ := vmutil.HTLCProgram(hash[:], []ed25519.PublicKey{recipPub}, 1, timeout, []ed25519.PublicKey{refundPub}, 1)
+	if !reflect.DeepEqual(prog, want) {
+		t.Fatalf("got program %x want %x", prog, want)
+	}
+
+	pos := uint32(0)
+	redeem := &spendContractAction{
+		TxHash:      &bc.Hash{2},
+		TxOut:       &pos,
+		AssetAmount: assetAmt,
+		Program:     prog,
+		Preimage:    preimage,
+	}
+	tpl, err := Build(ctx, nil, []Action{redeem, newControlProgramAction(assetAmt, []byte("dest"))}, expiryTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tpl.Transaction.MaxTime != timeout-1 {
+		t.Errorf("got maxtime %d want %d", tpl.Transaction.MaxTime, timeout-1)
+	}
+	comps := tpl.SigningInstructions[0].WitnessComponents
+	if len(comps) != 3 {
+		t.Fatalf("got %d witness components want 3", len(comps))
+	}
+	if !reflect.DeepEqual(comps[1], DataWitness(preimage)) || !reflect.DeepEqual(comps[2], DataWitness(vm.BoolBytes(false))) {
+		t.Errorf("got data witnesses %v, %v", comps[1], comps[2])
+	}
+
+	redeem.Preimage = []byte("guess")
+	_, err = redeem.Build(ctx, expiryTime)
+	if errors.Root(err) != ErrBadContract {
+		t.Errorf("got error %v want ErrBadContract", err)
+	}
+
+	refund := &spendContractAction{
+		TxHash:      &bc.Hash{2},
+		TxOut:       &pos,
+		AssetAmount: assetAmt,
+		Program:     prog,
+		Refund:      true,
+	}
+	res, err = refund.Build(ctx, expiryTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.MinTimeMS != timeout {
+		t.Errorf("got mintime %d want %d", res.MinTimeMS, timeout)
+	}
+}
@@ -3,6 +3,7 @@ package txbuilder
 import (
 	"bytes"
 	"context"
+	"sync"
 
 	"chain/core/rpc"
 	"chain/errors"
@@ -21,7 +22,19 @@ var (
 	ErrBadInstructionCount = errors.New("too many signing instructions in template")
 )
 
-var Generator *rpc.Client
+var (
+	generatorMu sync.Mutex
+	generator   *rpc.Client
+)
+
+// SetGenerator sets the remote generator to which finalized
+// transactions are submitted. If it is nil, transactions are added
+// to the local pool instead. It is safe to call at any time.
+func SetGenerator(c *rpc.Client) {
+	generatorMu.Lock()
+	generator = c
+	generatorMu.Unlock()
+}
 
 // FinalizeTx validates a transaction signature template,
 // assembles a fully signed tx, and stores the effects of
@@ -40,6 +53,28 @@ func FinalizeTx(ctx context.Context, c *protocol.Chain, tx *bc.Tx) error {
 	return nil
 }
 
+// FindTx looks for tx in the blocks of c after height. It reports
+// whether tx is in one of them, and if not, whether its max time
+// has passed so that it can no longer land.
+func FindTx(ctx context.Context, c *protocol.Chain, tx *bc.TxData, height uint64) (landed, expired bool, err error) {
+	txID := tx.Hash()
+	for h := height + 1; h <= c.Height(); h++ {
+		b, err := c.GetBlock(ctx, h)
+		if err != nil {
+			return false, false, errors.Wrapf(err, "getting block %d", h)
+		}
+		for _, confirmed := range b.Transactions {
+			if confirmed.Hash == txID {
+				return true, false, nil
+			}
+		}
+		if tx.MaxTime > 0 && tx.MaxTime < b.TimestampMS {
+			expired = true
+		}
+	}
+	return false, expired, nil
+}
+
 func publishTx(ctx context.Context, c *protocol.Chain, msg *bc.Tx) error {
 	err := checkTxSighashCommitment(msg)
 	if err != nil {
@@ -50,14 +85,18 @@ func publishTx(ctx context.Context, c *protocol.Chain, msg *bc.Tx) error {
 	// finalize a tx before the initial block has landed
 	<-c.WaitForBlock(1)
 
-	if Generator != nil {
+	generatorMu.Lock()
+	gen := generator
+	generatorMu.Unlock()
+
+	if gen != nil {
 		// If this transaction is valid, ValidateTxCached will store it in the cache.
 		err := c.ValidateTxCached(msg)
 		if err != nil {
 			return errors.Wrap(err, "tx rejected")
 		}
 
-		err = Generator.Call(ctx, "/rpc/submit", msg, nil)
+		err = gen.Call(ctx, "/rpc/submit", msg, nil)
 		if err != nil {
 			err = errors.Wrap(err, "generator transaction notice")
 			chainlog.Error(ctx, err)
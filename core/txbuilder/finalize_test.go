@@ -270,11 +270,11 @@ func bootdb(ctx context.Context, db *sql.DB, t testing.TB) (*testInfo, error) {
 		return nil, err
 	}
 
-	acctA, err := accounts.Create(ctx, []string{accPub.String()}, 1, "", nil, nil)
+	acctA, err := accounts.Create(ctx, []string{accPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
-	acctB, err := accounts.Create(ctx, []string{accPub.String()}, 1, "", nil, nil)
+	acctB, err := accounts.Create(ctx, []string{accPub.String()}, 1, "", nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -361,3 +361,39 @@ func cancel(ctx context.Context, db pg.DB, outpoints []bc.Outpoint) error {
 	_, err := db.Exec(ctx, query, pq.StringArray(txHashes), pg.Uint32s(indexes))
 	return err
 }
+
+func TestFindTx(t *testing.T) {
+	ctx := context.Background()
+	c := prottest.NewChain(t)
+
+	now := time.Now()
+	in := bc.NewIssuanceInput([]byte{1}, 1, nil, c.InitialBlockHash, []byte{0x51}, nil)
+	tx := bc.NewTx(bc.TxData{
+		Version: 1,
+		Inputs:  []*bc.TxInput{in},
+		Outputs: []*bc.TxOutput{bc.NewTxOutput(in.AssetID(), 1, []byte{0x51}, nil)},
+		MinTime: bc.Millis(now.Add(-time.Minute)),
+		MaxTime: bc.Millis(now.Add(time.Minute)),
+	})
+	err := c.AddTx(ctx, tx)
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	height := c.Height()
+	prottest.MakeBlock(t, c)
+
+	landed, expired, err := FindTx(ctx, c, &tx.TxData, height)
+	if err != nil || !landed || expired {
+		t.Errorf("FindTx(landed tx) = %t, %t, %v want true, false, nil", landed, expired, err)
+	}
+	landed, expired, err = FindTx(ctx, c, &tx.TxData, c.Height())
+	if err != nil || landed || expired {
+		t.Errorf("FindTx(after its block) = %t, %t, %v want false, false, nil", landed, expired, err)
+	}
+
+	stale := &bc.TxData{Version: 1, MaxTime: bc.Millis(now.Add(-time.Minute))}
+	landed, expired, err = FindTx(ctx, c, stale, height)
+	if err != nil || landed || !expired {
+		t.Errorf("FindTx(expired tx) = %t, %t, %v want false, true, nil", landed, expired, err)
+	}
+}
@@ -62,6 +62,7 @@ func Build(ctx context.Context, tx *bc.TxData, actions []Action, maxTime time.Ti
 		tplSigInsts []*SigningInstruction
 		errs        []error
 		rollbacks   []func()
+		checks      []func(context.Context, *bc.TxData) error
 	)
 result:
 	for i, v := range results {
@@ -124,9 +125,18 @@ result:
 			}
 		}
 
+		if buildResult.MaxTimeMS > 0 {
+			if tx.MaxTime == 0 || buildResult.MaxTimeMS < tx.MaxTime {
+				tx.MaxTime = buildResult.MaxTimeMS
+			}
+		}
+
 		if buildResult.Rollback != nil {
 			rollbacks = append(rollbacks, buildResult.Rollback)
 		}
+		if buildResult.Check != nil {
+			checks = append(checks, buildResult.Check)
+		}
 	}
 
 	if len(errs) > 0 {
@@ -140,6 +150,14 @@ result:
 		return nil, err
 	}
 
+	for _, check := range checks {
+		err = check(ctx, tx)
+		if err != nil {
+			rollback(rollbacks)
+			return nil, err
+		}
+	}
+
 	if tx.MaxTime == 0 || tx.MaxTime > bc.Millis(maxTime) {
 		tx.MaxTime = bc.Millis(maxTime)
 	}
@@ -148,6 +166,7 @@ result:
 		Transaction:         tx,
 		SigningInstructions: tplSigInsts,
 		Local:               local,
+		Rollback:            func() { rollback(rollbacks) },
 	}
 	return tpl, nil
 }
@@ -102,6 +102,60 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+type checkedAction struct {
+	testAction
+	check      func(context.Context, *bc.TxData) error
+	rolledBack bool
+}
+
+func (a *checkedAction) Build(ctx context.Context, maxTime time.Time) (*BuildResult, error) {
+	res, err := a.testAction.Build(ctx, maxTime)
+	if err != nil {
+		return nil, err
+	}
+	res.Check = a.check
+	res.Rollback = func() { a.rolledBack = true }
+	return res, nil
+}
+
+func TestBuildCheck(t *testing.T) {
+	ctx := context.Background()
+	errRejected := errors.New("rejected")
+
+	var nOutputs int
+	a := &checkedAction{
+		testAction: testAction(bc.AssetAmount{AssetID: [32]byte{1}, Amount: 5}),
+		check: func(_ context.Context, tx *bc.TxData) error {
+			nOutputs = len(tx.Outputs)
+			return nil
+		},
+	}
+	actions := []Action{
+		a,
+		newControlProgramAction(bc.AssetAmount{AssetID: [32]byte{2}, Amount: 6}, []byte("dest")),
+	}
+	_, err := Build(ctx, nil, actions, time.Now().Add(time.Minute))
+	if err != nil {
+		testutil.FatalErr(t, err)
+	}
+	// The check sees outputs from every action.
+	if nOutputs != 2 {
+		t.Errorf("check saw %d outputs, want 2", nOutputs)
+	}
+	if a.rolledBack {
+		t.Error("successful build was rolled back")
+	}
+
+	a.check = func(context.Context, *bc.TxData) error { return errRejected }
+	_, err = Build(ctx, nil, actions, time.Now().Add(time.Minute))
+	if errors.Root(err) != errRejected {
+		t.Errorf("got error %v, want %v", err, errRejected)
+	}
+	if !a.rolledBack {
+		t.Error("rejected build was not rolled back")
+	}
+}
+
 func TestMaterializeWitnesses(t *testing.T) {
 	var initialBlockHash bc.Hash
 	privkey, pubkey, err := chainkd.NewXKeys(nil)
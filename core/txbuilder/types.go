@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"time"
 
+	chainjson "chain/encoding/json"
 	"chain/errors"
 	"chain/protocol/bc"
 )
@@ -27,6 +28,12 @@ type Template struct {
 	// as a whole, and any change to the tx invalidates the signature.
 	AllowAdditional bool `json:"allow_additional_actions"`
 
+	// Rollback, set by Build, attempts to undo the side effects of
+	// building the template, such as reserving its inputs. Like
+	// BuildResult.Rollback, it is a best-effort operation. It is
+	// not part of the template's JSON.
+	Rollback func() `json:"-"`
+
 	sigHasher *bc.SigHasher
 }
 
@@ -51,6 +58,7 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 		WitnessComponents []struct {
 			Type string
 			SignatureWitness
+			Value chainjson.HexBytes `json:"value"`
 		} `json:"witness_components"`
 	}
 	err := json.Unmarshal(b, &pre)
@@ -62,10 +70,14 @@ func (si *SigningInstruction) UnmarshalJSON(b []byte) error {
 	si.Position = pre.Position
 	si.WitnessComponents = make([]WitnessComponent, 0, len(pre.WitnessComponents))
 	for i, w := range pre.WitnessComponents {
-		if w.Type != "signature" {
+		switch w.Type {
+		case "signature":
+			si.WitnessComponents = append(si.WitnessComponents, &w.SignatureWitness)
+		case "data":
+			si.WitnessComponents = append(si.WitnessComponents, DataWitness(w.Value))
+		default:
 			return errors.WithDetailf(ErrBadWitnessComponent, "witness component %d has unknown type '%s'", i, w.Type)
 		}
-		si.WitnessComponents = append(si.WitnessComponents, &w.SignatureWitness)
 	}
 	return nil
 }
@@ -78,6 +90,11 @@ type (
 		MinTimeMS           uint64
 		ReferenceData       []byte
 
+		// If non-zero, MaxTimeMS is the latest time at which the
+		// transaction may be valid. The earliest MaxTimeMS among all
+		// actions wins.
+		MaxTimeMS uint64
+
 		// If set, Rollback attempts to undo any side effects
 		// of building the action. For example, it might cancel
 		// any reservations that were made on UTXOs in a spend
@@ -85,6 +102,12 @@ type (
 		// guaranteed to succeed. Each action's side effects,
 		// if any, must be designed with this in mind.
 		Rollback func()
+
+		// If set, Check is called with the complete transaction
+		// once every action has been built. It may reject the
+		// transaction, for example because of where the action's
+		// inputs are being sent.
+		Check func(context.Context, *bc.TxData) error
 	}
 
 	Action interface {
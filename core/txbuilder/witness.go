@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 
+	"chain/crypto/ed25519/chainkd"
 	"chain/crypto/sha3pool"
 	chainjson "chain/encoding/json"
 	"chain/errors"
@@ -150,6 +151,27 @@ func contains(list []string, key string) bool {
 	return false
 }
 
+// VerifySig reports whether sig is a signature of h by the key
+// identified by k.
+func VerifySig(k KeyID, h [32]byte, sig []byte) bool {
+	var xpub chainkd.XPub
+	err := xpub.UnmarshalText([]byte(k.XPub))
+	if err != nil {
+		return false
+	}
+	var path [][]byte
+	for _, p := range k.DerivationPath {
+		path = append(path, p)
+	}
+	return xpub.Derive(path).Verify(h[:], sig)
+}
+
+// SigProgram returns the predicate that Sign infers for a signature
+// witness of the input at the given position of tpl's transaction.
+func SigProgram(tpl *Template, position int) []byte {
+	return buildSigProgram(tpl, position)
+}
+
 func buildSigProgram(tpl *Template, index int) []byte {
 	if !tpl.AllowAdditional {
 		h := tpl.Hash(index)
@@ -234,6 +256,31 @@ func (sw SignatureWitness) MarshalJSON() ([]byte, error) {
 	return json.Marshal(obj)
 }
 
+// DataWitness is a witness component that contributes a single,
+// fixed argument to the input witness, such as a hash preimage or a
+// contract branch selector.
+type DataWitness chainjson.HexBytes
+
+func (DataWitness) Sign(context.Context, *Template, int, []string, SignFunc) error {
+	return nil
+}
+
+func (d DataWitness) Materialize(tpl *Template, index int, args *[][]byte) error {
+	*args = append(*args, d)
+	return nil
+}
+
+func (d DataWitness) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		Type  string             `json:"type"`
+		Value chainjson.HexBytes `json:"value"`
+	}{
+		Type:  "data",
+		Value: chainjson.HexBytes(d),
+	}
+	return json.Marshal(obj)
+}
+
 func (si *SigningInstruction) AddWitnessKeys(keys []KeyID, quorum int) {
 	sw := &SignatureWitness{
 		Quorum: quorum,
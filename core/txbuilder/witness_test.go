@@ -53,6 +53,7 @@ func TestWitnessJSON(t *testing.T) {
 				}},
 				Sigs: []chainjson.HexBytes{{8, 9, 10}},
 			},
+			DataWitness{11, 12},
 		},
 	}
 
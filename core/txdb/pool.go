@@ -46,3 +46,11 @@ func (p *Pool) Dump(ctx context.Context) ([]*bc.Tx, error) {
 	txs = topSort(ctx, txs)
 	return txs, nil
 }
+
+// Count returns the number of transactions in the pool.
+func (p *Pool) Count(ctx context.Context) (int, error) {
+	const q = `SELECT COUNT(*) FROM pool_txs`
+	var n int
+	err := p.db.QueryRow(ctx, q).Scan(&n)
+	return n, errors.Wrap(err, "counting pool txs")
+}
@@ -42,11 +42,8 @@ function preprocessTransaction(formParams) {
       }
     })
 
-    // HACK: Check for retire actions and replace with OP_FAIL control programs.
-    // TODO: update JS SDK to support Java SDK builder style.
     if (a.type == 'retire_asset') {
-      a.type = 'control_program'
-      a.control_program = '6a' // OP_FAIL hex byte
+      a.type = 'retire'
     }
 
     try {
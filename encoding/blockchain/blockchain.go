@@ -55,6 +55,13 @@ func ReadVarstr31(r io.Reader) ([]byte, int, error) {
 	if len == 0 {
 		return nil, n, nil
 	}
+	// Don't trust the length prefix to size the buffer if we can
+	// tell the input is shorter.
+	if lr, ok := r.(interface {
+		Len() int
+	}); ok && int(len) > lr.Len() {
+		return nil, n, io.ErrUnexpectedEOF
+	}
 	buf := make([]byte, len)
 	n2, err := io.ReadFull(r, buf)
 	return buf, n + n2, err
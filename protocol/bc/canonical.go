@@ -0,0 +1,76 @@
+package bc
+
+import (
+	"bytes"
+
+	"chain/errors"
+)
+
+// ErrNonCanonical is returned by the canonical decoders when their
+// input is not the unique serialization of the value it decodes to:
+// for instance, when it contains non-minimal varints or trailing
+// bytes.
+var ErrNonCanonical = errors.New("non-canonical encoding")
+
+// UnmarshalCanonical decodes tx from b, like Scan, but additionally
+// requires b to be exactly the canonical serialization of the result.
+// Any other encoding would decode to the same transaction while
+// hashing differently as raw bytes, so input received from the
+// network should be decoded with this function.
+func (tx *TxData) UnmarshalCanonical(b []byte) error {
+	r := bytes.NewReader(b)
+	err := tx.readFrom(r)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	tx.writeTo(buf, serRequired)
+	return checkCanonical(b, r, buf)
+}
+
+// UnmarshalCanonical decodes bh from b, requiring b to be exactly
+// the canonical serialization of the result. It accepts any of the
+// block header serialization flags; a serialization that includes
+// transactions must be decoded with (*Block).UnmarshalCanonical.
+func (bh *BlockHeader) UnmarshalCanonical(b []byte) error {
+	r := bytes.NewReader(b)
+	serflags, err := bh.readFrom(r)
+	if err != nil {
+		return err
+	}
+	if serflags&SerBlockTransactions == SerBlockTransactions {
+		return errors.WithDetail(ErrNonCanonical, "block header includes transactions")
+	}
+	buf := new(bytes.Buffer)
+	err = bh.writeTo(buf, serflags)
+	if err != nil {
+		return err
+	}
+	return checkCanonical(b, r, buf)
+}
+
+// UnmarshalCanonical decodes block from b, requiring b to be exactly
+// the canonical serialization of the result.
+func (b *Block) UnmarshalCanonical(data []byte) error {
+	r := bytes.NewReader(data)
+	err := b.readFrom(r)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 || data[0] != SerBlockFull {
+		return errors.WithDetail(ErrNonCanonical, "block serialization must include transactions and witness")
+	}
+	buf := new(bytes.Buffer)
+	b.writeTo(buf, SerBlockFull)
+	return checkCanonical(data, r, buf)
+}
+
+func checkCanonical(input []byte, r *bytes.Reader, reencoded *bytes.Buffer) error {
+	if r.Len() > 0 {
+		return errors.WithDetailf(ErrNonCanonical, "%d trailing bytes", r.Len())
+	}
+	if !bytes.Equal(input, reencoded.Bytes()) {
+		return errors.WithDetail(ErrNonCanonical, "input differs from its canonical serialization")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package bc
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"chain/errors"
+)
+
+func TestUnmarshalCanonicalTx(t *testing.T) {
+	cases := []struct {
+		hex  string
+		want error
+	}{
+		// empty transaction
+		{hex: "070102000000000000"},
+		// trailing byte
+		{hex: "07010200000000000000", want: ErrNonCanonical},
+		// non-minimal varint for the transaction version
+		{hex: "07810002000000000000", want: ErrNonCanonical},
+		// non-minimal varint for the inputs count
+		{hex: "07010200000080000000", want: ErrNonCanonical},
+	}
+	for i, c := range cases {
+		b, err := hex.DecodeString(c.hex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tx TxData
+		err = tx.UnmarshalCanonical(b)
+		if errors.Root(err) != c.want {
+			t.Errorf("case %d: UnmarshalCanonical(%s) error = %v want %v", i, c.hex, err, c.want)
+		}
+
+		// Lenient decoding accepts all of them.
+		err = tx.Scan(b)
+		if err != nil {
+			t.Errorf("case %d: Scan(%s) error = %v", i, c.hex, err)
+		}
+	}
+
+	// unknown serflags
+	var tx TxData
+	err := tx.UnmarshalCanonical([]byte{0x03, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+	if err == nil {
+		t.Error("UnmarshalCanonical with serflags 0x03 = success want error")
+	}
+}
+
+func TestUnmarshalCanonicalBlock(t *testing.T) {
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:     1,
+			Height:      1,
+			TimestampMS: 1000,
+			Witness:     [][]byte{{1, 2}},
+		},
+		Transactions: []*Tx{NewTx(TxData{Version: 1})},
+	}
+	var buf bytes.Buffer
+	_, err := block.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canonical := buf.Bytes()
+
+	var got Block
+	err = got.UnmarshalCanonical(canonical)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash() != block.Hash() {
+		t.Errorf("got block hash %x want %x", got.Hash(), block.Hash())
+	}
+
+	err = new(Block).UnmarshalCanonical(append(canonical, 0))
+	if errors.Root(err) != ErrNonCanonical {
+		t.Errorf("UnmarshalCanonical(trailing byte) error = %v want ErrNonCanonical", err)
+	}
+
+	buf.Reset()
+	block.BlockHeader.WriteTo(&buf)
+	var bh BlockHeader
+	err = bh.UnmarshalCanonical(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bh.UnmarshalCanonical(canonical)
+	if errors.Root(err) != ErrNonCanonical {
+		t.Errorf("BlockHeader.UnmarshalCanonical(full block) error = %v want ErrNonCanonical", err)
+	}
+}
+
+func FuzzTxData(f *testing.F) {
+	f.Add(mustDecodeHex("070102000000000000"))
+	f.Add(mustDecodeHex("07810002000000000000"))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var lenient TxData
+		lenientErr := lenient.Scan(b)
+
+		var tx TxData
+		err := tx.UnmarshalCanonical(b)
+		if err != nil {
+			return
+		}
+		if lenientErr != nil {
+			t.Fatalf("canonical decoding accepted %x, lenient decoding rejected it: %v", b, lenientErr)
+		}
+		var buf bytes.Buffer
+		tx.WriteTo(&buf)
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Fatalf("canonical decoding accepted %x, which re-encodes as %x", b, buf.Bytes())
+		}
+		if tx.Hash() != lenient.Hash() {
+			t.Fatalf("hash mismatch for %x", b)
+		}
+	})
+}
+
+func FuzzBlockHeader(f *testing.F) {
+	var buf bytes.Buffer
+	bh := BlockHeader{Version: 1, Height: 2, TimestampMS: 3, ConsensusProgram: []byte{4}, Witness: [][]byte{{5}}}
+	bh.WriteTo(&buf)
+	f.Add(buf.Bytes())
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var bh BlockHeader
+		err := bh.UnmarshalCanonical(b)
+		if err != nil {
+			return
+		}
+		var buf bytes.Buffer
+		bh.writeTo(&buf, b[0])
+		if !bytes.Equal(buf.Bytes(), b) {
+			t.Fatalf("canonical decoding accepted %x, which re-encodes as %x", b, buf.Bytes())
+		}
+	})
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -102,7 +102,9 @@ type Pool interface {
 // objects can be safely stored.
 type Chain struct {
 	InitialBlockHash  bc.Hash
-	MaxIssuanceWindow time.Duration // only used by generators
+	MaxIssuanceWindow time.Duration // only used by generators; see SetMaxIssuanceWindow
+
+	issuanceWindowMu sync.Mutex // protects MaxIssuanceWindow once the chain is in use
 
 	state struct {
 		cond     sync.Cond // protects height, block, snapshot
@@ -3,6 +3,7 @@ package protocol
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/golang/groupcache/lru"
 
@@ -79,12 +80,23 @@ func (c *prevalidatedTxsCache) cache(txID bc.Hash, err error) {
 	c.mu.Unlock()
 }
 
+// SetMaxIssuanceWindow changes c.MaxIssuanceWindow. It is safe to
+// call while c is in use.
+func (c *Chain) SetMaxIssuanceWindow(d time.Duration) {
+	c.issuanceWindowMu.Lock()
+	c.MaxIssuanceWindow = d
+	c.issuanceWindowMu.Unlock()
+}
+
 func (c *Chain) checkIssuanceWindow(tx *bc.Tx) error {
+	c.issuanceWindowMu.Lock()
+	window := c.MaxIssuanceWindow
+	c.issuanceWindowMu.Unlock()
 	for _, txi := range tx.Inputs {
 		if _, ok := txi.TypedInput.(*bc.IssuanceInput); ok {
 			// TODO(tessr): consider removing 0 check once we can configure this
-			if c.MaxIssuanceWindow != 0 && tx.MinTime+bc.DurationMillis(c.MaxIssuanceWindow) < tx.MaxTime {
-				return errors.WithDetailf(validation.ErrBadTx, "issuance input's time window is larger than the network maximum (%s)", c.MaxIssuanceWindow)
+			if window != 0 && tx.MinTime+bc.DurationMillis(window) < tx.MaxTime {
+				return errors.WithDetailf(validation.ErrBadTx, "issuance input's time window is larger than the network maximum (%s)", window)
 			}
 		}
 	}
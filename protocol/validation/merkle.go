@@ -5,6 +5,7 @@ import (
 
 	"golang.org/x/crypto/sha3"
 
+	"chain/errors"
 	"chain/protocol/bc"
 )
 
@@ -32,6 +33,59 @@ func CalcMerkleRoot(transactions []*bc.Tx) bc.Hash {
 	}
 }
 
+// ErrBadMerklePath is returned by MerkleRootFromPath when a
+// merkle path has the wrong length for its tree.
+var ErrBadMerklePath = errors.New("invalid merkle path")
+
+// CalcMerklePath returns the merkle path of transactions[i]: the
+// sibling hashes needed to recompute the merkle root of transactions
+// from the witness hash of that one transaction, ordered from the
+// leaf up to the root.
+func CalcMerklePath(transactions []*bc.Tx, i int) []bc.Hash {
+	if len(transactions) <= 1 {
+		return nil
+	}
+	k := prevPowerOfTwo(len(transactions))
+	if i < k {
+		return append(CalcMerklePath(transactions[:k], i), CalcMerkleRoot(transactions[k:]))
+	}
+	return append(CalcMerklePath(transactions[k:], i-k), CalcMerkleRoot(transactions[:k]))
+}
+
+// MerkleRootFromPath returns the merkle root of a block of n
+// transactions whose transaction at position i has witness hash
+// witHash and merkle path path, as returned by CalcMerklePath.
+// A transaction is in a block if the result equals the block's
+// TransactionsMerkleRoot.
+func MerkleRootFromPath(witHash bc.Hash, i, n int, path []bc.Hash) (bc.Hash, error) {
+	if i < 0 || i >= n {
+		return bc.Hash{}, ErrBadMerklePath
+	}
+	if n == 1 {
+		if len(path) != 0 {
+			return bc.Hash{}, ErrBadMerklePath
+		}
+		return sha3.Sum256(append(leafPrefix, witHash[:]...)), nil
+	}
+	if len(path) == 0 {
+		return bc.Hash{}, ErrBadMerklePath
+	}
+	k := prevPowerOfTwo(n)
+	sibling, path := path[len(path)-1], path[:len(path)-1]
+	if i < k {
+		left, err := MerkleRootFromPath(witHash, i, k, path)
+		if err != nil {
+			return bc.Hash{}, err
+		}
+		return sha3.Sum256(append(append(interiorPrefix, left[:]...), sibling[:]...)), nil
+	}
+	right, err := MerkleRootFromPath(witHash, i-k, n-k, path)
+	if err != nil {
+		return bc.Hash{}, err
+	}
+	return sha3.Sum256(append(append(interiorPrefix, sibling[:]...), right[:]...)), nil
+}
+
 // prevPowerOfTwo returns the largest power of two that is smaller than a given number.
 // In other words, for some input n, the prevPowerOfTwo k is a power of two such that
 // k < n <= 2k. This is a helper function used during the calculation of a merkle tree.
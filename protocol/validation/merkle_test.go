@@ -126,6 +126,42 @@ func TestAllDuplicateLeaves(t *testing.T) {
 	}
 }
 
+func TestMerklePath(t *testing.T) {
+	var initialBlockHash bc.Hash
+	trueProg := []byte{byte(vm.OP_TRUE)}
+	for n := 1; n <= 9; n++ {
+		txs := make([]*bc.Tx, n)
+		for i := range txs {
+			txs[i] = bc.NewTx(bc.TxData{
+				Version: 1,
+				Inputs:  []*bc.TxInput{bc.NewIssuanceInput(vm.Int64Bytes(int64(i)), 1, nil, initialBlockHash, trueProg, nil)},
+			})
+		}
+		root := CalcMerkleRoot(txs)
+		for i, tx := range txs {
+			path := CalcMerklePath(txs, i)
+			got, err := MerkleRootFromPath(tx.WitnessHash(), i, n, path)
+			if err != nil {
+				t.Fatalf("n=%d i=%d: %v", n, i, err)
+			}
+			if got != root {
+				t.Errorf("n=%d i=%d: got root %x want %x", n, i, got[:], root[:])
+			}
+			if n > 1 {
+				// A path must not prove the transaction at another position.
+				got, _ = MerkleRootFromPath(tx.WitnessHash(), (i+1)%n, n, path)
+				if got == root {
+					t.Errorf("n=%d i=%d: path also proves position %d", n, i, (i+1)%n)
+				}
+			}
+		}
+		_, err := MerkleRootFromPath(txs[0].WitnessHash(), 0, n, append(CalcMerklePath(txs, 0), bc.Hash{}))
+		if err != ErrBadMerklePath {
+			t.Errorf("n=%d: long path: got error %v want %v", n, err, ErrBadMerklePath)
+		}
+	}
+}
+
 func mustParseHash(s string) bc.Hash {
 	h, err := bc.ParseHash(s)
 	if err != nil {
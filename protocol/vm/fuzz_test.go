@@ -0,0 +1,23 @@
+package vm
+
+import "testing"
+
+func FuzzParseProgram(f *testing.F) {
+	f.Add([]byte{byte(OP_TRUE)})
+	f.Add(mustDecodeHex("76aa20a1b2c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8a9b0c1d2e3f4a5b6c7d8e9f0a1b25151ad6c00c0"))
+	f.Add([]byte{byte(OP_JUMPIF), 5, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, prog []byte) {
+		insts, err := ParseProgram(prog)
+		if err != nil {
+			return
+		}
+		var n uint32
+		for _, inst := range insts {
+			n += inst.Len
+		}
+		if int(n) != len(prog) {
+			t.Fatalf("instructions of %x cover %d bytes", prog, n)
+		}
+		Disassemble(prog)
+	})
+}
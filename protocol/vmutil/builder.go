@@ -1,6 +1,10 @@
 package vmutil
 
-import "chain/protocol/vm"
+import (
+	"encoding/binary"
+
+	"chain/protocol/vm"
+)
 
 type Builder struct {
 	Program []byte
@@ -29,3 +33,13 @@ func (b *Builder) AddOp(op vm.Op) *Builder {
 	b.Program = append(b.Program, byte(op))
 	return b
 }
+
+// AddJump adds a JUMP or JUMPIF op with the given absolute target
+// address.
+func (b *Builder) AddJump(op vm.Op, addr uint32) *Builder {
+	var a [4]byte
+	binary.LittleEndian.PutUint32(a[:], addr)
+	b.Program = append(b.Program, byte(op))
+	b.Program = append(b.Program, a[:]...)
+	return b
+}
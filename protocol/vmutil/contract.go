@@ -0,0 +1,310 @@
+package vmutil
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"chain/crypto/ed25519"
+	"chain/errors"
+	"chain/protocol/vm"
+)
+
+var ErrContractFormat = errors.New("bad contract program format")
+
+// jumpLen is the encoded size of a JUMP or JUMPIF instruction:
+// the opcode plus a 4-byte little-endian target address.
+const jumpLen = 5
+
+// Branch describes one spending path of a contract program: the
+// conditions it checks before delegating to a P2SP multisig over
+// Pubkeys.
+type Branch struct {
+	// Hash, if non-nil, is the SHA3-256 digest of a preimage that
+	// must be supplied in the input witness.
+	Hash []byte
+
+	// NotBefore, if non-zero, is the earliest tx mintime (in
+	// milliseconds) for which this branch is spendable.
+	NotBefore uint64
+
+	// NotAfter, if non-zero, is the latest tx maxtime (in
+	// milliseconds) for which this branch is spendable.
+	NotAfter uint64
+
+	Pubkeys []ed25519.PublicKey
+	Quorum  int
+}
+
+// BranchProgram returns a program that checks the conditions of b
+// and then behaves like P2SPMultiSigProgram(b.Pubkeys, b.Quorum).
+// The result is: [SHA3 <hash> EQUALVERIFY] [MINTIME <notbefore>
+// GREATERTHANOREQUAL VERIFY] [MAXTIME <notafter> LESSTHANOREQUAL
+// VERIFY] <p2sp multisig>, with bracketed parts present only when
+// the corresponding field of b is set.
+func BranchProgram(b Branch) ([]byte, error) {
+	if b.Hash != nil && len(b.Hash) != 32 {
+		return nil, errors.WithDetail(ErrBadValue, "hash must be 32 bytes")
+	}
+	if b.NotBefore > 0 && b.NotAfter > 0 && b.NotAfter < b.NotBefore {
+		return nil, errors.WithDetail(ErrBadValue, "empty time window")
+	}
+	p2sp, err := P2SPMultiSigProgram(b.Pubkeys, b.Quorum)
+	if err != nil {
+		return nil, err
+	}
+	builder := NewBuilder()
+	if b.Hash != nil {
+		builder.AddOp(vm.OP_SHA3).AddData(b.Hash).AddOp(vm.OP_EQUALVERIFY)
+	}
+	if b.NotBefore > 0 {
+		builder.AddOp(vm.OP_MINTIME).AddInt64(int64(b.NotBefore)).AddOp(vm.OP_GREATERTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	}
+	if b.NotAfter > 0 {
+		builder.AddOp(vm.OP_MAXTIME).AddInt64(int64(b.NotAfter)).AddOp(vm.OP_LESSTHANOREQUAL).AddOp(vm.OP_VERIFY)
+	}
+	builder.AddRawBytes(p2sp)
+	return builder.Program, nil
+}
+
+// ParseBranchProgram is the inverse of BranchProgram. It returns
+// ErrContractFormat if prog was not produced by BranchProgram.
+func ParseBranchProgram(prog []byte) (Branch, error) {
+	var b Branch
+	pops, err := vm.ParseProgram(prog)
+	if err != nil {
+		return b, err
+	}
+	var (
+		i   int
+		off uint32
+	)
+	match := func(ops ...vm.Op) bool {
+		if len(pops)-i < len(ops) {
+			return false
+		}
+		for j, op := range ops {
+			if op == vm.OP_DATA_1 {
+				// OP_DATA_1 stands in for any push op.
+				if pops[i+j].Op > vm.OP_16 {
+					return false
+				}
+				continue
+			}
+			if pops[i+j].Op != op {
+				return false
+			}
+		}
+		return true
+	}
+	advance := func(n int) {
+		for ; n > 0; n-- {
+			off += pops[i].Len
+			i++
+		}
+	}
+	if match(vm.OP_SHA3, vm.OP_DATA_1, vm.OP_EQUALVERIFY) {
+		b.Hash = pops[i+1].Data
+		if len(b.Hash) != 32 {
+			return b, errors.WithDetail(ErrContractFormat, "bad hash length")
+		}
+		advance(3)
+	}
+	if match(vm.OP_MINTIME, vm.OP_DATA_1, vm.OP_GREATERTHANOREQUAL, vm.OP_VERIFY) {
+		b.NotBefore, err = parseTime(pops[i+1].Data)
+		if err != nil {
+			return b, err
+		}
+		advance(4)
+	}
+	if match(vm.OP_MAXTIME, vm.OP_DATA_1, vm.OP_LESSTHANOREQUAL, vm.OP_VERIFY) {
+		b.NotAfter, err = parseTime(pops[i+1].Data)
+		if err != nil {
+			return b, err
+		}
+		advance(4)
+	}
+	b.Pubkeys, b.Quorum, err = ParseP2SPMultiSigProgram(prog[off:])
+	if err != nil {
+		return b, errors.WithDetail(ErrContractFormat, err.Error())
+	}
+
+	// Make sure nothing else is hiding in the program.
+	want, err := BranchProgram(b)
+	if err != nil {
+		return b, err
+	}
+	if !bytes.Equal(want, prog) {
+		return b, errors.WithDetail(ErrContractFormat, "non-canonical branch program")
+	}
+	return b, nil
+}
+
+func parseTime(data []byte) (uint64, error) {
+	t, err := vm.AsInt64(data)
+	if err != nil {
+		return 0, err
+	}
+	if t <= 0 {
+		return 0, errors.WithDetail(ErrContractFormat, "non-positive time bound")
+	}
+	return uint64(t), nil
+}
+
+// TwoBranchProgram returns a program that runs main if the top stack
+// item is false and alt if it is true. The selector is consumed.
+// The result is: JUMPIF:alt <main> JUMP:end alt: <alt> end:
+func TwoBranchProgram(main, alt []byte) []byte {
+	altAddr := uint32(jumpLen + len(main) + jumpLen)
+	builder := NewBuilder()
+	builder.AddJump(vm.OP_JUMPIF, altAddr)
+	builder.AddRawBytes(main)
+	builder.AddJump(vm.OP_JUMP, altAddr+uint32(len(alt)))
+	builder.AddRawBytes(alt)
+	return builder.Program
+}
+
+// ParseTwoBranchProgram is the inverse of TwoBranchProgram.
+func ParseTwoBranchProgram(prog []byte) (main, alt []byte, err error) {
+	if len(prog) < 2*jumpLen || prog[0] != byte(vm.OP_JUMPIF) {
+		return nil, nil, errors.WithDetail(ErrContractFormat, "no leading JUMPIF")
+	}
+	altAddr := binary.LittleEndian.Uint32(prog[1:jumpLen])
+	if altAddr < 2*jumpLen || int(altAddr) > len(prog) {
+		return nil, nil, errors.WithDetail(ErrContractFormat, "bad branch address")
+	}
+	jump := prog[altAddr-jumpLen : altAddr]
+	if jump[0] != byte(vm.OP_JUMP) || binary.LittleEndian.Uint32(jump[1:]) != uint32(len(prog)) {
+		return nil, nil, errors.WithDetail(ErrContractFormat, "bad end jump")
+	}
+	return prog[jumpLen : altAddr-jumpLen], prog[altAddr:], nil
+}
+
+// HashLockProgram returns a program spendable by nrequired of pubkeys
+// on presentation of a preimage whose SHA3-256 hash is hash.
+func HashLockProgram(hash []byte, pubkeys []ed25519.PublicKey, nrequired int) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.WithDetail(ErrBadValue, "hash must be 32 bytes")
+	}
+	return BranchProgram(Branch{Hash: hash, Pubkeys: pubkeys, Quorum: nrequired})
+}
+
+func ParseHashLockProgram(prog []byte) (hash []byte, pubkeys []ed25519.PublicKey, nrequired int, err error) {
+	b, err := ParseBranchProgram(prog)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if b.Hash == nil || b.NotBefore != 0 || b.NotAfter != 0 {
+		return nil, nil, 0, errors.WithDetail(ErrContractFormat, "not a hash lock")
+	}
+	return b.Hash, b.Pubkeys, b.Quorum, nil
+}
+
+// TimeLockProgram returns a program spendable by nrequired of pubkeys
+// only in transactions whose time range lies within [notBefore,
+// notAfter]. A zero bound is omitted; at least one must be non-zero.
+func TimeLockProgram(notBefore, notAfter uint64, pubkeys []ed25519.PublicKey, nrequired int) ([]byte, error) {
+	if notBefore == 0 && notAfter == 0 {
+		return nil, errors.WithDetail(ErrBadValue, "no time bound")
+	}
+	return BranchProgram(Branch{NotBefore: notBefore, NotAfter: notAfter, Pubkeys: pubkeys, Quorum: nrequired})
+}
+
+func ParseTimeLockProgram(prog []byte) (notBefore, notAfter uint64, pubkeys []ed25519.PublicKey, nrequired int, err error) {
+	b, err := ParseBranchProgram(prog)
+	if err != nil {
+		return 0, 0, nil, 0, err
+	}
+	if b.Hash != nil || (b.NotBefore == 0 && b.NotAfter == 0) {
+		return 0, 0, nil, 0, errors.WithDetail(ErrContractFormat, "not a time lock")
+	}
+	return b.NotBefore, b.NotAfter, b.Pubkeys, b.Quorum, nil
+}
+
+// HTLCProgram returns a hash-time-locked contract. Before timeout
+// (milliseconds since the epoch) it is spendable by the recipient
+// keys with a preimage of hash; from timeout on it is spendable by
+// the refund keys alone.
+//
+// To redeem, push a false selector after the preimage; to refund,
+// push a true selector.
+func HTLCProgram(hash []byte, recipient []ed25519.PublicKey, recipientQuorum int, timeout uint64, refund []ed25519.PublicKey, refundQuorum int) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.WithDetail(ErrBadValue, "hash must be 32 bytes")
+	}
+	if timeout <= 1 {
+		return nil, errors.WithDetail(ErrBadValue, "bad timeout")
+	}
+	return refundProgram(Branch{Hash: hash, Pubkeys: recipient, Quorum: recipientQuorum}, timeout, refund, refundQuorum)
+}
+
+// ParseHTLCProgram returns the redeem and refund branches of an HTLC
+// program.
+func ParseHTLCProgram(prog []byte) (redeem, refund Branch, err error) {
+	redeem, refund, err = parseRefundProgram(prog)
+	if err != nil {
+		return redeem, refund, err
+	}
+	if redeem.Hash == nil {
+		return redeem, refund, errors.WithDetail(ErrContractFormat, "no hash lock")
+	}
+	return redeem, refund, nil
+}
+
+// MultiSigRefundProgram returns a program spendable by nrequired of
+// pubkeys before timeout (milliseconds since the epoch), and by
+// refundNRequired of refundPubkeys from timeout on.
+// Spend it like an HTLC, without the preimage.
+func MultiSigRefundProgram(pubkeys []ed25519.PublicKey, nrequired int, timeout uint64, refundPubkeys []ed25519.PublicKey, refundNRequired int) ([]byte, error) {
+	if timeout <= 1 {
+		return nil, errors.WithDetail(ErrBadValue, "bad timeout")
+	}
+	return refundProgram(Branch{Pubkeys: pubkeys, Quorum: nrequired}, timeout, refundPubkeys, refundNRequired)
+}
+
+// ParseMultiSigRefundProgram returns the main and refund branches of
+// a multisig-with-refund program.
+func ParseMultiSigRefundProgram(prog []byte) (main, refund Branch, err error) {
+	main, refund, err = parseRefundProgram(prog)
+	if err != nil {
+		return main, refund, err
+	}
+	if main.Hash != nil {
+		return main, refund, errors.WithDetail(ErrContractFormat, "unexpected hash lock")
+	}
+	return main, refund, nil
+}
+
+// refundProgram builds a two-branch program in which main is
+// spendable strictly before timeout and the refund keys are
+// able to spend from timeout on. The two windows never overlap.
+func refundProgram(main Branch, timeout uint64, refund []ed25519.PublicKey, refundQuorum int) ([]byte, error) {
+	main.NotAfter = timeout - 1
+	mainProg, err := BranchProgram(main)
+	if err != nil {
+		return nil, err
+	}
+	altProg, err := BranchProgram(Branch{NotBefore: timeout, Pubkeys: refund, Quorum: refundQuorum})
+	if err != nil {
+		return nil, err
+	}
+	return TwoBranchProgram(mainProg, altProg), nil
+}
+
+func parseRefundProgram(prog []byte) (main, refund Branch, err error) {
+	mainProg, altProg, err := ParseTwoBranchProgram(prog)
+	if err != nil {
+		return main, refund, err
+	}
+	main, err = ParseBranchProgram(mainProg)
+	if err != nil {
+		return main, refund, err
+	}
+	refund, err = ParseBranchProgram(altProg)
+	if err != nil {
+		return main, refund, err
+	}
+	if refund.Hash != nil || refund.NotAfter != 0 || refund.NotBefore == 0 || main.NotAfter != refund.NotBefore-1 || main.NotBefore != 0 {
+		return main, refund, errors.WithDetail(ErrContractFormat, "bad refund timeout")
+	}
+	return main, refund, nil
+}
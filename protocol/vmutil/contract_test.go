@@ -0,0 +1,154 @@
+package vmutil
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+
+	"chain/crypto/ed25519"
+	"chain/protocol/bc"
+	"chain/protocol/vm"
+)
+
+func TestContractRoundTrip(t *testing.T) {
+	pub1, _, _ := ed25519.GenerateKey(nil)
+	pub2, _, _ := ed25519.GenerateKey(nil)
+	hash := sha3.Sum256([]byte("secret"))
+
+	prog, err := HashLockProgram(hash[:], []ed25519.PublicKey{pub1}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotHash, pubs, n, err := ParseHashLockProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotHash, hash[:]) || !reflect.DeepEqual(pubs, []ed25519.PublicKey{pub1}) || n != 1 {
+		t.Errorf("ParseHashLockProgram(%x) = (%x, %v, %d)", prog, gotHash, pubs, n)
+	}
+
+	prog, err = TimeLockProgram(100, 200, []ed25519.PublicKey{pub1, pub2}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notBefore, notAfter, _, n, err := ParseTimeLockProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notBefore != 100 || notAfter != 200 || n != 2 {
+		t.Errorf("ParseTimeLockProgram(%x) = (%d, %d, %d)", prog, notBefore, notAfter, n)
+	}
+
+	prog, err = HTLCProgram(hash[:], []ed25519.PublicKey{pub1}, 1, 1000, []ed25519.PublicKey{pub2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redeem, refund, err := ParseHTLCProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRedeem := Branch{Hash: hash[:], NotAfter: 999, Pubkeys: []ed25519.PublicKey{pub1}, Quorum: 1}
+	wantRefund := Branch{NotBefore: 1000, Pubkeys: []ed25519.PublicKey{pub2}, Quorum: 1}
+	if !reflect.DeepEqual(redeem, wantRedeem) || !reflect.DeepEqual(refund, wantRefund) {
+		t.Errorf("ParseHTLCProgram(%x) = (%+v, %+v) want (%+v, %+v)", prog, redeem, refund, wantRedeem, wantRefund)
+	}
+	_, _, err = ParseMultiSigRefundProgram(prog)
+	if err == nil {
+		t.Error("ParseMultiSigRefundProgram(htlc) = success want error")
+	}
+
+	prog, err = MultiSigRefundProgram([]ed25519.PublicKey{pub1, pub2}, 2, 1000, []ed25519.PublicKey{pub2}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, refund, err := ParseMultiSigRefundProgram(prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if main.Quorum != 2 || main.NotAfter != 999 || refund.NotBefore != 1000 {
+		t.Errorf("ParseMultiSigRefundProgram(%x) = (%+v, %+v)", prog, main, refund)
+	}
+
+	// Appending anything to a branch makes it unparseable.
+	_, err = ParseBranchProgram(append(mustBranchProgram(t, wantRedeem), byte(vm.OP_DROP)))
+	if err == nil {
+		t.Error("ParseBranchProgram(trailing op) = success want error")
+	}
+}
+
+func mustBranchProgram(t *testing.T, b Branch) []byte {
+	prog, err := BranchProgram(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestHTLCSpend(t *testing.T) {
+	recipPub, recipPriv, _ := ed25519.GenerateKey(nil)
+	refundPub, refundPriv, _ := ed25519.GenerateKey(nil)
+	preimage := []byte("secret")
+	hash := sha3.Sum256(preimage)
+	const timeout = 1000
+
+	prog, err := HTLCProgram(hash[:], []ed25519.PublicKey{recipPub}, 1, timeout, []ed25519.PublicKey{refundPub}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The predicate is trivially true; these tests exercise the
+	// contract, not the signature program.
+	pred := []byte{byte(vm.OP_TRUE)}
+	predHash := sha3.Sum256(pred)
+	recipSig := ed25519.Sign(recipPriv, predHash[:])
+	refundSig := ed25519.Sign(refundPriv, predHash[:])
+
+	cases := []struct {
+		desc             string
+		args             [][]byte
+		minTime, maxTime uint64
+		ok               bool
+	}{{
+		desc:    "redeem",
+		args:    [][]byte{{0}, recipSig, pred, preimage, vm.BoolBytes(false)},
+		maxTime: timeout - 1,
+		ok:      true,
+	}, {
+		desc:    "redeem wrong preimage",
+		args:    [][]byte{{0}, recipSig, pred, []byte("guess"), vm.BoolBytes(false)},
+		maxTime: timeout - 1,
+	}, {
+		desc:    "redeem too late",
+		args:    [][]byte{{0}, recipSig, pred, preimage, vm.BoolBytes(false)},
+		maxTime: timeout,
+	}, {
+		desc:    "redeem with refund key",
+		args:    [][]byte{{0}, refundSig, pred, preimage, vm.BoolBytes(false)},
+		maxTime: timeout - 1,
+	}, {
+		desc:    "refund",
+		args:    [][]byte{{0}, refundSig, pred, vm.BoolBytes(true)},
+		minTime: timeout,
+		ok:      true,
+	}, {
+		desc:    "refund too early",
+		args:    [][]byte{{0}, refundSig, pred, vm.BoolBytes(true)},
+		minTime: timeout - 1,
+	}}
+	for _, c := range cases {
+		tx := bc.NewTx(bc.TxData{
+			Version: 1,
+			MinTime: c.minTime,
+			MaxTime: c.maxTime,
+			Inputs: []*bc.TxInput{
+				bc.NewSpendInput(bc.Hash{}, 0, c.args, bc.AssetID{}, 1, prog, nil),
+			},
+		})
+		ok, err := vm.VerifyTxInput(tx, 0)
+		if ok != c.ok {
+			t.Errorf("%s: VerifyTxInput = (%v, %v) want ok=%v", c.desc, ok, err, c.ok)
+		}
+	}
+}
@@ -15,6 +15,12 @@ func IsUnspendable(prog []byte) bool {
 	return len(prog) > 0 && prog[0] == byte(vm.OP_FAIL)
 }
 
+// RetireProgram returns the canonical control program for
+// retiring asset units: a lone FAIL instruction.
+func RetireProgram() []byte {
+	return []byte{byte(vm.OP_FAIL)}
+}
+
 // BlockMultiSigProgram returns a valid multisignature consensus
 // program where nrequired of the keys in pubkeys are required to have
 // signed the block for success.  An ErrBadValue will be returned if
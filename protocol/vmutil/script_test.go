@@ -27,6 +27,11 @@ func TestIsUnspendable(t *testing.T) {
 				0xfa, 0x0b, 0x5c, 0x88, 0xac},
 			expected: false,
 		},
+		{
+			// Canonical retirement program
+			pkScript: RetireProgram(),
+			expected: true,
+		},
 	}
 
 	for i, test := range tests {
@@ -915,11 +915,10 @@ public class Transaction {
      */
     public static class Retire extends Action {
       /**
-       * Default constructor defines the action type as "control_program"
+       * Default constructor defines the action type as "retire"
        */
       public Retire() {
-        this.put("type", "control_program");
-        this.put("control_program", ControlProgram.retireProgram());
+        this.put("type", "retire");
       }
 
       /**